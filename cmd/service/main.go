@@ -1,11 +1,18 @@
 package main
 
 import (
+	"os"
+
 	_ "github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
 
 	"service-rss/internal/config"
 	"service-rss/internal/database"
+	"service-rss/internal/digest"
+	"service-rss/internal/feedcache"
+	"service-rss/internal/newsletter"
+	"service-rss/internal/reads"
+	"service-rss/internal/retention"
 	"service-rss/internal/rss"
 	"service-rss/internal/server"
 	"service-rss/internal/signal"
@@ -17,27 +24,129 @@ func main() {
 		log.WithError(err).Fatal("failed to read config")
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = migrate(cfg, os.Args[2:])
+		if err != nil {
+			log.WithError(err).Fatal("failed to migrate db")
+		}
+		return
+	}
+
+	if cfg.DbMigrateOnStart {
+		err = migrate(cfg, []string{"up"})
+		if err != nil {
+			log.WithError(err).Fatal("failed to migrate db")
+		}
+	}
+
 	db, err := database.New(cfg)
 	if err != nil {
 		log.WithError(err).Fatal("failed to establish db connection")
 	}
 	defer db.Shutdown()
 
-	fetcher, err := rss.NewFetcher()
+	fetcher, err := rss.NewFetcher(cfg)
 	if err != nil {
 		log.WithError(err).Fatal("failed to init fetcher")
 	}
 
-	aggregator, err := rss.NewAggregator(fetcher)
+	var subscriber rss.Subscriber
+	if cfg.WebSubEnabled {
+		subscriber, err = rss.NewSubscriber(cfg, db)
+		if err != nil {
+			log.WithError(err).Fatal("failed to init websub subscriber")
+		}
+		go subscriber.Start()
+		defer subscriber.Shutdown()
+	}
+
+	aggregator, err := rss.NewAggregator(cfg, db, fetcher, subscriber)
 	if err != nil {
 		log.WithError(err).Fatal("failed to init aggregator")
 	}
 
-	cacher := rss.NewCacher(cfg, db, aggregator)
+	discoverer, err := rss.NewDiscoverer(cfg)
+	if err != nil {
+		log.WithError(err).Fatal("failed to init discoverer")
+	}
+
+	validator, err := rss.NewValidator(discoverer)
+	if err != nil {
+		log.WithError(err).Fatal("failed to init validator")
+	}
+
+	listener, err := database.NewRefreshListener(cfg)
+	if err != nil {
+		log.WithError(err).Fatal("failed to listen to refresh notifications")
+	}
+	defer listener.Close()
+
+	var hub rss.Hub
+	if cfg.WebSubHubEnabled {
+		hub, err = rss.NewHub(cfg, db)
+		if err != nil {
+			log.WithError(err).Fatal("failed to init websub hub")
+		}
+		go hub.Start()
+		defer hub.Shutdown()
+	}
+
+	var webhooks rss.WebhookNotifier
+	if cfg.WebhooksEnabled {
+		webhooks, err = rss.NewWebhookNotifier(cfg, db)
+		if err != nil {
+			log.WithError(err).Fatal("failed to init webhook notifier")
+		}
+		go webhooks.Start()
+		defer webhooks.Shutdown()
+	}
+
+	cacher, err := rss.NewCacher(cfg, db, aggregator, listener, hub, webhooks)
+	if err != nil {
+		log.WithError(err).Fatal("failed to init cacher")
+	}
 	go cacher.Start()
 	defer cacher.Shutdown()
 
-	srv, err := server.New(cfg, db, aggregator)
+	hotCache, err := feedcache.New(cfg, listener)
+	if err != nil {
+		log.WithError(err).Fatal("failed to init hot cache")
+	}
+	go hotCache.Start()
+	defer hotCache.Shutdown()
+
+	readsRecorder := reads.NewRecorder(cfg, db)
+	go readsRecorder.Start()
+	defer readsRecorder.Shutdown()
+
+	pruner := retention.NewPruner(cfg, db)
+	go pruner.Start()
+	defer pruner.Shutdown()
+
+	if cfg.DigestsEnabled {
+		digestSender, err := digest.NewSender(cfg, db)
+		if err != nil {
+			log.WithError(err).Fatal("failed to init digest sender")
+		}
+		go digestSender.Start()
+		defer digestSender.Shutdown()
+	}
+
+	if cfg.NewslettersEnabled {
+		newsletters, err := rss.NewNewsletters(cfg, db)
+		if err != nil {
+			log.WithError(err).Fatal("failed to init newsletters")
+		}
+
+		newsletterServer, err := newsletter.NewServer(cfg, newsletters)
+		if err != nil {
+			log.WithError(err).Fatal("failed to init newsletter server")
+		}
+		go newsletterServer.Start()
+		defer newsletterServer.Shutdown()
+	}
+
+	srv, err := server.New(cfg, db, aggregator, discoverer, validator, cacher, hotCache, readsRecorder, subscriber, hub)
 	if err != nil {
 		log.WithError(err).Fatal("failed to init server")
 	}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+
+	"service-rss/internal/config"
+	"service-rss/internal/database"
+)
+
+const migrateUsage = "usage: service migrate up | down [steps] | status"
+
+// migrate runs migrate subcommand, args are arguments after it
+func migrate(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	migrator, err := database.NewMigrator(cfg)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	switch args[0] {
+	case "up":
+		return migrator.Up()
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("steps should be positive number, got %s", args[1])
+			}
+		}
+		return migrator.Down(steps)
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			log.WithField("applied", status.Applied).Infof("%04d_%s", status.Version, status.Name)
+		}
+		return nil
+	default:
+		return errors.New(migrateUsage)
+	}
+}
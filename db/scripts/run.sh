@@ -4,7 +4,6 @@ docker run                                             \
     --name "rss-db"                                       \
     --env POSTGRES_USER=postgres                       \
     --env POSTGRES_PASSWORD=postgres                   \
-    --volume $(pwd)/db/sql:/docker-entrypoint-initdb.d \
     --detach                                           \
     --publish 5444:5432                                \
-    postgres
\ No newline at end of file
+    postgres:13
\ No newline at end of file
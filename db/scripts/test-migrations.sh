@@ -0,0 +1,21 @@
+#!/usr/bin/env bash
+
+# runs migration tests against throwaway postgres container
+set -e
+
+docker run                                 \
+    --name "rss-db-test"                   \
+    --env POSTGRES_USER=postgres           \
+    --env POSTGRES_PASSWORD=postgres       \
+    --detach                               \
+    --rm                                   \
+    --publish 5446:5432                    \
+    postgres:13 > /dev/null
+trap 'docker stop "rss-db-test" > /dev/null' EXIT
+
+until docker exec "rss-db-test" pg_isready --host localhost --username postgres > /dev/null 2>&1; do
+    sleep 1
+done
+
+RSS_TEST_DB_DSN="host=localhost port=5446 user=postgres password=postgres dbname=postgres sslmode=disable" \
+    go test -count=1 -run TestMigrator ./internal/database
@@ -3,6 +3,8 @@ module service-rss
 go 1.16
 
 require (
+	github.com/andybalholm/brotli v1.0.4
+	github.com/andybalholm/cascadia v1.2.0
 	github.com/asaskevich/govalidator v0.0.0-20210307081110-f21760c49a8d
 	github.com/caarlos0/env/v6 v6.4.0
 	github.com/go-chi/chi v1.5.4
@@ -10,9 +12,12 @@ require (
 	github.com/lib/pq v1.10.3
 	github.com/pkg/errors v0.9.1
 	github.com/prometheus/client_golang v1.11.0
+	github.com/prometheus/client_model v0.2.0
 	github.com/sirupsen/logrus v1.8.1
 	github.com/stretchr/testify v1.7.0
 	github.com/xeipuuv/gojsonschema v1.2.0
 	go.octolab.org v0.12.0
+	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4
 	golang.org/x/oauth2 v0.0.0-20210819190943-2bc19b11175f
+	golang.org/x/time v0.0.0-20210220033141-f8bda1e9f3ba
 )
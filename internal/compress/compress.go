@@ -0,0 +1,106 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	Gzip   = "gzip"
+	Brotli = "br"
+
+	// feeds are compressed once per caching and read many times, so ratio is preferred over speed
+	storedGzipLevel     = gzip.BestCompression
+	storedBrotliQuality = 8
+)
+
+// Encoded is feed stored in every supported encoding, plain feed is decompressed from gzip on demand
+type Encoded struct {
+	Gzip   []byte
+	Brotli []byte
+}
+
+// Encode compresses body for storing
+func Encode(body []byte) (*Encoded, error) {
+	gzipped := &bytes.Buffer{}
+	gzipWriter, err := gzip.NewWriterLevel(gzipped, storedGzipLevel)
+	if err != nil {
+		return nil, err
+	}
+	if err := write(gzipWriter, body); err != nil {
+		return nil, err
+	}
+
+	brotlied := &bytes.Buffer{}
+	if err := write(brotli.NewWriterLevel(brotlied, storedBrotliQuality), body); err != nil {
+		return nil, err
+	}
+
+	return &Encoded{
+		Gzip:   gzipped.Bytes(),
+		Brotli: brotlied.Bytes(),
+	}, nil
+}
+
+// Decode returns plain body for clients which don't accept any encoding
+func Decode(encoded *Encoded) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(encoded.Gzip))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
+
+// Negotiate picks encoding by Accept-Encoding header, encodings are given in order of preference for equal quality.
+// Empty string means identity
+func Negotiate(header string, encodings ...string) string {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if len(name) == 0 {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				var err error
+				q, err = strconv.ParseFloat(param[len("q="):], 64)
+				if err != nil {
+					q = 0
+				}
+			}
+		}
+		qualities[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range encodings {
+		q, ok := qualities[encoding]
+		if !ok {
+			q = qualities["*"]
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+
+	return best
+}
+
+func write(writer io.WriteCloser, body []byte) error {
+	if _, err := writer.Write(body); err != nil {
+		return err
+	}
+	return writer.Close()
+}
@@ -0,0 +1,95 @@
+package compress
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncode(t *testing.T) {
+	body := []byte(strings.Repeat("<item><title>title</title></item>", 100))
+
+	encoded, err := Encode(body)
+	assert.NoError(t, err)
+	assert.Less(t, len(encoded.Gzip), len(body))
+	assert.Less(t, len(encoded.Brotli), len(body))
+
+	decoded, err := Decode(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, body, decoded)
+
+	unbrotlied, err := ioutil.ReadAll(brotli.NewReader(bytes.NewReader(encoded.Brotli)))
+	assert.NoError(t, err)
+	assert.Equal(t, body, unbrotlied)
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected string
+	}{
+		{header: "", expected: ""},
+		{header: "gzip", expected: Gzip},
+		{header: "deflate, GZIP", expected: Gzip},
+		{header: "gzip;q=0", expected: ""},
+		{header: "gzip, deflate, br", expected: Brotli},
+		{header: "br;q=0.5, gzip; q=0.8", expected: Gzip},
+		{header: "br", expected: Brotli},
+		{header: "*", expected: Brotli},
+		{header: "*;q=0.5, br;q=0", expected: Gzip},
+		{header: "identity", expected: ""},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, Negotiate(tt.header, Brotli, Gzip), tt.header)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	body := strings.Repeat("<p>text</p>", 100)
+
+	handler := Middleware(5)(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/encoded" {
+			writer.Header().Set("Content-Encoding", Gzip)
+		}
+		writer.Header().Set("Content-Type", "text/html")
+		_, _ = writer.Write([]byte(body))
+	}))
+
+	t.Run("brotli", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip, br")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, Brotli, rr.Header().Get("Content-Encoding"))
+		decoded, err := ioutil.ReadAll(brotli.NewReader(rr.Body))
+		assert.NoError(t, err)
+		assert.Equal(t, body, string(decoded))
+	})
+
+	t.Run("identity", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Empty(t, rr.Header().Get("Content-Encoding"))
+		assert.Equal(t, body, rr.Body.String())
+	})
+
+	t.Run("encoded by handler", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/encoded", nil)
+		req.Header.Set("Accept-Encoding", "br")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, Gzip, rr.Header().Get("Content-Encoding"))
+		assert.Equal(t, body, rr.Body.String())
+	})
+}
@@ -0,0 +1,30 @@
+package compress
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/andybalholm/brotli"
+	"github.com/go-chi/chi/middleware"
+)
+
+// Middleware compresses responses on the fly by negotiated encoding,
+// responses with Content-Encoding set by handler are written as they are
+func Middleware(level int) func(http.Handler) http.Handler {
+	compressor := middleware.NewCompressor(level,
+		"text/html",
+		"text/css",
+		"text/plain",
+		"text/javascript",
+		"application/javascript",
+		"application/json",
+		"application/xml",
+		"application/rss+xml",
+	)
+
+	compressor.SetEncoder(Brotli, func(w io.Writer, level int) io.Writer {
+		return brotli.NewWriterLevel(w, level)
+	})
+
+	return compressor.Handler
+}
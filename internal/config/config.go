@@ -14,14 +14,128 @@ type Config struct {
 	DbUser      string `env:"RSS_DB_USER" envDefault:"postgres"`
 	DbPassword  string `env:"RSS_DB_PASSWORD" envDefault:"postgres"`
 	DbEnableSsl bool   `env:"RSS_DB_ENABLE_SSL" envDefault:"false"`
+	// DbMigrateOnStart applies pending migrations at startup, otherwise they are applied by migrate subcommand
+	DbMigrateOnStart bool `env:"RSS_DB_MIGRATE_ON_START" envDefault:"true"`
 
 	ServerPort         int           `env:"RSS_SERVER_PORT" envDefault:"80"`
 	ServerReadTimeout  time.Duration `env:"RSS_SERVER_READ_TIMEOUT" envDefault:"300ms"`
 	ServerWriteTimeout time.Duration `env:"RSS_SERVER_WRITE_TIMEOUT" envDefault:"5000ms"`
+	ServerPublicUrl    string        `env:"RSS_SERVER_PUBLIC_URL" envDefault:"http://localhost"`
 
-	CacherWorkersCount int           `env:"RSS_CACHER_WORKERS_COUNT" envDefault:"4"`
-	CacherPullPeriod   time.Duration `env:"RSS_CACHER_PULL_PERIOD" envDefault:"500ms"`
-	CacherBatchSize    int           `env:"RSS_CACHER_BATCH_SIZE" envDefault:"100"`
+	CacherWorkersCount int `env:"RSS_CACHER_WORKERS_COUNT" envDefault:"4"`
+	CacherBatchSize    int `env:"RSS_CACHER_BATCH_SIZE" envDefault:"100"`
+	// cacher sleeps until the next rss is outdated or notification is received, but not longer than max sleep
+	CacherMaxSleep time.Duration `env:"RSS_CACHER_MAX_SLEEP" envDefault:"1m"`
+	// leases of crashed replicas expire after lease duration, live ones are extended every heartbeat period
+	CacherLeaseDuration   time.Duration `env:"RSS_CACHER_LEASE_DURATION" envDefault:"1m"`
+	CacherHeartbeatPeriod time.Duration `env:"RSS_CACHER_HEARTBEAT_PERIOD" envDefault:"15s"`
+	// outdated rss are cached in order of read demand, which halves every half life without reads,
+	// rss unread for dormant period are cached not more often than dormant interval until they are read again
+	CacherDemandHalfLife  time.Duration `env:"RSS_CACHER_DEMAND_HALF_LIFE" envDefault:"24h"`
+	CacherDormantAfter    time.Duration `env:"RSS_CACHER_DORMANT_AFTER" envDefault:"168h"`
+	CacherDormantInterval time.Duration `env:"RSS_CACHER_DORMANT_INTERVAL" envDefault:"24h"`
+
+	// sources are fetched at intervals estimated by their update frequency, failures are retried with exponential backoff
+	SchedulerMinInterval time.Duration `env:"RSS_SCHEDULER_MIN_INTERVAL" envDefault:"5m"`
+	SchedulerMaxInterval time.Duration `env:"RSS_SCHEDULER_MAX_INTERVAL" envDefault:"6h"`
+	SchedulerBackoff     time.Duration `env:"RSS_SCHEDULER_BACKOFF" envDefault:"1m"`
+	SchedulerMaxBackoff  time.Duration `env:"RSS_SCHEDULER_MAX_BACKOFF" envDefault:"24h"`
+	SchedulerJitter      float64       `env:"RSS_SCHEDULER_JITTER" envDefault:"0.1"`
+
+	// sources advertising websub hub are subscribed with callback at public url, they are polled rarely while subscribed.
+	// Subscriptions are renewed before lease expires, failed ones are retried with exponential backoff
+	WebSubEnabled      bool          `env:"RSS_WEBSUB_ENABLED" envDefault:"true"`
+	WebSubLease        time.Duration `env:"RSS_WEBSUB_LEASE" envDefault:"240h"`
+	WebSubPollInterval time.Duration `env:"RSS_WEBSUB_POLL_INTERVAL" envDefault:"12h"`
+	WebSubCheckPeriod  time.Duration `env:"RSS_WEBSUB_CHECK_PERIOD" envDefault:"1m"`
+	WebSubRetry        time.Duration `env:"RSS_WEBSUB_RETRY" envDefault:"10m"`
+	WebSubMaxRetry     time.Duration `env:"RSS_WEBSUB_MAX_RETRY" envDefault:"24h"`
+	// our feeds advertise hub, changed feeds are pushed to subscribers with retries up to max attempts.
+	// Verifications limit concurrent checks of intents, rate limits are in requests per minute per callback host and in total
+	WebSubHubEnabled          bool          `env:"RSS_WEBSUB_HUB_ENABLED" envDefault:"true"`
+	WebSubHubLease            time.Duration `env:"RSS_WEBSUB_HUB_LEASE" envDefault:"240h"`
+	WebSubHubMaxLease         time.Duration `env:"RSS_WEBSUB_HUB_MAX_LEASE" envDefault:"720h"`
+	WebSubHubRetry            time.Duration `env:"RSS_WEBSUB_HUB_RETRY" envDefault:"1m"`
+	WebSubHubMaxAttempts      int           `env:"RSS_WEBSUB_HUB_MAX_ATTEMPTS" envDefault:"8"`
+	WebSubHubVerifications    int           `env:"RSS_WEBSUB_HUB_VERIFICATIONS" envDefault:"16"`
+	WebSubHubRateLimitPerHost int           `env:"RSS_WEBSUB_HUB_RATE_LIMIT_PER_HOST" envDefault:"10"`
+	WebSubHubRateLimitTotal   int           `env:"RSS_WEBSUB_HUB_RATE_LIMIT_TOTAL" envDefault:"120"`
+
+	// new items of rss are posted to its webhooks with retries up to max attempts, then deliveries are dead letters.
+	// Finished deliveries are kept in log for log retention
+	WebhooksEnabled     bool          `env:"RSS_WEBHOOKS_ENABLED" envDefault:"true"`
+	WebhookCheckPeriod  time.Duration `env:"RSS_WEBHOOK_CHECK_PERIOD" envDefault:"30s"`
+	WebhookTimeout      time.Duration `env:"RSS_WEBHOOK_TIMEOUT" envDefault:"10s"`
+	WebhookRetry        time.Duration `env:"RSS_WEBHOOK_RETRY" envDefault:"1m"`
+	WebhookMaxRetry     time.Duration `env:"RSS_WEBHOOK_MAX_RETRY" envDefault:"6h"`
+	WebhookMaxAttempts  int           `env:"RSS_WEBHOOK_MAX_ATTEMPTS" envDefault:"8"`
+	WebhookLogRetention time.Duration `env:"RSS_WEBHOOK_LOG_RETENTION" envDefault:"168h"`
+
+	// digests of new items are emailed through smtp relay, so they are disabled until relay is configured.
+	// Digests are sent at digest hour of their time zone, failed ones are retried up to max attempts
+	DigestsEnabled    bool          `env:"RSS_DIGESTS_ENABLED" envDefault:"false"`
+	DigestHour        int           `env:"RSS_DIGEST_HOUR" envDefault:"8"`
+	DigestCheckPeriod time.Duration `env:"RSS_DIGEST_CHECK_PERIOD" envDefault:"1m"`
+	DigestRetry       time.Duration `env:"RSS_DIGEST_RETRY" envDefault:"10m"`
+	DigestMaxAttempts int           `env:"RSS_DIGEST_MAX_ATTEMPTS" envDefault:"5"`
+	SmtpHost          string        `env:"RSS_SMTP_HOST"`
+	SmtpPort          int           `env:"RSS_SMTP_PORT" envDefault:"25"`
+	SmtpUsername      string        `env:"RSS_SMTP_USERNAME"`
+	SmtpPassword      string        `env:"RSS_SMTP_PASSWORD"`
+	SmtpFrom          string        `env:"RSS_SMTP_FROM"`
+
+	// emails to token addresses at newsletter domain are received by smtp listener, mx of domain should point to it.
+	// Emails larger than max bytes are rejected, idle connections are closed after timeout.
+	// Connections over max connections are refused with 421, so senders retry later
+	NewslettersEnabled bool          `env:"RSS_NEWSLETTERS_ENABLED" envDefault:"false"`
+	NewsletterDomain   string        `env:"RSS_NEWSLETTER_DOMAIN" envDefault:"newsletters.localhost"`
+	NewsletterSmtpPort int           `env:"RSS_NEWSLETTER_SMTP_PORT" envDefault:"2525"`
+	NewsletterMaxBytes int64         `env:"RSS_NEWSLETTER_MAX_BYTES" envDefault:"10485760"`
+	NewsletterTimeout  time.Duration `env:"RSS_NEWSLETTER_TIMEOUT" envDefault:"1m"`
+	NewsletterMaxConns int           `env:"RSS_NEWSLETTER_MAX_CONNS" envDefault:"100"`
+
+	// FeedItemsLimit is count of stored items in aggregated feed
+	FeedItemsLimit int `env:"RSS_FEED_ITEMS_LIMIT" envDefault:"200"`
+
+	// items are pruned when they are neither among max items newest nor younger than max days, zero disables limit
+	RetentionMaxItems   int           `env:"RSS_RETENTION_MAX_ITEMS" envDefault:"1000"`
+	RetentionMaxDays    int           `env:"RSS_RETENTION_MAX_DAYS" envDefault:"90"`
+	RetentionPeriod     time.Duration `env:"RSS_RETENTION_PERIOD" envDefault:"1h"`
+	RetentionBatchSize  int           `env:"RSS_RETENTION_BATCH_SIZE" envDefault:"500"`
+	RetentionArchiveDir string        `env:"RSS_RETENTION_ARCHIVE_DIR"`
+
+	// SearchLanguage is postgres text search configuration for items of feeds without known language
+	SearchLanguage string `env:"RSS_SEARCH_LANGUAGE" envDefault:"english"`
+
+	DiscoveryTimeout time.Duration `env:"RSS_DISCOVERY_TIMEOUT" envDefault:"2s"`
+	// FetchTimeout limits every fetch of source including reading of body
+	FetchTimeout time.Duration `env:"RSS_FETCH_TIMEOUT" envDefault:"30s"`
+	// AllowPrivateNetworks lets sources, hubs, callbacks and webhooks be at private, loopback and link-local addresses.
+	// They are refused by default, since urls are given by users
+	AllowPrivateNetworks bool `env:"RSS_ALLOW_PRIVATE_NETWORKS" envDefault:"false"`
+
+	// sources of preview are fetched concurrently, ones which are not fetched in preview timeout are reported as failed.
+	// Preview timeout should be less than server write timeout
+	PreviewTimeout time.Duration `env:"RSS_PREVIEW_TIMEOUT" envDefault:"4s"`
+
+	// preview limits are in requests per minute, since every preview fetches all sources
+	PreviewRateLimitPerUser int `env:"RSS_PREVIEW_RATE_LIMIT_PER_USER" envDefault:"10"`
+	PreviewRateLimitTotal   int `env:"RSS_PREVIEW_RATE_LIMIT_TOTAL" envDefault:"60"`
+
+	// refresh limits are in requests per minute, wait timeout should be less than server write timeout
+	RefreshRateLimitPerUser int           `env:"RSS_REFRESH_RATE_LIMIT_PER_USER" envDefault:"5"`
+	RefreshRateLimitTotal   int           `env:"RSS_REFRESH_RATE_LIMIT_TOTAL" envDefault:"60"`
+	RefreshWaitTimeout      time.Duration `env:"RSS_REFRESH_WAIT_TIMEOUT" envDefault:"4s"`
+	// CacheMissWaitTimeout is time to wait for rss which has not been cached yet, it should be less than server write timeout
+	CacheMissWaitTimeout time.Duration `env:"RSS_CACHE_MISS_WAIT_TIMEOUT" envDefault:"3s"`
+
+	// feeds are kept in memory until they are cached again or max age passes, zero max bytes disables hot cache
+	HotCacheMaxBytes int64         `env:"RSS_HOT_CACHE_MAX_BYTES" envDefault:"67108864"`
+	HotCacheMaxAge   time.Duration `env:"RSS_HOT_CACHE_MAX_AGE" envDefault:"1m"`
+	// ReadsFlushPeriod is how often reads of feeds are saved, read of dormant rss refreshes it not later than that
+	ReadsFlushPeriod time.Duration `env:"RSS_READS_FLUSH_PERIOD" envDefault:"10s"`
+	// CompressionLevel is used for responses compressed on the fly, feeds are stored compressed with the best ratio
+	CompressionLevel int `env:"RSS_COMPRESSION_LEVEL" envDefault:"5"`
 
 	GoogleAuthClientID     string `env:"RSS_GOOGLE_AUTH_CLIENT_ID,required"`
 	GoogleAuthClientSecret string `env:"RSS_GOOGLE_AUTH_CLIENT_SECRET,required"`
@@ -2,7 +2,10 @@
 package database
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -11,50 +14,221 @@ import (
 	"github.com/lib/pq"
 	"github.com/prometheus/client_golang/prometheus"
 
+	"service-rss/internal/compress"
 	"service-rss/internal/config"
 )
 
-var (
-	lockTimeout = 30 * time.Minute
+const (
+	ModeRss     = "rss"
+	ModePodcast = "podcast"
 )
 
+const (
+	rssColumns  = "id, email, name, sources, mode, channel, podcast, retention, search"
+	itemColumns = "id, source, hash, guid, link, title, description, content, language, published_time, data, pinned, first_seen_time, updated_time"
+)
+
+// ErrRssLeased means rss is being cached by some replica at the moment
+var ErrRssLeased = errors.New("rss is leased")
+
 type Rss struct {
-	ID      int64
-	Email   string
-	Name    string
-	Sources []string
+	ID        int64
+	Email     string
+	Name      string
+	Sources   []string
+	Mode      string
+	Channel   *ChannelSettings
+	Podcast   *PodcastSettings
+	Retention *RetentionSettings
+	Search    *SearchSettings // rss is saved search over other rss of owner instead of sources
+}
+
+type ChannelSettings struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Link        string `json:"link,omitempty"`
+	Language    string `json:"language,omitempty"`
+	Image       string `json:"image,omitempty"`
+	Icon        string `json:"icon,omitempty"`
+	Copyright   string `json:"copyright,omitempty"`
+	Category    string `json:"category,omitempty"`
+}
+
+// RetentionSettings override global retention, zero value means global one
+type RetentionSettings struct {
+	MaxItems int `json:"max_items,omitempty"`
+	MaxDays  int `json:"max_days,omitempty"`
+}
+
+type SearchSettings struct {
+	Query string   `json:"query"`
+	Feeds []string `json:"feeds"` // names of rss of the same owner
+}
+
+type PodcastSettings struct {
+	Author      string `json:"author"`
+	OwnerName   string `json:"owner_name,omitempty"`
+	OwnerEmail  string `json:"owner_email"`
+	Image       string `json:"image"`
+	Category    string `json:"category"`
+	Subcategory string `json:"subcategory,omitempty"`
+	Explicit    bool   `json:"explicit,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Locked      bool   `json:"locked,omitempty"`
+}
+
+// Item is an item of source feed, it is unique by source and hash of guid or link
+type Item struct {
+	ID            int64
+	Source        string
+	Hash          string
+	Guid          string
+	Link          string
+	Title         string
+	Description   string
+	Content       string // plain text of description for search
+	Language      string // language of source feed
+	PublishedTime *time.Time
+	Data          string // serialized feed item
+	Pinned        bool   // pinned items are never pruned
+	FirstSeenTime time.Time
+	UpdatedTime   time.Time
+}
+
+// SourceState is schedule of source fetching, it is shared by all rss with the source
+type SourceState struct {
+	Url             string
+	NextFetchTime   time.Time
+	LastFetchTime   *time.Time
+	LastSuccessTime *time.Time
+	LastItemTime    *time.Time    // publishing time of the newest item
+	Interval        time.Duration // estimated interval between fetches without failures
+	Failures        int           // count of failures in a row
+	LastError       string
+	SkipHours       []int64 // hours and days from source channel, they are kept for retries after failures
+	SkipDays        []string
+	Pushed          bool // source pushes updates by active websub subscription, it is not saved
 }
 
-type RssCached struct {
-	Rss
-	RssFeed string
+// CachedFeed is rendered feed of rss, feed is nil if rss has not been cached yet
+type CachedFeed struct {
+	ID   int64
+	Feed *compress.Encoded
+	// ValidFor is time until feed is outdated by db clock, it is not positive for outdated feed
+	ValidFor time.Duration
+}
+
+// CacheQueueStats describes rss waiting for cacher, leases are counted for all replicas
+type CacheQueueStats struct {
+	Pending        int
+	Leased         int
+	OldestLeaseAge time.Duration
 }
 
 type Database interface {
 	Shutdown() error
 	CreateRss(*Rss) error
-	GetItemsToCache(batchSize int) ([]*Rss, error)
-	SaveCachedRss(id int64, rssFeed string, validUntil time.Time) error
-	GetCachedRss(email string, name string) (*RssCached, error)
+	UpdateRss(*Rss) error
+	// LeaseItemsToCache claims outdated rss until lease expires, leases are extended by heartbeats
+	LeaseItemsToCache(batchSize int, lease time.Duration) ([]*Rss, error)
+	// LeaseRss claims rss of owner regardless of its validity, it returns ErrRssLeased if rss is leased already
+	LeaseRss(email string, name string, lease time.Duration) (*Rss, error)
+	ExtendLeases(ids []int64, lease time.Duration) error
+	ReleaseLeases(ids []int64) error
+	GetCacheQueueStats() (*CacheQueueStats, error)
+	// GetNextCacheDelay returns time until the next rss is outdated or its lease expires, but not more than max
+	GetNextCacheDelay(max time.Duration) (time.Duration, error)
+	// SaveCachedRss postpones validity of dormant rss up to dormant interval,
+	// it reports whether content hash differs from the previous one
+	SaveCachedRss(id int64, rssFeed *compress.Encoded, contentHash string, validUntil time.Time) (bool, error)
+	GetCachedFeed(email string, name string) (*CachedFeed, error)
+	// GetRss returns rss with its sources and settings, it returns sql.ErrNoRows if there is no such rss
+	GetRss(email string, name string) (*Rss, error)
+	// GetSourceRss returns rss which include source
+	GetSourceRss(source string) ([]*Rss, error)
+	// RecordReads raises read demand of rss by counts of reads, read of dormant rss makes it outdated to be cached promptly
+	RecordReads(reads map[int64]int64) error
 	GetRssForIndex() ([]*Rss, error)
+	SaveItems(items []*Item) error
+	GetItems(sources []string, limit int) ([]*Item, error)
+	GetItemSources() ([]string, error)
+	// PruneItems deletes items beyond retention, their hashes are kept, so SaveItems skips them while sources still have them
+	PruneItems(source string, keepItems int, keepSince time.Time, batchSize int, archive func([]*Item) error) (int, error)
+	// ForgetPrunedItems deletes hashes of pruned items of sources which no rss includes, they aren't fetched anymore
+	ForgetPrunedItems() (int, error)
+	PinItem(email string, name string, item string, pinned bool) error
+	GetSourceStates(urls []string) (map[string]*SourceState, error)
+	SaveSourceStates(states []*SourceState) error
+	SearchItems(query *SearchQuery) ([]*SearchResult, error)
+	// SaveSubscription creates pending subscription of source, it is reset if source moved to other hub or topic
+	SaveSubscription(sub *Subscription) error
+	GetSubscription(id int64) (*Subscription, error)
+	// LeaseSubscriptions claims subscriptions due to subscribe or renew, claimed ones are retried after lease
+	LeaseSubscriptions(batchSize int, lease time.Duration) ([]*Subscription, error)
+	ActivateSubscription(id int64, lease time.Duration, renewAfter time.Duration) error
+	FailSubscription(id int64, state string, lastError string, retryAfter time.Duration) error
+	// InvalidateSourceRss makes all rss with source outdated
+	InvalidateSourceRss(source string) error
+	GetRssID(email string, name string) (int64, error)
+	// SaveHubSubscription subscribes callback to rss or renews lease of existing subscription
+	SaveHubSubscription(sub *HubSubscription) error
+	DeleteHubSubscription(rssID int64, callback string) error
+	// QueueHubPushes makes push of rss due for all subscribers with active lease
+	QueueHubPushes(rssID int64) error
+	// LeaseHubPushes claims due pushes with current feed of rss, claimed ones are retried after lease
+	LeaseHubPushes(batchSize int, lease time.Duration) ([]*HubPush, error)
+	// FinishHubPush retries push after given time, zero time means push is done
+	FinishHubPush(id int64, retryAfter time.Duration) error
+	// CreateWebhook adds webhook to rss of owner, it returns sql.ErrNoRows if owner has no such rss
+	CreateWebhook(email string, name string, webhook *Webhook) error
+	GetWebhooks(email string) ([]*Webhook, error)
+	GetRssWebhooks(rssID int64) ([]*Webhook, error)
+	DeleteWebhook(email string, id int64) error
+	// QueueWebhookDeliveries queues deliveries of new items and remembers items of the current feed
+	QueueWebhookDeliveries(webhookID int64, seenItems []string, deliveries []*WebhookDelivery) error
+	// LeaseWebhookDeliveries claims due deliveries, claimed ones are retried after lease
+	LeaseWebhookDeliveries(batchSize int, lease time.Duration) ([]*WebhookDelivery, error)
+	// FinishWebhookDelivery saves state and result of delivery, pending one is retried after given time
+	FinishWebhookDelivery(delivery *WebhookDelivery, retryAfter time.Duration) error
+	GetWebhookDeliveries(email string, webhookID int64, state string, limit int) ([]*WebhookDelivery, error)
+	// RedeliverWebhookDeliveries queues dead deliveries again, it returns count of queued ones
+	RedeliverWebhookDeliveries(email string, webhookID int64, deliveryID int64) (int, error)
+	PruneWebhookDeliveries(keepSince time.Time) (int, error)
+	// CreateDigest adds digest to rss of owner, it returns sql.ErrNoRows if owner has no such rss
+	CreateDigest(email string, name string, digest *Digest) error
+	// GetDigests returns digests of rss of owner and digests sent to email
+	GetDigests(email string) ([]*Digest, error)
+	// DeleteDigest deletes digest of rss of owner or digest sent to email
+	DeleteDigest(email string, id int64) error
+	// UnsubscribeDigest deletes digest by token of its unsubscribe link, it returns sql.ErrNoRows if there is no such digest
+	UnsubscribeDigest(id int64, token string) error
+	// LeaseDigests claims due digests, claimed ones are retried after lease
+	LeaseDigests(batchSize int, lease time.Duration) ([]*Digest, error)
+	// GetDigestItems returns the newest items of leased digest, which were not sent yet
+	GetDigestItems(digest *Digest, limit int) ([]*Item, error)
+	// FinishDigest remembers sent items and schedules the next digest
+	FinishDigest(digest *Digest, itemIDs []int64, nextSendTime time.Time) error
+	FailDigest(id int64, lastError string, nextSendTime time.Time, attempts int) error
+	// CreateNewsletter adds newsletter source to rss of owner, it returns sql.ErrNoRows if owner has no such rss
+	CreateNewsletter(email string, name string, newsletter *Newsletter) error
+	GetNewsletters(email string) ([]*Newsletter, error)
+	// GetNewsletter returns newsletter by token of its address, it returns sql.ErrNoRows for unknown token
+	GetNewsletter(token string) (*Newsletter, error)
+	DeleteNewsletter(email string, id int64) error
 }
 
 type database struct {
-	db        *sql.DB
-	serviceID string
-	histogram *prometheus.HistogramVec
+	db              *sql.DB
+	serviceID       string
+	searchLanguage  string
+	demandHalfLife  time.Duration
+	dormantAfter    time.Duration
+	dormantInterval time.Duration
+	histogram       *prometheus.HistogramVec
 }
 
 func New(cfg *config.Config) (Database, error) {
-	settings := fmt.Sprintf(
-		"host=%s port=%d dbname=%s user=%s password=%s",
-		cfg.DbHost, cfg.DbPort, cfg.DbName, cfg.DbUser, cfg.DbPassword,
-	)
-	if !cfg.DbEnableSsl {
-		settings = fmt.Sprintf("%s sslmode=disable", settings)
-	}
-
-	db, err := sql.Open("postgres", settings)
+	db, err := open(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -64,7 +238,12 @@ func New(cfg *config.Config) (Database, error) {
 		return nil, err
 	}
 
-	serviceID := fmt.Sprintf("%s-%d", hostname, os.Getppid())
+	// random suffix keeps lease owners unique even if hostname and pid are reused
+	suffix := make([]byte, 4)
+	if _, err = rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	serviceID := fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), hex.EncodeToString(suffix))
 
 	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "database_duration_seconds",
@@ -78,12 +257,32 @@ func New(cfg *config.Config) (Database, error) {
 	}
 
 	return &database{
-		db:        db,
-		serviceID: serviceID,
-		histogram: histogram,
+		db:              db,
+		serviceID:       serviceID,
+		searchLanguage:  cfg.SearchLanguage,
+		demandHalfLife:  cfg.CacherDemandHalfLife,
+		dormantAfter:    cfg.CacherDormantAfter,
+		dormantInterval: cfg.CacherDormantInterval,
+		histogram:       histogram,
 	}, nil
 }
 
+func open(cfg *config.Config) (*sql.DB, error) {
+	return sql.Open("postgres", connectionSettings(cfg))
+}
+
+func connectionSettings(cfg *config.Config) string {
+	settings := fmt.Sprintf(
+		"host=%s port=%d dbname=%s user=%s password=%s",
+		cfg.DbHost, cfg.DbPort, cfg.DbName, cfg.DbUser, cfg.DbPassword,
+	)
+	if !cfg.DbEnableSsl {
+		settings = fmt.Sprintf("%s sslmode=disable", settings)
+	}
+
+	return settings
+}
+
 func (db *database) Shutdown() error {
 	return db.db.Close()
 }
@@ -107,57 +306,284 @@ func (db *database) createRss(rss *Rss) error {
 		return errors.New("empty rss")
 	}
 
-	query := "INSERT INTO rss (email, name, sources, cached_valid_until) VALUES ($1, $2, $3, $4)"
-	_, err := db.db.Exec(query, rss.Email, rss.Name, pq.Array(rss.Sources), time.Unix(0, 0))
+	channel, err := marshalJson(rss.Channel)
+	if err != nil {
+		return err
+	}
+
+	podcast, err := marshalJson(rss.Podcast)
+	if err != nil {
+		return err
+	}
+
+	retention, err := marshalJson(rss.Retention)
+	if err != nil {
+		return err
+	}
+
+	search, err := marshalJson(rss.Search)
+	if err != nil {
+		return err
+	}
+
+	query := "INSERT INTO rss (email, name, sources, mode, channel, podcast, retention, search, cached_valid_until) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)"
+	_, err = db.db.Exec(query, rss.Email, rss.Name, pq.Array(getSources(rss)), getMode(rss), channel, podcast, retention, search, time.Unix(0, 0))
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (db *database) GetItemsToCache(batchSize int) ([]*Rss, error) {
+func (db *database) UpdateRss(rss *Rss) error {
 	start := time.Now()
 
-	rss, err := db.getItemsToCache(batchSize)
+	err := db.updateRss(rss)
 
 	status := "ok"
 	if err != nil {
 		status = "error"
 	}
-	db.histogram.WithLabelValues("get_items_to_cache", status).Observe(time.Since(start).Seconds())
+	db.histogram.WithLabelValues("update_rss", status).Observe(time.Since(start).Seconds())
 
-	return rss, err
+	return err
 }
 
-func (db *database) getItemsToCache(batchSize int) ([]*Rss, error) {
-	now := time.Now()
+func (db *database) updateRss(rss *Rss) error {
+	if rss == nil {
+		return errors.New("empty rss")
+	}
 
-	ids, err := db.getNotLockedItems(batchSize, now)
+	channel, err := marshalJson(rss.Channel)
+	if err != nil {
+		return err
+	}
+
+	podcast, err := marshalJson(rss.Podcast)
+	if err != nil {
+		return err
+	}
+
+	retention, err := marshalJson(rss.Retention)
+	if err != nil {
+		return err
+	}
+
+	search, err := marshalJson(rss.Search)
+	if err != nil {
+		return err
+	}
+
+	// reset validity, so cacher rebuilds feed with new settings
+	query := "UPDATE rss SET sources=$1, mode=$2, channel=$3, podcast=$4, retention=$5, search=$6, cached_valid_until=$7 WHERE email=$8 and name=$9"
+	result, err := db.db.Exec(query, pq.Array(getSources(rss)), getMode(rss), channel, podcast, retention, search, time.Unix(0, 0), rss.Email, rss.Name)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (db *database) LeaseItemsToCache(batchSize int, lease time.Duration) ([]*Rss, error) {
+	start := time.Now()
+
+	rss, err := db.leaseItemsToCache(batchSize, lease)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("lease_items_to_cache", status).Observe(time.Since(start).Seconds())
+
+	return rss, err
+}
+
+// leaseItemsToCache claims outdated rss in one statement, rows claimed by other replicas are skipped instead of awaited
+func (db *database) leaseItemsToCache(batchSize int, lease time.Duration) ([]*Rss, error) {
+	query := `UPDATE rss SET lease_owner=$1, leased_time=now(), lease_expires_time=now() + $2 * interval '1 millisecond'
+		WHERE id IN (
+			SELECT id FROM rss WHERE cached_valid_until < now() and (lease_expires_time is null or lease_expires_time < now())
+			ORDER BY ` + readDemand("$4") + ` DESC, cached_valid_until LIMIT $3 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + rssColumns
+	rows, err := db.db.Query(query, db.serviceID, lease.Milliseconds(), batchSize, db.demandHalfLife.Seconds())
 	if err != nil {
 		return nil, err
 	}
 
-	if len(ids) == 0 {
-		return []*Rss{}, nil
+	defer rows.Close()
+
+	items := make([]*Rss, 0, batchSize)
+	for rows.Next() {
+		item, err := scanRss(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
 	}
 
-	err = db.lockItems(ids, now)
+	return items, rows.Err()
+}
+
+func (db *database) LeaseRss(email string, name string, lease time.Duration) (*Rss, error) {
+	start := time.Now()
+
+	rss, err := db.leaseRss(email, name, lease)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("lease_rss", status).Observe(time.Since(start).Seconds())
+
+	return rss, err
+}
+
+func (db *database) leaseRss(email string, name string, lease time.Duration) (*Rss, error) {
+	query := `UPDATE rss SET lease_owner=$1, leased_time=now(), lease_expires_time=now() + $2 * interval '1 millisecond'
+		WHERE email=$3 and name=$4 and (lease_expires_time is null or lease_expires_time < now())
+		RETURNING ` + rssColumns
+	row := db.db.QueryRow(query, db.serviceID, lease.Milliseconds(), email, name)
+	rss, err := scanRss(row)
+	if err != sql.ErrNoRows {
+		return rss, err
+	}
+
+	// rss is either absent or leased
+	var exists bool
+	err = db.db.QueryRow("SELECT exists(SELECT 1 FROM rss WHERE email=$1 and name=$2)", email, name).Scan(&exists)
 	if err != nil {
 		return nil, err
 	}
+	if exists {
+		return nil, ErrRssLeased
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+func (db *database) ExtendLeases(ids []int64, lease time.Duration) error {
+	start := time.Now()
+
+	err := db.extendLeases(ids, lease)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("extend_leases", status).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+// extendLeases keeps only own leases, expired lease may be taken by other replica already
+func (db *database) extendLeases(ids []int64, lease time.Duration) error {
+	query := "UPDATE rss SET lease_expires_time=now() + $1 * interval '1 millisecond' WHERE lease_owner=$2 and id=any($3)"
+	_, err := db.db.Exec(query, lease.Milliseconds(), db.serviceID, pq.Array(ids))
+	return err
+}
 
-	items, err := db.getLockedItems(ids)
+func (db *database) ReleaseLeases(ids []int64) error {
+	start := time.Now()
+
+	err := db.releaseLeases(ids)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("release_leases", status).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+func (db *database) releaseLeases(ids []int64) error {
+	query := "UPDATE rss SET lease_owner=NULL, leased_time=NULL, lease_expires_time=NULL WHERE lease_owner=$1 and id=any($2)"
+	_, err := db.db.Exec(query, db.serviceID, pq.Array(ids))
+	return err
+}
+
+func (db *database) GetCacheQueueStats() (*CacheQueueStats, error) {
+	start := time.Now()
+
+	stats, err := db.getCacheQueueStats()
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("get_cache_queue_stats", status).Observe(time.Since(start).Seconds())
+
+	return stats, err
+}
+
+func (db *database) getCacheQueueStats() (*CacheQueueStats, error) {
+	query := `SELECT
+			count(*) FILTER (WHERE cached_valid_until < now() and (lease_expires_time is null or lease_expires_time < now())),
+			count(*) FILTER (WHERE lease_expires_time >= now()),
+			coalesce(extract(epoch FROM now() - min(leased_time) FILTER (WHERE lease_expires_time >= now())), 0)
+		FROM rss`
+
+	stats := &CacheQueueStats{}
+	var oldestLeaseAge float64
+	err := db.db.QueryRow(query).Scan(&stats.Pending, &stats.Leased, &oldestLeaseAge)
 	if err != nil {
 		return nil, err
 	}
+	stats.OldestLeaseAge = time.Duration(oldestLeaseAge * float64(time.Second))
 
-	return items, nil
+	return stats, nil
+}
+
+func (db *database) GetNextCacheDelay(max time.Duration) (time.Duration, error) {
+	start := time.Now()
+
+	delay, err := db.getNextCacheDelay(max)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("get_next_cache_delay", status).Observe(time.Since(start).Seconds())
+
+	return delay, err
+}
+
+// getNextCacheDelay is calculated by db clock, the same one is used for leasing
+func (db *database) getNextCacheDelay(max time.Duration) (time.Duration, error) {
+	query := `SELECT coalesce(extract(epoch FROM min(
+			CASE WHEN lease_expires_time >= now() THEN lease_expires_time ELSE cached_valid_until END
+		) - now()), $1) FROM rss`
+
+	var seconds float64
+	err := db.db.QueryRow(query, max.Seconds()).Scan(&seconds)
+	if err != nil {
+		return 0, err
+	}
+
+	delay := time.Duration(seconds * float64(time.Second))
+	if delay < 0 {
+		return 0, nil
+	}
+	if delay > max {
+		return max, nil
+	}
+
+	return delay, nil
 }
 
-func (db *database) SaveCachedRss(id int64, rssFeed string, validUntil time.Time) error {
+func (db *database) SaveCachedRss(id int64, rssFeed *compress.Encoded, contentHash string, validUntil time.Time) (bool, error) {
 	start := time.Now()
 
-	err := db.saveCachedRss(id, rssFeed, validUntil)
+	changed, err := db.saveCachedRss(id, rssFeed, contentHash, validUntil)
 
 	status := "ok"
 	if err != nil {
@@ -165,61 +591,206 @@ func (db *database) SaveCachedRss(id int64, rssFeed string, validUntil time.Time
 	}
 	db.histogram.WithLabelValues("save_cached_rss", status).Observe(time.Since(start).Seconds())
 
+	return changed, err
+}
+
+// saveCachedRss releases own lease, feed may be saved on cache miss while other replica holds it.
+// Plain feed cached before compression is dropped
+func (db *database) saveCachedRss(id int64, rssFeed *compress.Encoded, contentHash string, validUntil time.Time) (bool, error) {
+	// feed is written only if its content is changed, so replicas are notified about changed feeds only
+	query := `UPDATE rss SET cached_rss_hash=$8,
+		cached_rss_gzip=CASE WHEN previous.cached_rss_hash IS DISTINCT FROM $8 THEN $1 ELSE rss.cached_rss_gzip END,
+		cached_rss_br=CASE WHEN previous.cached_rss_hash IS DISTINCT FROM $8 THEN $7 ELSE rss.cached_rss_br END,
+		cached_rss=CASE WHEN previous.cached_rss_hash IS DISTINCT FROM $8 THEN NULL ELSE rss.cached_rss END,
+		cached_valid_until=CASE WHEN last_read_time < now() - $5 * interval '1 millisecond'
+			THEN greatest($2, now() + $6 * interval '1 millisecond') ELSE $2 END,
+		lease_owner=CASE WHEN lease_owner=$3 THEN NULL ELSE lease_owner END,
+		leased_time=CASE WHEN lease_owner=$3 THEN NULL ELSE leased_time END,
+		lease_expires_time=CASE WHEN lease_owner=$3 THEN NULL ELSE lease_expires_time END
+		FROM (SELECT id, cached_rss_hash FROM rss WHERE id=$4 FOR UPDATE) previous
+		WHERE rss.id=previous.id
+		RETURNING previous.cached_rss_hash IS DISTINCT FROM $8`
+
+	var changed bool
+	err := db.db.QueryRow(query, rssFeed.Gzip, validUntil, db.serviceID, id,
+		db.dormantAfter.Milliseconds(), db.dormantInterval.Milliseconds(), rssFeed.Brotli, contentHash).Scan(&changed)
+	if err == sql.ErrNoRows {
+		// rss was deleted while it was cached
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return changed, nil
+}
+
+func (db *database) RecordReads(reads map[int64]int64) error {
+	start := time.Now()
+
+	err := db.recordReads(reads)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("record_reads", status).Observe(time.Since(start).Seconds())
+
 	return err
 }
 
-func (db *database) saveCachedRss(id int64, rssFeed string, validUntil time.Time) error {
-	query := "UPDATE rss SET is_locked=FALSE, cached_rss=$1, cached_valid_until=$2 WHERE id=$3"
-	_, err := db.db.Exec(query, rssFeed, validUntil, id)
+// recordReads adds reads to decayed demand, all expressions use last read time before update
+func (db *database) recordReads(reads map[int64]int64) error {
+	if len(reads) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(reads))
+	counts := make([]int64, 0, len(reads))
+	for id, count := range reads {
+		ids = append(ids, id)
+		counts = append(counts, count)
+	}
+
+	query := `UPDATE rss SET read_score=` + readDemand("$3") + ` + r.count,
+		cached_valid_until=CASE WHEN last_read_time < now() - $4 * interval '1 millisecond'
+			THEN least(cached_valid_until, now()) ELSE cached_valid_until END,
+		last_read_time=now()
+		FROM unnest($1::bigint[], $2::bigint[]) AS r(id, count)
+		WHERE rss.id=r.id`
+	_, err := db.db.Exec(query, pq.Array(ids), pq.Array(counts), db.demandHalfLife.Seconds(), db.dormantAfter.Milliseconds())
+	return err
+}
+
+// readDemand is read score halved every half life since the last read, exponent is limited to avoid float underflow
+func readDemand(halfLifeParam string) string {
+	return `read_score * power(0.5, least(extract(epoch FROM now() - last_read_time)::float8 / ` + halfLifeParam + `, 1000))`
+}
+
+func (db *database) GetCachedFeed(email string, name string) (*CachedFeed, error) {
+	start := time.Now()
+
+	feed, err := db.getCachedFeed(email, name)
+
+	status := "ok"
 	if err != nil {
-		return err
+		status = "error"
 	}
-	return nil
+	db.histogram.WithLabelValues("get_cached_feed", status).Observe(time.Since(start).Seconds())
+
+	return feed, err
+}
+
+// getCachedFeed reads neither sources nor settings of rss, it is called on every read of feed
+func (db *database) getCachedFeed(email string, name string) (*CachedFeed, error) {
+	query := `SELECT id, cached_rss_gzip, cached_rss_br, coalesce(cached_rss, ''),
+		coalesce(extract(epoch FROM cached_valid_until - now()), 0)
+		FROM rss WHERE email=$1 and name=$2`
+
+	feed := &CachedFeed{}
+	var gzipped, brotlied []byte
+	var plain string
+	var seconds float64
+	err := db.db.QueryRow(query, email, name).Scan(&feed.ID, &gzipped, &brotlied, &plain, &seconds)
+	if err != nil {
+		return nil, err
+	}
+	feed.ValidFor = time.Duration(seconds * float64(time.Second))
+
+	switch {
+	case len(gzipped) > 0:
+		feed.Feed = &compress.Encoded{Gzip: gzipped, Brotli: brotlied}
+	case len(plain) > 0:
+		// feed cached before compression is compressed on read until it is cached again
+		feed.Feed, err = compress.Encode([]byte(plain))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return feed, nil
+}
+
+func (db *database) GetRss(email string, name string) (*Rss, error) {
+	start := time.Now()
+
+	rss, err := db.getRss(email, name)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("get_rss", status).Observe(time.Since(start).Seconds())
+
+	return rss, err
+}
+
+func (db *database) getRss(email string, name string) (*Rss, error) {
+	query := "SELECT " + rssColumns + " FROM rss WHERE email=$1 AND name=$2"
+	return scanRss(db.db.QueryRow(query, email, name))
+}
+
+func (db *database) GetSourceRss(source string) ([]*Rss, error) {
+	start := time.Now()
+
+	rss, err := db.getSourceRss(source)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("get_source_rss", status).Observe(time.Since(start).Seconds())
+
+	return rss, err
 }
 
-func (db *database) getNotLockedItems(batchSize int, now time.Time) ([]int64, error) {
-	query := "SELECT id FROM rss WHERE (not is_locked or locked_time < $1) and cached_valid_until < $2 LIMIT $3"
-	rows, err := db.db.Query(query, now.Add(-lockTimeout), now, batchSize)
+func (db *database) getSourceRss(source string) ([]*Rss, error) {
+	query := "SELECT " + rssColumns + " FROM rss WHERE $1=any(sources)"
+	rows, err := db.db.Query(query, source)
 	if err != nil {
 		return nil, err
 	}
 
 	defer rows.Close()
 
-	ids := make([]int64, 0)
+	items := make([]*Rss, 0)
 	for rows.Next() {
-		var id int64
-		if err = rows.Scan(&id); err != nil {
+		item, err := scanRss(rows)
+		if err != nil {
 			return nil, err
 		}
-		ids = append(ids, id)
+		items = append(items, item)
 	}
 
-	return ids, nil
+	return items, rows.Err()
 }
 
-func (db *database) lockItems(ids []int64, now time.Time) error {
-	query := "UPDATE rss SET is_locked=TRUE, locked_by=$1, locked_time=$2 WHERE (not is_locked or locked_time < $3) and id=any($4)"
-	_, err := db.db.Exec(query, db.serviceID, now, now.Add(-lockTimeout), pq.Array(ids))
+func (db *database) GetRssForIndex() ([]*Rss, error) {
+	start := time.Now()
+
+	rss, err := db.getRssForIndex()
+
+	status := "ok"
 	if err != nil {
-		return err
+		status = "error"
 	}
-	return nil
+	db.histogram.WithLabelValues("get_rss_for_index", status).Observe(time.Since(start).Seconds())
+
+	return rss, err
 }
 
-func (db *database) getLockedItems(ids []int64) ([]*Rss, error) {
-	query := "SELECT id, email, name, sources FROM rss WHERE is_locked and locked_by=$1 and id=any($2)"
-	rows, err := db.db.Query(query, db.serviceID, pq.Array(ids))
+func (db *database) getRssForIndex() ([]*Rss, error) {
+	query := "SELECT " + rssColumns + " FROM rss ORDER BY added_time desc"
+	rows, err := db.db.Query(query)
 	if err != nil {
 		return nil, err
 	}
 
 	defer rows.Close()
 
-	items := make([]*Rss, 0, len(ids))
+	items := make([]*Rss, 0)
 	for rows.Next() {
-		item := &Rss{}
-		if err = rows.Scan(&item.ID, &item.Email, &item.Name, pq.Array(&item.Sources)); err != nil {
+		item, err := scanRss(rows)
+		if err != nil {
 			return nil, err
 		}
 		items = append(items, item)
@@ -228,72 +799,432 @@ func (db *database) getLockedItems(ids []int64) ([]*Rss, error) {
 	return items, nil
 }
 
-func (db *database) GetCachedRss(email string, name string) (*RssCached, error) {
+func (db *database) SaveItems(items []*Item) error {
 	start := time.Now()
 
-	cachedRss, err := db.getCachedRss(email, name)
+	err := db.saveItems(items)
 
 	status := "ok"
 	if err != nil {
 		status = "error"
 	}
-	db.histogram.WithLabelValues("get_cached_rss", status).Observe(time.Since(start).Seconds())
+	db.histogram.WithLabelValues("save_items", status).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+func (db *database) saveItems(items []*Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	pruned, err := prunedHashes(tx, items)
+	if err != nil {
+		return err
+	}
+
+	// first seen time is kept, updated time changes only if item was changed in source
+	query := `INSERT INTO items (source, hash, guid, link, title, description, content, language, search_config, search_vector, published_time, data)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9::regconfig,
+			setweight(to_tsvector($9::regconfig, $5), 'A') || setweight(to_tsvector($9::regconfig, $7), 'B'), $10, $11)
+		ON CONFLICT (source, hash) DO UPDATE SET guid=excluded.guid, link=excluded.link, title=excluded.title, description=excluded.description,
+		content=excluded.content, language=excluded.language, search_config=excluded.search_config, search_vector=excluded.search_vector,
+		published_time=excluded.published_time, data=excluded.data, updated_time=now()
+		WHERE items.data IS DISTINCT FROM excluded.data`
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, item := range items {
+		if pruned[item.Source+"\n"+item.Hash] {
+			continue
+		}
 
-	return cachedRss, err
+		config := SearchConfig(item.Language, db.searchLanguage)
+		_, err = stmt.Exec(item.Source, item.Hash, item.Guid, item.Link, item.Title, item.Description, item.Content, item.Language,
+			config, item.PublishedTime, item.Data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
-func (db *database) getCachedRss(email string, name string) (*RssCached, error) {
-	query := "SELECT sources, cached_rss FROM rss WHERE email=$1 and name=$2"
-	row := db.db.QueryRow(query, email, name)
+// prunedHashes returns pruned items among items, they are keyed by source and hash
+func prunedHashes(tx *sql.Tx, items []*Item) (map[string]bool, error) {
+	sources := make([]string, 0, len(items))
+	hashes := make([]string, 0, len(items))
+	for _, item := range items {
+		sources = append(sources, item.Source)
+		hashes = append(hashes, item.Hash)
+	}
 
-	var rssFeed string
-	var sources []string
-	err := row.Scan(pq.Array(&sources), &rssFeed)
+	query := "SELECT source, hash FROM pruned_items WHERE (source, hash) IN (SELECT unnest($1::text[]), unnest($2::text[]))"
+	rows, err := tx.Query(query, pq.Array(sources), pq.Array(hashes))
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return &RssCached{
-		Rss: Rss{
-			Email:   email,
-			Name:    name,
-			Sources: sources,
-		},
-		RssFeed: rssFeed,
-	}, nil
+	pruned := make(map[string]bool)
+	for rows.Next() {
+		var source, hash string
+		if err = rows.Scan(&source, &hash); err != nil {
+			return nil, err
+		}
+		pruned[source+"\n"+hash] = true
+	}
+
+	return pruned, rows.Err()
 }
 
-func (db *database) GetRssForIndex() ([]*Rss, error) {
+func (db *database) GetItems(sources []string, limit int) ([]*Item, error) {
 	start := time.Now()
 
-	rss, err := db.getRssForIndex()
+	items, err := db.getItems(sources, limit)
 
 	status := "ok"
 	if err != nil {
 		status = "error"
 	}
-	db.histogram.WithLabelValues("get_rss_for_index", status).Observe(time.Since(start).Seconds())
+	db.histogram.WithLabelValues("get_items", status).Observe(time.Since(start).Seconds())
 
-	return rss, err
+	return items, err
 }
 
-func (db *database) getRssForIndex() ([]*Rss, error) {
-	query := "SELECT id, email, name, sources FROM rss ORDER BY added_time desc"
-	rows, err := db.db.Query(query)
+func (db *database) getItems(sources []string, limit int) ([]*Item, error) {
+	query := "SELECT " + itemColumns + " FROM items WHERE source=any($1) ORDER BY published_time desc nulls last, first_seen_time desc, id LIMIT $2"
+	rows, err := db.db.Query(query, pq.Array(sources), limit)
 	if err != nil {
 		return nil, err
 	}
 
 	defer rows.Close()
 
-	items := make([]*Rss, 0)
+	items := make([]*Item, 0, limit)
 	for rows.Next() {
-		item := &Rss{}
-		if err = rows.Scan(&item.ID, &item.Email, &item.Name, pq.Array(&item.Sources)); err != nil {
+		item, err := scanItem(rows)
+		if err != nil {
 			return nil, err
 		}
 		items = append(items, item)
 	}
 
-	return items, nil
+	return items, rows.Err()
+}
+
+func (db *database) GetItemSources() ([]string, error) {
+	start := time.Now()
+
+	sources, err := db.getItemSources()
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("get_item_sources", status).Observe(time.Since(start).Seconds())
+
+	return sources, err
+}
+
+func (db *database) getItemSources() ([]string, error) {
+	rows, err := db.db.Query("SELECT DISTINCT source FROM items")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	sources := make([]string, 0)
+	for rows.Next() {
+		var source string
+		if err = rows.Scan(&source); err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+
+	return sources, rows.Err()
+}
+
+func (db *database) PruneItems(source string, keepItems int, keepSince time.Time, batchSize int, archive func([]*Item) error) (int, error) {
+	start := time.Now()
+
+	count, err := db.pruneItems(source, keepItems, keepSince, batchSize, archive)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("prune_items", status).Observe(time.Since(start).Seconds())
+
+	return count, err
+}
+
+// pruneItems deletes one batch of not pinned items of source which are neither among keepItems newest
+// nor published after keepSince, items are deleted only if archive succeeded. Hashes of deleted items are kept,
+// otherwise items which are still in source would be stored again with new first seen time
+func (db *database) pruneItems(source string, keepItems int, keepSince time.Time, batchSize int, archive func([]*Item) error) (int, error) {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// locked rows are skipped, so instances don't prune and archive the same items
+	query := `SELECT ` + itemColumns + ` FROM items WHERE id IN (
+			SELECT id FROM (
+				SELECT id, pinned, published_time, first_seen_time,
+					row_number() OVER (ORDER BY published_time desc nulls last, first_seen_time desc, id) AS rank
+				FROM items WHERE source=$1
+			) ranked
+			WHERE not pinned and rank > $2 and coalesce(published_time, first_seen_time) < $3
+		) ORDER BY id LIMIT $4 FOR UPDATE SKIP LOCKED`
+	rows, err := tx.Query(query, source, keepItems, keepSince, batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	items := make([]*Item, 0, batchSize)
+	ids := make([]int64, 0, batchSize)
+	for rows.Next() {
+		item, err := scanItem(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		items = append(items, item)
+		ids = append(ids, item.ID)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(items) == 0 {
+		return 0, nil
+	}
+
+	if archive != nil {
+		if err = archive(items); err != nil {
+			return 0, err
+		}
+	}
+
+	query = `WITH deleted AS (DELETE FROM items WHERE id=any($1) RETURNING source, hash)
+		INSERT INTO pruned_items (source, hash) SELECT source, hash FROM deleted
+		ON CONFLICT (source, hash) DO UPDATE SET pruned_time=now()`
+	_, err = tx.Exec(query, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(items), tx.Commit()
+}
+
+func (db *database) ForgetPrunedItems() (int, error) {
+	start := time.Now()
+
+	count, err := db.forgetPrunedItems()
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("forget_pruned_items", status).Observe(time.Since(start).Seconds())
+
+	return count, err
+}
+
+func (db *database) forgetPrunedItems() (int, error) {
+	query := "DELETE FROM pruned_items WHERE source NOT IN (SELECT unnest(sources) FROM rss)"
+	result, err := db.db.Exec(query)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := result.RowsAffected()
+	return int(count), err
+}
+
+func (db *database) PinItem(email string, name string, item string, pinned bool) error {
+	start := time.Now()
+
+	err := db.pinItem(email, name, item, pinned)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("pin_item", status).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+// pinItem marks item by guid or link, only owners of rss with source of item may pin it
+func (db *database) pinItem(email string, name string, item string, pinned bool) error {
+	query := `UPDATE items SET pinned=$1 WHERE (guid=$2 or link=$2)
+		and source=any(SELECT unnest(sources) FROM rss WHERE email=$3 and name=$4)`
+	result, err := db.db.Exec(query, pinned, item, email, name)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (db *database) GetSourceStates(urls []string) (map[string]*SourceState, error) {
+	start := time.Now()
+
+	states, err := db.getSourceStates(urls)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("get_source_states", status).Observe(time.Since(start).Seconds())
+
+	return states, err
+}
+
+func (db *database) getSourceStates(urls []string) (map[string]*SourceState, error) {
+	query := `SELECT url, next_fetch_time, last_fetch_time, last_success_time, last_item_time, interval_seconds, failures,
+		last_error, skip_hours, skip_days, EXISTS (SELECT 1 FROM websub_subscriptions w WHERE w.source=sources.url
+			AND w.state='active' AND w.lease_expires_time > now())
+		FROM sources WHERE url=any($1)`
+	rows, err := db.db.Query(query, pq.Array(urls))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	states := make(map[string]*SourceState, len(urls))
+	for rows.Next() {
+		state := &SourceState{}
+		var intervalSeconds int64
+		err = rows.Scan(&state.Url, &state.NextFetchTime, &state.LastFetchTime, &state.LastSuccessTime, &state.LastItemTime,
+			&intervalSeconds, &state.Failures, &state.LastError, pq.Array(&state.SkipHours), pq.Array(&state.SkipDays),
+			&state.Pushed)
+		if err != nil {
+			return nil, err
+		}
+		state.Interval = time.Duration(intervalSeconds) * time.Second
+		states[state.Url] = state
+	}
+
+	return states, rows.Err()
+}
+
+func (db *database) SaveSourceStates(states []*SourceState) error {
+	start := time.Now()
+
+	err := db.saveSourceStates(states)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("save_source_states", status).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+func (db *database) saveSourceStates(states []*SourceState) error {
+	if len(states) == 0 {
+		return nil
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO sources (url, next_fetch_time, last_fetch_time, last_success_time, last_item_time, interval_seconds,
+			failures, last_error, skip_hours, skip_days)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (url) DO UPDATE SET next_fetch_time=excluded.next_fetch_time, last_fetch_time=excluded.last_fetch_time,
+		last_success_time=excluded.last_success_time, last_item_time=excluded.last_item_time,
+		interval_seconds=excluded.interval_seconds, failures=excluded.failures, last_error=excluded.last_error,
+		skip_hours=excluded.skip_hours, skip_days=excluded.skip_days`
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, state := range states {
+		_, err = stmt.Exec(state.Url, state.NextFetchTime, state.LastFetchTime, state.LastSuccessTime, state.LastItemTime,
+			int64(state.Interval.Seconds()), state.Failures, state.LastError, pq.Array(nonNilInts(state.SkipHours)),
+			pq.Array(nonNilStrings(state.SkipDays)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// getSources returns empty array for saved searches, since column is not nullable
+func getSources(rss *Rss) []string {
+	return nonNilStrings(rss.Sources)
+}
+
+// nonNilStrings is used for not nullable array columns, pq sends nil slice as null
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+
+	return values
+}
+
+func nonNilInts(values []int64) []int64 {
+	if values == nil {
+		return []int64{}
+	}
+
+	return values
+}
+
+func getMode(rss *Rss) string {
+	if len(rss.Mode) == 0 {
+		return ModeRss
+	}
+
+	return rss.Mode
+}
+
+// marshalJson returns string for jsonb column, since pq sends []byte as bytea, and nil for null
+func marshalJson(value interface{}) (interface{}, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if string(raw) == "null" {
+		return nil, nil
+	}
+
+	return string(raw), nil
 }
@@ -0,0 +1,318 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// Digest is email digest of rss, items first seen after last sent time are new
+type Digest struct {
+	ID           int64
+	Rss          *Rss
+	Recipient    string
+	Frequency    string
+	TimeZone     string
+	MaxItems     int
+	LastSentTime time.Time
+	NextSendTime time.Time
+	Attempts     int
+	LastError    string
+	CreatedTime  time.Time
+	// UnsubscribeToken is secret of unsubscribe link sent with digest
+	UnsubscribeToken string
+	// LeasedTime is db time of lease, items first seen before it are sent by leased digest
+	LeasedTime time.Time
+}
+
+func (db *database) CreateDigest(email string, name string, digest *Digest) error {
+	start := time.Now()
+
+	err := db.createDigest(email, name, digest)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("create_digest", status).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+// createDigest returns sql.ErrNoRows if owner has no such rss, items seen before creation are not sent
+func (db *database) createDigest(email string, name string, digest *Digest) error {
+	query := `INSERT INTO digests (rss_id, recipient, frequency, time_zone, max_items, next_send_time, unsubscribe_token)
+		SELECT id, $3, $4, $5, $6, $7, $8 FROM rss WHERE email=$1 AND name=$2
+		RETURNING id, last_sent_time, created_time`
+	return db.db.QueryRow(query, email, name, digest.Recipient, digest.Frequency, digest.TimeZone, digest.MaxItems, digest.NextSendTime,
+		digest.UnsubscribeToken).Scan(&digest.ID, &digest.LastSentTime, &digest.CreatedTime)
+}
+
+func (db *database) GetDigests(email string) ([]*Digest, error) {
+	start := time.Now()
+
+	digests, err := db.getDigests(email)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("get_digests", status).Observe(time.Since(start).Seconds())
+
+	return digests, err
+}
+
+func (db *database) getDigests(email string) ([]*Digest, error) {
+	query := `SELECT ` + prefixed("rss", rssColumns) + `, d.id, d.recipient, d.frequency, d.time_zone, d.max_items,
+			d.last_sent_time, d.next_send_time, d.attempts, d.last_error, d.created_time
+		FROM digests d JOIN rss ON rss.id=d.rss_id WHERE rss.email=$1 OR lower(d.recipient)=lower($1) ORDER BY d.id`
+	rows, err := db.db.Query(query, email)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	digests := make([]*Digest, 0)
+	for rows.Next() {
+		digest := &Digest{}
+		digest.Rss, err = scanRss(rows, &digest.ID, &digest.Recipient, &digest.Frequency, &digest.TimeZone, &digest.MaxItems,
+			&digest.LastSentTime, &digest.NextSendTime, &digest.Attempts, &digest.LastError, &digest.CreatedTime)
+		if err != nil {
+			return nil, err
+		}
+		digests = append(digests, digest)
+	}
+
+	return digests, rows.Err()
+}
+
+func (db *database) DeleteDigest(email string, id int64) error {
+	start := time.Now()
+
+	err := db.deleteDigest(email, id)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("delete_digest", status).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+// deleteDigest returns sql.ErrNoRows if digest is neither of rss of email nor sent to email
+func (db *database) deleteDigest(email string, id int64) error {
+	query := `DELETE FROM digests d USING rss WHERE rss.id=d.rss_id AND d.id=$1 AND (rss.email=$2 OR lower(d.recipient)=lower($2))`
+	result, err := db.db.Exec(query, id, email)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (db *database) UnsubscribeDigest(id int64, token string) error {
+	start := time.Now()
+
+	err := db.unsubscribeDigest(id, token)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("unsubscribe_digest", status).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+// unsubscribeDigest returns sql.ErrNoRows if there is no digest with such token
+func (db *database) unsubscribeDigest(id int64, token string) error {
+	query := `DELETE FROM digests WHERE id=$1 AND unsubscribe_token=$2 AND unsubscribe_token<>''`
+	result, err := db.db.Exec(query, id, token)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (db *database) LeaseDigests(batchSize int, lease time.Duration) ([]*Digest, error) {
+	start := time.Now()
+
+	digests, err := db.leaseDigests(batchSize, lease)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("lease_digests", status).Observe(time.Since(start).Seconds())
+
+	return digests, err
+}
+
+// leaseDigests postpones the next sending by lease, so digest is retried if replica fails while sending
+func (db *database) leaseDigests(batchSize int, lease time.Duration) ([]*Digest, error) {
+	query := `UPDATE digests d SET next_send_time=now() + $1 * interval '1 millisecond', attempts=d.attempts + 1
+		FROM rss
+		WHERE rss.id=d.rss_id AND d.id IN (
+			SELECT id FROM digests WHERE next_send_time <= now()
+			ORDER BY next_send_time LIMIT $2 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + prefixed("rss", rssColumns) + `, d.id, d.recipient, d.frequency, d.time_zone, d.max_items,
+			d.last_sent_time, d.attempts, d.last_error, d.created_time, d.unsubscribe_token, now()`
+	rows, err := db.db.Query(query, lease.Milliseconds(), batchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	digests := make([]*Digest, 0, batchSize)
+	for rows.Next() {
+		digest := &Digest{}
+		digest.Rss, err = scanRss(rows, &digest.ID, &digest.Recipient, &digest.Frequency, &digest.TimeZone, &digest.MaxItems,
+			&digest.LastSentTime, &digest.Attempts, &digest.LastError, &digest.CreatedTime, &digest.UnsubscribeToken, &digest.LeasedTime)
+		if err != nil {
+			return nil, err
+		}
+		digests = append(digests, digest)
+	}
+
+	return digests, rows.Err()
+}
+
+func (db *database) GetDigestItems(digest *Digest, limit int) ([]*Item, error) {
+	start := time.Now()
+
+	items, err := db.getDigestItems(digest, limit)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("get_digest_items", status).Observe(time.Since(start).Seconds())
+
+	return items, err
+}
+
+// getDigestItems returns the newest items first seen between last sending and lease of digest, which were not sent by it.
+// Items of saved search are searched in sources of its feeds, items of nested rss are searched in their sources
+func (db *database) getDigestItems(digest *Digest, limit int) ([]*Item, error) {
+	var text string
+	names := []string{digest.Rss.Name}
+	if digest.Rss.Search != nil {
+		text = websearchText(digest.Rss.Search.Query)
+		names = append(names, digest.Rss.Search.Feeds...)
+	}
+
+	query := `SELECT ` + prefixed("i", itemColumns) + ` FROM items i
+		WHERE i.source=any(` + scopedSources("$1", "$2") + `)
+			and i.first_seen_time > $3 and i.first_seen_time <= $4
+			and ($5 = '' or i.search_vector @@ websearch_to_tsquery($6::regconfig, $5))
+			and NOT EXISTS (SELECT 1 FROM digest_items d WHERE d.digest_id=$7 and d.item_id=i.id)
+		ORDER BY i.published_time desc nulls last, i.first_seen_time desc, i.id
+		LIMIT $8`
+	rows, err := db.db.Query(query, digest.Rss.Email, pq.Array(names),
+		digest.LastSentTime, digest.LeasedTime, text, SearchConfig("", db.searchLanguage), digest.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	items := make([]*Item, 0, limit)
+	for rows.Next() {
+		item, err := scanItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+func (db *database) FinishDigest(digest *Digest, itemIDs []int64, nextSendTime time.Time) error {
+	start := time.Now()
+
+	err := db.finishDigest(digest, itemIDs, nextSendTime)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("finish_digest", status).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+// finishDigest saves sent items together with lease time as last sent time, so items are sent once
+func (db *database) finishDigest(digest *Digest, itemIDs []int64, nextSendTime time.Time) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if len(itemIDs) > 0 {
+		query := `INSERT INTO digest_items (digest_id, item_id) SELECT $1, unnest($2::bigint[]) ON CONFLICT DO NOTHING`
+		_, err = tx.Exec(query, digest.ID, pq.Array(itemIDs))
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `UPDATE digests SET last_sent_time=$1, next_send_time=$2, attempts=0, last_error='' WHERE id=$3`
+	_, err = tx.Exec(query, digest.LeasedTime, nextSendTime, digest.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *database) FailDigest(id int64, lastError string, nextSendTime time.Time, attempts int) error {
+	start := time.Now()
+
+	err := db.failDigest(id, lastError, nextSendTime, attempts)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("fail_digest", status).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+// failDigest keeps last sent time, so items of failed digest are sent by the next one
+func (db *database) failDigest(id int64, lastError string, nextSendTime time.Time, attempts int) error {
+	query := `UPDATE digests SET last_error=$1, next_send_time=$2, attempts=$3 WHERE id=$4`
+	_, err := db.db.Exec(query, lastError, nextSendTime, attempts, id)
+	return err
+}
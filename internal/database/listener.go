@@ -0,0 +1,172 @@
+//go:generate mockgen -package ${GOPACKAGE} -destination mock_listener.go -source listener.go
+package database
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"service-rss/internal/config"
+)
+
+const (
+	refreshChannel = "rss_refresh"
+	cachedChannel  = "rss_cached"
+	touchedChannel = "rss_touched"
+
+	// invalidations are dropped when nobody reads them for a while, feeds are kept in memory for limited time anyway
+	invalidationsBufferSize = 1024
+
+	listenerMinReconnect = 1 * time.Second
+	listenerMaxReconnect = 1 * time.Minute
+	listenerPingPeriod   = 90 * time.Second
+)
+
+type RefreshListener interface {
+	// Refresh receives when rss should be cached right away, notifications are coalesced
+	Refresh() <-chan struct{}
+	// Invalidated receives email and name of rss joined by slash when its feed is cached again,
+	// empty key means that notifications could be lost and all feeds should be invalidated
+	Invalidated() <-chan string
+	// Cached receives the same keys as Invalidated for cacher, which lets waiters of rss leased by others go
+	Cached() <-chan string
+	// Touched receives rss which are cached again without changes, so copies of their feeds are valid for longer
+	Touched() <-chan Touch
+	Close() error
+}
+
+// Touch is new validity of feed which is not changed, key is the same as in invalidations
+type Touch struct {
+	Key      string
+	ValidFor time.Duration
+}
+
+type refreshListener struct {
+	listener        *pq.Listener
+	refreshChan     chan struct{}
+	invalidatedChan chan string
+	cachedChan      chan string
+	touchedChan     chan Touch
+	closeChan       chan interface{}
+}
+
+// NewRefreshListener listens to notifications sent by rss trigger on every replica
+func NewRefreshListener(cfg *config.Config) (RefreshListener, error) {
+	listener := pq.NewListener(connectionSettings(cfg), listenerMinReconnect, listenerMaxReconnect,
+		func(event pq.ListenerEventType, err error) {
+			if err != nil {
+				log.WithError(err).WithField("event", event).Warn("refresh listener connection event")
+			}
+		})
+
+	for _, channel := range []string{refreshChannel, cachedChannel, touchedChannel} {
+		err := listener.Listen(channel)
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+
+	l := &refreshListener{
+		listener:        listener,
+		refreshChan:     make(chan struct{}, 1),
+		invalidatedChan: make(chan string, invalidationsBufferSize),
+		cachedChan:      make(chan string, invalidationsBufferSize),
+		touchedChan:     make(chan Touch, invalidationsBufferSize),
+		closeChan:       make(chan interface{}),
+	}
+	go l.forward()
+
+	return l, nil
+}
+
+func (l *refreshListener) Refresh() <-chan struct{} {
+	return l.refreshChan
+}
+
+func (l *refreshListener) Invalidated() <-chan string {
+	return l.invalidatedChan
+}
+
+func (l *refreshListener) Cached() <-chan string {
+	return l.cachedChan
+}
+
+func (l *refreshListener) Touched() <-chan Touch {
+	return l.touchedChan
+}
+
+func (l *refreshListener) Close() error {
+	close(l.closeChan)
+	return l.listener.Close()
+}
+
+func (l *refreshListener) forward() {
+	ticker := time.NewTicker(listenerPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.closeChan:
+			return
+		// nil notification is sent after reconnect, notifications could be lost meanwhile, so it wakes cacher too
+		case notification := <-l.listener.Notify:
+			if notification == nil || notification.Channel == refreshChannel {
+				select {
+				case l.refreshChan <- struct{}{}:
+				default:
+				}
+			}
+			if notification == nil || notification.Channel == cachedChannel {
+				key := ""
+				if notification != nil {
+					key = notification.Extra
+				}
+				for _, ch := range []chan string{l.invalidatedChan, l.cachedChan} {
+					select {
+					case ch <- key:
+					default:
+					}
+				}
+			}
+			// lost touches are not resent after reconnect, feeds are revalidated once they are outdated anyway
+			if notification != nil && notification.Channel == touchedChannel {
+				touch, err := parseTouch(notification.Extra)
+				if err != nil {
+					log.WithError(err).WithField("payload", notification.Extra).Warn("malformed touch notification")
+					continue
+				}
+				select {
+				case l.touchedChan <- touch:
+				default:
+				}
+			}
+		// ping detects broken connection when there are no notifications for a long time
+		case <-ticker.C:
+			go func() {
+				if err := l.listener.Ping(); err != nil {
+					log.WithError(err).Warn("failed to ping refresh listener")
+				}
+			}()
+		}
+	}
+}
+
+// parseTouch reads milliseconds of validity and key separated by space
+func parseTouch(payload string) (Touch, error) {
+	parts := strings.SplitN(payload, " ", 2)
+	if len(parts) != 2 {
+		return Touch{}, errors.New("no key in touch notification")
+	}
+
+	millis, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return Touch{}, err
+	}
+
+	return Touch{Key: parts[1], ValidFor: time.Duration(millis) * time.Millisecond}, nil
+}
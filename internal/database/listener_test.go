@@ -0,0 +1,24 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTouch(t *testing.T) {
+	touch, err := parseTouch("90000 example@gmail.com/Go news")
+	assert.NoError(t, err)
+	assert.Equal(t, Touch{Key: "example@gmail.com/Go news", ValidFor: 90 * time.Second}, touch)
+
+	// feed which is outdated already is touched with negative validity
+	touch, err = parseTouch("-1000 example@gmail.com/one")
+	assert.NoError(t, err)
+	assert.Equal(t, -time.Second, touch.ValidFor)
+
+	for _, malformed := range []string{"", "90000", "soon example@gmail.com/one"} {
+		_, err = parseTouch(malformed)
+		assert.Error(t, err, malformed)
+	}
+}
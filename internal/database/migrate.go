@@ -0,0 +1,289 @@
+//go:generate mockgen -package ${GOPACKAGE} -destination mock_migrate.go -source migrate.go
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+
+	"service-rss/internal/config"
+)
+
+const (
+	// migrationsLockKey is key of postgres advisory lock, so replicas started together apply migrations once
+	migrationsLockKey = 7_305_184_221
+
+	createSchemaMigrations = `create table if not exists schema_migrations
+(
+    version      bigint primary key,
+    name         text      not null,
+    applied_time timestamp not null default now()
+)`
+)
+
+var (
+	//go:embed migrations/*.sql
+	migrationsFS embed.FS
+
+	migrationFileRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+)
+
+type Migrator interface {
+	// Up applies all pending migrations
+	Up() error
+	// Down reverts the given number of the latest applied migrations
+	Down(steps int) error
+	Status() ([]*MigrationStatus, error)
+	Close() error
+}
+
+type MigrationStatus struct {
+	Version int64
+	Name    string
+	Applied bool
+}
+
+type migration struct {
+	version int64
+	name    string
+	up      string
+	down    string
+}
+
+type migrator struct {
+	db         *sql.DB
+	migrations []*migration
+}
+
+func NewMigrator(cfg *config.Config) (Migrator, error) {
+	db, err := open(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := loadMigrations(migrationsFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	return &migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+func (m *migrator) Close() error {
+	return m.db.Close()
+}
+
+func (m *migrator) Up() error {
+	return m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if applied[mig.version] {
+				continue
+			}
+
+			query := "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)"
+			err = inTx(ctx, conn, mig.up, query, mig.version, mig.name)
+			if err != nil {
+				return fmt.Errorf("apply migration %d_%s: %w", mig.version, mig.name, err)
+			}
+
+			log.WithField("version", mig.version).WithField("name", mig.name).Info("migration was applied")
+		}
+
+		return nil
+	})
+}
+
+func (m *migrator) Down(steps int) error {
+	return m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			mig := m.migrations[i]
+			if !applied[mig.version] {
+				continue
+			}
+
+			query := "DELETE FROM schema_migrations WHERE version=$1"
+			err = inTx(ctx, conn, mig.down, query, mig.version)
+			if err != nil {
+				return fmt.Errorf("revert migration %d_%s: %w", mig.version, mig.name, err)
+			}
+
+			log.WithField("version", mig.version).WithField("name", mig.name).Info("migration was reverted")
+			steps--
+		}
+
+		return nil
+	})
+}
+
+func (m *migrator) Status() ([]*MigrationStatus, error) {
+	statuses := make([]*MigrationStatus, 0, len(m.migrations))
+
+	err := m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			statuses = append(statuses, &MigrationStatus{
+				Version: mig.version,
+				Name:    mig.name,
+				Applied: applied[mig.version],
+			})
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// withLock holds session advisory lock, so all statements run on one connection
+func (m *migrator) withLock(f func(ctx context.Context, conn *sql.Conn) error) error {
+	ctx := context.Background()
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationsLockKey)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationsLockKey)
+		if err != nil {
+			log.WithError(err).Error("failed to release migrations lock")
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, createSchemaMigrations)
+	if err != nil {
+		return err
+	}
+
+	return f(ctx, conn)
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]bool, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	applied := make(map[int64]bool)
+	for rows.Next() {
+		var version int64
+		if err = rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
+
+// inTx runs migration script and bookkeeping query in one transaction, failed migration leaves no changes
+func inTx(ctx context.Context, conn *sql.Conn, script string, query string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// script is sent without arguments, so it may contain several statements
+	_, err = tx.ExecContext(ctx, script)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// loadMigrations reads pairs of NNNN_name.up.sql and NNNN_name.down.sql ordered by version
+func loadMigrations(fsys fs.FS, dir string) ([]*migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*migration)
+	for _, entry := range entries {
+		match := migrationFileRegexp.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %s", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		script, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &migration{version: version, name: match[2]}
+			byVersion[version] = mig
+		}
+
+		if mig.name != match[2] {
+			return nil, fmt.Errorf("migration %d has different names %s and %s", version, mig.name, match[2])
+		}
+
+		if match[3] == "up" {
+			mig.up = string(script)
+		} else {
+			mig.down = string(script)
+		}
+	}
+
+	migrations := make([]*migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if len(mig.up) == 0 || len(mig.down) == 0 {
+			return nil, fmt.Errorf("migration %d_%s should have both up and down scripts", mig.version, mig.name)
+		}
+		migrations = append(migrations, mig)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+
+	return migrations, nil
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"database/sql"
+	"os"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationsFS, "migrations")
+	assert.NoError(t, err)
+
+	for i, mig := range migrations {
+		assert.Equal(t, int64(i+1), mig.version)
+		assert.NotEmpty(t, mig.up)
+		assert.NotEmpty(t, mig.down)
+	}
+
+	t.Run("ordered by version", func(t *testing.T) {
+		migrations, err := loadMigrations(fstest.MapFS{
+			"m/0010_b.up.sql":   {Data: []byte("b")},
+			"m/0010_b.down.sql": {Data: []byte("b")},
+			"m/0002_a.up.sql":   {Data: []byte("a")},
+			"m/0002_a.down.sql": {Data: []byte("a")},
+		}, "m")
+		assert.NoError(t, err)
+		if assert.Len(t, migrations, 2) {
+			assert.Equal(t, "a", migrations[0].name)
+			assert.Equal(t, "b", migrations[1].name)
+		}
+	})
+
+	t.Run("without down", func(t *testing.T) {
+		_, err := loadMigrations(fstest.MapFS{"m/0001_a.up.sql": {Data: []byte("a")}}, "m")
+		assert.Error(t, err)
+	})
+
+	t.Run("malformed name", func(t *testing.T) {
+		_, err := loadMigrations(fstest.MapFS{"m/a.sql": {Data: []byte("a")}}, "m")
+		assert.Error(t, err)
+	})
+
+	t.Run("different names", func(t *testing.T) {
+		_, err := loadMigrations(fstest.MapFS{
+			"m/0001_a.up.sql":   {Data: []byte("a")},
+			"m/0001_b.down.sql": {Data: []byte("b")},
+		}, "m")
+		assert.Error(t, err)
+	})
+}
+
+// TestMigrator_Postgres runs against ephemeral postgres started by db/scripts/test-migrations.sh
+func TestMigrator_Postgres(t *testing.T) {
+	dsn := os.Getenv("RSS_TEST_DB_DSN")
+	if len(dsn) == 0 {
+		t.Skip("RSS_TEST_DB_DSN is not set")
+	}
+
+	newMigrator := func() *migrator {
+		db, err := sql.Open("postgres", dsn)
+		assert.NoError(t, err)
+
+		migrations, err := loadMigrations(migrationsFS, "migrations")
+		assert.NoError(t, err)
+
+		return &migrator{db: db, migrations: migrations}
+	}
+
+	m := newMigrator()
+	defer m.Close()
+
+	tableExists := func(table string) bool {
+		var name sql.NullString
+		err := m.db.QueryRow("SELECT to_regclass($1)::text", table).Scan(&name)
+		assert.NoError(t, err)
+		return name.Valid
+	}
+
+	appliedCount := func() int {
+		var count int
+		err := m.db.QueryRow("SELECT count(*) FROM schema_migrations").Scan(&count)
+		assert.NoError(t, err)
+		return count
+	}
+
+	t.Run("up", func(t *testing.T) {
+		assert.NoError(t, m.Up())
+		assert.NoError(t, m.Up())
+
+		assert.True(t, tableExists("rss"))
+		assert.True(t, tableExists("items"))
+		assert.Equal(t, len(m.migrations), appliedCount())
+
+		statuses, err := m.Status()
+		assert.NoError(t, err)
+		for _, status := range statuses {
+			assert.True(t, status.Applied)
+		}
+	})
+
+	t.Run("down", func(t *testing.T) {
+		assert.NoError(t, m.Down(1))
+		assert.Equal(t, len(m.migrations)-1, appliedCount())
+
+		assert.NoError(t, m.Down(len(m.migrations)))
+		assert.Equal(t, 0, appliedCount())
+		assert.False(t, tableExists("rss"))
+		assert.False(t, tableExists("items"))
+	})
+
+	t.Run("replicas migrate concurrently", func(t *testing.T) {
+		var wg sync.WaitGroup
+		errs := make(chan error, 3)
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				replica := newMigrator()
+				defer replica.Close()
+
+				errs <- replica.Up()
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, len(m.migrations), appliedCount())
+	})
+}
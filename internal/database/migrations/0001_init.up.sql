@@ -16,4 +16,4 @@ create table if not exists rss
 
 create index if not exists cached_valid_until_idx ON rss (cached_valid_until);
 
-create unique index if not exists email_name_idx ON rss (email, name);
\ No newline at end of file
+create unique index if not exists email_name_idx ON rss (email, name);
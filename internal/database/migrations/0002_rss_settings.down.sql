@@ -0,0 +1,3 @@
+alter table rss drop column if exists podcast;
+alter table rss drop column if exists channel;
+alter table rss drop column if exists mode;
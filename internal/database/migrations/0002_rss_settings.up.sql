@@ -0,0 +1,3 @@
+alter table rss add column if not exists mode text not null default 'rss';
+alter table rss add column if not exists channel jsonb;
+alter table rss add column if not exists podcast jsonb;
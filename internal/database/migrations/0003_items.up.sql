@@ -0,0 +1,18 @@
+create table if not exists items
+(
+    id              bigserial primary key,
+    source          text      not null,
+    hash            text      not null,
+    guid            text      not null default '',
+    link            text      not null default '',
+    title           text      not null default '',
+    description     text      not null default '',
+    published_time  timestamp,
+    data            jsonb     not null,
+    first_seen_time timestamp not null default now(),
+    updated_time    timestamp not null default now()
+);
+
+create unique index if not exists items_source_hash_idx ON items (source, hash);
+
+create index if not exists items_source_published_time_idx ON items (source, published_time desc nulls last);
@@ -0,0 +1,2 @@
+alter table items drop column if exists pinned;
+alter table rss drop column if exists retention;
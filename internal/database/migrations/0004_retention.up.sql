@@ -0,0 +1,2 @@
+alter table rss add column if not exists retention jsonb;
+alter table items add column if not exists pinned bool not null default false;
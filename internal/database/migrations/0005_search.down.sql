@@ -0,0 +1,6 @@
+drop index if exists items_search_vector_idx;
+
+alter table items drop column if exists search_vector;
+alter table items drop column if exists search_config;
+alter table items drop column if exists language;
+alter table items drop column if exists content;
@@ -0,0 +1,6 @@
+alter table items add column if not exists content text not null default '';
+alter table items add column if not exists language text not null default '';
+alter table items add column if not exists search_config regconfig not null default 'simple';
+alter table items add column if not exists search_vector tsvector;
+
+create index if not exists items_search_vector_idx ON items USING gin (search_vector);
@@ -0,0 +1 @@
+alter table rss drop column if exists search;
@@ -0,0 +1 @@
+alter table rss add column if not exists search jsonb;
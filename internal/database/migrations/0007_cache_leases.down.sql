@@ -0,0 +1,7 @@
+alter table rss add column if not exists is_locked bool default false;
+alter table rss add column if not exists locked_by text;
+alter table rss add column if not exists locked_time timestamp;
+
+alter table rss drop column if exists lease_expires_time;
+alter table rss drop column if exists leased_time;
+alter table rss drop column if exists lease_owner;
@@ -0,0 +1,7 @@
+alter table rss add column if not exists lease_owner text;
+alter table rss add column if not exists leased_time timestamp;
+alter table rss add column if not exists lease_expires_time timestamp;
+
+alter table rss drop column if exists is_locked;
+alter table rss drop column if exists locked_by;
+alter table rss drop column if exists locked_time;
@@ -0,0 +1,17 @@
+create or replace function notify_rss_refresh() returns trigger as
+$$
+begin
+    perform pg_notify('rss_refresh', new.id::text);
+    return new;
+end;
+$$ language plpgsql;
+
+drop trigger if exists rss_refresh_trigger on rss;
+
+-- rss is outdated on create, update and forced refresh, cacher saves future validity only
+create trigger rss_refresh_trigger
+    after insert or update of cached_valid_until
+    on rss
+    for each row
+    when (new.cached_valid_until <= now())
+execute function notify_rss_refresh();
@@ -0,0 +1,13 @@
+create table if not exists sources
+(
+    url               text primary key,
+    next_fetch_time   timestamp not null default now(),
+    last_fetch_time   timestamp,
+    last_success_time timestamp,
+    last_item_time    timestamp,
+    interval_seconds  bigint    not null default 0,
+    failures          int       not null default 0,
+    last_error        text      not null default '',
+    skip_hours        bigint[]  not null default '{}',
+    skip_days         text[]    not null default '{}'
+);
@@ -0,0 +1,2 @@
+alter table rss drop column if exists read_score;
+alter table rss drop column if exists last_read_time;
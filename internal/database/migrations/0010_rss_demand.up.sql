@@ -0,0 +1,3 @@
+-- existing rss are considered read at migration, so none of them is demoted at once
+alter table rss add column if not exists last_read_time timestamp not null default now();
+alter table rss add column if not exists read_score double precision not null default 0;
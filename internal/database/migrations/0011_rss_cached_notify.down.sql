@@ -0,0 +1,3 @@
+drop trigger if exists rss_cached_trigger on rss;
+
+drop function if exists notify_rss_cached();
@@ -0,0 +1,16 @@
+create or replace function notify_rss_cached() returns trigger as
+$$
+begin
+    perform pg_notify('rss_cached', new.email || '/' || new.name);
+    return new;
+end;
+$$ language plpgsql;
+
+drop trigger if exists rss_cached_trigger on rss;
+
+-- replicas drop copies of feed kept in memory when feed is cached again
+create trigger rss_cached_trigger
+    after update of cached_rss
+    on rss
+    for each row
+execute function notify_rss_cached();
@@ -0,0 +1,13 @@
+drop trigger if exists rss_cached_trigger on rss;
+
+create trigger rss_cached_trigger
+    after update of cached_rss
+    on rss
+    for each row
+execute function notify_rss_cached();
+
+-- compressed feeds are lost, so they are cached again soon
+update rss set cached_valid_until = least(cached_valid_until, now()) where cached_rss_gzip is not null;
+
+alter table rss drop column if exists cached_rss_br;
+alter table rss drop column if exists cached_rss_gzip;
@@ -0,0 +1,11 @@
+-- feeds are stored compressed, plain feeds cached before are served until they are cached again
+alter table rss add column if not exists cached_rss_gzip bytea;
+alter table rss add column if not exists cached_rss_br bytea;
+
+drop trigger if exists rss_cached_trigger on rss;
+
+create trigger rss_cached_trigger
+    after update of cached_rss, cached_rss_gzip
+    on rss
+    for each row
+execute function notify_rss_cached();
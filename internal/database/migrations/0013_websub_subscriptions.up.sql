@@ -0,0 +1,19 @@
+-- subscriptions to websub hubs advertised by sources, they are renewed before lease expires
+create table if not exists websub_subscriptions
+(
+    id                 bigserial primary key,
+    source             text      not null,
+    hub                text      not null,
+    topic              text      not null,
+    secret             text      not null,
+    state              text      not null default 'pending',
+    lease_expires_time timestamp,
+    next_attempt_time  timestamp not null default now(),
+    attempts           int       not null default 0,
+    last_error         text      not null default '',
+    updated_time       timestamp not null default now()
+);
+
+create unique index if not exists websub_subscriptions_source_idx ON websub_subscriptions (source);
+
+create index if not exists websub_subscriptions_next_attempt_time_idx ON websub_subscriptions (next_attempt_time);
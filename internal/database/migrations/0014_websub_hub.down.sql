@@ -0,0 +1,3 @@
+drop table if exists websub_hub_subscriptions;
+
+alter table rss drop column if exists cached_rss_hash;
@@ -0,0 +1,19 @@
+-- hash of cached feed without build date, subscribers are pushed only when it changes
+alter table rss add column if not exists cached_rss_hash text;
+
+-- subscribers of our own feeds, pending push is retried until next push time is cleared
+create table if not exists websub_hub_subscriptions
+(
+    id                 bigserial primary key,
+    rss_id             int       not null references rss (id) on delete cascade,
+    callback           text      not null,
+    secret             text      not null default '',
+    lease_expires_time timestamp not null,
+    next_push_time     timestamp,
+    push_attempts      int       not null default 0,
+    created_time       timestamp not null default now()
+);
+
+create unique index if not exists websub_hub_subscriptions_rss_callback_idx ON websub_hub_subscriptions (rss_id, callback);
+
+create index if not exists websub_hub_subscriptions_next_push_time_idx ON websub_hub_subscriptions (next_push_time);
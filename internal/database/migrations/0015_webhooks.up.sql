@@ -0,0 +1,35 @@
+-- webhooks of rss, seen items are hashes of items of the last notified feed, they are null until the first feed is seen
+create table if not exists webhooks
+(
+    id           bigserial primary key,
+    rss_id       int       not null references rss (id) on delete cascade,
+    url          text      not null,
+    secret       text      not null,
+    template     text      not null,
+    seen_items   text[],
+    created_time timestamp not null default now()
+);
+
+create index if not exists webhooks_rss_id_idx ON webhooks (rss_id);
+
+-- deliveries are log of webhook, dead ones are kept as dead letters until owner redelivers them
+create table if not exists webhook_deliveries
+(
+    id                bigserial primary key,
+    webhook_id        bigint    not null references webhooks (id) on delete cascade,
+    item              text      not null,
+    payload           text      not null,
+    state             text      not null default 'pending',
+    attempts          int       not null default 0,
+    next_attempt_time timestamp not null default now(),
+    status_code       int       not null default 0,
+    last_error        text      not null default '',
+    created_time      timestamp not null default now(),
+    updated_time      timestamp not null default now()
+);
+
+create index if not exists webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id, id);
+
+create index if not exists webhook_deliveries_next_attempt_time_idx ON webhook_deliveries (next_attempt_time) WHERE state = 'pending';
+
+create index if not exists webhook_deliveries_updated_time_idx ON webhook_deliveries (updated_time);
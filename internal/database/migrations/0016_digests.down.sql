@@ -0,0 +1,3 @@
+drop table if exists digest_items;
+
+drop table if exists digests;
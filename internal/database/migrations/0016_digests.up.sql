@@ -0,0 +1,30 @@
+-- email digests of rss, items first seen after last sent time are new for the next digest
+create table if not exists digests
+(
+    id             bigserial primary key,
+    rss_id         int       not null references rss (id) on delete cascade,
+    recipient      text      not null,
+    frequency      text      not null,
+    time_zone      text      not null,
+    max_items      int       not null,
+    last_sent_time timestamp not null default now(),
+    next_send_time timestamp not null,
+    attempts       int       not null default 0,
+    last_error     text      not null default '',
+    created_time   timestamp not null default now()
+);
+
+create index if not exists digests_rss_id_idx ON digests (rss_id);
+
+create index if not exists digests_next_send_time_idx ON digests (next_send_time);
+
+-- items sent by digest, they are never sent by it again
+create table if not exists digest_items
+(
+    digest_id bigint    not null references digests (id) on delete cascade,
+    item_id   bigint    not null references items (id) on delete cascade,
+    sent_time timestamp not null default now(),
+    primary key (digest_id, item_id)
+);
+
+create index if not exists digest_items_item_id_idx ON digest_items (item_id);
@@ -0,0 +1,11 @@
+-- inbound addresses of rss, emails sent to token address are stored as items of newsletter source
+create table if not exists newsletters
+(
+    id           bigserial primary key,
+    rss_id       int       not null references rss (id) on delete cascade,
+    token        text      not null unique,
+    source       text      not null,
+    created_time timestamp not null default now()
+);
+
+create index if not exists newsletters_rss_id_idx ON newsletters (rss_id);
@@ -0,0 +1,5 @@
+update rss
+set podcast = podcast || jsonb_build_object('language', channel ->> 'language')
+where mode = 'podcast'
+  and podcast is not null
+  and channel ? 'language';
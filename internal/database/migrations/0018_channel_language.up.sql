@@ -0,0 +1,9 @@
+-- language of podcast settings moved to channel settings, channel language wins if both are set
+update rss
+set channel = coalesce(channel, '{}'::jsonb) || jsonb_build_object('language', podcast ->> 'language')
+where podcast ? 'language'
+  and coalesce(channel ->> 'language', '') = '';
+
+update rss
+set podcast = podcast - 'language'
+where podcast ? 'language';
@@ -0,0 +1,7 @@
+drop trigger if exists rss_cached_trigger on rss;
+
+create trigger rss_cached_trigger
+    after update of cached_rss, cached_rss_gzip
+    on rss
+    for each row
+execute function notify_rss_cached();
@@ -0,0 +1,9 @@
+drop trigger if exists rss_cached_trigger on rss;
+
+-- hash is written on every save, replicas are notified only when content of feed is changed
+create trigger rss_cached_trigger
+    after update of cached_rss_hash
+    on rss
+    for each row
+    when (old.cached_rss_hash is distinct from new.cached_rss_hash)
+execute function notify_rss_cached();
@@ -0,0 +1,2 @@
+alter table websub_subscriptions drop column if exists requested;
+alter table websub_subscriptions drop column if exists callback_token;
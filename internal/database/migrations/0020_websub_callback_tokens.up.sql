@@ -0,0 +1,9 @@
+-- callbacks have random token, so they can't be called by guessing ids of subscriptions,
+-- known subscriptions are subscribed again with new callbacks
+alter table websub_subscriptions add column if not exists callback_token text not null default '';
+alter table websub_subscriptions add column if not exists requested boolean not null default false;
+
+update websub_subscriptions
+set callback_token    = replace(gen_random_uuid()::text, '-', ''),
+    next_attempt_time = now()
+where callback_token = '';
@@ -0,0 +1 @@
+alter table digests drop column if exists unsubscribe_token;
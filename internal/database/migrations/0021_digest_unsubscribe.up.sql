@@ -0,0 +1,6 @@
+-- token of unsubscribe link, so digest can be stopped from email without signing in
+alter table digests add column if not exists unsubscribe_token text not null default '';
+
+update digests
+set unsubscribe_token = replace(gen_random_uuid()::text, '-', '')
+where unsubscribe_token = '';
@@ -0,0 +1,4 @@
+-- parents with nested rss are rebuilt, so items of nested rss are stored again
+update rss
+set cached_valid_until = least(cached_valid_until, now())
+where exists(select 1 from unnest(sources) s where s like 'aggregate:%');
@@ -0,0 +1,4 @@
+-- items of nested rss were stored again under nested source, parents merge items of nested rss into feeds instead
+delete
+from items
+where source like 'aggregate:%';
@@ -0,0 +1 @@
+drop table if exists pruned_items;
@@ -0,0 +1,8 @@
+-- hashes of pruned items, so items which are still in sources are not stored again as new ones
+create table if not exists pruned_items
+(
+    source      text      not null,
+    hash        text      not null,
+    pruned_time timestamp not null default now(),
+    primary key (source, hash)
+);
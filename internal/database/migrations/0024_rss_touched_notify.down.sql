@@ -0,0 +1,3 @@
+drop trigger if exists rss_touched_trigger on rss;
+
+drop function if exists notify_rss_touched();
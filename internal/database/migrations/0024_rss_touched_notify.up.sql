@@ -0,0 +1,18 @@
+create or replace function notify_rss_touched() returns trigger as
+$$
+begin
+    perform pg_notify('rss_touched',
+                      coalesce((extract(epoch from new.cached_valid_until - now()) * 1000)::bigint, 0) || ' ' ||
+                      new.email || '/' || new.name);
+    return new;
+end;
+$$ language plpgsql;
+
+-- feed cached again without changes doesn't invalidate copies kept in memory, replicas get its new validity instead
+create trigger rss_touched_trigger
+    after update of cached_valid_until
+    on rss
+    for each row
+    when (old.cached_rss_hash is not distinct from new.cached_rss_hash and
+          old.cached_valid_until is distinct from new.cached_valid_until)
+execute function notify_rss_touched();
@@ -6,6 +6,7 @@ package database
 
 import (
 	reflect "reflect"
+	compress "service-rss/internal/compress"
 	time "time"
 
 	gomock "github.com/golang/mock/gomock"
@@ -34,6 +35,48 @@ func (m *MockDatabase) EXPECT() *MockDatabaseMockRecorder {
 	return m.recorder
 }
 
+// ActivateSubscription mocks base method.
+func (m *MockDatabase) ActivateSubscription(id int64, lease, renewAfter time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ActivateSubscription", id, lease, renewAfter)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ActivateSubscription indicates an expected call of ActivateSubscription.
+func (mr *MockDatabaseMockRecorder) ActivateSubscription(id, lease, renewAfter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ActivateSubscription", reflect.TypeOf((*MockDatabase)(nil).ActivateSubscription), id, lease, renewAfter)
+}
+
+// CreateDigest mocks base method.
+func (m *MockDatabase) CreateDigest(email, name string, digest *Digest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateDigest", email, name, digest)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateDigest indicates an expected call of CreateDigest.
+func (mr *MockDatabaseMockRecorder) CreateDigest(email, name, digest interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateDigest", reflect.TypeOf((*MockDatabase)(nil).CreateDigest), email, name, digest)
+}
+
+// CreateNewsletter mocks base method.
+func (m *MockDatabase) CreateNewsletter(email, name string, newsletter *Newsletter) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateNewsletter", email, name, newsletter)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateNewsletter indicates an expected call of CreateNewsletter.
+func (mr *MockDatabaseMockRecorder) CreateNewsletter(email, name, newsletter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateNewsletter", reflect.TypeOf((*MockDatabase)(nil).CreateNewsletter), email, name, newsletter)
+}
+
 // CreateRss mocks base method.
 func (m *MockDatabase) CreateRss(arg0 *Rss) error {
 	m.ctrl.T.Helper()
@@ -48,34 +91,323 @@ func (mr *MockDatabaseMockRecorder) CreateRss(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateRss", reflect.TypeOf((*MockDatabase)(nil).CreateRss), arg0)
 }
 
-// GetCachedRss mocks base method.
-func (m *MockDatabase) GetCachedRss(email, name string) (*RssCached, error) {
+// CreateWebhook mocks base method.
+func (m *MockDatabase) CreateWebhook(email, name string, webhook *Webhook) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateWebhook", email, name, webhook)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateWebhook indicates an expected call of CreateWebhook.
+func (mr *MockDatabaseMockRecorder) CreateWebhook(email, name, webhook interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWebhook", reflect.TypeOf((*MockDatabase)(nil).CreateWebhook), email, name, webhook)
+}
+
+// DeleteDigest mocks base method.
+func (m *MockDatabase) DeleteDigest(email string, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteDigest", email, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteDigest indicates an expected call of DeleteDigest.
+func (mr *MockDatabaseMockRecorder) DeleteDigest(email, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteDigest", reflect.TypeOf((*MockDatabase)(nil).DeleteDigest), email, id)
+}
+
+// DeleteHubSubscription mocks base method.
+func (m *MockDatabase) DeleteHubSubscription(rssID int64, callback string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteHubSubscription", rssID, callback)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteHubSubscription indicates an expected call of DeleteHubSubscription.
+func (mr *MockDatabaseMockRecorder) DeleteHubSubscription(rssID, callback interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteHubSubscription", reflect.TypeOf((*MockDatabase)(nil).DeleteHubSubscription), rssID, callback)
+}
+
+// DeleteNewsletter mocks base method.
+func (m *MockDatabase) DeleteNewsletter(email string, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteNewsletter", email, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteNewsletter indicates an expected call of DeleteNewsletter.
+func (mr *MockDatabaseMockRecorder) DeleteNewsletter(email, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteNewsletter", reflect.TypeOf((*MockDatabase)(nil).DeleteNewsletter), email, id)
+}
+
+// DeleteWebhook mocks base method.
+func (m *MockDatabase) DeleteWebhook(email string, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteWebhook", email, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteWebhook indicates an expected call of DeleteWebhook.
+func (mr *MockDatabaseMockRecorder) DeleteWebhook(email, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteWebhook", reflect.TypeOf((*MockDatabase)(nil).DeleteWebhook), email, id)
+}
+
+// ExtendLeases mocks base method.
+func (m *MockDatabase) ExtendLeases(ids []int64, lease time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExtendLeases", ids, lease)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExtendLeases indicates an expected call of ExtendLeases.
+func (mr *MockDatabaseMockRecorder) ExtendLeases(ids, lease interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExtendLeases", reflect.TypeOf((*MockDatabase)(nil).ExtendLeases), ids, lease)
+}
+
+// FailDigest mocks base method.
+func (m *MockDatabase) FailDigest(id int64, lastError string, nextSendTime time.Time, attempts int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FailDigest", id, lastError, nextSendTime, attempts)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FailDigest indicates an expected call of FailDigest.
+func (mr *MockDatabaseMockRecorder) FailDigest(id, lastError, nextSendTime, attempts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FailDigest", reflect.TypeOf((*MockDatabase)(nil).FailDigest), id, lastError, nextSendTime, attempts)
+}
+
+// FailSubscription mocks base method.
+func (m *MockDatabase) FailSubscription(id int64, state, lastError string, retryAfter time.Duration) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetCachedRss", email, name)
-	ret0, _ := ret[0].(*RssCached)
+	ret := m.ctrl.Call(m, "FailSubscription", id, state, lastError, retryAfter)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FailSubscription indicates an expected call of FailSubscription.
+func (mr *MockDatabaseMockRecorder) FailSubscription(id, state, lastError, retryAfter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FailSubscription", reflect.TypeOf((*MockDatabase)(nil).FailSubscription), id, state, lastError, retryAfter)
+}
+
+// FinishDigest mocks base method.
+func (m *MockDatabase) FinishDigest(digest *Digest, itemIDs []int64, nextSendTime time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FinishDigest", digest, itemIDs, nextSendTime)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FinishDigest indicates an expected call of FinishDigest.
+func (mr *MockDatabaseMockRecorder) FinishDigest(digest, itemIDs, nextSendTime interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FinishDigest", reflect.TypeOf((*MockDatabase)(nil).FinishDigest), digest, itemIDs, nextSendTime)
+}
+
+// FinishHubPush mocks base method.
+func (m *MockDatabase) FinishHubPush(id int64, retryAfter time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FinishHubPush", id, retryAfter)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FinishHubPush indicates an expected call of FinishHubPush.
+func (mr *MockDatabaseMockRecorder) FinishHubPush(id, retryAfter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FinishHubPush", reflect.TypeOf((*MockDatabase)(nil).FinishHubPush), id, retryAfter)
+}
+
+// FinishWebhookDelivery mocks base method.
+func (m *MockDatabase) FinishWebhookDelivery(delivery *WebhookDelivery, retryAfter time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FinishWebhookDelivery", delivery, retryAfter)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FinishWebhookDelivery indicates an expected call of FinishWebhookDelivery.
+func (mr *MockDatabaseMockRecorder) FinishWebhookDelivery(delivery, retryAfter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FinishWebhookDelivery", reflect.TypeOf((*MockDatabase)(nil).FinishWebhookDelivery), delivery, retryAfter)
+}
+
+// ForgetPrunedItems mocks base method.
+func (m *MockDatabase) ForgetPrunedItems() (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ForgetPrunedItems")
+	ret0, _ := ret[0].(int)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetCachedRss indicates an expected call of GetCachedRss.
-func (mr *MockDatabaseMockRecorder) GetCachedRss(email, name interface{}) *gomock.Call {
+// ForgetPrunedItems indicates an expected call of ForgetPrunedItems.
+func (mr *MockDatabaseMockRecorder) ForgetPrunedItems() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCachedRss", reflect.TypeOf((*MockDatabase)(nil).GetCachedRss), email, name)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ForgetPrunedItems", reflect.TypeOf((*MockDatabase)(nil).ForgetPrunedItems))
 }
 
-// GetItemsToCache mocks base method.
-func (m *MockDatabase) GetItemsToCache(batchSize int) ([]*Rss, error) {
+// GetCacheQueueStats mocks base method.
+func (m *MockDatabase) GetCacheQueueStats() (*CacheQueueStats, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetItemsToCache", batchSize)
-	ret0, _ := ret[0].([]*Rss)
+	ret := m.ctrl.Call(m, "GetCacheQueueStats")
+	ret0, _ := ret[0].(*CacheQueueStats)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetItemsToCache indicates an expected call of GetItemsToCache.
-func (mr *MockDatabaseMockRecorder) GetItemsToCache(batchSize interface{}) *gomock.Call {
+// GetCacheQueueStats indicates an expected call of GetCacheQueueStats.
+func (mr *MockDatabaseMockRecorder) GetCacheQueueStats() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetItemsToCache", reflect.TypeOf((*MockDatabase)(nil).GetItemsToCache), batchSize)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCacheQueueStats", reflect.TypeOf((*MockDatabase)(nil).GetCacheQueueStats))
+}
+
+// GetCachedFeed mocks base method.
+func (m *MockDatabase) GetCachedFeed(email, name string) (*CachedFeed, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCachedFeed", email, name)
+	ret0, _ := ret[0].(*CachedFeed)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCachedFeed indicates an expected call of GetCachedFeed.
+func (mr *MockDatabaseMockRecorder) GetCachedFeed(email, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCachedFeed", reflect.TypeOf((*MockDatabase)(nil).GetCachedFeed), email, name)
+}
+
+// GetDigestItems mocks base method.
+func (m *MockDatabase) GetDigestItems(digest *Digest, limit int) ([]*Item, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDigestItems", digest, limit)
+	ret0, _ := ret[0].([]*Item)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDigestItems indicates an expected call of GetDigestItems.
+func (mr *MockDatabaseMockRecorder) GetDigestItems(digest, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDigestItems", reflect.TypeOf((*MockDatabase)(nil).GetDigestItems), digest, limit)
+}
+
+// GetDigests mocks base method.
+func (m *MockDatabase) GetDigests(email string) ([]*Digest, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDigests", email)
+	ret0, _ := ret[0].([]*Digest)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDigests indicates an expected call of GetDigests.
+func (mr *MockDatabaseMockRecorder) GetDigests(email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDigests", reflect.TypeOf((*MockDatabase)(nil).GetDigests), email)
+}
+
+// GetItemSources mocks base method.
+func (m *MockDatabase) GetItemSources() ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetItemSources")
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetItemSources indicates an expected call of GetItemSources.
+func (mr *MockDatabaseMockRecorder) GetItemSources() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetItemSources", reflect.TypeOf((*MockDatabase)(nil).GetItemSources))
+}
+
+// GetItems mocks base method.
+func (m *MockDatabase) GetItems(sources []string, limit int) ([]*Item, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetItems", sources, limit)
+	ret0, _ := ret[0].([]*Item)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetItems indicates an expected call of GetItems.
+func (mr *MockDatabaseMockRecorder) GetItems(sources, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetItems", reflect.TypeOf((*MockDatabase)(nil).GetItems), sources, limit)
+}
+
+// GetNewsletter mocks base method.
+func (m *MockDatabase) GetNewsletter(token string) (*Newsletter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetNewsletter", token)
+	ret0, _ := ret[0].(*Newsletter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetNewsletter indicates an expected call of GetNewsletter.
+func (mr *MockDatabaseMockRecorder) GetNewsletter(token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNewsletter", reflect.TypeOf((*MockDatabase)(nil).GetNewsletter), token)
+}
+
+// GetNewsletters mocks base method.
+func (m *MockDatabase) GetNewsletters(email string) ([]*Newsletter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetNewsletters", email)
+	ret0, _ := ret[0].([]*Newsletter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetNewsletters indicates an expected call of GetNewsletters.
+func (mr *MockDatabaseMockRecorder) GetNewsletters(email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNewsletters", reflect.TypeOf((*MockDatabase)(nil).GetNewsletters), email)
+}
+
+// GetNextCacheDelay mocks base method.
+func (m *MockDatabase) GetNextCacheDelay(max time.Duration) (time.Duration, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetNextCacheDelay", max)
+	ret0, _ := ret[0].(time.Duration)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetNextCacheDelay indicates an expected call of GetNextCacheDelay.
+func (mr *MockDatabaseMockRecorder) GetNextCacheDelay(max interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNextCacheDelay", reflect.TypeOf((*MockDatabase)(nil).GetNextCacheDelay), max)
+}
+
+// GetRss mocks base method.
+func (m *MockDatabase) GetRss(email, name string) (*Rss, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRss", email, name)
+	ret0, _ := ret[0].(*Rss)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRss indicates an expected call of GetRss.
+func (mr *MockDatabaseMockRecorder) GetRss(email, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRss", reflect.TypeOf((*MockDatabase)(nil).GetRss), email, name)
 }
 
 // GetRssForIndex mocks base method.
@@ -93,18 +425,414 @@ func (mr *MockDatabaseMockRecorder) GetRssForIndex() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRssForIndex", reflect.TypeOf((*MockDatabase)(nil).GetRssForIndex))
 }
 
-// SaveCachedRss mocks base method.
-func (m *MockDatabase) SaveCachedRss(id int64, rssFeed string, validUntil time.Time) error {
+// GetRssID mocks base method.
+func (m *MockDatabase) GetRssID(email, name string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRssID", email, name)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRssID indicates an expected call of GetRssID.
+func (mr *MockDatabaseMockRecorder) GetRssID(email, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRssID", reflect.TypeOf((*MockDatabase)(nil).GetRssID), email, name)
+}
+
+// GetRssWebhooks mocks base method.
+func (m *MockDatabase) GetRssWebhooks(rssID int64) ([]*Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRssWebhooks", rssID)
+	ret0, _ := ret[0].([]*Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRssWebhooks indicates an expected call of GetRssWebhooks.
+func (mr *MockDatabaseMockRecorder) GetRssWebhooks(rssID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRssWebhooks", reflect.TypeOf((*MockDatabase)(nil).GetRssWebhooks), rssID)
+}
+
+// GetSourceRss mocks base method.
+func (m *MockDatabase) GetSourceRss(source string) ([]*Rss, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSourceRss", source)
+	ret0, _ := ret[0].([]*Rss)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSourceRss indicates an expected call of GetSourceRss.
+func (mr *MockDatabaseMockRecorder) GetSourceRss(source interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSourceRss", reflect.TypeOf((*MockDatabase)(nil).GetSourceRss), source)
+}
+
+// GetSourceStates mocks base method.
+func (m *MockDatabase) GetSourceStates(urls []string) (map[string]*SourceState, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SaveCachedRss", id, rssFeed, validUntil)
+	ret := m.ctrl.Call(m, "GetSourceStates", urls)
+	ret0, _ := ret[0].(map[string]*SourceState)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSourceStates indicates an expected call of GetSourceStates.
+func (mr *MockDatabaseMockRecorder) GetSourceStates(urls interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSourceStates", reflect.TypeOf((*MockDatabase)(nil).GetSourceStates), urls)
+}
+
+// GetSubscription mocks base method.
+func (m *MockDatabase) GetSubscription(id int64) (*Subscription, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSubscription", id)
+	ret0, _ := ret[0].(*Subscription)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSubscription indicates an expected call of GetSubscription.
+func (mr *MockDatabaseMockRecorder) GetSubscription(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSubscription", reflect.TypeOf((*MockDatabase)(nil).GetSubscription), id)
+}
+
+// GetWebhookDeliveries mocks base method.
+func (m *MockDatabase) GetWebhookDeliveries(email string, webhookID int64, state string, limit int) ([]*WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWebhookDeliveries", email, webhookID, state, limit)
+	ret0, _ := ret[0].([]*WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWebhookDeliveries indicates an expected call of GetWebhookDeliveries.
+func (mr *MockDatabaseMockRecorder) GetWebhookDeliveries(email, webhookID, state, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWebhookDeliveries", reflect.TypeOf((*MockDatabase)(nil).GetWebhookDeliveries), email, webhookID, state, limit)
+}
+
+// GetWebhooks mocks base method.
+func (m *MockDatabase) GetWebhooks(email string) ([]*Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWebhooks", email)
+	ret0, _ := ret[0].([]*Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWebhooks indicates an expected call of GetWebhooks.
+func (mr *MockDatabaseMockRecorder) GetWebhooks(email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWebhooks", reflect.TypeOf((*MockDatabase)(nil).GetWebhooks), email)
+}
+
+// InvalidateSourceRss mocks base method.
+func (m *MockDatabase) InvalidateSourceRss(source string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InvalidateSourceRss", source)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InvalidateSourceRss indicates an expected call of InvalidateSourceRss.
+func (mr *MockDatabaseMockRecorder) InvalidateSourceRss(source interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InvalidateSourceRss", reflect.TypeOf((*MockDatabase)(nil).InvalidateSourceRss), source)
+}
+
+// LeaseDigests mocks base method.
+func (m *MockDatabase) LeaseDigests(batchSize int, lease time.Duration) ([]*Digest, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LeaseDigests", batchSize, lease)
+	ret0, _ := ret[0].([]*Digest)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LeaseDigests indicates an expected call of LeaseDigests.
+func (mr *MockDatabaseMockRecorder) LeaseDigests(batchSize, lease interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LeaseDigests", reflect.TypeOf((*MockDatabase)(nil).LeaseDigests), batchSize, lease)
+}
+
+// LeaseHubPushes mocks base method.
+func (m *MockDatabase) LeaseHubPushes(batchSize int, lease time.Duration) ([]*HubPush, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LeaseHubPushes", batchSize, lease)
+	ret0, _ := ret[0].([]*HubPush)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LeaseHubPushes indicates an expected call of LeaseHubPushes.
+func (mr *MockDatabaseMockRecorder) LeaseHubPushes(batchSize, lease interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LeaseHubPushes", reflect.TypeOf((*MockDatabase)(nil).LeaseHubPushes), batchSize, lease)
+}
+
+// LeaseItemsToCache mocks base method.
+func (m *MockDatabase) LeaseItemsToCache(batchSize int, lease time.Duration) ([]*Rss, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LeaseItemsToCache", batchSize, lease)
+	ret0, _ := ret[0].([]*Rss)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LeaseItemsToCache indicates an expected call of LeaseItemsToCache.
+func (mr *MockDatabaseMockRecorder) LeaseItemsToCache(batchSize, lease interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LeaseItemsToCache", reflect.TypeOf((*MockDatabase)(nil).LeaseItemsToCache), batchSize, lease)
+}
+
+// LeaseRss mocks base method.
+func (m *MockDatabase) LeaseRss(email, name string, lease time.Duration) (*Rss, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LeaseRss", email, name, lease)
+	ret0, _ := ret[0].(*Rss)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LeaseRss indicates an expected call of LeaseRss.
+func (mr *MockDatabaseMockRecorder) LeaseRss(email, name, lease interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LeaseRss", reflect.TypeOf((*MockDatabase)(nil).LeaseRss), email, name, lease)
+}
+
+// LeaseSubscriptions mocks base method.
+func (m *MockDatabase) LeaseSubscriptions(batchSize int, lease time.Duration) ([]*Subscription, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LeaseSubscriptions", batchSize, lease)
+	ret0, _ := ret[0].([]*Subscription)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LeaseSubscriptions indicates an expected call of LeaseSubscriptions.
+func (mr *MockDatabaseMockRecorder) LeaseSubscriptions(batchSize, lease interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LeaseSubscriptions", reflect.TypeOf((*MockDatabase)(nil).LeaseSubscriptions), batchSize, lease)
+}
+
+// LeaseWebhookDeliveries mocks base method.
+func (m *MockDatabase) LeaseWebhookDeliveries(batchSize int, lease time.Duration) ([]*WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LeaseWebhookDeliveries", batchSize, lease)
+	ret0, _ := ret[0].([]*WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LeaseWebhookDeliveries indicates an expected call of LeaseWebhookDeliveries.
+func (mr *MockDatabaseMockRecorder) LeaseWebhookDeliveries(batchSize, lease interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LeaseWebhookDeliveries", reflect.TypeOf((*MockDatabase)(nil).LeaseWebhookDeliveries), batchSize, lease)
+}
+
+// PinItem mocks base method.
+func (m *MockDatabase) PinItem(email, name, item string, pinned bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PinItem", email, name, item, pinned)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PinItem indicates an expected call of PinItem.
+func (mr *MockDatabaseMockRecorder) PinItem(email, name, item, pinned interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PinItem", reflect.TypeOf((*MockDatabase)(nil).PinItem), email, name, item, pinned)
+}
+
+// PruneItems mocks base method.
+func (m *MockDatabase) PruneItems(source string, keepItems int, keepSince time.Time, batchSize int, archive func([]*Item) error) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PruneItems", source, keepItems, keepSince, batchSize, archive)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PruneItems indicates an expected call of PruneItems.
+func (mr *MockDatabaseMockRecorder) PruneItems(source, keepItems, keepSince, batchSize, archive interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PruneItems", reflect.TypeOf((*MockDatabase)(nil).PruneItems), source, keepItems, keepSince, batchSize, archive)
+}
+
+// PruneWebhookDeliveries mocks base method.
+func (m *MockDatabase) PruneWebhookDeliveries(keepSince time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PruneWebhookDeliveries", keepSince)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PruneWebhookDeliveries indicates an expected call of PruneWebhookDeliveries.
+func (mr *MockDatabaseMockRecorder) PruneWebhookDeliveries(keepSince interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PruneWebhookDeliveries", reflect.TypeOf((*MockDatabase)(nil).PruneWebhookDeliveries), keepSince)
+}
+
+// QueueHubPushes mocks base method.
+func (m *MockDatabase) QueueHubPushes(rssID int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QueueHubPushes", rssID)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
+// QueueHubPushes indicates an expected call of QueueHubPushes.
+func (mr *MockDatabaseMockRecorder) QueueHubPushes(rssID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueueHubPushes", reflect.TypeOf((*MockDatabase)(nil).QueueHubPushes), rssID)
+}
+
+// QueueWebhookDeliveries mocks base method.
+func (m *MockDatabase) QueueWebhookDeliveries(webhookID int64, seenItems []string, deliveries []*WebhookDelivery) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QueueWebhookDeliveries", webhookID, seenItems, deliveries)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// QueueWebhookDeliveries indicates an expected call of QueueWebhookDeliveries.
+func (mr *MockDatabaseMockRecorder) QueueWebhookDeliveries(webhookID, seenItems, deliveries interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueueWebhookDeliveries", reflect.TypeOf((*MockDatabase)(nil).QueueWebhookDeliveries), webhookID, seenItems, deliveries)
+}
+
+// RecordReads mocks base method.
+func (m *MockDatabase) RecordReads(reads map[int64]int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordReads", reads)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RecordReads indicates an expected call of RecordReads.
+func (mr *MockDatabaseMockRecorder) RecordReads(reads interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordReads", reflect.TypeOf((*MockDatabase)(nil).RecordReads), reads)
+}
+
+// RedeliverWebhookDeliveries mocks base method.
+func (m *MockDatabase) RedeliverWebhookDeliveries(email string, webhookID, deliveryID int64) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RedeliverWebhookDeliveries", email, webhookID, deliveryID)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RedeliverWebhookDeliveries indicates an expected call of RedeliverWebhookDeliveries.
+func (mr *MockDatabaseMockRecorder) RedeliverWebhookDeliveries(email, webhookID, deliveryID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RedeliverWebhookDeliveries", reflect.TypeOf((*MockDatabase)(nil).RedeliverWebhookDeliveries), email, webhookID, deliveryID)
+}
+
+// ReleaseLeases mocks base method.
+func (m *MockDatabase) ReleaseLeases(ids []int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseLeases", ids)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseLeases indicates an expected call of ReleaseLeases.
+func (mr *MockDatabaseMockRecorder) ReleaseLeases(ids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseLeases", reflect.TypeOf((*MockDatabase)(nil).ReleaseLeases), ids)
+}
+
+// SaveCachedRss mocks base method.
+func (m *MockDatabase) SaveCachedRss(id int64, rssFeed *compress.Encoded, contentHash string, validUntil time.Time) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveCachedRss", id, rssFeed, contentHash, validUntil)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
 // SaveCachedRss indicates an expected call of SaveCachedRss.
-func (mr *MockDatabaseMockRecorder) SaveCachedRss(id, rssFeed, validUntil interface{}) *gomock.Call {
+func (mr *MockDatabaseMockRecorder) SaveCachedRss(id, rssFeed, contentHash, validUntil interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveCachedRss", reflect.TypeOf((*MockDatabase)(nil).SaveCachedRss), id, rssFeed, validUntil)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveCachedRss", reflect.TypeOf((*MockDatabase)(nil).SaveCachedRss), id, rssFeed, contentHash, validUntil)
+}
+
+// SaveHubSubscription mocks base method.
+func (m *MockDatabase) SaveHubSubscription(sub *HubSubscription) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveHubSubscription", sub)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveHubSubscription indicates an expected call of SaveHubSubscription.
+func (mr *MockDatabaseMockRecorder) SaveHubSubscription(sub interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveHubSubscription", reflect.TypeOf((*MockDatabase)(nil).SaveHubSubscription), sub)
+}
+
+// SaveItems mocks base method.
+func (m *MockDatabase) SaveItems(items []*Item) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveItems", items)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveItems indicates an expected call of SaveItems.
+func (mr *MockDatabaseMockRecorder) SaveItems(items interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveItems", reflect.TypeOf((*MockDatabase)(nil).SaveItems), items)
+}
+
+// SaveSourceStates mocks base method.
+func (m *MockDatabase) SaveSourceStates(states []*SourceState) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveSourceStates", states)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveSourceStates indicates an expected call of SaveSourceStates.
+func (mr *MockDatabaseMockRecorder) SaveSourceStates(states interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveSourceStates", reflect.TypeOf((*MockDatabase)(nil).SaveSourceStates), states)
+}
+
+// SaveSubscription mocks base method.
+func (m *MockDatabase) SaveSubscription(sub *Subscription) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveSubscription", sub)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveSubscription indicates an expected call of SaveSubscription.
+func (mr *MockDatabaseMockRecorder) SaveSubscription(sub interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveSubscription", reflect.TypeOf((*MockDatabase)(nil).SaveSubscription), sub)
+}
+
+// SearchItems mocks base method.
+func (m *MockDatabase) SearchItems(query *SearchQuery) ([]*SearchResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchItems", query)
+	ret0, _ := ret[0].([]*SearchResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchItems indicates an expected call of SearchItems.
+func (mr *MockDatabaseMockRecorder) SearchItems(query interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchItems", reflect.TypeOf((*MockDatabase)(nil).SearchItems), query)
 }
 
 // Shutdown mocks base method.
@@ -120,3 +848,31 @@ func (mr *MockDatabaseMockRecorder) Shutdown() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Shutdown", reflect.TypeOf((*MockDatabase)(nil).Shutdown))
 }
+
+// UnsubscribeDigest mocks base method.
+func (m *MockDatabase) UnsubscribeDigest(id int64, token string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UnsubscribeDigest", id, token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UnsubscribeDigest indicates an expected call of UnsubscribeDigest.
+func (mr *MockDatabaseMockRecorder) UnsubscribeDigest(id, token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnsubscribeDigest", reflect.TypeOf((*MockDatabase)(nil).UnsubscribeDigest), id, token)
+}
+
+// UpdateRss mocks base method.
+func (m *MockDatabase) UpdateRss(arg0 *Rss) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateRss", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateRss indicates an expected call of UpdateRss.
+func (mr *MockDatabaseMockRecorder) UpdateRss(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateRss", reflect.TypeOf((*MockDatabase)(nil).UpdateRss), arg0)
+}
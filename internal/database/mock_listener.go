@@ -0,0 +1,104 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: listener.go
+
+// Package database is a generated GoMock package.
+package database
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockRefreshListener is a mock of RefreshListener interface.
+type MockRefreshListener struct {
+	ctrl     *gomock.Controller
+	recorder *MockRefreshListenerMockRecorder
+}
+
+// MockRefreshListenerMockRecorder is the mock recorder for MockRefreshListener.
+type MockRefreshListenerMockRecorder struct {
+	mock *MockRefreshListener
+}
+
+// NewMockRefreshListener creates a new mock instance.
+func NewMockRefreshListener(ctrl *gomock.Controller) *MockRefreshListener {
+	mock := &MockRefreshListener{ctrl: ctrl}
+	mock.recorder = &MockRefreshListenerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRefreshListener) EXPECT() *MockRefreshListenerMockRecorder {
+	return m.recorder
+}
+
+// Cached mocks base method.
+func (m *MockRefreshListener) Cached() <-chan string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Cached")
+	ret0, _ := ret[0].(<-chan string)
+	return ret0
+}
+
+// Cached indicates an expected call of Cached.
+func (mr *MockRefreshListenerMockRecorder) Cached() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Cached", reflect.TypeOf((*MockRefreshListener)(nil).Cached))
+}
+
+// Close mocks base method.
+func (m *MockRefreshListener) Close() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Close")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockRefreshListenerMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockRefreshListener)(nil).Close))
+}
+
+// Invalidated mocks base method.
+func (m *MockRefreshListener) Invalidated() <-chan string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Invalidated")
+	ret0, _ := ret[0].(<-chan string)
+	return ret0
+}
+
+// Invalidated indicates an expected call of Invalidated.
+func (mr *MockRefreshListenerMockRecorder) Invalidated() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Invalidated", reflect.TypeOf((*MockRefreshListener)(nil).Invalidated))
+}
+
+// Refresh mocks base method.
+func (m *MockRefreshListener) Refresh() <-chan struct{} {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Refresh")
+	ret0, _ := ret[0].(<-chan struct{})
+	return ret0
+}
+
+// Refresh indicates an expected call of Refresh.
+func (mr *MockRefreshListenerMockRecorder) Refresh() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Refresh", reflect.TypeOf((*MockRefreshListener)(nil).Refresh))
+}
+
+// Touched mocks base method.
+func (m *MockRefreshListener) Touched() <-chan Touch {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Touched")
+	ret0, _ := ret[0].(<-chan Touch)
+	return ret0
+}
+
+// Touched indicates an expected call of Touched.
+func (mr *MockRefreshListenerMockRecorder) Touched() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Touched", reflect.TypeOf((*MockRefreshListener)(nil).Touched))
+}
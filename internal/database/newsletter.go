@@ -0,0 +1,166 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Newsletter is inbound address of rss, emails to it are items of its source
+type Newsletter struct {
+	ID          int64
+	RssID       int64
+	Email       string // owner of rss
+	Name        string // name of rss
+	Token       string // local part of address
+	Source      string
+	CreatedTime time.Time
+}
+
+func (db *database) CreateNewsletter(email string, name string, newsletter *Newsletter) error {
+	start := time.Now()
+
+	err := db.createNewsletter(email, name, newsletter)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("create_newsletter", status).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+// createNewsletter adds source of newsletter to rss, it returns sql.ErrNoRows if owner has no such rss
+func (db *database) createNewsletter(email string, name string, newsletter *Newsletter) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// saved searches have no sources
+	query := `UPDATE rss SET sources=array_append(sources, $3), cached_valid_until=now()
+		WHERE email=$1 AND name=$2 AND search IS NULL
+		RETURNING id`
+	err = tx.QueryRow(query, email, name, newsletter.Source).Scan(&newsletter.RssID)
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO newsletters (rss_id, token, source) VALUES ($1, $2, $3) RETURNING id, created_time`
+	err = tx.QueryRow(query, newsletter.RssID, newsletter.Token, newsletter.Source).Scan(&newsletter.ID, &newsletter.CreatedTime)
+	if err != nil {
+		return err
+	}
+
+	newsletter.Email = email
+	newsletter.Name = name
+	return tx.Commit()
+}
+
+func (db *database) GetNewsletters(email string) ([]*Newsletter, error) {
+	start := time.Now()
+
+	newsletters, err := db.getNewsletters("rss.email=$1", email)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("get_newsletters", status).Observe(time.Since(start).Seconds())
+
+	return newsletters, err
+}
+
+func (db *database) GetNewsletter(token string) (*Newsletter, error) {
+	start := time.Now()
+
+	newsletter, err := db.getNewsletter(token)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("get_newsletter", status).Observe(time.Since(start).Seconds())
+
+	return newsletter, err
+}
+
+// getNewsletter returns sql.ErrNoRows for unknown token
+func (db *database) getNewsletter(token string) (*Newsletter, error) {
+	newsletters, err := db.getNewsletters("n.token=$1", token)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(newsletters) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return newsletters[0], nil
+}
+
+func (db *database) getNewsletters(condition string, value interface{}) ([]*Newsletter, error) {
+	query := `SELECT n.id, n.rss_id, rss.email, rss.name, n.token, n.source, n.created_time
+		FROM newsletters n JOIN rss ON rss.id=n.rss_id WHERE ` + condition + ` ORDER BY n.id`
+	rows, err := db.db.Query(query, value)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	newsletters := make([]*Newsletter, 0)
+	for rows.Next() {
+		newsletter := &Newsletter{}
+		err = rows.Scan(&newsletter.ID, &newsletter.RssID, &newsletter.Email, &newsletter.Name, &newsletter.Token,
+			&newsletter.Source, &newsletter.CreatedTime)
+		if err != nil {
+			return nil, err
+		}
+		newsletters = append(newsletters, newsletter)
+	}
+
+	return newsletters, rows.Err()
+}
+
+func (db *database) DeleteNewsletter(email string, id int64) error {
+	start := time.Now()
+
+	err := db.deleteNewsletter(email, id)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("delete_newsletter", status).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+// deleteNewsletter removes source from rss of newsletter, stored items are pruned by retention.
+// It returns sql.ErrNoRows if newsletter is not owned by email
+func (db *database) deleteNewsletter(email string, id int64) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var rssID int64
+	var source string
+	query := `DELETE FROM newsletters n USING rss WHERE rss.id=n.rss_id AND n.id=$1 AND rss.email=$2
+		RETURNING n.rss_id, n.source`
+	err = tx.QueryRow(query, id, email).Scan(&rssID, &source)
+	if err != nil {
+		return err
+	}
+
+	query = `UPDATE rss SET sources=array_remove(sources, $1), cached_valid_until=now() WHERE id=$2`
+	_, err = tx.Exec(query, source, rssID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
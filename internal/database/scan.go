@@ -0,0 +1,65 @@
+package database
+
+import (
+	"encoding/json"
+
+	"github.com/lib/pq"
+)
+
+// scanner is row or rows, it is kept out of database.go, since mocks are generated from it
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanRss reads rssColumns followed by extra columns
+func scanRss(row scanner, extra ...interface{}) (*Rss, error) {
+	item := &Rss{}
+	var channelRaw, podcastRaw, retentionRaw, searchRaw []byte
+
+	dest := []interface{}{&item.ID, &item.Email, &item.Name, pq.Array(&item.Sources), &item.Mode, &channelRaw, &podcastRaw, &retentionRaw, &searchRaw}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(channelRaw) > 0 {
+		item.Channel = &ChannelSettings{}
+		if err = json.Unmarshal(channelRaw, item.Channel); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(podcastRaw) > 0 {
+		item.Podcast = &PodcastSettings{}
+		if err = json.Unmarshal(podcastRaw, item.Podcast); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(retentionRaw) > 0 {
+		item.Retention = &RetentionSettings{}
+		if err = json.Unmarshal(retentionRaw, item.Retention); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(searchRaw) > 0 {
+		item.Search = &SearchSettings{}
+		if err = json.Unmarshal(searchRaw, item.Search); err != nil {
+			return nil, err
+		}
+	}
+
+	return item, nil
+}
+
+func scanItem(row scanner) (*Item, error) {
+	item := &Item{}
+	err := row.Scan(&item.ID, &item.Source, &item.Hash, &item.Guid, &item.Link, &item.Title, &item.Description, &item.Content,
+		&item.Language, &item.PublishedTime, &item.Data, &item.Pinned, &item.FirstSeenTime, &item.UpdatedTime)
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
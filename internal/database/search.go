@@ -0,0 +1,179 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// text search configurations of postgres by language codes of rss
+	searchConfigs = map[string]string{
+		"ar": "arabic",
+		"da": "danish",
+		"de": "german",
+		"el": "greek",
+		"en": "english",
+		"es": "spanish",
+		"fi": "finnish",
+		"fr": "french",
+		"hu": "hungarian",
+		"id": "indonesian",
+		"it": "italian",
+		"nl": "dutch",
+		"no": "norwegian",
+		"pt": "portuguese",
+		"ro": "romanian",
+		"ru": "russian",
+		"sv": "swedish",
+		"tr": "turkish",
+	}
+)
+
+type SearchQuery struct {
+	Text string
+	// Email and Names scope search to sources of rss, all items are searched if they are empty
+	Email    string
+	Names    []string
+	Since    *time.Time
+	Language string
+	// Newest orders items by publishing time instead of rank, saved searches are read as feeds
+	Newest bool
+	Limit  int
+	Offset int
+}
+
+type SearchResult struct {
+	Item
+	Rank           float64
+	TitleHighlight string
+	Snippet        string
+}
+
+// SearchConfig returns text search configuration for language code like "en-us" or configuration name like "english"
+func SearchConfig(language string, defaultConfig string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if i := strings.IndexAny(language, "-_"); i >= 0 {
+		language = language[:i]
+	}
+
+	if config, ok := searchConfigs[language]; ok {
+		return config
+	}
+
+	for _, config := range searchConfigs {
+		if config == language {
+			return config
+		}
+	}
+
+	if len(defaultConfig) > 0 {
+		return defaultConfig
+	}
+
+	return "simple"
+}
+
+func (db *database) SearchItems(query *SearchQuery) ([]*SearchResult, error) {
+	start := time.Now()
+
+	results, err := db.searchItems(query)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("search_items", status).Observe(time.Since(start).Seconds())
+
+	return results, err
+}
+
+func (db *database) searchItems(query *SearchQuery) ([]*SearchResult, error) {
+	config := SearchConfig(query.Language, db.searchLanguage)
+
+	var since interface{}
+	if query.Since != nil {
+		since = *query.Since
+	}
+
+	order := "rank desc, i.published_time desc nulls last, i.id"
+	if query.Newest {
+		order = "i.published_time desc nulls last, i.first_seen_time desc, i.id"
+	}
+
+	// items of sources used by several rss are stored once, so scope is checked by sources including nested ones
+	sqlQuery := `SELECT ` + prefixed("i", itemColumns) + `, ts_rank_cd(i.search_vector, q.query) AS rank,
+			ts_headline($1::regconfig, i.title, q.query, 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true'),
+			ts_headline($1::regconfig, i.content, q.query, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5')
+		FROM items i, websearch_to_tsquery($1::regconfig, $2) AS q(query)
+		WHERE i.search_vector @@ q.query
+			and ($3 = '' or i.source=any(` + scopedSources("$3", "$4") + `))
+			and ($5::timestamp is null or coalesce(i.published_time, i.first_seen_time) >= $5::timestamp)
+		ORDER BY ` + order + `
+		LIMIT $6 OFFSET $7`
+	rows, err := db.db.Query(sqlQuery, config, websearchText(query.Text), query.Email, pq.Array(query.Names), since, query.Limit, query.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	results := make([]*SearchResult, 0, query.Limit)
+	for rows.Next() {
+		result := &SearchResult{}
+		item := &result.Item
+		err = rows.Scan(&item.ID, &item.Source, &item.Hash, &item.Guid, &item.Link, &item.Title, &item.Description, &item.Content,
+			&item.Language, &item.PublishedTime, &item.Data, &item.Pinned, &item.FirstSeenTime, &item.UpdatedTime,
+			&result.Rank, &result.TitleHighlight, &result.Snippet)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// websearchText converts boolean operators written in upper case, websearch syntax has implicit AND, or and -
+func websearchText(text string) string {
+	words := strings.Fields(text)
+	result := make([]string, 0, len(words))
+	negate := false
+	for _, word := range words {
+		switch word {
+		case "AND":
+			continue
+		case "NOT":
+			negate = true
+			continue
+		}
+
+		if negate {
+			word = "-" + word
+			negate = false
+		}
+		result = append(result, word)
+	}
+
+	return strings.Join(result, " ")
+}
+
+// scopedSources selects sources of rss of email with names in array and sources of their nested rss recursively,
+// since parents merge items of nested rss into feeds instead of storing them. Arguments are placeholders of query
+func scopedSources(email string, names string) string {
+	return `WITH RECURSIVE scope(source) AS (
+			SELECT unnest(sources) FROM rss WHERE email=` + email + ` and name=any(` + names + `)
+			UNION
+			SELECT unnest(r.sources) FROM rss r JOIN scope ON scope.source='aggregate:' || r.email || '/' || r.name
+		) SELECT source FROM scope`
+}
+
+func prefixed(alias string, columns string) string {
+	fields := strings.Split(columns, ", ")
+	for i, field := range fields {
+		fields[i] = alias + "." + field
+	}
+
+	return strings.Join(fields, ", ")
+}
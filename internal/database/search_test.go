@@ -0,0 +1,23 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchConfig(t *testing.T) {
+	assert.Equal(t, "english", SearchConfig("en", "simple"))
+	assert.Equal(t, "german", SearchConfig("de-DE", "simple"))
+	assert.Equal(t, "russian", SearchConfig("ru_RU", "simple"))
+	assert.Equal(t, "french", SearchConfig("french", "simple"))
+	assert.Equal(t, "simple", SearchConfig("ja", "simple"))
+	assert.Equal(t, "english", SearchConfig("", "english"))
+	assert.Equal(t, "simple", SearchConfig("", ""))
+}
+
+func TestWebsearchText(t *testing.T) {
+	assert.Equal(t, "kubernetes security", websearchText("kubernetes AND security"))
+	assert.Equal(t, "kubernetes OR docker -windows", websearchText("kubernetes OR docker AND NOT windows"))
+	assert.Equal(t, "\"service mesh\" and", websearchText(" \"service mesh\"  and "))
+}
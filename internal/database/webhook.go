@@ -0,0 +1,378 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// Webhook posts payload rendered by template for every new item of rss
+type Webhook struct {
+	ID          int64
+	RssID       int64
+	Name        string // name of rss
+	Url         string
+	Secret      string
+	Template    string
+	SeenItems   []string // hashes of items of the last notified feed, nil until the first feed is seen
+	CreatedTime time.Time
+}
+
+// WebhookDelivery is delivery of one item, url and secret of webhook are set for leased deliveries only
+type WebhookDelivery struct {
+	ID          int64
+	WebhookID   int64
+	Url         string
+	Secret      string
+	Item        string // hash of item
+	Payload     string
+	State       string
+	Attempts    int
+	StatusCode  int // zero if request failed without response
+	LastError   string
+	CreatedTime time.Time
+	UpdatedTime time.Time
+}
+
+func (db *database) CreateWebhook(email string, name string, webhook *Webhook) error {
+	start := time.Now()
+
+	err := db.createWebhook(email, name, webhook)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("create_webhook", status).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+// createWebhook returns sql.ErrNoRows if owner has no such rss
+func (db *database) createWebhook(email string, name string, webhook *Webhook) error {
+	query := `INSERT INTO webhooks (rss_id, url, secret, template)
+		SELECT id, $3, $4, $5 FROM rss WHERE email=$1 AND name=$2
+		RETURNING id, rss_id, created_time`
+	err := db.db.QueryRow(query, email, name, webhook.Url, webhook.Secret, webhook.Template).
+		Scan(&webhook.ID, &webhook.RssID, &webhook.CreatedTime)
+	if err != nil {
+		return err
+	}
+
+	webhook.Name = name
+	return nil
+}
+
+func (db *database) GetWebhooks(email string) ([]*Webhook, error) {
+	start := time.Now()
+
+	webhooks, err := db.getWebhooks("rss.email=$1", email)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("get_webhooks", status).Observe(time.Since(start).Seconds())
+
+	return webhooks, err
+}
+
+func (db *database) GetRssWebhooks(rssID int64) ([]*Webhook, error) {
+	start := time.Now()
+
+	webhooks, err := db.getWebhooks("w.rss_id=$1", rssID)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("get_rss_webhooks", status).Observe(time.Since(start).Seconds())
+
+	return webhooks, err
+}
+
+func (db *database) getWebhooks(condition string, arg interface{}) ([]*Webhook, error) {
+	query := `SELECT w.id, w.rss_id, rss.name, w.url, w.secret, w.template, w.seen_items, w.created_time
+		FROM webhooks w JOIN rss ON rss.id=w.rss_id WHERE ` + condition + ` ORDER BY w.id`
+	rows, err := db.db.Query(query, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	webhooks := make([]*Webhook, 0)
+	for rows.Next() {
+		webhook := &Webhook{}
+		var seenItems pq.StringArray
+		err = rows.Scan(&webhook.ID, &webhook.RssID, &webhook.Name, &webhook.Url, &webhook.Secret, &webhook.Template,
+			&seenItems, &webhook.CreatedTime)
+		if err != nil {
+			return nil, err
+		}
+		// null array is scanned as nil
+		webhook.SeenItems = seenItems
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+func (db *database) DeleteWebhook(email string, id int64) error {
+	start := time.Now()
+
+	err := db.deleteWebhook(email, id)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("delete_webhook", status).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+// deleteWebhook deletes its deliveries too, it returns sql.ErrNoRows if webhook is not owned by email
+func (db *database) deleteWebhook(email string, id int64) error {
+	query := `DELETE FROM webhooks w USING rss WHERE rss.id=w.rss_id AND w.id=$1 AND rss.email=$2`
+	result, err := db.db.Exec(query, id, email)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (db *database) QueueWebhookDeliveries(webhookID int64, seenItems []string, deliveries []*WebhookDelivery) error {
+	start := time.Now()
+
+	err := db.queueWebhookDeliveries(webhookID, seenItems, deliveries)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("queue_webhook_deliveries", status).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+// queueWebhookDeliveries saves seen items together with deliveries, so items are queued once
+func (db *database) queueWebhookDeliveries(webhookID int64, seenItems []string, deliveries []*WebhookDelivery) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE webhooks SET seen_items=$1 WHERE id=$2`, pq.Array(nonNilStrings(seenItems)), webhookID)
+	if err != nil {
+		return err
+	}
+
+	if len(deliveries) > 0 {
+		stmt, err := tx.Prepare(`INSERT INTO webhook_deliveries (webhook_id, item, payload) VALUES ($1, $2, $3)`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, delivery := range deliveries {
+			_, err = stmt.Exec(webhookID, delivery.Item, delivery.Payload)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (db *database) LeaseWebhookDeliveries(batchSize int, lease time.Duration) ([]*WebhookDelivery, error) {
+	start := time.Now()
+
+	deliveries, err := db.leaseWebhookDeliveries(batchSize, lease)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("lease_webhook_deliveries", status).Observe(time.Since(start).Seconds())
+
+	return deliveries, err
+}
+
+// leaseWebhookDeliveries claims the oldest due deliveries, so items are delivered in order of queueing
+func (db *database) leaseWebhookDeliveries(batchSize int, lease time.Duration) ([]*WebhookDelivery, error) {
+	query := `UPDATE webhook_deliveries d SET next_attempt_time=now() + $1 * interval '1 millisecond',
+		attempts=d.attempts + 1, updated_time=now()
+		FROM webhooks w
+		WHERE w.id=d.webhook_id AND d.id IN (
+			SELECT id FROM webhook_deliveries WHERE state='pending' AND next_attempt_time <= now()
+			ORDER BY id LIMIT $2 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, d.webhook_id, w.url, w.secret, d.item, d.payload, d.state, d.attempts, d.status_code,
+			d.last_error, d.created_time, d.updated_time`
+	rows, err := db.db.Query(query, lease.Milliseconds(), batchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	deliveries := make([]*WebhookDelivery, 0, batchSize)
+	for rows.Next() {
+		delivery := &WebhookDelivery{}
+		err = rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Url, &delivery.Secret, &delivery.Item, &delivery.Payload,
+			&delivery.State, &delivery.Attempts, &delivery.StatusCode, &delivery.LastError, &delivery.CreatedTime, &delivery.UpdatedTime)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func (db *database) FinishWebhookDelivery(delivery *WebhookDelivery, retryAfter time.Duration) error {
+	start := time.Now()
+
+	err := db.finishWebhookDelivery(delivery, retryAfter)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("finish_webhook_delivery", status).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+func (db *database) finishWebhookDelivery(delivery *WebhookDelivery, retryAfter time.Duration) error {
+	query := `UPDATE webhook_deliveries SET state=$1, status_code=$2, last_error=$3,
+		next_attempt_time=now() + $4 * interval '1 millisecond', updated_time=now()
+		WHERE id=$5`
+	_, err := db.db.Exec(query, delivery.State, delivery.StatusCode, delivery.LastError, retryAfter.Milliseconds(), delivery.ID)
+	return err
+}
+
+func (db *database) GetWebhookDeliveries(email string, webhookID int64, state string, limit int) ([]*WebhookDelivery, error) {
+	start := time.Now()
+
+	deliveries, err := db.getWebhookDeliveries(email, webhookID, state, limit)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("get_webhook_deliveries", status).Observe(time.Since(start).Seconds())
+
+	return deliveries, err
+}
+
+// getWebhookDeliveries returns the newest deliveries in any state if state is empty,
+// it returns sql.ErrNoRows if webhook is not owned by email
+func (db *database) getWebhookDeliveries(email string, webhookID int64, state string, limit int) ([]*WebhookDelivery, error) {
+	var owned bool
+	query := `SELECT EXISTS (SELECT 1 FROM webhooks w JOIN rss ON rss.id=w.rss_id WHERE w.id=$1 AND rss.email=$2)`
+	err := db.db.QueryRow(query, webhookID, email).Scan(&owned)
+	if err != nil {
+		return nil, err
+	}
+	if !owned {
+		return nil, sql.ErrNoRows
+	}
+
+	query = `SELECT id, webhook_id, item, payload, state, attempts, status_code, last_error, created_time, updated_time
+		FROM webhook_deliveries WHERE webhook_id=$1 AND ($2='' OR state=$2)
+		ORDER BY id DESC LIMIT $3`
+	rows, err := db.db.Query(query, webhookID, state, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	deliveries := make([]*WebhookDelivery, 0, limit)
+	for rows.Next() {
+		delivery := &WebhookDelivery{}
+		err = rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Item, &delivery.Payload, &delivery.State,
+			&delivery.Attempts, &delivery.StatusCode, &delivery.LastError, &delivery.CreatedTime, &delivery.UpdatedTime)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func (db *database) RedeliverWebhookDeliveries(email string, webhookID int64, deliveryID int64) (int, error) {
+	start := time.Now()
+
+	count, err := db.redeliverWebhookDeliveries(email, webhookID, deliveryID)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("redeliver_webhook_deliveries", status).Observe(time.Since(start).Seconds())
+
+	return count, err
+}
+
+// redeliverWebhookDeliveries queues dead deliveries of webhook again, all of them if delivery id is zero
+func (db *database) redeliverWebhookDeliveries(email string, webhookID int64, deliveryID int64) (int, error) {
+	query := `UPDATE webhook_deliveries d SET state='pending', attempts=0, next_attempt_time=now(), updated_time=now()
+		FROM webhooks w JOIN rss ON rss.id=w.rss_id
+		WHERE w.id=d.webhook_id AND d.webhook_id=$1 AND rss.email=$2 AND d.state='dead' AND ($3::bigint=0 OR d.id=$3::bigint)`
+	result, err := db.db.Exec(query, webhookID, email, deliveryID)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
+
+func (db *database) PruneWebhookDeliveries(keepSince time.Time) (int, error) {
+	start := time.Now()
+
+	count, err := db.pruneWebhookDeliveries(keepSince)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("prune_webhook_deliveries", status).Observe(time.Since(start).Seconds())
+
+	return count, err
+}
+
+// pruneWebhookDeliveries deletes finished deliveries which were not updated since keepSince, pending ones are kept
+func (db *database) pruneWebhookDeliveries(keepSince time.Time) (int, error) {
+	query := `DELETE FROM webhook_deliveries WHERE state<>'pending' AND updated_time < $1`
+	result, err := db.db.Exec(query, keepSince)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
@@ -0,0 +1,381 @@
+package database
+
+import (
+	"time"
+
+	"service-rss/internal/compress"
+)
+
+const (
+	SubscriptionPending = "pending"
+	SubscriptionActive  = "active"
+	SubscriptionDenied  = "denied"
+)
+
+// Subscription is websub subscription of source, topic is canonical url of source advertised with hub
+type Subscription struct {
+	ID               int64
+	Source           string
+	Hub              string
+	Topic            string
+	Secret           string
+	Token            string // random part of callback url, so callbacks can't be guessed by id
+	State            string
+	LeaseExpiresTime *time.Time
+	Attempts         int  // count of subscribe requests since the last verification
+	Requested        bool // subscribe request is sent and hub has not verified it yet
+}
+
+// HubSubscription is subscription of callback to our own rss
+type HubSubscription struct {
+	RssID    int64
+	Callback string
+	Secret   string
+	Lease    time.Duration
+}
+
+// HubPush is due push of current feed of rss to subscriber
+type HubPush struct {
+	ID       int64
+	RssID    int64
+	Email    string
+	Name     string
+	Callback string
+	Secret   string
+	Attempts int
+	Feed     *compress.Encoded // nil if rss has not been cached
+}
+
+func (db *database) SaveSubscription(sub *Subscription) error {
+	start := time.Now()
+
+	err := db.saveSubscription(sub)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("save_subscription", status).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+// saveSubscription keeps existing subscription unless source moved to other hub or topic, then it is subscribed anew
+func (db *database) saveSubscription(sub *Subscription) error {
+	query := `INSERT INTO websub_subscriptions (source, hub, topic, secret, callback_token) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (source) DO UPDATE SET hub=excluded.hub, topic=excluded.topic, secret=excluded.secret,
+		callback_token=excluded.callback_token, state='pending', lease_expires_time=NULL, next_attempt_time=now(),
+		attempts=0, requested=false, last_error='', updated_time=now()
+		WHERE websub_subscriptions.hub<>excluded.hub OR websub_subscriptions.topic<>excluded.topic`
+	_, err := db.db.Exec(query, sub.Source, sub.Hub, sub.Topic, sub.Secret, sub.Token)
+	return err
+}
+
+func (db *database) GetSubscription(id int64) (*Subscription, error) {
+	start := time.Now()
+
+	sub, err := db.getSubscription(id)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("get_subscription", status).Observe(time.Since(start).Seconds())
+
+	return sub, err
+}
+
+func (db *database) getSubscription(id int64) (*Subscription, error) {
+	query := `SELECT id, source, hub, topic, secret, callback_token, state, lease_expires_time, attempts, requested
+		FROM websub_subscriptions WHERE id=$1`
+
+	sub := &Subscription{}
+	err := db.db.QueryRow(query, id).Scan(&sub.ID, &sub.Source, &sub.Hub, &sub.Topic, &sub.Secret, &sub.Token, &sub.State,
+		&sub.LeaseExpiresTime, &sub.Attempts, &sub.Requested)
+	if err != nil {
+		return nil, err
+	}
+
+	return sub, nil
+}
+
+func (db *database) LeaseSubscriptions(batchSize int, lease time.Duration) ([]*Subscription, error) {
+	start := time.Now()
+
+	subs, err := db.leaseSubscriptions(batchSize, lease)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("lease_subscriptions", status).Observe(time.Since(start).Seconds())
+
+	return subs, err
+}
+
+// leaseSubscriptions postpones the next attempt by lease, so subscription is retried if hub doesn't verify it.
+// Leased subscriptions are requested, so hub may verify them. Subscriptions of sources which are not used
+// by any rss anymore are left to expire
+func (db *database) leaseSubscriptions(batchSize int, lease time.Duration) ([]*Subscription, error) {
+	query := `UPDATE websub_subscriptions SET next_attempt_time=now() + $1 * interval '1 millisecond',
+		attempts=attempts + 1, requested=true, updated_time=now()
+		WHERE id IN (
+			SELECT w.id FROM websub_subscriptions w WHERE w.next_attempt_time <= now()
+			AND EXISTS (SELECT 1 FROM rss WHERE w.source=any(rss.sources))
+			ORDER BY w.next_attempt_time LIMIT $2 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, source, hub, topic, secret, callback_token, state, lease_expires_time, attempts, requested`
+	rows, err := db.db.Query(query, lease.Milliseconds(), batchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	subs := make([]*Subscription, 0, batchSize)
+	for rows.Next() {
+		sub := &Subscription{}
+		err = rows.Scan(&sub.ID, &sub.Source, &sub.Hub, &sub.Topic, &sub.Secret, &sub.Token, &sub.State,
+			&sub.LeaseExpiresTime, &sub.Attempts, &sub.Requested)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+
+	return subs, rows.Err()
+}
+
+func (db *database) ActivateSubscription(id int64, lease time.Duration, renewAfter time.Duration) error {
+	start := time.Now()
+
+	err := db.activateSubscription(id, lease, renewAfter)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("activate_subscription", status).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+func (db *database) activateSubscription(id int64, lease time.Duration, renewAfter time.Duration) error {
+	query := `UPDATE websub_subscriptions SET state='active', lease_expires_time=now() + $1 * interval '1 millisecond',
+		next_attempt_time=now() + $2 * interval '1 millisecond', attempts=0, requested=false, last_error='',
+		updated_time=now()
+		WHERE id=$3`
+	_, err := db.db.Exec(query, lease.Milliseconds(), renewAfter.Milliseconds(), id)
+	return err
+}
+
+func (db *database) FailSubscription(id int64, state string, lastError string, retryAfter time.Duration) error {
+	start := time.Now()
+
+	err := db.failSubscription(id, state, lastError, retryAfter)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("fail_subscription", status).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+// failSubscription keeps active subscription active until its lease expires, hub still pushes to it
+func (db *database) failSubscription(id int64, state string, lastError string, retryAfter time.Duration) error {
+	query := `UPDATE websub_subscriptions SET state=$1, last_error=$2,
+		next_attempt_time=now() + $3 * interval '1 millisecond', updated_time=now()
+		WHERE id=$4`
+	_, err := db.db.Exec(query, state, lastError, retryAfter.Milliseconds(), id)
+	return err
+}
+
+func (db *database) InvalidateSourceRss(source string) error {
+	start := time.Now()
+
+	err := db.invalidateSourceRss(source)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("invalidate_source_rss", status).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+// invalidateSourceRss makes rss with source outdated, so cacher rebuilds them at once
+func (db *database) invalidateSourceRss(source string) error {
+	query := `UPDATE rss SET cached_valid_until=now()
+		WHERE $1=any(sources) AND (cached_valid_until IS NULL OR cached_valid_until > now())`
+	_, err := db.db.Exec(query, source)
+	return err
+}
+
+func (db *database) GetRssID(email string, name string) (int64, error) {
+	start := time.Now()
+
+	id, err := db.getRssID(email, name)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("get_rss_id", status).Observe(time.Since(start).Seconds())
+
+	return id, err
+}
+
+func (db *database) getRssID(email string, name string) (int64, error) {
+	var id int64
+	err := db.db.QueryRow(`SELECT id FROM rss WHERE email=$1 and name=$2`, email, name).Scan(&id)
+	return id, err
+}
+
+func (db *database) SaveHubSubscription(sub *HubSubscription) error {
+	start := time.Now()
+
+	err := db.saveHubSubscription(sub)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("save_hub_subscription", status).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+// saveHubSubscription keeps pending push of renewed subscription
+func (db *database) saveHubSubscription(sub *HubSubscription) error {
+	query := `INSERT INTO websub_hub_subscriptions (rss_id, callback, secret, lease_expires_time)
+		VALUES ($1, $2, $3, now() + $4 * interval '1 millisecond')
+		ON CONFLICT (rss_id, callback) DO UPDATE SET secret=excluded.secret, lease_expires_time=excluded.lease_expires_time`
+	_, err := db.db.Exec(query, sub.RssID, sub.Callback, sub.Secret, sub.Lease.Milliseconds())
+	return err
+}
+
+func (db *database) DeleteHubSubscription(rssID int64, callback string) error {
+	start := time.Now()
+
+	err := db.deleteHubSubscription(rssID, callback)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("delete_hub_subscription", status).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+func (db *database) deleteHubSubscription(rssID int64, callback string) error {
+	_, err := db.db.Exec(`DELETE FROM websub_hub_subscriptions WHERE rss_id=$1 AND callback=$2`, rssID, callback)
+	return err
+}
+
+func (db *database) QueueHubPushes(rssID int64) error {
+	start := time.Now()
+
+	err := db.queueHubPushes(rssID)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("queue_hub_pushes", status).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+// queueHubPushes coalesces pushes, pending one sends the newest feed anyway
+func (db *database) queueHubPushes(rssID int64) error {
+	query := `UPDATE websub_hub_subscriptions SET next_push_time=now(), push_attempts=0
+		WHERE rss_id=$1 AND lease_expires_time > now()`
+	_, err := db.db.Exec(query, rssID)
+	return err
+}
+
+func (db *database) LeaseHubPushes(batchSize int, lease time.Duration) ([]*HubPush, error) {
+	start := time.Now()
+
+	pushes, err := db.leaseHubPushes(batchSize, lease)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("lease_hub_pushes", status).Observe(time.Since(start).Seconds())
+
+	return pushes, err
+}
+
+// leaseHubPushes deletes expired subscriptions first, so they are not pushed
+func (db *database) leaseHubPushes(batchSize int, lease time.Duration) ([]*HubPush, error) {
+	_, err := db.db.Exec(`DELETE FROM websub_hub_subscriptions WHERE lease_expires_time < now()`)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `UPDATE websub_hub_subscriptions w SET next_push_time=now() + $1 * interval '1 millisecond',
+		push_attempts=w.push_attempts + 1
+		FROM rss
+		WHERE rss.id=w.rss_id AND w.id IN (
+			SELECT id FROM websub_hub_subscriptions WHERE next_push_time <= now()
+			ORDER BY next_push_time LIMIT $2 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING w.id, w.rss_id, rss.email, rss.name, w.callback, w.secret, w.push_attempts, rss.cached_rss_gzip, rss.cached_rss_br`
+	rows, err := db.db.Query(query, lease.Milliseconds(), batchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	pushes := make([]*HubPush, 0, batchSize)
+	for rows.Next() {
+		push := &HubPush{}
+		var gzipped, brotlied []byte
+		err = rows.Scan(&push.ID, &push.RssID, &push.Email, &push.Name, &push.Callback, &push.Secret, &push.Attempts, &gzipped, &brotlied)
+		if err != nil {
+			return nil, err
+		}
+		if len(gzipped) > 0 {
+			push.Feed = &compress.Encoded{Gzip: gzipped, Brotli: brotlied}
+		}
+		pushes = append(pushes, push)
+	}
+
+	return pushes, rows.Err()
+}
+
+func (db *database) FinishHubPush(id int64, retryAfter time.Duration) error {
+	start := time.Now()
+
+	err := db.finishHubPush(id, retryAfter)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	db.histogram.WithLabelValues("finish_hub_push", status).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+// finishHubPush leaves push due if rss was changed again while it was pushed, so the newer feed is pushed too
+func (db *database) finishHubPush(id int64, retryAfter time.Duration) error {
+	if retryAfter <= 0 {
+		query := `UPDATE websub_hub_subscriptions SET next_push_time=NULL, push_attempts=0
+			WHERE id=$1 AND next_push_time > now()`
+		_, err := db.db.Exec(query, id)
+		return err
+	}
+
+	query := `UPDATE websub_hub_subscriptions SET next_push_time=now() + $1 * interval '1 millisecond'
+		WHERE id=$2 AND next_push_time > now()`
+	_, err := db.db.Exec(query, retryAfter.Milliseconds(), id)
+	return err
+}
@@ -0,0 +1,105 @@
+//go:generate mockgen -package ${GOPACKAGE} -destination mock_mailer.go -source mailer.go
+package digest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"service-rss/internal/config"
+)
+
+// Mailer sends email with plain text and html alternatives, unsubscribe url is advertised by List-Unsubscribe header
+type Mailer interface {
+	Send(to string, subject string, text string, html string, unsubscribeUrl string) error
+}
+
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSmtpMailer makes mailer which sends through relay, relay without username is used without authentication
+func NewSmtpMailer(cfg *config.Config) Mailer {
+	var auth smtp.Auth
+	if len(cfg.SmtpUsername) > 0 {
+		auth = smtp.PlainAuth("", cfg.SmtpUsername, cfg.SmtpPassword, cfg.SmtpHost)
+	}
+
+	return &smtpMailer{
+		addr: net.JoinHostPort(cfg.SmtpHost, strconv.Itoa(cfg.SmtpPort)),
+		auth: auth,
+		from: cfg.SmtpFrom,
+	}
+}
+
+func (m *smtpMailer) Send(to string, subject string, text string, html string, unsubscribeUrl string) error {
+	msg, err := message(m.from, to, subject, text, html, unsubscribeUrl, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to}, msg)
+}
+
+// message builds multipart/alternative email, the last part is preferred by clients.
+// Unsubscribe url accepts one-click unsubscribe by post of mail clients
+func message(from string, to string, subject string, text string, html string, unsubscribeUrl string, date time.Time) ([]byte, error) {
+	boundary, err := newBoundary()
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "From: %s\r\n", from)
+	fmt.Fprintf(buf, "To: %s\r\n", to)
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	if len(unsubscribeUrl) > 0 {
+		fmt.Fprintf(buf, "List-Unsubscribe: <%s>\r\n", unsubscribeUrl)
+		fmt.Fprintf(buf, "List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n")
+	}
+	fmt.Fprintf(buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+	for _, part := range []struct {
+		contentType string
+		body        string
+	}{
+		{contentType: "text/plain", body: text},
+		{contentType: "text/html", body: html},
+	} {
+		fmt.Fprintf(buf, "--%s\r\n", boundary)
+		fmt.Fprintf(buf, "Content-Type: %s; charset=utf-8\r\n", part.contentType)
+		fmt.Fprintf(buf, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+		w := quotedprintable.NewWriter(buf)
+		if _, err = w.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err = w.Close(); err != nil {
+			return nil, err
+		}
+		buf.WriteString("\r\n")
+	}
+	fmt.Fprintf(buf, "--%s--\r\n", boundary)
+
+	return buf.Bytes(), nil
+}
+
+func newBoundary() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
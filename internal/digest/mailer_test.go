@@ -0,0 +1,152 @@
+package digest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/config"
+)
+
+// smtpStandIn accepts one message like relay and sends it to channel
+type smtpStandIn struct {
+	listener net.Listener
+	messages chan string
+	rcpts    chan string
+}
+
+func newSmtpStandIn(t *testing.T) *smtpStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &smtpStandIn{listener: listener, messages: make(chan string, 1), rcpts: make(chan string, 1)}
+	go s.serve()
+
+	return s
+}
+
+func (s *smtpStandIn) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) {
+		fmt.Fprintf(conn, "%s\r\n", line)
+	}
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			s.rcpts <- strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>")
+			reply("250 OK")
+		case strings.HasPrefix(command, "DATA"):
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			data := &strings.Builder{}
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			s.messages <- data.String()
+			reply("250 OK")
+		case strings.HasPrefix(command, "QUIT"):
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSmtpMailer_Send(t *testing.T) {
+	standIn := newSmtpStandIn(t)
+	defer standIn.listener.Close()
+
+	addr := standIn.listener.Addr().(*net.TCPAddr)
+	cfg := &config.Config{SmtpHost: addr.IP.String(), SmtpPort: addr.Port, SmtpFrom: "rss@example.com"}
+
+	err := NewSmtpMailer(cfg).Send("reader@example.com", "Test digest: 1 new item", "one\nhttps://one.com/1", "<a href=\"https://one.com/1\">one</a>",
+		"http://localhost/digests/1/unsubscribe/token")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "reader@example.com", <-standIn.rcpts)
+
+	msg, err := mail.ReadMessage(strings.NewReader(<-standIn.messages))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "rss@example.com", msg.Header.Get("From"))
+	assert.Equal(t, "reader@example.com", msg.Header.Get("To"))
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Test digest: 1 new item", subject)
+	assert.Equal(t, "<http://localhost/digests/1/unsubscribe/token>", msg.Header.Get("List-Unsubscribe"))
+	assert.Equal(t, "List-Unsubscribe=One-Click", msg.Header.Get("List-Unsubscribe-Post"))
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	parts := make(map[string]string)
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		body, err := io.ReadAll(part)
+		assert.NoError(t, err)
+		parts[part.Header.Get("Content-Type")] = string(body)
+	}
+
+	assert.Equal(t, map[string]string{
+		// relay client sends lines with crlf
+		"text/plain; charset=utf-8": "one\r\nhttps://one.com/1",
+		"text/html; charset=utf-8":  "<a href=\"https://one.com/1\">one</a>",
+	}, parts)
+}
+
+func TestMessage(t *testing.T) {
+	date := time.Date(2021, time.March, 10, 8, 0, 0, 0, time.UTC)
+
+	msg, err := message("rss@example.com", "reader@example.com", "Новости digest", "text", "html", "", date)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(msg), "List-Unsubscribe")
+	assert.Contains(t, string(msg), "Subject: =?utf-8?q?")
+	assert.Contains(t, string(msg), "Date: Wed, 10 Mar 2021 08:00:00 +0000\r\n")
+}
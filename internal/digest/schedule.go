@@ -0,0 +1,19 @@
+package digest
+
+import (
+	"time"
+
+	"service-rss/internal/database"
+)
+
+// Next returns the next sending time after now, digests are sent at hour of their time zone, weekly ones on monday
+func Next(frequency string, loc *time.Location, hour int, now time.Time) time.Time {
+	local := now.In(loc)
+	next := time.Date(local.Year(), local.Month(), local.Day(), hour, 0, 0, 0, loc)
+	// days are added by date instead of duration, so hour is kept when offset of zone changes
+	for day := 1; !next.After(now) || (frequency == database.DigestWeekly && next.Weekday() != time.Monday); day++ {
+		next = time.Date(local.Year(), local.Month(), local.Day()+day, hour, 0, 0, 0, loc)
+	}
+
+	return next
+}
@@ -0,0 +1,290 @@
+package digest
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+
+	"service-rss/internal/config"
+	"service-rss/internal/database"
+	"service-rss/internal/rss"
+	"service-rss/internal/safe"
+)
+
+const (
+	batchSize = 10
+	// digest is retried if replica fails before it is sent
+	lease           = 10 * time.Minute
+	snippetMaxRunes = 300
+)
+
+// Data is data of digest templates
+type Data struct {
+	Feed        Feed
+	Items       []Item
+	Unsubscribe string // url which deletes digest
+}
+
+type Feed struct {
+	Name  string
+	Title string
+	Url   string
+}
+
+type Item struct {
+	Title   string
+	Link    string
+	Snippet string
+	Date    string // publishing time in time zone of digest, it is empty for items without it
+}
+
+// Sender emails due digests of all replicas
+type Sender struct {
+	db           database.Database
+	mailer       Mailer
+	htmlTemplate *htmltemplate.Template
+	textTemplate *template.Template
+	publicUrl    string
+	hour         int
+	checkPeriod  time.Duration
+	retry        time.Duration
+	maxAttempts  int
+	counter      *prometheus.CounterVec
+
+	// graceful shutdown helper-channels
+	shutdownChan     chan interface{}
+	shutdownWaitChan chan interface{}
+}
+
+func NewSender(cfg *config.Config, db database.Database) (*Sender, error) {
+	rawHtml, err := os.ReadFile("html/digest.html")
+	if err != nil {
+		return nil, err
+	}
+
+	htmlTemplate, err := htmltemplate.New("digest").Parse(string(rawHtml))
+	if err != nil {
+		return nil, err
+	}
+
+	rawText, err := os.ReadFile("html/digest.txt")
+	if err != nil {
+		return nil, err
+	}
+
+	textTemplate, err := template.New("digest").Parse(string(rawText))
+	if err != nil {
+		return nil, err
+	}
+
+	sender := newSender(cfg, db, NewSmtpMailer(cfg), htmlTemplate, textTemplate)
+
+	err = prometheus.Register(sender.counter)
+	if err != nil {
+		return nil, err
+	}
+
+	return sender, nil
+}
+
+// newSender makes sender with parsed templates without registering its metrics
+func newSender(cfg *config.Config, db database.Database, mailer Mailer, htmlTemplate *htmltemplate.Template,
+	textTemplate *template.Template) *Sender {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "digest_events_counter",
+		Help: "Counter of email digests by event",
+	}, []string{"event"})
+
+	return &Sender{
+		db:           db,
+		mailer:       mailer,
+		htmlTemplate: htmlTemplate,
+		textTemplate: textTemplate,
+		publicUrl:    cfg.ServerPublicUrl,
+		hour:         cfg.DigestHour,
+		checkPeriod:  cfg.DigestCheckPeriod,
+		retry:        cfg.DigestRetry,
+		maxAttempts:  cfg.DigestMaxAttempts,
+		counter:      counter,
+
+		shutdownChan:     make(chan interface{}),
+		shutdownWaitChan: make(chan interface{}),
+	}
+}
+
+func (s *Sender) Start() {
+	defer close(s.shutdownWaitChan)
+
+	ticker := time.NewTicker(s.checkPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.shutdownChan:
+			return
+		case <-ticker.C:
+			safe.Do(s.sendDue)
+		}
+	}
+}
+
+func (s *Sender) Shutdown() {
+	close(s.shutdownChan)
+	<-s.shutdownWaitChan
+}
+
+func (s *Sender) sendDue() {
+	for {
+		digests, err := s.db.LeaseDigests(batchSize, lease)
+		if err != nil {
+			log.WithError(err).Error("failed to lease digests")
+			return
+		}
+
+		for _, digest := range digests {
+			select {
+			case <-s.shutdownChan:
+				return
+			default:
+			}
+
+			s.send(digest, time.Now())
+		}
+
+		if len(digests) < batchSize {
+			return
+		}
+	}
+}
+
+// send emails new items of digest, digest without new items is rescheduled without email
+func (s *Sender) send(digest *database.Digest, now time.Time) {
+	logger := log.WithField("id", digest.ID)
+
+	loc, err := time.LoadLocation(digest.TimeZone)
+	if err != nil {
+		// time zone is validated on creation, it may be missing from tz database of replica only
+		logger.WithError(err).Warn("failed to load time zone of digest")
+		loc = time.UTC
+	}
+	next := Next(digest.Frequency, loc, s.hour, now)
+
+	items, err := s.db.GetDigestItems(digest, digest.MaxItems)
+	if err != nil {
+		s.fail(digest, err, next, now)
+		return
+	}
+
+	if len(items) > 0 {
+		unsubscribeUrl := UnsubscribeUrl(s.publicUrl, digest.ID, digest.UnsubscribeToken)
+		subject, text, html, err := s.render(digest, items, loc, unsubscribeUrl)
+		if err == nil {
+			err = s.mailer.Send(digest.Recipient, subject, text, html, unsubscribeUrl)
+		}
+		if err != nil {
+			s.fail(digest, err, next, now)
+			return
+		}
+		s.counter.WithLabelValues("sent").Inc()
+	}
+
+	itemIDs := make([]int64, 0, len(items))
+	for _, item := range items {
+		itemIDs = append(itemIDs, item.ID)
+	}
+
+	err = s.db.FinishDigest(digest, itemIDs, next)
+	if err != nil {
+		// items are sent again by the next digest
+		logger.WithError(err).Error("failed to finish digest")
+	}
+}
+
+// fail retries digest after delay growing with attempts, digest is skipped till the next time after max attempts
+func (s *Sender) fail(digest *database.Digest, err error, next time.Time, now time.Time) {
+	logger := log.WithError(err).WithField("id", digest.ID)
+
+	attempts := digest.Attempts
+	retryTime := now.Add(time.Duration(attempts) * s.retry)
+	if attempts >= s.maxAttempts || !retryTime.Before(next) {
+		logger.Warn("digest is skipped after retries")
+		s.counter.WithLabelValues("skipped").Inc()
+		attempts = 0
+		retryTime = next
+	} else {
+		logger.Warn("failed to send digest")
+		s.counter.WithLabelValues("failed").Inc()
+	}
+
+	err = s.db.FailDigest(digest.ID, err.Error(), retryTime, attempts)
+	if err != nil {
+		log.WithError(err).WithField("id", digest.ID).Error("failed to save failure of digest")
+	}
+}
+
+func (s *Sender) render(digest *database.Digest, items []*database.Item, loc *time.Location, unsubscribeUrl string) (string, string, string, error) {
+	feed := Feed{
+		Name:  digest.Rss.Name,
+		Title: digest.Rss.Name,
+		Url:   rss.FeedUrl(s.publicUrl, digest.Rss.Email, digest.Rss.Name),
+	}
+	if digest.Rss.Channel != nil && len(digest.Rss.Channel.Title) > 0 {
+		feed.Title = digest.Rss.Channel.Title
+	}
+
+	data := &Data{Feed: feed, Items: make([]Item, 0, len(items)), Unsubscribe: unsubscribeUrl}
+	for _, item := range items {
+		digestItem := Item{
+			Title:   item.Title,
+			Link:    item.Link,
+			Snippet: snippet(item.Content),
+		}
+		if len(digestItem.Title) == 0 {
+			digestItem.Title = item.Link
+		}
+		if item.PublishedTime != nil {
+			digestItem.Date = item.PublishedTime.In(loc).Format("Jan 2, 15:04")
+		}
+		data.Items = append(data.Items, digestItem)
+	}
+
+	text := &bytes.Buffer{}
+	if err := s.textTemplate.Execute(text, data); err != nil {
+		return "", "", "", err
+	}
+
+	html := &bytes.Buffer{}
+	if err := s.htmlTemplate.Execute(html, data); err != nil {
+		return "", "", "", err
+	}
+
+	subject := fmt.Sprintf("%s digest: %d new items", feed.Title, len(items))
+	if len(items) == 1 {
+		subject = fmt.Sprintf("%s digest: 1 new item", feed.Title)
+	}
+
+	return subject, text.String(), html.String(), nil
+}
+
+// snippet cuts content by word boundary
+func snippet(content string) string {
+	content = strings.Join(strings.Fields(content), " ")
+	if utf8.RuneCountInString(content) <= snippetMaxRunes {
+		return content
+	}
+
+	cut := string([]rune(content)[:snippetMaxRunes])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+
+	return cut + "…"
+}
@@ -0,0 +1,142 @@
+package digest
+
+import (
+	"errors"
+	htmltemplate "html/template"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/config"
+	"service-rss/internal/database"
+)
+
+func newTestSender(db database.Database, mailer Mailer) *Sender {
+	return newSender(&config.Config{
+		ServerPublicUrl:   "http://localhost",
+		DigestHour:        8,
+		DigestCheckPeriod: time.Minute,
+		DigestRetry:       10 * time.Minute,
+		DigestMaxAttempts: 3,
+	}, db, mailer,
+		htmltemplate.Must(htmltemplate.New("digest").Parse(
+			`<h2>{{.Feed.Title}}</h2>{{range .Items}}<a href="{{.Link}}">{{.Title}}</a>{{.Date}}{{end}}`)),
+		template.Must(template.New("digest").Parse(
+			`{{.Feed.Title}} {{.Feed.Url}}{{range .Items}}|{{.Title}} {{.Link}} {{.Snippet}}{{end}}|{{.Unsubscribe}}`)))
+}
+
+func TestNext(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	assert.NoError(t, err)
+	newYork, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+
+	// wednesday
+	now := time.Date(2021, time.March, 10, 4, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, time.Date(2021, time.March, 10, 8, 0, 0, 0, time.UTC), Next(database.DigestDaily, time.UTC, 8, now))
+	// it is 7 am in moscow already
+	assert.Equal(t, time.Date(2021, time.March, 11, 7, 0, 0, 0, moscow), Next(database.DigestDaily, moscow, 7, now))
+	assert.Equal(t, time.Date(2021, time.March, 15, 8, 0, 0, 0, time.UTC), Next(database.DigestWeekly, time.UTC, 8, now))
+	// hour is kept after daylight saving time starts on march 14
+	assert.Equal(t, time.Date(2021, time.March, 15, 8, 0, 0, 0, newYork), Next(database.DigestWeekly, newYork, 8, now))
+	// digest sent at hour is scheduled for the next day
+	sent := time.Date(2021, time.March, 10, 8, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2021, time.March, 11, 8, 0, 0, 0, time.UTC), Next(database.DigestDaily, time.UTC, 8, sent))
+}
+
+func TestSender_Send(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	now := time.Date(2021, time.March, 10, 8, 0, 30, 0, time.UTC)
+	published := time.Date(2021, time.March, 10, 6, 0, 0, 0, time.UTC)
+
+	digest := &database.Digest{
+		ID:        1,
+		Rss:       &database.Rss{Email: "example@gmail.com", Name: "test", Channel: &database.ChannelSettings{Title: "Test"}},
+		Recipient: "reader@example.com",
+		Frequency: database.DigestDaily,
+		TimeZone:  "Europe/Moscow",
+		MaxItems:  10,
+		Attempts:  1,
+
+		UnsubscribeToken: "token",
+	}
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().GetDigestItems(digest, 10).Return([]*database.Item{
+		{ID: 3, Title: "three <b>", Link: "https://one.com/3", Content: "three\n content", PublishedTime: &published},
+		{ID: 2, Link: "https://one.com/2"},
+	}, nil)
+	db.EXPECT().FinishDigest(digest, []int64{3, 2}, time.Date(2021, time.March, 11, 8, 0, 0, 0, digestZone(t, "Europe/Moscow"))).Return(nil)
+
+	mailer := NewMockMailer(ctrl)
+	mailer.EXPECT().Send("reader@example.com", "Test digest: 2 new items",
+		"Test http://localhost/example@gmail.com/test|three <b> https://one.com/3 three content|https://one.com/2 https://one.com/2 "+
+			"|http://localhost/digests/1/unsubscribe/token",
+		`<h2>Test</h2><a href="https://one.com/3">three &lt;b&gt;</a>Mar 10, 09:00<a href="https://one.com/2">https://one.com/2</a>`,
+		"http://localhost/digests/1/unsubscribe/token",
+	).Return(nil)
+
+	newTestSender(db, mailer).send(digest, now)
+
+	t.Run("without items", func(t *testing.T) {
+		db.EXPECT().GetDigestItems(digest, 10).Return([]*database.Item{}, nil)
+		db.EXPECT().FinishDigest(digest, []int64{}, gomock.Any()).Return(nil)
+
+		newTestSender(db, mailer).send(digest, now)
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		db.EXPECT().GetDigestItems(gomock.Any(), 10).Return([]*database.Item{{ID: 3, Title: "three"}}, nil)
+		mailer.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("554 rejected"))
+		// cursor is kept, so items are sent by retry
+		db.EXPECT().FailDigest(int64(1), "554 rejected", now.Add(20*time.Minute), 2).Return(nil)
+
+		failed := *digest
+		failed.Attempts = 2
+		newTestSender(db, mailer).send(&failed, now)
+	})
+
+	t.Run("skipped after retries", func(t *testing.T) {
+		db.EXPECT().GetDigestItems(gomock.Any(), 10).Return(nil, errors.New("error"))
+		db.EXPECT().FailDigest(int64(1), "error", time.Date(2021, time.March, 11, 8, 0, 0, 0, digestZone(t, "Europe/Moscow")), 0).Return(nil)
+
+		failed := *digest
+		failed.Attempts = 3
+		newTestSender(db, mailer).send(&failed, now)
+	})
+}
+
+func TestSender_SendDue(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	digest := &database.Digest{ID: 1, Rss: &database.Rss{Name: "test"}, TimeZone: "UTC", MaxItems: 5}
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().LeaseDigests(batchSize, lease).Return([]*database.Digest{digest}, nil)
+	db.EXPECT().GetDigestItems(digest, 5).Return([]*database.Item{}, nil)
+	db.EXPECT().FinishDigest(digest, []int64{}, gomock.Any()).Return(nil)
+
+	newTestSender(db, NewMockMailer(ctrl)).sendDue()
+}
+
+func TestSnippet(t *testing.T) {
+	assert.Equal(t, "one two", snippet(" one\n\ttwo "))
+
+	long := snippet(strings.Repeat("word ", 100))
+	assert.True(t, strings.HasSuffix(long, "word…"))
+	assert.Len(t, []rune(long), 300)
+}
+
+func digestZone(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	assert.NoError(t, err)
+	return loc
+}
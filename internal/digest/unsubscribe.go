@@ -0,0 +1,23 @@
+package digest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// UnsubscribeUrl is url of unsubscribe link of digest, token keeps others from deleting digests by id
+func UnsubscribeUrl(publicUrl string, id int64, token string) string {
+	return fmt.Sprintf("%s/digests/%d/unsubscribe/%s", strings.TrimRight(publicUrl, "/"), id, token)
+}
+
+// NewUnsubscribeToken makes random token of unsubscribe link
+func NewUnsubscribeToken() (string, error) {
+	token := make([]byte, 20)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(token), nil
+}
@@ -2,39 +2,355 @@ package dto
 
 import "encoding/xml"
 
+const (
+	NamespaceAtom    = "http://www.w3.org/2005/Atom"
+	NamespaceItunes  = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+	NamespacePodcast = "https://podcastindex.org/namespace/1.0"
+)
+
 type ErrorResponse struct {
-	Error string `json:"error"`
-	Value string `json:"value,omitempty"`
+	Error   string            `json:"error"`
+	Value   string            `json:"value,omitempty"`
+	Sources []*SourceCheckOut `json:"sources,omitempty"`
 }
 
 type RssFeed struct {
-	XMLName xml.Name        `xml:"rss"`
-	Channel *RssFeedChannel `xml:"channel"`
+	XMLName          xml.Name        `xml:"rss"`
+	Version          string          `xml:"version,attr,omitempty"`
+	NamespaceAtom    string          `xml:"xmlns:atom,attr,omitempty"`
+	NamespaceItunes  string          `xml:"xmlns:itunes,attr,omitempty"`
+	NamespacePodcast string          `xml:"xmlns:podcast,attr,omitempty"`
+	Channel          *RssFeedChannel `xml:"channel"`
 }
 
+// RssFeedChannel keeps namespaced elements first, since decoder puts element into the first field
+// with matching name and fields without namespace match elements of any namespace
 type RssFeedChannel struct {
+	AtomLink []*AtomLink `xml:"http://www.w3.org/2005/Atom link,omitempty"`
+	AtomIcon string      `xml:"http://www.w3.org/2005/Atom icon,omitempty"`
+
+	ItunesAuthor   string            `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd author,omitempty"`
+	ItunesOwner    *ItunesOwner      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd owner,omitempty"`
+	ItunesImage    *ItunesImage      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image,omitempty"`
+	ItunesCategory []*ItunesCategory `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd category,omitempty"`
+	ItunesExplicit string            `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd explicit,omitempty"`
+	ItunesType     string            `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd type,omitempty"`
+	PodcastLocked  *PodcastLocked    `xml:"https://podcastindex.org/namespace/1.0 locked,omitempty"`
+	PodcastGuid    string            `xml:"https://podcastindex.org/namespace/1.0 guid,omitempty"`
+
 	Title         string         `xml:"title"`
 	Link          string         `xml:"link"`
 	Description   string         `xml:"description"`
+	Language      string         `xml:"language,omitempty"`
+	Copyright     string         `xml:"copyright,omitempty"`
+	Category      []string       `xml:"category,omitempty"`
+	Image         *RssFeedImage  `xml:"image,omitempty"`
 	LastBuildDate string         `xml:"lastBuildDate,omitempty"`
 	Ttl           int64          `xml:"ttl,omitempty"`
+	SkipHours     *SkipHours     `xml:"skipHours,omitempty"`
+	SkipDays      *SkipDays      `xml:"skipDays,omitempty"`
 	Items         []*RssFeedItem `xml:"item"`
 }
 
+// SkipHours are hours in GMT when source should not be read, they are used for scheduling only
+type SkipHours struct {
+	Hours []int64 `xml:"hour"`
+}
+
+type SkipDays struct {
+	Days []string `xml:"day"`
+}
+
 type RssFeedItem struct {
-	Title       string   `xml:"title,omitempty"`
-	Link        string   `xml:"link,omitempty"`
-	Description string   `xml:"description,omitempty"`
-	Author      string   `xml:"author,omitempty"`
-	Category    []string `xml:"category,omitempty"`
-	Comments    string   `xml:"comments,omitempty"`
-	Enclosure   string   `xml:"enclosure,omitempty"`
-	Guid        string   `xml:"guid,omitempty"`
-	PubDate     string   `xml:"pubDate,omitempty"`
-	Source      string   `xml:"source,omitempty"`
+	Title       string            `xml:"title,omitempty"`
+	Link        string            `xml:"link,omitempty"`
+	Description string            `xml:"description,omitempty"`
+	Author      string            `xml:"author,omitempty"`
+	Category    []string          `xml:"category,omitempty"`
+	Comments    string            `xml:"comments,omitempty"`
+	Enclosure   *RssFeedEnclosure `xml:"enclosure,omitempty"`
+	Guid        string            `xml:"guid,omitempty"`
+	PubDate     string            `xml:"pubDate,omitempty"`
+	Source      *RssFeedSource    `xml:"source,omitempty"`
+
+	ItunesDuration    string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration,omitempty"`
+	ItunesEpisode     string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episode,omitempty"`
+	ItunesSeason      string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd season,omitempty"`
+	ItunesEpisodeType string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episodeType,omitempty"`
+	ItunesExplicit    string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd explicit,omitempty"`
+	ItunesImage       *ItunesImage `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image,omitempty"`
+}
+
+type RssFeedEnclosure struct {
+	Url    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type RssFeedImage struct {
+	Url   string `xml:"url"`
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+}
+
+type RssFeedSource struct {
+	Url   string `xml:"url,attr"`
+	Title string `xml:",chardata"`
+}
+
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type ItunesOwner struct {
+	Name  string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd name,omitempty"`
+	Email string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd email,omitempty"`
+}
+
+type ItunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+type ItunesCategory struct {
+	Text          string            `xml:"text,attr"`
+	Subcategories []*ItunesCategory `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd category,omitempty"`
 }
 
+type PodcastLocked struct {
+	Owner  string `xml:"owner,attr,omitempty"`
+	Locked string `xml:",chardata"`
+}
+
+// RssCreateIn is used both for creation and update of rss
 type RssCreateIn struct {
-	Name    string   `json:"name"`
-	Sources []string `json:"sources"`
+	Name      string       `json:"name"`
+	Sources   []string     `json:"sources"`
+	Mode      string       `json:"mode,omitempty"`
+	Channel   *ChannelIn   `json:"channel,omitempty"`
+	Podcast   *PodcastIn   `json:"podcast,omitempty"`
+	Retention *RetentionIn `json:"retention,omitempty"`
+	// Search makes saved search over other rss of user, it is used instead of sources
+	Search *SearchIn `json:"search,omitempty"`
+	// Force saves rss even if some of sources failed validation
+	Force bool `json:"force,omitempty"`
+}
+
+type SearchIn struct {
+	Query string   `json:"query"`
+	Feeds []string `json:"feeds"`
+}
+
+type ChannelIn struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Link        string `json:"link,omitempty"`
+	Language    string `json:"language,omitempty"`
+	Image       string `json:"image,omitempty"`
+	Icon        string `json:"icon,omitempty"`
+	Copyright   string `json:"copyright,omitempty"`
+	Category    string `json:"category,omitempty"`
+}
+
+type PodcastIn struct {
+	Author      string `json:"author"`
+	OwnerName   string `json:"owner_name,omitempty"`
+	OwnerEmail  string `json:"owner_email"`
+	Image       string `json:"image"`
+	Category    string `json:"category"`
+	Subcategory string `json:"subcategory,omitempty"`
+	Explicit    bool   `json:"explicit,omitempty"`
+	Language    string `json:"language,omitempty"` // deprecated, channel language is used instead
+	Type        string `json:"type,omitempty"`
+	Locked      bool   `json:"locked,omitempty"`
+}
+
+type RetentionIn struct {
+	MaxItems int `json:"max_items,omitempty"`
+	MaxDays  int `json:"max_days,omitempty"`
+}
+
+type ItemPinIn struct {
+	Name   string `json:"name"`
+	Item   string `json:"item"`
+	Pinned bool   `json:"pinned"`
+}
+
+type SourcesDiscoverIn struct {
+	Url string `json:"url"`
+}
+
+type SourcesDiscoverOut struct {
+	Feeds []*DiscoveredFeedOut `json:"feeds"`
+}
+
+type SourcesScrapeIn struct {
+	Url     string `json:"url"`
+	Item    string `json:"item"`
+	Title   string `json:"title"`
+	Link    string `json:"link"`
+	Date    string `json:"date"`
+	Summary string `json:"summary"`
+}
+
+type SourcesScrapeOut struct {
+	Source string            `json:"source"`
+	Error  string            `json:"error,omitempty"`
+	Items  []*ScrapedItemOut `json:"items"`
+}
+
+type ScrapedItemOut struct {
+	Title   string `json:"title"`
+	Link    string `json:"link,omitempty"`
+	PubDate string `json:"pub_date,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+type DiscoveredFeedOut struct {
+	Url   string `json:"url"`
+	Title string `json:"title,omitempty"`
+	Type  string `json:"type"`
+}
+
+type SourceCheckOut struct {
+	Url    string               `json:"url"`
+	Status string               `json:"status"`
+	Error  string               `json:"error,omitempty"`
+	Feeds  []*DiscoveredFeedOut `json:"feeds,omitempty"`
+}
+
+type RssPreviewOut struct {
+	Title       string                 `json:"title"`
+	Link        string                 `json:"link"`
+	Description string                 `json:"description"`
+	Ttl         int64                  `json:"ttl"`
+	Items       []*PreviewItemOut      `json:"items"`
+	Sources     []*SourceDiagnosticOut `json:"sources"`
+}
+
+type PreviewItemOut struct {
+	Title   string `json:"title,omitempty"`
+	Link    string `json:"link,omitempty"`
+	PubDate string `json:"pub_date,omitempty"`
+	Source  string `json:"source,omitempty"`
+}
+
+type SourceDiagnosticOut struct {
+	Url        string `json:"url"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	Items      int    `json:"items"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+type RssRefreshOut struct {
+	Status string `json:"status"`
+}
+
+type SearchOut struct {
+	Query string           `json:"query"`
+	Items []*SearchItemOut `json:"items"`
+}
+
+type SearchItemOut struct {
+	Source         string  `json:"source"`
+	Title          string  `json:"title,omitempty"`
+	Link           string  `json:"link,omitempty"`
+	PubDate        string  `json:"pub_date,omitempty"`
+	Rank           float64 `json:"rank"`
+	TitleHighlight string  `json:"title_highlight,omitempty"`
+	Snippet        string  `json:"snippet,omitempty"`
+}
+
+type WebhookCreateIn struct {
+	Name     string `json:"name"`
+	Url      string `json:"url"`
+	Secret   string `json:"secret,omitempty"`
+	Template string `json:"template,omitempty"`
+}
+
+// DeleteIn is input of deleting objects of owner like webhooks, digests and newsletters
+type DeleteIn struct {
+	ID int64 `json:"id"`
+}
+
+type WebhookRedeliverIn struct {
+	ID       int64 `json:"id"`
+	Delivery int64 `json:"delivery,omitempty"`
+}
+
+type WebhooksOut struct {
+	Webhooks []*WebhookOut `json:"webhooks"`
+}
+
+type WebhookOut struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Url         string `json:"url"`
+	Secret      string `json:"secret,omitempty"` // secret is returned only when webhook is created
+	Template    string `json:"template"`
+	CreatedTime string `json:"created_time"`
+}
+
+type WebhookDeliveriesOut struct {
+	Deliveries []*WebhookDeliveryOut `json:"deliveries"`
+}
+
+type WebhookDeliveryOut struct {
+	ID          int64  `json:"id"`
+	State       string `json:"state"`
+	Attempts    int    `json:"attempts"`
+	StatusCode  int    `json:"status_code,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Payload     string `json:"payload"`
+	CreatedTime string `json:"created_time"`
+	UpdatedTime string `json:"updated_time"`
+}
+
+type WebhookRedeliverOut struct {
+	Redelivered int `json:"redelivered"`
+}
+
+type DigestCreateIn struct {
+	Email     string `json:"email,omitempty"`
+	Name      string `json:"name"`
+	Recipient string `json:"recipient"`
+	Frequency string `json:"frequency"`
+	TimeZone  string `json:"time_zone,omitempty"`
+	MaxItems  int    `json:"max_items,omitempty"`
+}
+
+type DigestsOut struct {
+	Digests []*DigestOut `json:"digests"`
+}
+
+type DigestOut struct {
+	ID           int64  `json:"id"`
+	Email        string `json:"email"`
+	Name         string `json:"name"`
+	Recipient    string `json:"recipient"`
+	Frequency    string `json:"frequency"`
+	TimeZone     string `json:"time_zone"`
+	MaxItems     int    `json:"max_items"`
+	LastSentTime string `json:"last_sent_time"`
+	NextSendTime string `json:"next_send_time"`
+	Error        string `json:"error,omitempty"`
+	CreatedTime  string `json:"created_time"`
+}
+
+type NewsletterCreateIn struct {
+	Name string `json:"name"`
+}
+
+type NewslettersOut struct {
+	Newsletters []*NewsletterOut `json:"newsletters"`
+}
+
+type NewsletterOut struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Address     string `json:"address"`
+	Source      string `json:"source"`
+	CreatedTime string `json:"created_time"`
 }
@@ -0,0 +1,102 @@
+package dto
+
+import "encoding/xml"
+
+// encoding/xml can't write namespace prefixes, so elements from extension namespaces
+// are decoded by namespace url and encoded through the mirror types below with the
+// prefix spelled out in the tag. Prefixes are declared on the root element.
+
+type rssFeedChannelXml struct {
+	Title         string        `xml:"title"`
+	AtomLink      []*AtomLink   `xml:"atom:link,omitempty"`
+	Link          string        `xml:"link"`
+	Description   string        `xml:"description"`
+	Language      string        `xml:"language,omitempty"`
+	Copyright     string        `xml:"copyright,omitempty"`
+	Category      []string      `xml:"category,omitempty"`
+	Image         *RssFeedImage `xml:"image,omitempty"`
+	AtomIcon      string        `xml:"atom:icon,omitempty"`
+	LastBuildDate string        `xml:"lastBuildDate,omitempty"`
+	Ttl           int64         `xml:"ttl,omitempty"`
+
+	ItunesAuthor   string            `xml:"itunes:author,omitempty"`
+	ItunesOwner    *ItunesOwner      `xml:"itunes:owner,omitempty"`
+	ItunesImage    *ItunesImage      `xml:"itunes:image,omitempty"`
+	ItunesCategory []*ItunesCategory `xml:"itunes:category,omitempty"`
+	ItunesExplicit string            `xml:"itunes:explicit,omitempty"`
+	ItunesType     string            `xml:"itunes:type,omitempty"`
+	PodcastLocked  *PodcastLocked    `xml:"podcast:locked,omitempty"`
+	PodcastGuid    string            `xml:"podcast:guid,omitempty"`
+
+	Items []*RssFeedItem `xml:"item"`
+}
+
+// MarshalXML copies fields one by one, since order of elements differs from RssFeedChannel
+func (c *RssFeedChannel) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement(&rssFeedChannelXml{
+		Title:         c.Title,
+		AtomLink:      c.AtomLink,
+		Link:          c.Link,
+		Description:   c.Description,
+		Language:      c.Language,
+		Copyright:     c.Copyright,
+		Category:      c.Category,
+		Image:         c.Image,
+		AtomIcon:      c.AtomIcon,
+		LastBuildDate: c.LastBuildDate,
+		Ttl:           c.Ttl,
+
+		ItunesAuthor:   c.ItunesAuthor,
+		ItunesOwner:    c.ItunesOwner,
+		ItunesImage:    c.ItunesImage,
+		ItunesCategory: c.ItunesCategory,
+		ItunesExplicit: c.ItunesExplicit,
+		ItunesType:     c.ItunesType,
+		PodcastLocked:  c.PodcastLocked,
+		PodcastGuid:    c.PodcastGuid,
+
+		Items: c.Items,
+	}, start)
+}
+
+type rssFeedItemXml struct {
+	Title       string            `xml:"title,omitempty"`
+	Link        string            `xml:"link,omitempty"`
+	Description string            `xml:"description,omitempty"`
+	Author      string            `xml:"author,omitempty"`
+	Category    []string          `xml:"category,omitempty"`
+	Comments    string            `xml:"comments,omitempty"`
+	Enclosure   *RssFeedEnclosure `xml:"enclosure,omitempty"`
+	Guid        string            `xml:"guid,omitempty"`
+	PubDate     string            `xml:"pubDate,omitempty"`
+	Source      *RssFeedSource    `xml:"source,omitempty"`
+
+	ItunesDuration    string       `xml:"itunes:duration,omitempty"`
+	ItunesEpisode     string       `xml:"itunes:episode,omitempty"`
+	ItunesSeason      string       `xml:"itunes:season,omitempty"`
+	ItunesEpisodeType string       `xml:"itunes:episodeType,omitempty"`
+	ItunesExplicit    string       `xml:"itunes:explicit,omitempty"`
+	ItunesImage       *ItunesImage `xml:"itunes:image,omitempty"`
+}
+
+func (i *RssFeedItem) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement((*rssFeedItemXml)(i), start)
+}
+
+type itunesOwnerXml struct {
+	Name  string `xml:"itunes:name,omitempty"`
+	Email string `xml:"itunes:email,omitempty"`
+}
+
+func (o *ItunesOwner) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement((*itunesOwnerXml)(o), start)
+}
+
+type itunesCategoryXml struct {
+	Text          string            `xml:"text,attr"`
+	Subcategories []*ItunesCategory `xml:"itunes:category,omitempty"`
+}
+
+func (c *ItunesCategory) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement((*itunesCategoryXml)(c), start)
+}
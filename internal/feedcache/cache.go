@@ -0,0 +1,247 @@
+//go:generate mockgen -package ${GOPACKAGE} -destination mock_cache.go -source cache.go
+package feedcache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+
+	"service-rss/internal/config"
+	"service-rss/internal/database"
+)
+
+// invalidations of keys are remembered up to that count, older ones are treated as invalidation of all keys
+const maxInvalidations = 4096
+
+// Cache keeps rendered feeds in memory in front of db, feeds are dropped when they are changed by any replica
+// and get new validity when they are cached again without changes
+type Cache interface {
+	Get(key string) (*Entry, bool)
+	// Put skips entry if its key has been invalidated since version was taken, so entry could be outdated
+	Put(key string, entry *Entry, version uint64)
+	// Version should be taken before feed is read from db
+	Version() uint64
+	Invalidate(key string)
+	// Touch sets validity of kept feed which is cached again without changes, entries are replaced rather than changed
+	// since they are read by handlers concurrently
+	Touch(key string, validFor time.Duration)
+	Start()
+	Shutdown()
+}
+
+type element struct {
+	key   string
+	entry *Entry
+}
+
+type cache struct {
+	listener database.RefreshListener
+	maxBytes int64
+	maxAge   time.Duration
+
+	requestsCounter  *prometheus.CounterVec
+	evictionsCounter prometheus.Counter
+	bytesGauge       prometheus.Gauge
+
+	mutex   sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	bytes   int64
+	// version is incremented on every invalidation, invalidated keeps version of the last invalidation of key
+	// and purged is version of the last invalidation of all keys
+	version     uint64
+	invalidated map[string]uint64
+	purged      uint64
+
+	// graceful shutdown helper-channels
+	shutdownChan     chan interface{}
+	shutdownWaitChan chan interface{}
+}
+
+// New makes cache invalidated by listener notifications, zero max bytes disables cache
+func New(cfg *config.Config, listener database.RefreshListener) (Cache, error) {
+	requestsCounter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hot_cache_requests_counter",
+		Help: "Counter of hot cache requests by result",
+	}, []string{"result"})
+
+	evictionsCounter := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hot_cache_evictions_counter",
+		Help: "Counter of feeds evicted from hot cache to fit its size",
+	})
+
+	bytesGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "hot_cache_bytes",
+		Help: "Size of feeds in hot cache in bytes",
+	})
+
+	for _, collector := range []prometheus.Collector{requestsCounter, evictionsCounter, bytesGauge} {
+		err := prometheus.Register(collector)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &cache{
+		listener: listener,
+		maxBytes: cfg.HotCacheMaxBytes,
+		maxAge:   cfg.HotCacheMaxAge,
+
+		requestsCounter:  requestsCounter,
+		evictionsCounter: evictionsCounter,
+		bytesGauge:       bytesGauge,
+
+		lru:         list.New(),
+		entries:     make(map[string]*list.Element),
+		invalidated: make(map[string]uint64),
+
+		shutdownChan:     make(chan interface{}),
+		shutdownWaitChan: make(chan interface{}),
+	}, nil
+}
+
+// Key of rss feed
+func Key(email string, name string) string {
+	return email + "/" + name
+}
+
+func (c *cache) Get(key string) (*Entry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		c.requestsCounter.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+
+	// invalidation could be lost, so feeds are not kept for long
+	entry := el.Value.(*element).entry
+	if time.Since(entry.cachedTime) > c.maxAge {
+		c.remove(el)
+		c.requestsCounter.WithLabelValues("expired").Inc()
+		return nil, false
+	}
+
+	c.lru.MoveToFront(el)
+	c.requestsCounter.WithLabelValues("hit").Inc()
+	return entry, true
+}
+
+func (c *cache) Put(key string, entry *Entry, version uint64) {
+	size := entry.size()
+	if size > c.maxBytes {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if version < c.purged || version < c.invalidated[key] {
+		return
+	}
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+
+	c.entries[key] = c.lru.PushFront(&element{key: key, entry: entry})
+	c.bytes += size
+
+	for c.bytes > c.maxBytes {
+		c.remove(c.lru.Back())
+		c.evictionsCounter.Inc()
+	}
+
+	c.bytesGauge.Set(float64(c.bytes))
+}
+
+func (c *cache) Version() uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.version
+}
+
+func (c *cache) Invalidate(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.version++
+	if len(c.invalidated) >= maxInvalidations {
+		c.invalidated = make(map[string]uint64)
+		c.purged = c.version
+	}
+	c.invalidated[key] = c.version
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+		c.bytesGauge.Set(float64(c.bytes))
+	}
+}
+
+func (c *cache) Touch(key string, validFor time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*element)
+		e.entry = e.entry.touched(validFor)
+	}
+}
+
+func (c *cache) Start() {
+	defer close(c.shutdownWaitChan)
+
+	var invalidated <-chan string
+	var touched <-chan database.Touch
+	if c.listener != nil {
+		invalidated = c.listener.Invalidated()
+		touched = c.listener.Touched()
+	}
+
+	for {
+		select {
+		case <-c.shutdownChan:
+			return
+		case key := <-invalidated:
+			if len(key) == 0 {
+				c.purge()
+				continue
+			}
+			c.Invalidate(key)
+		case touch := <-touched:
+			c.Touch(touch.Key, touch.ValidFor)
+		}
+	}
+}
+
+func (c *cache) Shutdown() {
+	close(c.shutdownChan)
+	<-c.shutdownWaitChan
+}
+
+// purge drops all feeds, since some of invalidations could be lost
+func (c *cache) purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.version++
+	c.invalidated = make(map[string]uint64)
+	c.purged = c.version
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+	c.bytes = 0
+	c.bytesGauge.Set(0)
+
+	log.Info("hot cache was purged")
+}
+
+func (c *cache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*element)
+	delete(c.entries, e.key)
+	c.bytes -= e.entry.size()
+}
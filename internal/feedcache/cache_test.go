@@ -0,0 +1,218 @@
+package feedcache
+
+import (
+	"container/list"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/compress"
+	"service-rss/internal/database"
+)
+
+func newTestCache(maxBytes int64, listener database.RefreshListener) *cache {
+	return &cache{
+		listener: listener,
+		maxBytes: maxBytes,
+		maxAge:   time.Minute,
+
+		requestsCounter:  prometheus.NewCounterVec(prometheus.CounterOpts{Name: "hot_cache_requests_counter"}, []string{"result"}),
+		evictionsCounter: prometheus.NewCounter(prometheus.CounterOpts{Name: "hot_cache_evictions_counter"}),
+		bytesGauge:       prometheus.NewGauge(prometheus.GaugeOpts{Name: "hot_cache_bytes"}),
+
+		lru:         list.New(),
+		entries:     make(map[string]*list.Element),
+		invalidated: make(map[string]uint64),
+
+		shutdownChan:     make(chan interface{}),
+		shutdownWaitChan: make(chan interface{}),
+	}
+}
+
+func newTestEntry(t *testing.T, id int64, body string) *Entry {
+	feed, err := compress.Encode([]byte(body))
+	assert.NoError(t, err)
+	return NewEntry(id, feed, time.Hour)
+}
+
+func TestCache_LRU(t *testing.T) {
+	one := newTestEntry(t, 1, strings.Repeat("1", 100))
+	two := newTestEntry(t, 2, strings.Repeat("2", 100))
+	three := newTestEntry(t, 3, strings.Repeat("3", 100))
+
+	c := newTestCache(2*one.size()+10, nil)
+	c.Put("one", one, c.Version())
+	c.Put("two", two, c.Version())
+
+	// one becomes the most recently used, so two is evicted
+	_, ok := c.Get("one")
+	assert.True(t, ok)
+	c.Put("three", three, c.Version())
+
+	_, ok = c.Get("two")
+	assert.False(t, ok)
+	entry, ok := c.Get("one")
+	assert.True(t, ok)
+	assert.Equal(t, one, entry)
+	_, ok = c.Get("three")
+	assert.True(t, ok)
+	assert.Equal(t, one.size()+three.size(), c.bytes)
+}
+
+func TestCache_Put(t *testing.T) {
+	t.Run("entry larger than cache", func(t *testing.T) {
+		c := newTestCache(10, nil)
+		c.Put("one", newTestEntry(t, 1, strings.Repeat("1", 100)), c.Version())
+
+		_, ok := c.Get("one")
+		assert.False(t, ok)
+	})
+
+	t.Run("entry read before invalidation", func(t *testing.T) {
+		c := newTestCache(1<<20, nil)
+		version := c.Version()
+		c.Invalidate("one")
+		c.Put("one", newTestEntry(t, 1, "old"), version)
+
+		_, ok := c.Get("one")
+		assert.False(t, ok)
+	})
+
+	t.Run("other entry invalidated while reading", func(t *testing.T) {
+		c := newTestCache(1<<20, nil)
+		version := c.Version()
+		c.Invalidate("two")
+		c.Put("one", newTestEntry(t, 1, "one"), version)
+
+		_, ok := c.Get("one")
+		assert.True(t, ok)
+	})
+
+	t.Run("entry read before purge", func(t *testing.T) {
+		c := newTestCache(1<<20, nil)
+		version := c.Version()
+		c.purge()
+		c.Put("one", newTestEntry(t, 1, "one"), version)
+
+		_, ok := c.Get("one")
+		assert.False(t, ok)
+	})
+
+	t.Run("invalidations are forgotten", func(t *testing.T) {
+		c := newTestCache(1<<20, nil)
+		version := c.Version()
+		for i := 0; i <= maxInvalidations; i++ {
+			c.Invalidate(strconv.Itoa(i))
+		}
+		assert.LessOrEqual(t, len(c.invalidated), maxInvalidations)
+
+		// entry could be invalidated among forgotten ones
+		c.Put("one", newTestEntry(t, 1, "one"), version)
+		_, ok := c.Get("one")
+		assert.False(t, ok)
+	})
+
+	t.Run("replaced entry", func(t *testing.T) {
+		c := newTestCache(1<<20, nil)
+		c.Put("one", newTestEntry(t, 1, "old"), c.Version())
+		fresh := newTestEntry(t, 1, "fresh")
+		c.Put("one", fresh, c.Version())
+
+		entry, ok := c.Get("one")
+		assert.True(t, ok)
+		assert.Equal(t, fresh, entry)
+		assert.Equal(t, fresh.size(), c.bytes)
+	})
+
+	t.Run("expired entry", func(t *testing.T) {
+		c := newTestCache(1<<20, nil)
+		entry := newTestEntry(t, 1, "old")
+		entry.cachedTime = time.Now().Add(-2 * time.Minute)
+		c.Put("one", entry, c.Version())
+
+		_, ok := c.Get("one")
+		assert.False(t, ok)
+		assert.Equal(t, int64(0), c.bytes)
+	})
+}
+
+func TestCache_Invalidation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	invalidated := make(chan string)
+	listener := database.NewMockRefreshListener(ctrl)
+	listener.EXPECT().Invalidated().Return((<-chan string)(invalidated))
+	listener.EXPECT().Touched().Return((<-chan database.Touch)(nil))
+
+	c := newTestCache(1<<20, listener)
+	c.Put("example@gmail.com/one", newTestEntry(t, 1, "one"), c.Version())
+	c.Put("example@gmail.com/two", newTestEntry(t, 2, "two"), c.Version())
+	c.Put("example@gmail.com/three", newTestEntry(t, 3, "three"), c.Version())
+
+	go c.Start()
+
+	invalidated <- Key("example@gmail.com", "one")
+	// unbuffered send returns before key is handled, so the next one makes sure the first is done
+	invalidated <- "example@gmail.com/absent"
+
+	c.mutex.Lock()
+	assert.Len(t, c.entries, 2)
+	assert.NotContains(t, c.entries, "example@gmail.com/one")
+	c.mutex.Unlock()
+
+	// empty key purges cache, since notifications could be lost
+	invalidated <- ""
+	c.Shutdown()
+
+	assert.Empty(t, c.entries)
+	assert.Equal(t, int64(0), c.bytes)
+}
+
+func TestCache_Touch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	touched := make(chan database.Touch)
+	listener := database.NewMockRefreshListener(ctrl)
+	listener.EXPECT().Invalidated().Return((<-chan string)(nil))
+	listener.EXPECT().Touched().Return((<-chan database.Touch)(touched))
+
+	c := newTestCache(1<<20, listener)
+	outdated := NewEntry(1, newTestEntry(t, 1, "one").Feed, 0)
+	assert.True(t, outdated.Revalidate())
+	c.Put("example@gmail.com/one", outdated, c.Version())
+
+	go c.Start()
+
+	// feed cached again without changes stays in cache with new validity and can be revalidated again
+	touched <- database.Touch{Key: "example@gmail.com/one", ValidFor: time.Hour}
+	touched <- database.Touch{Key: "example@gmail.com/absent", ValidFor: time.Hour}
+	c.Shutdown()
+
+	entry, ok := c.Get("example@gmail.com/one")
+	assert.True(t, ok)
+	assert.False(t, entry.Outdated())
+	assert.Equal(t, outdated.ETag, entry.ETag)
+	assert.True(t, entry.Revalidate())
+	assert.Equal(t, outdated.size(), c.bytes)
+}
+
+func TestEntry(t *testing.T) {
+	entry := newTestEntry(t, 1, "feed")
+	assert.False(t, entry.Outdated())
+	assert.NotEqual(t, entry.ETag, entry.GzipETag)
+	assert.NotEqual(t, entry.GzipETag, entry.BrotliETag)
+
+	outdated := NewEntry(1, entry.Feed, 0)
+	assert.True(t, outdated.Outdated())
+	assert.Equal(t, entry.ETag, outdated.ETag)
+
+	assert.True(t, outdated.Revalidate())
+	assert.False(t, outdated.Revalidate())
+}
@@ -0,0 +1,69 @@
+package feedcache
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+
+	"service-rss/internal/compress"
+)
+
+// Entry is rendered feed stored compressed, plain feed is decompressed for clients which don't accept encoding
+type Entry struct {
+	ID   int64
+	Feed *compress.Encoded
+	// encodings are different representations, so they have different strong etags
+	ETag       string
+	GzipETag   string
+	BrotliETag string
+
+	validUntil time.Time
+	cachedTime time.Time
+	// revalidating is set when refresh of outdated feed is queued
+	revalidating int32
+}
+
+// NewEntry makes entry of feed valid for given time by db clock
+func NewEntry(id int64, feed *compress.Encoded, validFor time.Duration) *Entry {
+	// gzip of the same feed is the same, so it identifies content of all representations
+	sum := sha1.Sum(feed.Gzip)
+	hash := hex.EncodeToString(sum[:])
+
+	now := time.Now()
+	return &Entry{
+		ID:         id,
+		Feed:       feed,
+		ETag:       `"` + hash + `"`,
+		GzipETag:   `"` + hash + `-gzip"`,
+		BrotliETag: `"` + hash + `-br"`,
+		validUntil: now.Add(validFor),
+		cachedTime: now,
+	}
+}
+
+// touched is copy of entry with new validity, so outdated copy is revalidated again
+func (e *Entry) touched(validFor time.Duration) *Entry {
+	return &Entry{
+		ID:         e.ID,
+		Feed:       e.Feed,
+		ETag:       e.ETag,
+		GzipETag:   e.GzipETag,
+		BrotliETag: e.BrotliETag,
+		validUntil: time.Now().Add(validFor),
+		cachedTime: e.cachedTime,
+	}
+}
+
+func (e *Entry) Outdated() bool {
+	return !time.Now().Before(e.validUntil)
+}
+
+// Revalidate reports whether refresh of outdated feed should be queued, it is true once per entry
+func (e *Entry) Revalidate() bool {
+	return atomic.CompareAndSwapInt32(&e.revalidating, 0, 1)
+}
+
+func (e *Entry) size() int64 {
+	return int64(len(e.Feed.Gzip) + len(e.Feed.Brotli))
+}
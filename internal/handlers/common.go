@@ -2,13 +2,75 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/xeipuuv/gojsonschema"
 
 	"service-rss/internal/dto"
 )
 
+// readJsonInput validates body by schema and unmarshals it into in, bad request is written on failure
+func readJsonInput(writer http.ResponseWriter, req *http.Request, schema *gojsonschema.Schema, in interface{}) bool {
+	bodyBytes, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeBadRequest(writer, "failed to read request body", "")
+		return false
+	}
+
+	loader := gojsonschema.NewBytesLoader(bodyBytes)
+	result, err := schema.Validate(loader)
+	if err != nil {
+		writeBadRequest(writer, "failed to validate input", string(bodyBytes))
+		return false
+	}
+
+	if !result.Valid() {
+		response := []string{"input validation failed:"}
+		for _, desc := range result.Errors() {
+			response = append(response, fmt.Sprintf("- %s", desc))
+		}
+		errors := strings.Join(response, "\n")
+
+		writeBadRequest(writer, "input validation failed", errors)
+		return false
+	}
+
+	err = json.Unmarshal(bodyBytes, in)
+	if err != nil {
+		writeBadRequest(writer, "failed to unmarshal input", string(bodyBytes))
+		return false
+	}
+
+	return true
+}
+
+func writeJsonResponse(writer http.ResponseWriter, resp interface{}) {
+	writeJsonResponseWithStatus(writer, http.StatusOK, resp)
+}
+
+func writeJsonResponseWithStatus(writer http.ResponseWriter, status int, resp interface{}) {
+	response, err := json.Marshal(resp)
+	if err != nil {
+		writeInternalError(writer, "failed to serialize response", err)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	writer.WriteHeader(status)
+
+	_, err = writer.Write(response)
+	if err != nil {
+		log.WithError(err).Warn("failed to write response")
+	}
+}
+
 func writeErrorResponse(writer http.ResponseWriter, status int, resp *dto.ErrorResponse) {
 	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
 
@@ -57,3 +119,58 @@ func writeNotFound(writer http.ResponseWriter, responseErr string, value string)
 
 	writeErrorResponse(writer, http.StatusNotFound, resp)
 }
+
+func writeConflict(writer http.ResponseWriter, responseErr string, value string) {
+	log.WithField("value", value).Warn(responseErr)
+
+	resp := &dto.ErrorResponse{
+		Error: responseErr,
+		Value: value,
+	}
+
+	writeErrorResponse(writer, http.StatusConflict, resp)
+}
+
+func writeServiceUnavailable(writer http.ResponseWriter, responseErr string, value string, retryAfter time.Duration) {
+	log.WithField("value", value).WithField("retry_after", retryAfter).Warn(responseErr)
+
+	writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+
+	resp := &dto.ErrorResponse{
+		Error: responseErr,
+		Value: value,
+	}
+
+	writeErrorResponse(writer, http.StatusServiceUnavailable, resp)
+}
+
+func writeTooManyRequests(writer http.ResponseWriter, responseErr string, retryAfter time.Duration) {
+	log.WithField("retry_after", retryAfter).Warn(responseErr)
+
+	writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+
+	resp := &dto.ErrorResponse{
+		Error: responseErr,
+	}
+
+	writeErrorResponse(writer, http.StatusTooManyRequests, resp)
+}
+
+func writeGone(writer http.ResponseWriter, responseErr string, value string) {
+	log.WithField("value", value).Warn(responseErr)
+
+	resp := &dto.ErrorResponse{
+		Error: responseErr,
+		Value: value,
+	}
+
+	writeErrorResponse(writer, http.StatusGone, resp)
+}
+
+func errorValue(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/xeipuuv/gojsonschema"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+	"service-rss/internal/digest"
+	"service-rss/internal/dto"
+)
+
+const (
+	defaultDigestMaxItems = 20
+)
+
+type digestCreateHandler struct {
+	db          database.Database
+	schema      *gojsonschema.Schema
+	authHandler auth.Handler
+	hour        int
+}
+
+// NewDigestCreateHandler subscribes signed in user to digests of rss of any owner, feeds are public anyway.
+// Digests are sent at hour of time zone of digest to address of signed in user only, since it is verified by sign in
+func NewDigestCreateHandler(db database.Database, schema *gojsonschema.Schema, authHandler auth.Handler, hour int) http.Handler {
+	return &digestCreateHandler{
+		db:          db,
+		schema:      schema,
+		authHandler: authHandler,
+		hour:        hour,
+	}
+}
+
+func (h *digestCreateHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	email, err := h.authHandler.GetEmail(writer, req)
+	if err != nil || len(email) == 0 {
+		writeBadRequest(writer, "failed to get email", errorValue(err))
+		return
+	}
+
+	in := &dto.DigestCreateIn{}
+	if !readJsonInput(writer, req, h.schema, in) {
+		return
+	}
+
+	if len(in.Recipient) == 0 {
+		in.Recipient = email
+	}
+	if !strings.EqualFold(in.Recipient, email) {
+		writeBadRequest(writer, "digests are sent to address of signed in user only", in.Recipient)
+		return
+	}
+
+	owner := in.Email
+	if len(owner) == 0 {
+		owner = email
+	}
+
+	if len(in.TimeZone) == 0 {
+		in.TimeZone = "UTC"
+	}
+	loc, err := time.LoadLocation(in.TimeZone)
+	if err != nil {
+		writeBadRequest(writer, "unknown time zone", in.TimeZone)
+		return
+	}
+
+	if in.MaxItems == 0 {
+		in.MaxItems = defaultDigestMaxItems
+	}
+
+	token, err := digest.NewUnsubscribeToken()
+	if err != nil {
+		writeInternalError(writer, "failed to generate unsubscribe token", err)
+		return
+	}
+
+	d := &database.Digest{
+		Recipient:        email,
+		Frequency:        in.Frequency,
+		TimeZone:         in.TimeZone,
+		MaxItems:         in.MaxItems,
+		NextSendTime:     digest.Next(in.Frequency, loc, h.hour, time.Now()),
+		UnsubscribeToken: token,
+	}
+	err = h.db.CreateDigest(owner, in.Name, d)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeNotFound(writer, "rss feed was not found", in.Name)
+			return
+		}
+
+		writeInternalError(writer, "failed to create digest", err)
+		return
+	}
+
+	d.Rss = &database.Rss{Email: owner, Name: in.Name}
+	writeJsonResponseWithStatus(writer, http.StatusCreated, toDigestOut(d))
+}
+
+func toDigestOut(d *database.Digest) *dto.DigestOut {
+	return &dto.DigestOut{
+		ID:           d.ID,
+		Email:        d.Rss.Email,
+		Name:         d.Rss.Name,
+		Recipient:    d.Recipient,
+		Frequency:    d.Frequency,
+		TimeZone:     d.TimeZone,
+		MaxItems:     d.MaxItems,
+		LastSentTime: d.LastSentTime.Format(time.RFC3339),
+		NextSendTime: d.NextSendTime.UTC().Format(time.RFC3339),
+		Error:        d.LastError,
+		CreatedTime:  d.CreatedTime.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/xeipuuv/gojsonschema"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+)
+
+const (
+	digestCreateSchema = "{\"type\":\"object\",\"required\":[\"name\",\"frequency\"],\"additionalProperties\":false,\"properties\":{\"email\":{\"type\":\"string\",\"format\":\"email\"},\"name\":{\"type\":\"string\"},\"recipient\":{\"type\":\"string\",\"format\":\"email\"},\"frequency\":{\"type\":\"string\",\"enum\":[\"daily\",\"weekly\"]},\"time_zone\":{\"type\":\"string\"},\"max_items\":{\"type\":\"integer\",\"minimum\":1,\"maximum\":100}}}"
+)
+
+func TestDigestCreateHandler_ServeHTTP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().CreateDigest("example@gmail.com", "feed", gomock.Any()).DoAndReturn(func(email string, name string, digest *database.Digest) error {
+		assert.Equal(t, "example@gmail.com", digest.Recipient)
+		assert.Len(t, digest.UnsubscribeToken, 40)
+		assert.Equal(t, database.DigestWeekly, digest.Frequency)
+		assert.Equal(t, "Europe/Moscow", digest.TimeZone)
+		assert.Equal(t, 5, digest.MaxItems)
+		// weekly digest is sent on monday at hour of its time zone
+		next := digest.NextSendTime.In(time.FixedZone("MSK", 3*60*60))
+		assert.Equal(t, time.Monday, next.Weekday())
+		assert.Equal(t, 8, next.Hour())
+
+		digest.ID = 3
+		digest.NextSendTime = time.Date(2021, 1, 4, 5, 0, 0, 0, time.UTC)
+		digest.LastSentTime = time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+		digest.CreatedTime = time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+		return nil
+	})
+	db.EXPECT().CreateDigest("example@gmail.com", "defaults", gomock.Any()).DoAndReturn(func(email string, name string, digest *database.Digest) error {
+		assert.Equal(t, "example@gmail.com", digest.Recipient)
+		assert.Equal(t, "UTC", digest.TimeZone)
+		assert.Equal(t, 20, digest.MaxItems)
+		return nil
+	})
+	// teammates subscribe their own addresses to rss of owner
+	db.EXPECT().CreateDigest("owner@gmail.com", "team", gomock.Any()).DoAndReturn(func(email string, name string, digest *database.Digest) error {
+		assert.Equal(t, "example@gmail.com", digest.Recipient)
+		assert.Len(t, digest.UnsubscribeToken, 40)
+		return nil
+	})
+	db.EXPECT().CreateDigest("example@gmail.com", "missing", gomock.Any()).Return(sql.ErrNoRows)
+	db.EXPECT().CreateDigest("example@gmail.com", "error", gomock.Any()).Return(errors.New("error"))
+
+	loader := gojsonschema.NewStringLoader(digestCreateSchema)
+	jsonSchema, err := gojsonschema.NewSchema(loader)
+	assert.NoError(t, err)
+
+	authHandler := auth.NewMockHandler(ctrl)
+	authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).AnyTimes().Return("example@gmail.com", nil)
+
+	handler := NewDigestCreateHandler(db, jsonSchema, authHandler, 8)
+
+	tests := []struct {
+		name   string
+		body   string
+		code   int
+		result string
+	}{
+		{name: "ok", code: 201, body: `{"name":"feed","recipient":"Example@gmail.com","frequency":"weekly","time_zone":"Europe/Moscow","max_items":5}`,
+			result: `{"id":3,"email":"example@gmail.com","name":"feed","recipient":"example@gmail.com","frequency":"weekly","time_zone":"Europe/Moscow","max_items":5,` +
+				`"last_sent_time":"2021-01-02T03:04:05Z","next_send_time":"2021-01-04T05:00:00Z","created_time":"2021-01-02T03:04:05Z"}`},
+		{name: "defaults", code: 201, body: `{"name":"defaults","frequency":"daily"}`, result: `"time_zone":"UTC","max_items":20`},
+		{name: "rss of other owner", code: 201, body: `{"email":"owner@gmail.com","name":"team","frequency":"daily"}`,
+			result: `"email":"owner@gmail.com","name":"team","recipient":"example@gmail.com"`},
+		{name: "other recipient", code: 400, body: `{"email":"owner@gmail.com","name":"team","recipient":"reader@example.com","frequency":"daily"}`,
+			result: "digests are sent to address of signed in user only"},
+		{name: "malformed input", code: 400, body: `{"name":"feed","recipient":"reader","frequency":"daily"}`, result: "input validation failed"},
+		{name: "unknown frequency", code: 400, body: `{"name":"feed","frequency":"hourly"}`, result: "input validation failed"},
+		{name: "unknown time zone", code: 400, body: `{"name":"feed","frequency":"daily","time_zone":"Mars/Base"}`,
+			result: "unknown time zone"},
+		{name: "not found", code: 404, body: `{"name":"missing","frequency":"daily"}`, result: "rss feed was not found"},
+		{name: "error", code: 500, body: `{"name":"error","frequency":"daily"}`, result: "failed to create digest"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/digests/create", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.code, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.result)
+		})
+	}
+}
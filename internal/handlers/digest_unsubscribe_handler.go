@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"database/sql"
+	"html/template"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/go-chi/chi"
+
+	"service-rss/internal/database"
+)
+
+type unsubscribeData struct {
+	Unsubscribed bool
+}
+
+type digestUnsubscribeHandler struct {
+	db           database.Database
+	htmlTemplate *template.Template
+}
+
+// NewDigestUnsubscribeHandler deletes digest by link from its email without signing in.
+// Opened link asks to confirm, so link checkers of mail services don't unsubscribe recipients,
+// post is sent by confirmation and by one-click unsubscribe of mail clients
+func NewDigestUnsubscribeHandler(db database.Database) (http.Handler, error) {
+	rawTemplate, err := os.ReadFile("html/unsubscribe.html")
+	if err != nil {
+		return nil, err
+	}
+
+	htmlTemplate, err := template.New("unsubscribe").Parse(string(rawTemplate))
+	if err != nil {
+		return nil, err
+	}
+
+	return &digestUnsubscribeHandler{
+		db:           db,
+		htmlTemplate: htmlTemplate,
+	}, nil
+}
+
+func (h *digestUnsubscribeHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(req, "id"), 10, 64)
+	if err != nil {
+		writeNotFound(writer, "digest was not found", chi.URLParam(req, "id"))
+		return
+	}
+
+	data := unsubscribeData{Unsubscribed: req.Method == http.MethodPost}
+	if data.Unsubscribed {
+		err = h.db.UnsubscribeDigest(id, chi.URLParam(req, "token"))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				writeNotFound(writer, "digest was not found", strconv.FormatInt(id, 10))
+				return
+			}
+
+			writeInternalError(writer, "failed to unsubscribe from digest", err)
+			return
+		}
+	}
+
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = h.htmlTemplate.Execute(writer, data)
+	if err != nil {
+		writeInternalError(writer, "failed to fill template", err)
+		return
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"html/template"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/database"
+)
+
+func TestDigestUnsubscribeHandler_ServeHTTP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().UnsubscribeDigest(int64(1), "token").Return(nil)
+	db.EXPECT().UnsubscribeDigest(int64(1), "other").Return(sql.ErrNoRows)
+	db.EXPECT().UnsubscribeDigest(int64(2), "token").Return(errors.New("error"))
+
+	htmlTemplate, err := template.New("unsubscribe").Parse("{{if .Unsubscribed}}unsubscribed{{else}}confirm{{end}}")
+	assert.NoError(t, err)
+
+	handler := &digestUnsubscribeHandler{
+		db:           db,
+		htmlTemplate: htmlTemplate,
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		id     string
+		token  string
+		code   int
+		result string
+	}{
+		// link checkers of mail services open links, so opened link doesn't unsubscribe
+		{name: "confirm", method: "GET", id: "1", token: "token", code: 200, result: "confirm"},
+		{name: "unsubscribe", method: "POST", id: "1", token: "token", code: 200, result: "unsubscribed"},
+		{name: "wrong token", method: "POST", id: "1", token: "other", code: 404, result: "digest was not found"},
+		{name: "malformed id", method: "POST", id: "one", token: "token", code: 404, result: "digest was not found"},
+		{name: "error", method: "POST", id: "2", token: "token", code: 500, result: "failed to unsubscribe from digest"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/digests/"+tt.id+"/unsubscribe/"+tt.token, nil)
+
+			routeContext := &chi.Context{
+				URLParams: chi.RouteParams{
+					Keys:   []string{"id", "token"},
+					Values: []string{tt.id, tt.token},
+				},
+			}
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeContext))
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.code, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.result)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+)
+
+type digestsGetHandler struct {
+	db          database.Database
+	authHandler auth.Handler
+}
+
+// NewDigestsGetHandler lists digests of all rss of owner and digests sent to owner with error of the last failed sending
+func NewDigestsGetHandler(db database.Database, authHandler auth.Handler) http.Handler {
+	return &digestsGetHandler{
+		db:          db,
+		authHandler: authHandler,
+	}
+}
+
+func (h *digestsGetHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	email, err := h.authHandler.GetEmail(writer, req)
+	if err != nil || len(email) == 0 {
+		writeBadRequest(writer, "failed to get email", errorValue(err))
+		return
+	}
+
+	digests, err := h.db.GetDigests(email)
+	if err != nil {
+		writeInternalError(writer, "failed to get digests", err)
+		return
+	}
+
+	out := &dto.DigestsOut{
+		Digests: make([]*dto.DigestOut, 0, len(digests)),
+	}
+	for _, d := range digests {
+		out.Digests = append(out.Digests, toDigestOut(d))
+	}
+
+	writeJsonResponse(writer, out)
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+)
+
+func TestDigestsGetHandler_ServeHTTP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	authHandler := auth.NewMockHandler(ctrl)
+	authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).Return("example@gmail.com", nil)
+	authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).Return("error@gmail.com", nil)
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().GetDigests("example@gmail.com").Return([]*database.Digest{{
+		ID:           1,
+		Rss:          &database.Rss{Email: "example@gmail.com", Name: "feed"},
+		Recipient:    "reader@example.com",
+		Frequency:    database.DigestWeekly,
+		TimeZone:     "Europe/Moscow",
+		MaxItems:     10,
+		LastSentTime: time.Date(2021, 1, 4, 5, 0, 0, 0, time.UTC),
+		NextSendTime: time.Date(2021, 1, 11, 5, 0, 0, 0, time.UTC),
+		LastError:    "554 rejected",
+		CreatedTime:  time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+	}}, nil)
+	db.EXPECT().GetDigests("error@gmail.com").Return(nil, errors.New("error"))
+
+	handler := NewDigestsGetHandler(db, authHandler)
+
+	t.Run("ok", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/digests", nil))
+
+		assert.Equal(t, 200, rr.Code)
+		assert.Equal(t, `{"digests":[{"id":1,"email":"example@gmail.com","name":"feed","recipient":"reader@example.com","frequency":"weekly","time_zone":"Europe/Moscow",`+
+			`"max_items":10,"last_sent_time":"2021-01-04T05:00:00Z","next_send_time":"2021-01-11T05:00:00Z","error":"554 rejected",`+
+			`"created_time":"2021-01-02T03:04:05Z"}]}`, rr.Body.String())
+	})
+
+	t.Run("error", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/digests", nil))
+
+		assert.Equal(t, 500, rr.Code)
+		assert.Contains(t, rr.Body.String(), "failed to get digests")
+	})
+}
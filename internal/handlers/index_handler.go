@@ -7,6 +7,12 @@ import (
 
 	"service-rss/internal/auth"
 	"service-rss/internal/database"
+	"service-rss/internal/rss"
+)
+
+const (
+	// maskedNewsletterSource is shown instead of newsletter sources of other owners
+	maskedNewsletterSource = "newsletter"
 )
 
 type templateData struct {
@@ -50,7 +56,7 @@ func (h *indexHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request)
 
 	data := templateData{
 		Email:    email,
-		RssFeeds: rssFeeds,
+		RssFeeds: publicRss(rssFeeds, email),
 	}
 
 	err = h.htmlTemplate.Execute(writer, data)
@@ -61,3 +67,26 @@ func (h *indexHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request)
 
 	writer.WriteHeader(http.StatusOK)
 }
+
+// publicRss masks newsletter sources of rss of other owners, since sources hold secret addresses of newsletters
+func publicRss(rssFeeds []*database.Rss, email string) []*database.Rss {
+	result := make([]*database.Rss, 0, len(rssFeeds))
+	for _, feed := range rssFeeds {
+		if feed.Email == email {
+			result = append(result, feed)
+			continue
+		}
+
+		masked := *feed
+		masked.Sources = make([]string, 0, len(feed.Sources))
+		for _, source := range feed.Sources {
+			if rss.IsNewsletterSource(source) {
+				source = maskedNewsletterSource
+			}
+			masked.Sources = append(masked.Sources, source)
+		}
+		result = append(result, &masked)
+	}
+
+	return result
+}
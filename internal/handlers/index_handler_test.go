@@ -102,4 +102,31 @@ func TestIndexHandler_ServeHTTP(t *testing.T) {
 		assert.Equal(t, 500, rr.Code)
 		assert.Contains(t, rr.Body.String(), "{\"error\":\"failed to get feeds\",\"value\":\"error\"}")
 	})
+
+	t.Run("newsletter sources of other owners are masked", func(t *testing.T) {
+		sourcesTemplate, err := template.New("webpage").Parse("{{range .RssFeeds}}{{.Name}}:{{range .Sources}} {{.}}{{end}};{{end}}")
+		assert.NoError(t, err)
+
+		db := database.NewMockDatabase(ctrl)
+		db.EXPECT().GetRssForIndex().Return([]*database.Rss{
+			{Email: "example@gmail.com", Name: "own", Sources: []string{"newsletter:token1"}},
+			{Email: "other@gmail.com", Name: "other", Sources: []string{"http://google.com", "newsletter:token2"}},
+		}, nil)
+
+		authHandler := auth.NewMockHandler(ctrl)
+		authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).Return("example@gmail.com", nil)
+
+		handler := &indexHandler{
+			db:           db,
+			authHandler:  authHandler,
+			htmlTemplate: sourcesTemplate,
+		}
+
+		req := httptest.NewRequest("GET", "/", nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 200, rr.Code)
+		assert.Equal(t, "own: newsletter:token1;other: http://google.com newsletter;", rr.Body.String())
+	})
 }
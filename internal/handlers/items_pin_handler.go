@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/xeipuuv/gojsonschema"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+)
+
+type itemsPinHandler struct {
+	db          database.Database
+	schema      *gojsonschema.Schema
+	authHandler auth.Handler
+}
+
+func NewItemsPinHandler(db database.Database, schema *gojsonschema.Schema, authHandler auth.Handler) http.Handler {
+	return &itemsPinHandler{
+		db:          db,
+		schema:      schema,
+		authHandler: authHandler,
+	}
+}
+
+func (h *itemsPinHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	email, err := h.authHandler.GetEmail(writer, req)
+	if err != nil || len(email) == 0 {
+		writeBadRequest(writer, "failed to get email", errorValue(err))
+		return
+	}
+
+	in := &dto.ItemPinIn{}
+	if !readJsonInput(writer, req, h.schema, in) {
+		return
+	}
+
+	// item is looked up in sources of owned rss only, pinned items are kept by retention forever
+	err = h.db.PinItem(email, in.Name, in.Item, in.Pinned)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeNotFound(writer, "item was not found", in.Item)
+			return
+		}
+
+		writeInternalError(writer, "failed to pin item", err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusOK)
+}
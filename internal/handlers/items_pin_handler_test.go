@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/xeipuuv/gojsonschema"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+)
+
+const (
+	pinSchema = "{\"type\":\"object\",\"required\":[\"name\",\"item\",\"pinned\"],\"additionalProperties\":false,\"properties\":{\"name\":{\"type\":\"string\"},\"item\":{\"type\":\"string\",\"minLength\":1},\"pinned\":{\"type\":\"boolean\"}}}"
+)
+
+func TestItemsPinHandler_ServeHTTP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().PinItem("example@gmail.com", "feed", "http://missing.com", true).Return(sql.ErrNoRows)
+	db.EXPECT().PinItem("example@gmail.com", "feed", "http://error.com", true).Return(errors.New("error"))
+	db.EXPECT().PinItem("example@gmail.com", "feed", "http://google.com/item", false).Return(nil)
+
+	loader := gojsonschema.NewStringLoader(pinSchema)
+	jsonSchema, err := gojsonschema.NewSchema(loader)
+	assert.NoError(t, err)
+
+	authHandler := auth.NewMockHandler(ctrl)
+	authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).AnyTimes().Return("example@gmail.com", nil)
+
+	defaultHandler := NewItemsPinHandler(db, jsonSchema, authHandler)
+
+	t.Run("auth error", func(t *testing.T) {
+		authHandler := auth.NewMockHandler(ctrl)
+		authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).Return("", errors.New("err"))
+
+		handler := NewItemsPinHandler(db, jsonSchema, authHandler)
+
+		req := httptest.NewRequest("POST", "/api/items/pin", nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 400, rr.Code)
+		assert.Contains(t, rr.Body.String(), "failed to get email")
+	})
+
+	t.Run("malformed input", func(t *testing.T) {
+		body := strings.NewReader("{\"name\":\"feed\"}")
+		req := httptest.NewRequest("POST", "/api/items/pin", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 400, rr.Code)
+		assert.Contains(t, rr.Body.String(), "item is required")
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		body := strings.NewReader("{\"name\":\"feed\",\"item\":\"http://missing.com\",\"pinned\":true}")
+		req := httptest.NewRequest("POST", "/api/items/pin", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 404, rr.Code)
+		assert.Contains(t, rr.Body.String(), "item was not found")
+	})
+
+	t.Run("error", func(t *testing.T) {
+		body := strings.NewReader("{\"name\":\"feed\",\"item\":\"http://error.com\",\"pinned\":true}")
+		req := httptest.NewRequest("POST", "/api/items/pin", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 500, rr.Code)
+		assert.Contains(t, rr.Body.String(), "failed to pin item")
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		body := strings.NewReader("{\"name\":\"feed\",\"item\":\"http://google.com/item\",\"pinned\":false}")
+		req := httptest.NewRequest("POST", "/api/items/pin", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 200, rr.Code)
+	})
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/xeipuuv/gojsonschema"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+	"service-rss/internal/rss"
+)
+
+type newsletterCreateHandler struct {
+	db          database.Database
+	schema      *gojsonschema.Schema
+	authHandler auth.Handler
+	domain      string
+}
+
+// NewNewsletterCreateHandler gives rss address at newsletter domain, its source is added to sources of rss
+func NewNewsletterCreateHandler(db database.Database, schema *gojsonschema.Schema, authHandler auth.Handler, domain string) http.Handler {
+	return &newsletterCreateHandler{
+		db:          db,
+		schema:      schema,
+		authHandler: authHandler,
+		domain:      domain,
+	}
+}
+
+func (h *newsletterCreateHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	email, err := h.authHandler.GetEmail(writer, req)
+	if err != nil || len(email) == 0 {
+		writeBadRequest(writer, "failed to get email", errorValue(err))
+		return
+	}
+
+	in := &dto.NewsletterCreateIn{}
+	if !readJsonInput(writer, req, h.schema, in) {
+		return
+	}
+
+	newsletter, err := rss.NewNewsletter()
+	if err != nil {
+		writeInternalError(writer, "failed to create newsletter", err)
+		return
+	}
+
+	err = h.db.CreateNewsletter(email, in.Name, newsletter)
+	if err != nil {
+		// saved searches have no sources, so they are not found as well
+		if err == sql.ErrNoRows {
+			writeNotFound(writer, "rss feed was not found", in.Name)
+			return
+		}
+
+		writeInternalError(writer, "failed to create newsletter", err)
+		return
+	}
+
+	writeJsonResponseWithStatus(writer, http.StatusCreated, toNewsletterOut(newsletter, h.domain))
+}
+
+func toNewsletterOut(newsletter *database.Newsletter, domain string) *dto.NewsletterOut {
+	return &dto.NewsletterOut{
+		ID:          newsletter.ID,
+		Name:        newsletter.Name,
+		Address:     rss.NewsletterAddress(newsletter.Token, domain),
+		Source:      newsletter.Source,
+		CreatedTime: newsletter.CreatedTime.Format(time.RFC3339),
+	}
+}
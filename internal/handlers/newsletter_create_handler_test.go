@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/xeipuuv/gojsonschema"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+)
+
+const (
+	newsletterCreateSchema = "{\"type\":\"object\",\"required\":[\"name\"],\"additionalProperties\":false,\"properties\":{\"name\":{\"type\":\"string\"}}}"
+)
+
+func TestNewsletterCreateHandler_ServeHTTP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().CreateNewsletter("example@gmail.com", "feed", gomock.Any()).DoAndReturn(func(email string, name string, newsletter *database.Newsletter) error {
+		assert.Len(t, newsletter.Token, 24)
+		assert.Equal(t, "newsletter:"+newsletter.Token, newsletter.Source)
+
+		newsletter.ID = 3
+		newsletter.Name = name
+		newsletter.Token = "0123456789abcdef01234567"
+		newsletter.Source = "newsletter:0123456789abcdef01234567"
+		newsletter.CreatedTime = time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+		return nil
+	})
+	db.EXPECT().CreateNewsletter("example@gmail.com", "missing", gomock.Any()).Return(sql.ErrNoRows)
+	db.EXPECT().CreateNewsletter("example@gmail.com", "error", gomock.Any()).Return(errors.New("error"))
+
+	loader := gojsonschema.NewStringLoader(newsletterCreateSchema)
+	jsonSchema, err := gojsonschema.NewSchema(loader)
+	assert.NoError(t, err)
+
+	authHandler := auth.NewMockHandler(ctrl)
+	authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).AnyTimes().Return("example@gmail.com", nil)
+
+	handler := NewNewsletterCreateHandler(db, jsonSchema, authHandler, "in.example.com")
+
+	tests := []struct {
+		name   string
+		body   string
+		code   int
+		result string
+	}{
+		{name: "ok", code: 201, body: `{"name":"feed"}`,
+			result: `{"id":3,"name":"feed","address":"0123456789abcdef01234567@in.example.com","source":"newsletter:0123456789abcdef01234567",` +
+				`"created_time":"2021-01-02T03:04:05Z"}`},
+		{name: "malformed input", code: 400, body: `{}`, result: "name is required"},
+		{name: "not found", code: 404, body: `{"name":"missing"}`, result: "rss feed was not found"},
+		{name: "error", code: 500, body: `{"name":"error"}`, result: "failed to create newsletter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/newsletters/create", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.code, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.result)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+)
+
+type newslettersGetHandler struct {
+	db          database.Database
+	authHandler auth.Handler
+	domain      string
+}
+
+// NewNewslettersGetHandler lists addresses of all rss of owner
+func NewNewslettersGetHandler(db database.Database, authHandler auth.Handler, domain string) http.Handler {
+	return &newslettersGetHandler{
+		db:          db,
+		authHandler: authHandler,
+		domain:      domain,
+	}
+}
+
+func (h *newslettersGetHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	email, err := h.authHandler.GetEmail(writer, req)
+	if err != nil || len(email) == 0 {
+		writeBadRequest(writer, "failed to get email", errorValue(err))
+		return
+	}
+
+	newsletters, err := h.db.GetNewsletters(email)
+	if err != nil {
+		writeInternalError(writer, "failed to get newsletters", err)
+		return
+	}
+
+	out := &dto.NewslettersOut{
+		Newsletters: make([]*dto.NewsletterOut, 0, len(newsletters)),
+	}
+	for _, newsletter := range newsletters {
+		out.Newsletters = append(out.Newsletters, toNewsletterOut(newsletter, h.domain))
+	}
+
+	writeJsonResponse(writer, out)
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+)
+
+func TestNewslettersGetHandler_ServeHTTP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	authHandler := auth.NewMockHandler(ctrl)
+	authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).Return("example@gmail.com", nil)
+	authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).Return("error@gmail.com", nil)
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().GetNewsletters("example@gmail.com").Return([]*database.Newsletter{{
+		ID:          1,
+		Name:        "feed",
+		Token:       "0123456789abcdef01234567",
+		Source:      "newsletter:0123456789abcdef01234567",
+		CreatedTime: time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+	}}, nil)
+	db.EXPECT().GetNewsletters("error@gmail.com").Return(nil, errors.New("error"))
+
+	handler := NewNewslettersGetHandler(db, authHandler, "in.example.com")
+
+	t.Run("ok", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/newsletters", nil))
+
+		assert.Equal(t, 200, rr.Code)
+		assert.Equal(t, `{"newsletters":[{"id":1,"name":"feed","address":"0123456789abcdef01234567@in.example.com",`+
+			`"source":"newsletter:0123456789abcdef01234567","created_time":"2021-01-02T03:04:05Z"}]}`, rr.Body.String())
+	})
+
+	t.Run("error", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/newsletters", nil))
+
+		assert.Equal(t, 500, rr.Code)
+		assert.Contains(t, rr.Body.String(), "failed to get newsletters")
+	})
+}
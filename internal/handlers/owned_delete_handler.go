@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/xeipuuv/gojsonschema"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/dto"
+)
+
+// DeleteOwned deletes object of owner by id, it returns sql.ErrNoRows if owner has no such object
+type DeleteOwned func(email string, id int64) error
+
+type ownedDeleteHandler struct {
+	kind        string
+	deleteOwned DeleteOwned
+	schema      *gojsonschema.Schema
+	authHandler auth.Handler
+}
+
+// NewOwnedDeleteHandler deletes objects like webhooks by id, kind names object in responses
+func NewOwnedDeleteHandler(kind string, deleteOwned DeleteOwned, schema *gojsonschema.Schema, authHandler auth.Handler) http.Handler {
+	return &ownedDeleteHandler{
+		kind:        kind,
+		deleteOwned: deleteOwned,
+		schema:      schema,
+		authHandler: authHandler,
+	}
+}
+
+func (h *ownedDeleteHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	email, err := h.authHandler.GetEmail(writer, req)
+	if err != nil || len(email) == 0 {
+		writeBadRequest(writer, "failed to get email", errorValue(err))
+		return
+	}
+
+	in := &dto.DeleteIn{}
+	if !readJsonInput(writer, req, h.schema, in) {
+		return
+	}
+
+	err = h.deleteOwned(email, in.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeNotFound(writer, h.kind+" was not found", strconv.FormatInt(in.ID, 10))
+			return
+		}
+
+		writeInternalError(writer, "failed to delete "+h.kind, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusOK)
+}
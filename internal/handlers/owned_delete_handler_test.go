@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/xeipuuv/gojsonschema"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+)
+
+const (
+	deleteSchema = "{\"type\":\"object\",\"required\":[\"id\"],\"additionalProperties\":false,\"properties\":{\"id\":{\"type\":\"integer\",\"minimum\":1}}}"
+)
+
+func TestOwnedDeleteHandler_ServeHTTP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().DeleteWebhook("example@gmail.com", int64(1)).Return(nil)
+	db.EXPECT().DeleteWebhook("example@gmail.com", int64(2)).Return(sql.ErrNoRows)
+	db.EXPECT().DeleteWebhook("example@gmail.com", int64(3)).Return(errors.New("error"))
+	db.EXPECT().DeleteDigest("example@gmail.com", int64(1)).Return(nil)
+	db.EXPECT().DeleteDigest("example@gmail.com", int64(2)).Return(sql.ErrNoRows)
+	db.EXPECT().DeleteNewsletter("example@gmail.com", int64(1)).Return(nil)
+	db.EXPECT().DeleteNewsletter("example@gmail.com", int64(2)).Return(sql.ErrNoRows)
+
+	loader := gojsonschema.NewStringLoader(deleteSchema)
+	jsonSchema, err := gojsonschema.NewSchema(loader)
+	assert.NoError(t, err)
+
+	authHandler := auth.NewMockHandler(ctrl)
+	authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).AnyTimes().Return("example@gmail.com", nil)
+
+	handlers := map[string]http.Handler{
+		"webhook":    NewOwnedDeleteHandler("webhook", db.DeleteWebhook, jsonSchema, authHandler),
+		"digest":     NewOwnedDeleteHandler("digest", db.DeleteDigest, jsonSchema, authHandler),
+		"newsletter": NewOwnedDeleteHandler("newsletter", db.DeleteNewsletter, jsonSchema, authHandler),
+	}
+
+	tests := []struct {
+		name   string
+		kind   string
+		body   string
+		code   int
+		result string
+	}{
+		{name: "ok", kind: "webhook", code: 200, body: `{"id":1}`},
+		{name: "malformed input", kind: "webhook", code: 400, body: `{"id":0}`, result: "input validation failed"},
+		{name: "not found", kind: "webhook", code: 404, body: `{"id":2}`, result: "webhook was not found"},
+		{name: "error", kind: "webhook", code: 500, body: `{"id":3}`, result: "failed to delete webhook"},
+		{name: "digest", kind: "digest", code: 200, body: `{"id":1}`},
+		{name: "digest not found", kind: "digest", code: 404, body: `{"id":2}`, result: "digest was not found"},
+		{name: "newsletter", kind: "newsletter", code: 200, body: `{"id":1}`},
+		{name: "newsletter not found", kind: "newsletter", code: 404, body: `{"id":2}`, result: "newsletter was not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/"+tt.kind+"s/delete", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			handlers[tt.kind].ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.code, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.result)
+		})
+	}
+}
@@ -13,10 +13,11 @@ import (
 
 	"service-rss/internal/auth"
 	"service-rss/internal/database"
+	"service-rss/internal/rss"
 )
 
 const (
-	schema = "{\"type\":\"object\",\"description\":\"Inputfor/rss/create\",\"required\":[\"name\",\"sources\"],\"additionalProperties\":false,\"properties\":{\"name\":{\"type\":\"string\",\"pattern\":\"^[a-zA-Z0-9]+$\"},\"sources\":{\"type\":\"array\",\"minLength\":1,\"items\":{\"type\":\"string\",\"minLength\":1}}}}"
+	schema = "{\"type\":\"object\",\"description\":\"Inputfor/rss/create\",\"required\":[\"name\"],\"additionalProperties\":false,\"properties\":{\"name\":{\"type\":\"string\",\"pattern\":\"^[a-zA-Z0-9]+$\"},\"sources\":{\"type\":\"array\",\"minLength\":1,\"items\":{\"type\":\"string\",\"minLength\":1}},\"search\":{\"type\":\"object\",\"required\":[\"query\",\"feeds\"],\"properties\":{\"query\":{\"type\":\"string\",\"minLength\":1},\"feeds\":{\"type\":\"array\",\"minItems\":1}}},\"force\":{\"type\":\"boolean\"},\"mode\":{\"type\":\"string\",\"enum\":[\"rss\",\"podcast\"]},\"channel\":{\"type\":\"object\"},\"podcast\":{\"type\":\"object\"}}}"
 )
 
 func TestRssCreateHandler_ServeHTTP(t *testing.T) {
@@ -45,6 +46,53 @@ func TestRssCreateHandler_ServeHTTP(t *testing.T) {
 			"http://google.com",
 		},
 	}).Return(nil)
+	db.EXPECT().CreateRss(&database.Rss{
+		Email: "example@gmail.com",
+		Name:  "forced",
+		Sources: []string{
+			"http://down.example.com",
+		},
+	}).Return(nil)
+	db.EXPECT().CreateRss(&database.Rss{
+		Email: "example@gmail.com",
+		Name:  "podcast",
+		Sources: []string{
+			"http://google.com",
+		},
+		Mode:    "podcast",
+		Channel: &database.ChannelSettings{Language: "en"},
+		Podcast: &database.PodcastSettings{
+			Author:     "author",
+			OwnerEmail: "example@gmail.com",
+			Image:      "http://google.com/image.png",
+			Category:   "Technology",
+		},
+	}).Return(nil)
+	db.EXPECT().CreateRss(&database.Rss{
+		Email: "example@gmail.com",
+		Name:  "newsletter",
+		Sources: []string{
+			"http://google.com",
+			"newsletter:0123456789abcdef01234567",
+		},
+	}).Return(nil)
+	db.EXPECT().CreateRss(&database.Rss{
+		Email: "example@gmail.com",
+		Name:  "scraped",
+		Sources: []string{
+			"http://google.com",
+			"scrape:item=li&title=h2&url=http%3A%2F%2Fstatus.example.com%2F",
+		},
+	}).Return(nil)
+
+	db.EXPECT().CreateRss(&database.Rss{
+		Email: "example@gmail.com",
+		Name:  "search",
+		Search: &database.SearchSettings{
+			Query: "kubernetes AND security",
+			Feeds: []string{"ok", "podcast"},
+		},
+	}).Return(nil)
 
 	loader := gojsonschema.NewStringLoader(schema)
 	jsonSchema, err := gojsonschema.NewSchema(loader)
@@ -53,13 +101,25 @@ func TestRssCreateHandler_ServeHTTP(t *testing.T) {
 	authHandler := auth.NewMockHandler(ctrl)
 	authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).AnyTimes().Return("example@gmail.com", nil)
 
-	defaultHandler := NewRssCreateHandler(db, jsonSchema, authHandler)
+	validator := rss.NewMockValidator(ctrl)
+	validator.EXPECT().Validate([]string{"http://google.com"}).AnyTimes().Return([]*rss.SourceCheck{
+		{Url: "http://google.com", Status: rss.SourceStatusOk},
+	})
+	validator.EXPECT().Validate([]string{"http://google.com", "http://blog.example.com", "http://down.example.com"}).Return([]*rss.SourceCheck{
+		{Url: "http://google.com", Status: rss.SourceStatusOk},
+		{Url: "http://blog.example.com", Status: rss.SourceStatusNotFeed, Error: "source is not a feed", Feeds: []*rss.DiscoveredFeed{
+			{Url: "http://blog.example.com/feed.xml", Type: rss.FeedTypeRss},
+		}},
+		{Url: "http://down.example.com", Status: rss.SourceStatusHttpError, Error: "unexpected http status 503"},
+	})
+
+	defaultHandler := NewRssCreateHandler(db, validator, jsonSchema, authHandler)
 
 	t.Run("auth error", func(t *testing.T) {
 		authHandler := auth.NewMockHandler(ctrl)
 		authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).Return("", errors.New("err"))
 
-		handler := NewRssCreateHandler(db, jsonSchema, authHandler)
+		handler := NewRssCreateHandler(db, validator, jsonSchema, authHandler)
 
 		req := httptest.NewRequest("POST", "/api/rss/create", nil)
 		rr := httptest.NewRecorder()
@@ -88,7 +148,26 @@ func TestRssCreateHandler_ServeHTTP(t *testing.T) {
 
 		assert.Equal(t, 400, rr.Code)
 		assert.Equal(t, "application/json; charset=utf-8", rr.Header().Get("Content-Type"))
-		assert.Contains(t, rr.Body.String(), "sources is required")
+		assert.Contains(t, rr.Body.String(), "sources or search should be specified")
+	})
+
+	t.Run("search with sources", func(t *testing.T) {
+		body := strings.NewReader("{\"name\":\"example\",\"sources\":[\"http://google.com\"],\"search\":{\"query\":\"golang\",\"feeds\":[\"ok\"]}}")
+		req := httptest.NewRequest("POST", "/api/rss/create", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 400, rr.Code)
+		assert.Contains(t, rr.Body.String(), "saved search should not have sources")
+	})
+
+	t.Run("search", func(t *testing.T) {
+		body := strings.NewReader("{\"name\":\"search\",\"search\":{\"query\":\"kubernetes AND security\",\"feeds\":[\"ok\",\"podcast\"]}}")
+		req := httptest.NewRequest("POST", "/api/rss/create", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 200, rr.Code)
 	})
 
 	t.Run("malformed source", func(t *testing.T) {
@@ -102,6 +181,77 @@ func TestRssCreateHandler_ServeHTTP(t *testing.T) {
 		assert.Contains(t, rr.Body.String(), "found malformed input source urls")
 	})
 
+	t.Run("newsletter source", func(t *testing.T) {
+		// newsletter source is neither url nor validated
+		body := strings.NewReader("{\"name\":\"newsletter\",\"sources\":[\"http://google.com\",\"newsletter:0123456789abcdef01234567\"]}")
+		req := httptest.NewRequest("POST", "/api/rss/create", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 200, rr.Code)
+	})
+
+	t.Run("scraped source", func(t *testing.T) {
+		// scraped source is page, so it is not validated as feed
+		body := strings.NewReader("{\"name\":\"scraped\",\"sources\":[\"http://google.com\",\"scrape:item=li&title=h2&url=http%3A%2F%2Fstatus.example.com%2F\"]}")
+		req := httptest.NewRequest("POST", "/api/rss/create", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 200, rr.Code)
+	})
+
+	t.Run("malformed scraped source", func(t *testing.T) {
+		body := strings.NewReader("{\"name\":\"scraped\",\"sources\":[\"scrape:item=li&url=http%3A%2F%2Fstatus.example.com%2F\"]}")
+		req := httptest.NewRequest("POST", "/api/rss/create", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 400, rr.Code)
+		assert.Contains(t, rr.Body.String(), "found malformed input source urls")
+	})
+
+	t.Run("podcast without settings", func(t *testing.T) {
+		body := strings.NewReader("{\"name\":\"podcast\",\"sources\":[\"http://google.com\"],\"mode\":\"podcast\"}")
+		req := httptest.NewRequest("POST", "/api/rss/create", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 400, rr.Code)
+		assert.Equal(t, "application/json; charset=utf-8", rr.Header().Get("Content-Type"))
+		assert.Contains(t, rr.Body.String(), "podcast settings are required for podcast mode")
+	})
+
+	t.Run("sources validation failed", func(t *testing.T) {
+		body := strings.NewReader("{\"name\":\"blog\",\"sources\":[\"http://google.com\",\"http://blog.example.com\",\"http://down.example.com\"]}")
+		req := httptest.NewRequest("POST", "/api/rss/create", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 400, rr.Code)
+		assert.Equal(t, "application/json; charset=utf-8", rr.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{
+			"error": "sources validation failed",
+			"value": "http://blog.example.com\nhttp://down.example.com",
+			"sources": [
+				{"url": "http://google.com", "status": "ok"},
+				{"url": "http://blog.example.com", "status": "not_feed", "error": "source is not a feed", "feeds": [
+					{"url": "http://blog.example.com/feed.xml", "type": "rss"}
+				]},
+				{"url": "http://down.example.com", "status": "http_error", "error": "unexpected http status 503"}
+			]
+		}`, rr.Body.String())
+	})
+
+	t.Run("force", func(t *testing.T) {
+		body := strings.NewReader("{\"name\":\"forced\",\"sources\":[\"http://down.example.com\"],\"force\":true}")
+		req := httptest.NewRequest("POST", "/api/rss/create", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 200, rr.Code)
+	})
+
 	t.Run("exists", func(t *testing.T) {
 		body := strings.NewReader("{\"name\":\"exists\",\"sources\":[\"http://google.com\"]}")
 		req := httptest.NewRequest("POST", "/api/rss/create", body)
@@ -134,4 +284,13 @@ func TestRssCreateHandler_ServeHTTP(t *testing.T) {
 		assert.Equal(t, rr.Header().Get("Content-Type"), "")
 		assert.Equal(t, rr.Body.String(), "")
 	})
+
+	t.Run("podcast", func(t *testing.T) {
+		body := strings.NewReader("{\"name\":\"podcast\",\"sources\":[\"http://google.com\"],\"mode\":\"podcast\",\"podcast\":{\"author\":\"author\",\"owner_email\":\"example@gmail.com\",\"image\":\"http://google.com/image.png\",\"category\":\"Technology\",\"language\":\"en\"}}")
+		req := httptest.NewRequest("POST", "/api/rss/create", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 200, rr.Code)
+	})
 }
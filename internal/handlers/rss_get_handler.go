@@ -2,39 +2,64 @@ package handlers
 
 import (
 	"database/sql"
-	"encoding/xml"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 
+	"service-rss/internal/compress"
 	"service-rss/internal/database"
+	"service-rss/internal/feedcache"
+	"service-rss/internal/reads"
 	"service-rss/internal/rss"
 )
 
+const (
+	// rss which is not cached yet is being aggregated, so reader retries soon
+	cacheMissRetryAfter = 10 * time.Second
+)
+
 type rssGetHandler struct {
-	db               database.Database
-	aggregator       rss.Aggregator
-	cacheMissCounter prometheus.Counter
+	db                database.Database
+	refresher         rss.Refresher
+	hotCache          feedcache.Cache
+	reads             reads.Recorder
+	missWaitTimeout   time.Duration
+	cacheMissCounter  prometheus.Counter
+	cacheStaleCounter prometheus.Counter
 }
 
-func NewRssGetHandler(db database.Database, aggregator rss.Aggregator) (http.Handler, error) {
-	counter := prometheus.NewCounter(prometheus.CounterOpts{
+func NewRssGetHandler(db database.Database, refresher rss.Refresher, hotCache feedcache.Cache, reads reads.Recorder,
+	missWaitTimeout time.Duration) (http.Handler, error) {
+	missCounter := prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "cache_miss_counter",
 		Help: "Counter of cache misses",
 	})
 
-	err := prometheus.Register(counter)
-	if err != nil {
-		return nil, err
+	staleCounter := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cache_stale_counter",
+		Help: "Counter of outdated feeds served while they are refreshed",
+	})
+
+	for _, collector := range []prometheus.Collector{missCounter, staleCounter} {
+		err := prometheus.Register(collector)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &rssGetHandler{
-		db:               db,
-		aggregator:       aggregator,
-		cacheMissCounter: counter,
+		db:                db,
+		refresher:         refresher,
+		hotCache:          hotCache,
+		reads:             reads,
+		missWaitTimeout:   missWaitTimeout,
+		cacheMissCounter:  missCounter,
+		cacheStaleCounter: staleCounter,
 	}, nil
 }
 
@@ -47,39 +72,171 @@ func (h *rssGetHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	rssCached, err := h.db.GetCachedRss(email, name)
+	key := feedcache.Key(email, name)
+	entry, ok := h.hotCache.Get(key)
+	if !ok {
+		var id int64
+		id, entry, ok = h.loadEntry(writer, key, email, name)
+		if !ok {
+			return
+		}
+		h.reads.Record(id)
+	} else {
+		h.reads.Record(entry.ID)
+	}
+
+	// outdated feed is served at once, reader gets the refreshed one next time
+	if entry != nil {
+		if entry.Outdated() {
+			h.cacheStaleCounter.Inc()
+			if entry.Revalidate() {
+				h.revalidate(email, name)
+			}
+		}
+
+		writeFeedEntry(writer, req, entry)
+		return
+	}
+
+	h.cacheMissCounter.Inc()
+
+	// concurrent misses wait for the same refresh, which is done by cacher workers out of turn
+	done, err := h.refresher.Refresh(email, name)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			writeNotFound(writer, "rss feed was not found", fmt.Sprintf("email: %s, name: %s", email, name))
+		case database.ErrRssLeased, rss.ErrRefreshQueueFull, rss.ErrCacherStopped:
+			writeServiceUnavailable(writer, "rss feed is not cached yet", err.Error(), cacheMissRetryAfter)
+		default:
+			writeInternalError(writer, "failed to refresh rss", err)
+		}
+		return
+	}
+
+	timer := time.NewTimer(h.missWaitTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+		writeServiceUnavailable(writer, "rss feed is not cached yet", "timeout", cacheMissRetryAfter)
+		return
+	case <-req.Context().Done():
+		return
+	}
+
+	_, entry, ok = h.loadEntry(writer, key, email, name)
+	if !ok {
+		return
+	}
+
+	// feed is not saved if aggregation failed
+	if entry == nil {
+		writeServiceUnavailable(writer, "rss feed is not cached yet", "empty feed", cacheMissRetryAfter)
+		return
+	}
+
+	writeFeedEntry(writer, req, entry)
+}
+
+// loadEntry reads feed from db and puts it into hot cache, entry is nil if rss has not been cached yet
+func (h *rssGetHandler) loadEntry(writer http.ResponseWriter, key string, email string, name string) (int64, *feedcache.Entry, bool) {
+	version := h.hotCache.Version()
+
+	feed, err := h.db.GetCachedFeed(email, name)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			msg := fmt.Sprintf("email: %s, name: %s", email, name)
 			writeNotFound(writer, "rss feed was not found", msg)
-			return
+			return 0, nil, false
 		}
 
 		writeInternalError(writer, "failed to get cached rss", err)
-		return
+		return 0, nil, false
 	}
 
-	rssFeedString := []byte(rssCached.RssFeed)
-	// fallback in case rss has not been cached yet
-	if len(rssFeedString) == 0 {
-		h.cacheMissCounter.Inc()
+	if feed.Feed == nil {
+		return feed.ID, nil, true
+	}
 
-		rssFeed := h.aggregator.Aggregate(&rssCached.Rss)
+	entry := feedcache.NewEntry(feed.ID, feed.Feed, feed.ValidFor)
+	h.hotCache.Put(key, entry, version)
 
-		rssFeedString, err = xml.Marshal(rssFeed)
-		if err != nil {
-			writeInternalError(writer, "failed to marshal rss feed", err)
-			return
-		}
+	return feed.ID, entry, true
+}
+
+// revalidate queues refresh of outdated rss, it is skipped if rss is refreshed already
+func (h *rssGetHandler) revalidate(email string, name string) {
+	_, err := h.refresher.Refresh(email, name)
+	if err != nil && err != database.ErrRssLeased {
+		log.WithError(err).
+			WithField("email", email).
+			WithField("name", name).
+			Warn("failed to queue refresh of outdated rss")
+	}
+}
+
+// writeFeedEntry serves stored compressed feed, plain feed is decompressed for clients which don't accept encoding
+func writeFeedEntry(writer http.ResponseWriter, req *http.Request, entry *feedcache.Entry) {
+	encodings := []string{compress.Gzip}
+	if len(entry.Feed.Brotli) > 0 {
+		encodings = []string{compress.Brotli, compress.Gzip}
+	}
+
+	encoding := compress.Negotiate(req.Header.Get("Accept-Encoding"), encodings...)
 
-		validUntil := rss.GetValidUntil(rssFeed)
-		err = h.db.SaveCachedRss(rssCached.Rss.ID, string(rssFeedString), validUntil)
+	etag := entry.ETag
+	switch encoding {
+	case compress.Brotli:
+		etag = entry.BrotliETag
+	case compress.Gzip:
+		etag = entry.GzipETag
+	}
+
+	writer.Header().Set("Vary", "Accept-Encoding")
+	writer.Header().Set("ETag", etag)
+
+	if matchesETag(req.Header.Get("If-None-Match"), etag) {
+		writer.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	var body []byte
+	switch encoding {
+	case compress.Brotli:
+		body = entry.Feed.Brotli
+	case compress.Gzip:
+		body = entry.Feed.Gzip
+	default:
+		var err error
+		body, err = compress.Decode(entry.Feed)
 		if err != nil {
-			log.WithError(err).Error("failed to save cached rss feed")
+			writeInternalError(writer, "failed to decompress rss feed", err)
+			return
 		}
 	}
 
 	writer.Header().Set("Content-Type", "application/xml")
+	if len(encoding) > 0 {
+		writer.Header().Set("Content-Encoding", encoding)
+	}
 	writer.WriteHeader(http.StatusOK)
-	writer.Write(rssFeedString)
+
+	_, err := writer.Write(body)
+	if err != nil {
+		log.WithError(err).Warn("failed to write response")
+	}
+}
+
+// matchesETag uses weak comparison as it is required for If-None-Match
+func matchesETag(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
 }
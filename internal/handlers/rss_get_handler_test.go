@@ -1,20 +1,27 @@
 package handlers
 
 import (
+	"compress/gzip"
 	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
-	"strings"
 	"testing"
+	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/go-chi/chi"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 
+	"service-rss/internal/compress"
+	"service-rss/internal/config"
 	"service-rss/internal/database"
+	"service-rss/internal/feedcache"
+	"service-rss/internal/reads"
 	"service-rss/internal/rss"
 )
 
@@ -22,19 +29,38 @@ func TestRssGetHandler_ServeHTTP(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
+	done := make(chan struct{})
+	close(done)
+	pending := make(chan struct{})
+
 	db := database.NewMockDatabase(ctrl)
-	db.EXPECT().GetCachedRss(gomock.Any(), "no_rows").Return(nil, sql.ErrNoRows)
-	db.EXPECT().GetCachedRss(gomock.Any(), "error").Return(nil, errors.New("error"))
-	db.EXPECT().GetCachedRss(gomock.Any(), "empty").Return(&database.RssCached{}, nil)
-	db.EXPECT().GetCachedRss(gomock.Any(), "ok").Return(&database.RssCached{RssFeed: "ok"}, nil)
-	db.EXPECT().SaveCachedRss(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
-
-	fetcher := rss.NewMockFetcher(ctrl)
-	fetcher.EXPECT().Fetch(gomock.Any()).AnyTimes().Return(nil, nil)
-	aggregator, err := rss.NewAggregator(fetcher)
+	db.EXPECT().GetCachedFeed(gomock.Any(), "no_rows").Return(nil, sql.ErrNoRows)
+	db.EXPECT().GetCachedFeed(gomock.Any(), "error").Return(nil, errors.New("error"))
+	// the second read of feed is served from hot cache
+	db.EXPECT().GetCachedFeed(gomock.Any(), "ok").Return(&database.CachedFeed{ID: 2, Feed: encodeFeed(t, "ok"), ValidFor: time.Hour}, nil)
+	db.EXPECT().GetCachedFeed(gomock.Any(), "stale").Return(&database.CachedFeed{ID: 4, Feed: encodeFeed(t, "stale")}, nil)
+	gomock.InOrder(
+		db.EXPECT().GetCachedFeed(gomock.Any(), "empty").Return(&database.CachedFeed{ID: 1}, nil),
+		db.EXPECT().GetCachedFeed(gomock.Any(), "empty").Return(&database.CachedFeed{ID: 1, Feed: encodeFeed(t, "fresh"), ValidFor: time.Hour}, nil),
+	)
+	db.EXPECT().GetCachedFeed(gomock.Any(), "slow").Return(&database.CachedFeed{ID: 5}, nil)
+	db.EXPECT().GetCachedFeed(gomock.Any(), "leased").Return(&database.CachedFeed{ID: 6}, nil)
+
+	refresher := rss.NewMockRefresher(ctrl)
+	// outdated feed is refreshed once while it is kept in hot cache
+	refresher.EXPECT().Refresh("example@gmail.com", "stale").Return(nil, database.ErrRssLeased)
+	refresher.EXPECT().Refresh("example@gmail.com", "empty").Return(done, nil)
+	refresher.EXPECT().Refresh("example@gmail.com", "slow").Return(pending, nil)
+	refresher.EXPECT().Refresh("example@gmail.com", "leased").Return(nil, database.ErrRssLeased)
+
+	recorder := reads.NewMockRecorder(ctrl)
+	recorder.EXPECT().Record(int64(2)).Times(5)
+	recorder.EXPECT().Record(gomock.Any()).AnyTimes()
+
+	hotCache, err := feedcache.New(&config.Config{HotCacheMaxBytes: 1 << 20, HotCacheMaxAge: time.Minute}, nil)
 	assert.NoError(t, err)
 
-	defaultHandler, err := NewRssGetHandler(db, aggregator)
+	defaultHandler, err := NewRssGetHandler(db, refresher, hotCache, recorder, 10*time.Millisecond)
 	assert.NoError(t, err)
 
 	t.Run("empty email", func(t *testing.T) {
@@ -84,20 +110,95 @@ func TestRssGetHandler_ServeHTTP(t *testing.T) {
 
 		assert.Equal(t, 200, rr.Code)
 		assert.Equal(t, "application/xml", rr.Header().Get("Content-Type"))
-		body := rr.Body.String()
-		assert.True(t, strings.HasPrefix(body, "<rss><channel><title>RSS Aggregator</title><link></link><description>Aggregated feed from different rss sources.</description><lastBuildDate>"))
-		assert.True(t, strings.HasSuffix(body, "</lastBuildDate><ttl>5</ttl></channel></rss>"))
+		assert.Equal(t, "fresh", rr.Body.String())
+	})
+
+	t.Run("empty cache timeout", func(t *testing.T) {
+		req := createReq("example@gmail.com", "slow")
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 503, rr.Code)
+		assert.Equal(t, "10", rr.Header().Get("Retry-After"))
+		assert.Contains(t, rr.Body.String(), "rss feed is not cached yet")
+	})
+
+	t.Run("empty cache leased", func(t *testing.T) {
+		req := createReq("example@gmail.com", "leased")
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 503, rr.Code)
+		assert.Equal(t, "10", rr.Header().Get("Retry-After"))
 	})
 
 	t.Run("cache hit", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			req := createReq("example@gmail.com", "ok")
+			rr := httptest.NewRecorder()
+			defaultHandler.ServeHTTP(rr, req)
+
+			assert.Equal(t, 200, rr.Code)
+			assert.Equal(t, "application/xml", rr.Header().Get("Content-Type"))
+			assert.Equal(t, "ok", rr.Body.String())
+			assert.NotEmpty(t, rr.Header().Get("ETag"))
+		}
+	})
+
+	t.Run("brotli", func(t *testing.T) {
 		req := createReq("example@gmail.com", "ok")
+		req.Header.Set("Accept-Encoding", "gzip, deflate, br")
 		rr := httptest.NewRecorder()
 		defaultHandler.ServeHTTP(rr, req)
 
 		assert.Equal(t, 200, rr.Code)
-		assert.Equal(t, "application/xml", rr.Header().Get("Content-Type"))
-		assert.Equal(t, "ok", rr.Body.String())
+		assert.Equal(t, "br", rr.Header().Get("Content-Encoding"))
+		body, err := ioutil.ReadAll(brotli.NewReader(rr.Body))
+		assert.NoError(t, err)
+		assert.Equal(t, "ok", string(body))
 	})
+
+	t.Run("gzip and etag", func(t *testing.T) {
+		req := createReq("example@gmail.com", "ok")
+		req.Header.Set("Accept-Encoding", "br;q=0.5, gzip;q=0.8")
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 200, rr.Code)
+		assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+		reader, err := gzip.NewReader(rr.Body)
+		assert.NoError(t, err)
+		body, err := ioutil.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, "ok", string(body))
+
+		etag := rr.Header().Get("ETag")
+		req = createReq("example@gmail.com", "ok")
+		req.Header.Set("Accept-Encoding", "gzip")
+		req.Header.Set("If-None-Match", "W/"+etag)
+		rr = httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 304, rr.Code)
+		assert.Empty(t, rr.Body.String())
+	})
+
+	t.Run("outdated cache", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			req := createReq("example@gmail.com", "stale")
+			rr := httptest.NewRecorder()
+			defaultHandler.ServeHTTP(rr, req)
+
+			assert.Equal(t, 200, rr.Code)
+			assert.Equal(t, "stale", rr.Body.String())
+		}
+	})
+}
+
+func encodeFeed(t *testing.T, body string) *compress.Encoded {
+	encoded, err := compress.Encode([]byte(body))
+	assert.NoError(t, err)
+	return encoded
 }
 
 func createReq(email string, name string) *http.Request {
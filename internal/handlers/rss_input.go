@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/asaskevich/govalidator"
+	log "github.com/sirupsen/logrus"
+	"github.com/xeipuuv/gojsonschema"
+
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+	"service-rss/internal/rss"
+)
+
+// readRssInput validates body of create and update requests, bad request is written on failure
+func readRssInput(writer http.ResponseWriter, req *http.Request, schema *gojsonschema.Schema, validator rss.Validator) (*database.Rss, bool) {
+	in := &dto.RssCreateIn{}
+	if !readJsonInput(writer, req, schema, in) {
+		return nil, false
+	}
+
+	if in.Search != nil && len(in.Sources) > 0 {
+		writeBadRequest(writer, "saved search should not have sources", in.Name)
+		return nil, false
+	}
+
+	if in.Search == nil && len(in.Sources) == 0 {
+		writeBadRequest(writer, "sources or search should be specified", in.Name)
+		return nil, false
+	}
+
+	wrongUrls := make([]string, 0, len(in.Sources))
+	fetched := make([]string, 0, len(in.Sources))
+	for _, rawUrl := range in.Sources {
+		// newsletter sources are emailed, so they are neither urls nor validated
+		if rss.IsNewsletterSource(rawUrl) {
+			continue
+		}
+
+		// nested sources are other rss, they are checked by caller which knows owner
+		if rss.IsNestedSource(rawUrl) {
+			if _, _, err := rss.ParseNestedSource(rawUrl); err != nil {
+				wrongUrls = append(wrongUrls, rawUrl)
+			}
+			continue
+		}
+
+		// scraped sources are pages, selectors are tuned with scrape preview instead of validation
+		if rss.IsScrapedSource(rawUrl) {
+			if _, err := rss.ParseScrapedSource(rawUrl); err != nil {
+				wrongUrls = append(wrongUrls, rawUrl)
+			}
+			continue
+		}
+		fetched = append(fetched, rawUrl)
+
+		isUrl := govalidator.IsURL(rawUrl)
+		if !isUrl {
+			wrongUrls = append(wrongUrls, rawUrl)
+		}
+	}
+
+	if len(wrongUrls) > 0 {
+		urls := strings.Join(wrongUrls, "\n")
+		writeBadRequest(writer, "found malformed input source urls", urls)
+		return nil, false
+	}
+
+	if in.Mode == database.ModePodcast && in.Podcast == nil {
+		writeBadRequest(writer, "podcast settings are required for podcast mode", in.Name)
+		return nil, false
+	}
+
+	// validator is omitted when sources are diagnosed by caller
+	if !in.Force && validator != nil && len(fetched) > 0 && !checkSources(writer, validator, fetched) {
+		return nil, false
+	}
+
+	return &database.Rss{
+		Name:      in.Name,
+		Sources:   in.Sources,
+		Mode:      in.Mode,
+		Channel:   toChannelSettings(in.Channel, in.Podcast),
+		Podcast:   toPodcastSettings(in.Podcast),
+		Retention: toRetentionSettings(in.Retention),
+		Search:    toSearchSettings(in.Search),
+	}, true
+}
+
+// checkNested writes bad request if nested sources of rss are unknown or include rss itself
+func checkNested(writer http.ResponseWriter, db database.Database, in *database.Rss) bool {
+	err := rss.CheckNested(db, in)
+	if err == nil {
+		return true
+	}
+
+	if errors.Is(err, rss.ErrUnknownNested) || errors.Is(err, rss.ErrNestedCycle) || errors.Is(err, rss.ErrNestedTooDeep) ||
+		errors.Is(err, rss.ErrForeignNested) {
+		writeBadRequest(writer, "invalid nested rss", err.Error())
+		return false
+	}
+
+	writeInternalError(writer, "failed to check nested rss", err)
+	return false
+}
+
+// checkSources fetches sources and writes bad request with per source results if any of them failed
+func checkSources(writer http.ResponseWriter, validator rss.Validator, sources []string) bool {
+	checks := validator.Validate(sources)
+
+	failed := make([]string, 0)
+	for _, check := range checks {
+		if !check.Ok() {
+			failed = append(failed, check.Url)
+		}
+	}
+
+	if len(failed) == 0 {
+		return true
+	}
+
+	log.WithField("value", failed).Warn("sources validation failed")
+
+	writeErrorResponse(writer, http.StatusBadRequest, &dto.ErrorResponse{
+		Error:   "sources validation failed",
+		Value:   strings.Join(failed, "\n"),
+		Sources: toSourceChecksOut(checks),
+	})
+	return false
+}
+
+func toSourceChecksOut(checks []*rss.SourceCheck) []*dto.SourceCheckOut {
+	out := make([]*dto.SourceCheckOut, 0, len(checks))
+	for _, check := range checks {
+		out = append(out, &dto.SourceCheckOut{
+			Url:    check.Url,
+			Status: check.Status,
+			Error:  check.Error,
+			Feeds:  toDiscoveredFeedsOut(check.Feeds),
+		})
+	}
+
+	return out
+}
+
+// toChannelSettings takes language of podcast settings, where it was before channel settings, if channel has none
+func toChannelSettings(in *dto.ChannelIn, podcast *dto.PodcastIn) *database.ChannelSettings {
+	if in == nil && (podcast == nil || len(podcast.Language) == 0) {
+		return nil
+	}
+	if in == nil {
+		in = &dto.ChannelIn{}
+	}
+
+	channel := &database.ChannelSettings{
+		Title:       in.Title,
+		Description: in.Description,
+		Link:        in.Link,
+		Language:    in.Language,
+		Image:       in.Image,
+		Icon:        in.Icon,
+		Copyright:   in.Copyright,
+		Category:    in.Category,
+	}
+	if len(channel.Language) == 0 && podcast != nil {
+		channel.Language = podcast.Language
+	}
+
+	return channel
+}
+
+func toPodcastSettings(in *dto.PodcastIn) *database.PodcastSettings {
+	if in == nil {
+		return nil
+	}
+
+	return &database.PodcastSettings{
+		Author:      in.Author,
+		OwnerName:   in.OwnerName,
+		OwnerEmail:  in.OwnerEmail,
+		Image:       in.Image,
+		Category:    in.Category,
+		Subcategory: in.Subcategory,
+		Explicit:    in.Explicit,
+		Type:        in.Type,
+		Locked:      in.Locked,
+	}
+}
+
+func toRetentionSettings(in *dto.RetentionIn) *database.RetentionSettings {
+	if in == nil || (in.MaxItems == 0 && in.MaxDays == 0) {
+		return nil
+	}
+
+	return &database.RetentionSettings{
+		MaxItems: in.MaxItems,
+		MaxDays:  in.MaxDays,
+	}
+}
+
+func toSearchSettings(in *dto.SearchIn) *database.SearchSettings {
+	if in == nil {
+		return nil
+	}
+
+	return &database.SearchSettings{
+		Query: in.Query,
+		Feeds: in.Feeds,
+	}
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+
+	"github.com/xeipuuv/gojsonschema"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/dto"
+	"service-rss/internal/ratelimit"
+	"service-rss/internal/rss"
+)
+
+const (
+	maxPreviewSources = 20
+	maxPreviewItems   = 50
+)
+
+type rssPreviewHandler struct {
+	aggregator  rss.Aggregator
+	limiter     ratelimit.Limiter
+	schema      *gojsonschema.Schema
+	authHandler auth.Handler
+}
+
+func NewRssPreviewHandler(aggregator rss.Aggregator, limiter ratelimit.Limiter, schema *gojsonschema.Schema, authHandler auth.Handler) http.Handler {
+	return &rssPreviewHandler{
+		aggregator:  aggregator,
+		limiter:     limiter,
+		schema:      schema,
+		authHandler: authHandler,
+	}
+}
+
+func (h *rssPreviewHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	email, err := h.authHandler.GetEmail(writer, req)
+	if err != nil || len(email) == 0 {
+		writeBadRequest(writer, "failed to get email", errorValue(err))
+		return
+	}
+
+	// sources are not validated, fetch results are reported in diagnostics instead
+	rssIn, ok := readRssInput(writer, req, h.schema, nil)
+	if !ok {
+		return
+	}
+	rssIn.Email = email
+
+	if len(rssIn.Sources) > maxPreviewSources {
+		writeBadRequest(writer, "too many sources for preview", fmt.Sprintf("max %d", maxPreviewSources))
+		return
+	}
+
+	// every preview fetches all of sources, so it is limited per user and in total, malformed input is not counted
+	if ok, retryAfter := h.limiter.Allow(email); !ok {
+		writeTooManyRequests(writer, "too many preview requests", retryAfter)
+		return
+	}
+
+	feed, diagnostics := h.aggregator.Preview(rssIn)
+	if feed == nil {
+		writeInternalError(writer, "failed to aggregate rss", fmt.Errorf("empty feed of %s", rssIn.Name))
+		return
+	}
+
+	if req.URL.Query().Get("format") == "xml" {
+		feedBytes, err := xml.Marshal(feed)
+		if err != nil {
+			writeInternalError(writer, "failed to marshal rss feed", err)
+			return
+		}
+
+		writer.Header().Set("Content-Type", "application/xml")
+		writer.WriteHeader(http.StatusOK)
+		writer.Write(feedBytes)
+		return
+	}
+
+	writeJsonResponse(writer, toRssPreviewOut(feed, diagnostics))
+}
+
+func toRssPreviewOut(feed *dto.RssFeed, diagnostics []*rss.SourceDiagnostic) *dto.RssPreviewOut {
+	channel := feed.Channel
+
+	items := channel.Items
+	if len(items) > maxPreviewItems {
+		items = items[:maxPreviewItems]
+	}
+
+	out := &dto.RssPreviewOut{
+		Title:       channel.Title,
+		Link:        channel.Link,
+		Description: channel.Description,
+		Ttl:         channel.Ttl,
+		Items:       make([]*dto.PreviewItemOut, 0, len(items)),
+		Sources:     make([]*dto.SourceDiagnosticOut, 0, len(diagnostics)),
+	}
+
+	for _, item := range items {
+		itemOut := &dto.PreviewItemOut{
+			Title:   item.Title,
+			Link:    item.Link,
+			PubDate: item.PubDate,
+		}
+		if item.Source != nil {
+			itemOut.Source = item.Source.Url
+		}
+		out.Items = append(out.Items, itemOut)
+	}
+
+	for _, diagnostic := range diagnostics {
+		status := "ok"
+		if len(diagnostic.Error) > 0 {
+			status = "error"
+		}
+
+		out.Sources = append(out.Sources, &dto.SourceDiagnosticOut{
+			Url:        diagnostic.Url,
+			Status:     status,
+			Error:      diagnostic.Error,
+			Items:      diagnostic.Items,
+			DurationMs: diagnostic.Duration.Milliseconds(),
+		})
+	}
+
+	return out
+}
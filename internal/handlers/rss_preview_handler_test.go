@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/xeipuuv/gojsonschema"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+	"service-rss/internal/ratelimit"
+	"service-rss/internal/rss"
+)
+
+func TestRssPreviewHandler_ServeHTTP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	feed := &dto.RssFeed{
+		Version: "2.0",
+		Channel: &dto.RssFeedChannel{
+			Title:       "preview",
+			Link:        "http://localhost",
+			Description: "description",
+			Ttl:         5,
+			Items: []*dto.RssFeedItem{
+				{
+					Title:  "item",
+					Link:   "http://google.com/item",
+					Source: &dto.RssFeedSource{Url: "http://google.com"},
+				},
+			},
+		},
+	}
+
+	aggregator := rss.NewMockAggregator(ctrl)
+	aggregator.EXPECT().Preview(&database.Rss{
+		Email:   "example@gmail.com",
+		Name:    "preview",
+		Sources: []string{"http://google.com", "http://broken.com"},
+	}).Times(3).Return(feed, []*rss.SourceDiagnostic{
+		{Url: "http://google.com", Items: 1, Duration: 20 * time.Millisecond},
+		{Url: "http://broken.com", Error: "malformed rss feed", Duration: 10 * time.Millisecond},
+	})
+
+	loader := gojsonschema.NewStringLoader(schema)
+	jsonSchema, err := gojsonschema.NewSchema(loader)
+	assert.NoError(t, err)
+
+	authHandler := auth.NewMockHandler(ctrl)
+	authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).AnyTimes().Return("example@gmail.com", nil)
+
+	defaultHandler := NewRssPreviewHandler(aggregator, ratelimit.New(100, 100), jsonSchema, authHandler)
+
+	t.Run("auth error", func(t *testing.T) {
+		authHandler := auth.NewMockHandler(ctrl)
+		authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).Return("", errors.New("err"))
+
+		handler := NewRssPreviewHandler(aggregator, ratelimit.New(100, 100), jsonSchema, authHandler)
+
+		req := httptest.NewRequest("POST", "/api/rss/preview", nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 400, rr.Code)
+		assert.Contains(t, rr.Body.String(), "failed to get email")
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		handler := NewRssPreviewHandler(aggregator, ratelimit.New(1, 100), jsonSchema, authHandler)
+
+		body := "{\"name\":\"preview\",\"sources\":[\"http://google.com\",\"http://broken.com\"]}"
+
+		// malformed input is rejected before limit is taken
+		req := httptest.NewRequest("POST", "/api/rss/preview", strings.NewReader("{}"))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, 400, rr.Code)
+
+		req = httptest.NewRequest("POST", "/api/rss/preview", strings.NewReader(body))
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, 200, rr.Code)
+
+		req = httptest.NewRequest("POST", "/api/rss/preview", strings.NewReader(body))
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 429, rr.Code)
+		assert.Equal(t, "60", rr.Header().Get("Retry-After"))
+		assert.Contains(t, rr.Body.String(), "too many preview requests")
+	})
+
+	t.Run("too many sources", func(t *testing.T) {
+		sources := make([]string, maxPreviewSources+1)
+		for i := range sources {
+			sources[i] = "\"http://google.com\""
+		}
+		body := strings.NewReader("{\"name\":\"preview\",\"sources\":[" + strings.Join(sources, ",") + "]}")
+		req := httptest.NewRequest("POST", "/api/rss/preview", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 400, rr.Code)
+		assert.Contains(t, rr.Body.String(), "too many sources for preview")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		body := strings.NewReader("{\"name\":\"preview\",\"sources\":[\"http://google.com\",\"http://broken.com\"]}")
+		req := httptest.NewRequest("POST", "/api/rss/preview", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 200, rr.Code)
+		assert.Equal(t, "application/json; charset=utf-8", rr.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{
+			"title": "preview",
+			"link": "http://localhost",
+			"description": "description",
+			"ttl": 5,
+			"items": [
+				{"title": "item", "link": "http://google.com/item", "source": "http://google.com"}
+			],
+			"sources": [
+				{"url": "http://google.com", "status": "ok", "items": 1, "duration_ms": 20},
+				{"url": "http://broken.com", "status": "error", "error": "malformed rss feed", "items": 0, "duration_ms": 10}
+			]
+		}`, rr.Body.String())
+	})
+
+	t.Run("xml", func(t *testing.T) {
+		body := strings.NewReader("{\"name\":\"preview\",\"sources\":[\"http://google.com\",\"http://broken.com\"]}")
+		req := httptest.NewRequest("POST", "/api/rss/preview?format=xml", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 200, rr.Code)
+		assert.Equal(t, "application/xml", rr.Header().Get("Content-Type"))
+		assert.Contains(t, rr.Body.String(), "<title>item</title>")
+	})
+}
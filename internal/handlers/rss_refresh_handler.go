@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+	"service-rss/internal/ratelimit"
+	"service-rss/internal/rss"
+)
+
+const (
+	refreshStatusQueued = "queued"
+	refreshStatusDone   = "done"
+
+	// refresh queue is drained by cacher workers, so it is retried soon
+	refreshRetryAfter = 5 * time.Second
+)
+
+type rssRefreshHandler struct {
+	refresher   rss.Refresher
+	limiter     ratelimit.Limiter
+	waitTimeout time.Duration
+	authHandler auth.Handler
+}
+
+func NewRssRefreshHandler(refresher rss.Refresher, limiter ratelimit.Limiter, waitTimeout time.Duration, authHandler auth.Handler) http.Handler {
+	return &rssRefreshHandler{
+		refresher:   refresher,
+		limiter:     limiter,
+		waitTimeout: waitTimeout,
+		authHandler: authHandler,
+	}
+}
+
+func (h *rssRefreshHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	email, err := h.authHandler.GetEmail(writer, req)
+	if err != nil || len(email) == 0 {
+		writeBadRequest(writer, "failed to get email", errorValue(err))
+		return
+	}
+
+	name := chi.URLParam(req, "name")
+	if len(name) == 0 {
+		writeBadRequest(writer, "name should be specified", "")
+		return
+	}
+
+	// every refresh fetches all of sources out of schedule, so it is limited per user and in total
+	if ok, retryAfter := h.limiter.Allow(email); !ok {
+		writeTooManyRequests(writer, "too many refresh requests", retryAfter)
+		return
+	}
+
+	// rss is leased by owner email, so other users can't refresh it
+	done, err := h.refresher.Refresh(email, name)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			writeNotFound(writer, "rss feed was not found", name)
+		case database.ErrRssLeased:
+			writeConflict(writer, "rss feed is being refreshed already", name)
+		case rss.ErrRefreshQueueFull, rss.ErrCacherStopped:
+			writeServiceUnavailable(writer, "too many refreshes are queued", name, refreshRetryAfter)
+		default:
+			writeInternalError(writer, "failed to refresh rss", err)
+		}
+		return
+	}
+
+	if req.URL.Query().Get("wait") != "true" {
+		writeJsonResponseWithStatus(writer, http.StatusAccepted, &dto.RssRefreshOut{Status: refreshStatusQueued})
+		return
+	}
+
+	timer := time.NewTimer(h.waitTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		writeJsonResponse(writer, &dto.RssRefreshOut{Status: refreshStatusDone})
+	case <-timer.C:
+		// rss is still cached in background
+		writeJsonResponseWithStatus(writer, http.StatusAccepted, &dto.RssRefreshOut{Status: refreshStatusQueued})
+	case <-req.Context().Done():
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+	"service-rss/internal/ratelimit"
+	"service-rss/internal/rss"
+)
+
+func TestRssRefreshHandler_ServeHTTP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	done := make(chan struct{})
+	close(done)
+	pending := make(chan struct{})
+
+	refresher := rss.NewMockRefresher(ctrl)
+	refresher.EXPECT().Refresh("example@gmail.com", "queued").Return(done, nil)
+	refresher.EXPECT().Refresh("example@gmail.com", "done").Return(done, nil)
+	refresher.EXPECT().Refresh("example@gmail.com", "slow").Return(pending, nil)
+	refresher.EXPECT().Refresh("example@gmail.com", "absent").Return(nil, sql.ErrNoRows)
+	refresher.EXPECT().Refresh("example@gmail.com", "leased").Return(nil, database.ErrRssLeased)
+	refresher.EXPECT().Refresh("example@gmail.com", "full").Return(nil, rss.ErrRefreshQueueFull)
+	refresher.EXPECT().Refresh("example@gmail.com", "error").Return(nil, errors.New("error"))
+
+	authHandler := auth.NewMockHandler(ctrl)
+	authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).AnyTimes().Return("example@gmail.com", nil)
+
+	defaultHandler := NewRssRefreshHandler(refresher, ratelimit.New(100, 100), 10*time.Millisecond, authHandler)
+
+	tests := []struct {
+		name   string
+		rss    string
+		wait   bool
+		code   int
+		result string
+	}{
+		{name: "queued", rss: "queued", code: 202, result: `{"status":"queued"}`},
+		{name: "wait", rss: "done", wait: true, code: 200, result: `{"status":"done"}`},
+		{name: "wait timeout", rss: "slow", wait: true, code: 202, result: `{"status":"queued"}`},
+		{name: "not found", rss: "absent", code: 404, result: "rss feed was not found"},
+		{name: "leased", rss: "leased", code: 409, result: "rss feed is being refreshed already"},
+		{name: "queue is full", rss: "full", code: 503, result: "too many refreshes are queued"},
+		{name: "error", rss: "error", code: 500, result: "failed to refresh rss"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			defaultHandler.ServeHTTP(rr, createRefreshReq(tt.rss, tt.wait))
+
+			assert.Equal(t, tt.code, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.result)
+		})
+	}
+
+	t.Run("auth error", func(t *testing.T) {
+		authHandler := auth.NewMockHandler(ctrl)
+		authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).Return("", errors.New("err"))
+
+		handler := NewRssRefreshHandler(refresher, ratelimit.New(100, 100), time.Second, authHandler)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, createRefreshReq("queued", false))
+
+		assert.Equal(t, 400, rr.Code)
+		assert.Contains(t, rr.Body.String(), "failed to get email")
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		refresher := rss.NewMockRefresher(ctrl)
+		refresher.EXPECT().Refresh("example@gmail.com", "queued").Return(done, nil)
+
+		handler := NewRssRefreshHandler(refresher, ratelimit.New(1, 100), time.Second, authHandler)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, createRefreshReq("queued", false))
+		assert.Equal(t, 202, rr.Code)
+
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, createRefreshReq("queued", false))
+		assert.Equal(t, 429, rr.Code)
+		assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+	})
+}
+
+func createRefreshReq(name string, wait bool) *http.Request {
+	target := "/api/rss/" + name + "/refresh"
+	if wait {
+		target += "?wait=true"
+	}
+	req := httptest.NewRequest("POST", target, nil)
+
+	routeContext := &chi.Context{
+		URLParams: chi.RouteParams{
+			Keys:   []string{"name"},
+			Values: []string{name},
+		},
+	}
+
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, routeContext)
+	return req.WithContext(ctx)
+}
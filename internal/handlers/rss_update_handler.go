@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/xeipuuv/gojsonschema"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+	"service-rss/internal/rss"
+)
+
+type rssUpdateHandler struct {
+	db          database.Database
+	validator   rss.Validator
+	schema      *gojsonschema.Schema
+	authHandler auth.Handler
+}
+
+func NewRssUpdateHandler(db database.Database, validator rss.Validator, schema *gojsonschema.Schema, authHandler auth.Handler) http.Handler {
+	return &rssUpdateHandler{
+		db:          db,
+		validator:   validator,
+		schema:      schema,
+		authHandler: authHandler,
+	}
+}
+
+func (h *rssUpdateHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	email, err := h.authHandler.GetEmail(writer, req)
+	if err != nil || len(email) == 0 {
+		writeBadRequest(writer, "failed to get email", errorValue(err))
+		return
+	}
+
+	rss, ok := readRssInput(writer, req, h.schema, h.validator)
+	if !ok {
+		return
+	}
+	// rss is looked up by owner email, so users can't update feeds of others
+	rss.Email = email
+
+	if !checkNested(writer, h.db, rss) {
+		return
+	}
+
+	err = h.db.UpdateRss(rss)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeNotFound(writer, "rss feed was not found", rss.Name)
+			return
+		}
+
+		writeInternalError(writer, "failed to update rss", err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusOK)
+}
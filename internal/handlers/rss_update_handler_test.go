@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/xeipuuv/gojsonschema"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+	"service-rss/internal/rss"
+)
+
+func TestRssUpdateHandler_ServeHTTP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().UpdateRss(&database.Rss{
+		Email: "example@gmail.com",
+		Name:  "missing",
+		Sources: []string{
+			"http://google.com",
+		},
+	}).Return(sql.ErrNoRows)
+	db.EXPECT().UpdateRss(&database.Rss{
+		Email: "example@gmail.com",
+		Name:  "error",
+		Sources: []string{
+			"http://google.com",
+		},
+	}).Return(errors.New("error"))
+	db.EXPECT().UpdateRss(&database.Rss{
+		Email: "example@gmail.com",
+		Name:  "ok",
+		Sources: []string{
+			"http://google.com",
+		},
+		Channel: &database.ChannelSettings{
+			Title:    "Title",
+			Language: "en",
+		},
+	}).Return(nil)
+	db.EXPECT().UpdateRss(&database.Rss{
+		Email: "example@gmail.com",
+		Name:  "backend",
+		Sources: []string{
+			"aggregate:example@gmail.com/go",
+		},
+	}).Return(nil)
+	db.EXPECT().GetRss("example@gmail.com", "go").AnyTimes().Return(&database.Rss{
+		Email:   "example@gmail.com",
+		Name:    "go",
+		Sources: []string{"http://google.com"},
+	}, nil)
+	db.EXPECT().GetRss("example@gmail.com", "loop").AnyTimes().Return(&database.Rss{
+		Email:   "example@gmail.com",
+		Name:    "loop",
+		Sources: []string{"aggregate:example@gmail.com/backend"},
+	}, nil)
+	db.EXPECT().GetRss("example@gmail.com", "unknown").AnyTimes().Return(nil, sql.ErrNoRows)
+	db.EXPECT().GetSourceRss("aggregate:example@gmail.com/backend").AnyTimes().Return([]*database.Rss{{
+		Email:   "example@gmail.com",
+		Name:    "loop",
+		Sources: []string{"aggregate:example@gmail.com/backend"},
+	}}, nil)
+	db.EXPECT().GetSourceRss("aggregate:example@gmail.com/loop").AnyTimes().Return([]*database.Rss{}, nil)
+	db.EXPECT().GetRss("example@gmail.com", "broken").AnyTimes().Return(nil, errors.New("error"))
+
+	loader := gojsonschema.NewStringLoader(schema)
+	jsonSchema, err := gojsonschema.NewSchema(loader)
+	assert.NoError(t, err)
+
+	authHandler := auth.NewMockHandler(ctrl)
+	authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).AnyTimes().Return("example@gmail.com", nil)
+
+	validator := rss.NewMockValidator(ctrl)
+	validator.EXPECT().Validate([]string{"http://google.com"}).AnyTimes().Return([]*rss.SourceCheck{
+		{Url: "http://google.com", Status: rss.SourceStatusOk},
+	})
+
+	defaultHandler := NewRssUpdateHandler(db, validator, jsonSchema, authHandler)
+
+	t.Run("auth error", func(t *testing.T) {
+		authHandler := auth.NewMockHandler(ctrl)
+		authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).Return("", errors.New("err"))
+
+		handler := NewRssUpdateHandler(db, validator, jsonSchema, authHandler)
+
+		req := httptest.NewRequest("POST", "/api/rss/update", nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 400, rr.Code)
+		assert.Contains(t, rr.Body.String(), "failed to get email")
+	})
+
+	t.Run("not logged in", func(t *testing.T) {
+		authHandler := auth.NewMockHandler(ctrl)
+		authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).Return("", nil)
+
+		handler := NewRssUpdateHandler(db, validator, jsonSchema, authHandler)
+
+		req := httptest.NewRequest("POST", "/api/rss/update", nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 400, rr.Code)
+		assert.Contains(t, rr.Body.String(), "failed to get email")
+	})
+
+	t.Run("malformed input", func(t *testing.T) {
+		body := strings.NewReader("{\"name\":\"example\"}")
+		req := httptest.NewRequest("POST", "/api/rss/update", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 400, rr.Code)
+		assert.Contains(t, rr.Body.String(), "sources or search should be specified")
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		body := strings.NewReader("{\"name\":\"missing\",\"sources\":[\"http://google.com\"]}")
+		req := httptest.NewRequest("POST", "/api/rss/update", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 404, rr.Code)
+		assert.Contains(t, rr.Body.String(), "rss feed was not found")
+	})
+
+	t.Run("error", func(t *testing.T) {
+		body := strings.NewReader("{\"name\":\"error\",\"sources\":[\"http://google.com\"]}")
+		req := httptest.NewRequest("POST", "/api/rss/update", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 500, rr.Code)
+		assert.Contains(t, rr.Body.String(), "failed to update rss")
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		body := strings.NewReader("{\"name\":\"ok\",\"sources\":[\"http://google.com\"],\"channel\":{\"title\":\"Title\",\"language\":\"en\"}}")
+		req := httptest.NewRequest("POST", "/api/rss/update", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 200, rr.Code)
+		assert.Equal(t, "", rr.Body.String())
+	})
+	t.Run("nested rss", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			source   string
+			code     int
+			expected string
+		}{
+			{name: "ok", source: "aggregate:example@gmail.com/go", code: 200},
+			{name: "cycle", source: "aggregate:example@gmail.com/loop", code: 400, expected: "nested rss make a cycle"},
+			{name: "self", source: "aggregate:example@gmail.com/backend", code: 400, expected: "nested rss make a cycle"},
+			{name: "unknown", source: "aggregate:example@gmail.com/unknown", code: 400, expected: "unknown nested rss"},
+			{name: "other owner", source: "aggregate:other@gmail.com/go", code: 400, expected: "nested rss of other owners can't be included"},
+			{name: "malformed", source: "aggregate:unknown", code: 400, expected: "found malformed input source urls"},
+			{name: "error", source: "aggregate:example@gmail.com/broken", code: 500, expected: "failed to check nested rss"},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				body := strings.NewReader("{\"name\":\"backend\",\"sources\":[\"" + test.source + "\"]}")
+				req := httptest.NewRequest("POST", "/api/rss/update", body)
+				rr := httptest.NewRecorder()
+				defaultHandler.ServeHTTP(rr, req)
+
+				assert.Equal(t, test.code, rr.Code)
+				assert.Contains(t, rr.Body.String(), test.expected)
+			})
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+	"service-rss/internal/rss"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+type searchHandler struct {
+	db database.Database
+}
+
+// NewSearchHandler searches stored items of all feeds or of one feed given as email/name, feeds are public anyway.
+// Sources of newsletters are secret addresses, so senders are returned instead
+func NewSearchHandler(db database.Database) http.Handler {
+	return &searchHandler{
+		db: db,
+	}
+}
+
+func (h *searchHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	params := req.URL.Query()
+
+	text := strings.TrimSpace(params.Get("q"))
+	if len(text) == 0 {
+		writeBadRequest(writer, "search query should be specified", "")
+		return
+	}
+
+	query := &database.SearchQuery{
+		Text:     text,
+		Language: params.Get("lang"),
+		Limit:    defaultSearchLimit,
+	}
+
+	if feed := params.Get("feed"); len(feed) > 0 {
+		i := strings.LastIndex(feed, "/")
+		if i <= 0 || i == len(feed)-1 {
+			writeBadRequest(writer, "feed should be specified as email/name", feed)
+			return
+		}
+		query.Email, query.Names = feed[:i], []string{feed[i+1:]}
+	}
+
+	if since := params.Get("since"); len(since) > 0 {
+		t, ok := parseSince(since)
+		if !ok {
+			writeBadRequest(writer, "since should be date or RFC 3339 time", since)
+			return
+		}
+		query.Since = &t
+	}
+
+	if limit := params.Get("limit"); len(limit) > 0 {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value <= 0 || value > maxSearchLimit {
+			writeBadRequest(writer, "limit should be between 1 and 100", limit)
+			return
+		}
+		query.Limit = value
+	}
+
+	if offset := params.Get("offset"); len(offset) > 0 {
+		value, err := strconv.Atoi(offset)
+		if err != nil || value < 0 {
+			writeBadRequest(writer, "offset should be non negative number", offset)
+			return
+		}
+		query.Offset = value
+	}
+
+	results, err := h.db.SearchItems(query)
+	if err != nil {
+		writeInternalError(writer, "failed to search items", err)
+		return
+	}
+
+	out := &dto.SearchOut{
+		Query: text,
+		Items: make([]*dto.SearchItemOut, 0, len(results)),
+	}
+	for _, result := range results {
+		item := &dto.SearchItemOut{
+			Source:         rss.PublicSource(&result.Item),
+			Title:          result.Title,
+			Link:           result.Link,
+			Rank:           result.Rank,
+			TitleHighlight: result.TitleHighlight,
+			Snippet:        result.Snippet,
+		}
+		if result.PublishedTime != nil {
+			item.PubDate = result.PublishedTime.Format(time.RFC1123Z)
+		}
+		out.Items = append(out.Items, item)
+	}
+
+	writeJsonResponse(writer, out)
+}
+
+func parseSince(since string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		t, err := time.Parse(layout, since)
+		if err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/database"
+)
+
+func TestSearchHandler_ServeHTTP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	published := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	since := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().SearchItems(&database.SearchQuery{Text: "error", Limit: 20}).Return(nil, errors.New("error"))
+	db.EXPECT().SearchItems(&database.SearchQuery{
+		Text:     "golang",
+		Email:    "example@gmail.com",
+		Names:    []string{"feed"},
+		Since:    &since,
+		Language: "en",
+		Limit:    5,
+		Offset:   10,
+	}).Return([]*database.SearchResult{
+		{
+			Item: database.Item{
+				Source:        "http://example.com/feed",
+				Title:         "Golang news",
+				Link:          "http://example.com/1",
+				PublishedTime: &published,
+			},
+			Rank:           0.5,
+			TitleHighlight: "<mark>Golang</mark> news",
+			Snippet:        "about <mark>golang</mark>",
+		},
+	}, nil)
+	db.EXPECT().SearchItems(&database.SearchQuery{Text: "weekly", Limit: 20}).Return([]*database.SearchResult{
+		{Item: database.Item{
+			Source: "newsletter:0123456789abcdef01234567",
+			Title:  "Weekly news",
+			Data:   `{"Title":"Weekly news","Source":{"Url":"mailto:news@example.com","Title":"News"}}`,
+		}},
+		{Item: database.Item{
+			Source: "newsletter:0123456789abcdef01234567",
+			Title:  "Anonymous news",
+			Data:   `{"Title":"Anonymous news"}`,
+		}},
+	}, nil)
+
+	handler := NewSearchHandler(db)
+
+	for name, target := range map[string]string{
+		"empty query":     "/api/search?q=%20",
+		"malformed feed":  "/api/search?q=golang&feed=feed",
+		"malformed since": "/api/search?q=golang&since=yesterday",
+		"big limit":       "/api/search?q=golang&limit=1000",
+		"bad offset":      "/api/search?q=golang&offset=-1",
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", target, nil)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, 400, rr.Code)
+		})
+	}
+
+	t.Run("db error", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/search?q=error", nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 500, rr.Code)
+		assert.Contains(t, rr.Body.String(), "failed to search items")
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/search?q=golang&feed=example@gmail.com/feed&since=2021-03-01&lang=en&limit=5&offset=10", nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 200, rr.Code)
+		assert.Equal(t, "application/json; charset=utf-8", rr.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"query":"golang","items":[{"source":"http://example.com/feed","title":"Golang news",
+			"link":"http://example.com/1","pub_date":"Mon, 02 Jan 2006 15:04:05 +0000","rank":0.5,
+			"title_highlight":"<mark>Golang</mark> news","snippet":"about <mark>golang</mark>"}]}`, rr.Body.String())
+	})
+
+	t.Run("newsletter", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/search?q=weekly", nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 200, rr.Code)
+		// token is address of newsletter, so sender is shown instead
+		assert.NotContains(t, rr.Body.String(), "0123456789abcdef01234567")
+		assert.JSONEq(t, `{"query":"weekly","items":[{"source":"mailto:news@example.com","title":"Weekly news","rank":0},
+			{"source":"","title":"Anonymous news","rank":0}]}`, rr.Body.String())
+	})
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/xeipuuv/gojsonschema"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/dto"
+	"service-rss/internal/rss"
+)
+
+type sourcesDiscoverHandler struct {
+	discoverer  rss.Discoverer
+	schema      *gojsonschema.Schema
+	authHandler auth.Handler
+}
+
+func NewSourcesDiscoverHandler(discoverer rss.Discoverer, schema *gojsonschema.Schema, authHandler auth.Handler) http.Handler {
+	return &sourcesDiscoverHandler{
+		discoverer:  discoverer,
+		schema:      schema,
+		authHandler: authHandler,
+	}
+}
+
+func (h *sourcesDiscoverHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	// discovery makes outbound requests, so it is available for logged in users only
+	email, err := h.authHandler.GetEmail(writer, req)
+	if err != nil || len(email) == 0 {
+		writeBadRequest(writer, "failed to get email", errorValue(err))
+		return
+	}
+
+	in := &dto.SourcesDiscoverIn{}
+	if !readJsonInput(writer, req, h.schema, in) {
+		return
+	}
+
+	if !govalidator.IsURL(in.Url) {
+		writeBadRequest(writer, "found malformed input source urls", in.Url)
+		return
+	}
+
+	feeds, err := h.discoverer.Discover(in.Url)
+	if err != nil {
+		writeBadRequest(writer, "failed to discover feeds", err.Error())
+		return
+	}
+
+	writeJsonResponse(writer, &dto.SourcesDiscoverOut{
+		Feeds: toDiscoveredFeedsOut(feeds),
+	})
+}
+
+func toDiscoveredFeedsOut(feeds []*rss.DiscoveredFeed) []*dto.DiscoveredFeedOut {
+	out := make([]*dto.DiscoveredFeedOut, 0, len(feeds))
+	for _, feed := range feeds {
+		out = append(out, &dto.DiscoveredFeedOut{
+			Url:   feed.Url,
+			Title: feed.Title,
+			Type:  feed.Type,
+		})
+	}
+
+	return out
+}
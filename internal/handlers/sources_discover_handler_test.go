@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/xeipuuv/gojsonschema"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/rss"
+)
+
+const (
+	discoverSchema = "{\"type\":\"object\",\"required\":[\"url\"],\"additionalProperties\":false,\"properties\":{\"url\":{\"type\":\"string\",\"minLength\":1}}}"
+)
+
+func TestSourcesDiscoverHandler_ServeHTTP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	discoverer := rss.NewMockDiscoverer(ctrl)
+	discoverer.EXPECT().Discover("http://blog.example.com").Return([]*rss.DiscoveredFeed{
+		{Url: "http://blog.example.com/feed.xml", Title: "Blog", Type: rss.FeedTypeRss},
+	}, nil)
+	discoverer.EXPECT().Discover("http://down.example.com").Return(nil, &rss.HttpError{StatusCode: 503})
+
+	loader := gojsonschema.NewStringLoader(discoverSchema)
+	jsonSchema, err := gojsonschema.NewSchema(loader)
+	assert.NoError(t, err)
+
+	authHandler := auth.NewMockHandler(ctrl)
+	authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).AnyTimes().Return("example@gmail.com", nil)
+
+	defaultHandler := NewSourcesDiscoverHandler(discoverer, jsonSchema, authHandler)
+
+	t.Run("auth error", func(t *testing.T) {
+		authHandler := auth.NewMockHandler(ctrl)
+		authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).Return("", errors.New("err"))
+
+		handler := NewSourcesDiscoverHandler(discoverer, jsonSchema, authHandler)
+
+		req := httptest.NewRequest("POST", "/api/sources/discover", nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 400, rr.Code)
+		assert.Contains(t, rr.Body.String(), "failed to get email")
+	})
+
+	t.Run("malformed url", func(t *testing.T) {
+		body := strings.NewReader("{\"url\":\"wrong_url\"}")
+		req := httptest.NewRequest("POST", "/api/sources/discover", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 400, rr.Code)
+		assert.Contains(t, rr.Body.String(), "found malformed input source urls")
+	})
+
+	t.Run("discovery error", func(t *testing.T) {
+		body := strings.NewReader("{\"url\":\"http://down.example.com\"}")
+		req := httptest.NewRequest("POST", "/api/sources/discover", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 400, rr.Code)
+		assert.Contains(t, rr.Body.String(), "unexpected http status 503")
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		body := strings.NewReader("{\"url\":\"http://blog.example.com\"}")
+		req := httptest.NewRequest("POST", "/api/sources/discover", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 200, rr.Code)
+		assert.Equal(t, "application/json; charset=utf-8", rr.Header().Get("Content-Type"))
+		assert.JSONEq(t, "{\"feeds\":[{\"url\":\"http://blog.example.com/feed.xml\",\"title\":\"Blog\",\"type\":\"rss\"}]}", rr.Body.String())
+	})
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/xeipuuv/gojsonschema"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+	"service-rss/internal/ratelimit"
+	"service-rss/internal/rss"
+)
+
+type sourcesScrapeHandler struct {
+	aggregator  rss.Aggregator
+	limiter     ratelimit.Limiter
+	schema      *gojsonschema.Schema
+	authHandler auth.Handler
+}
+
+func NewSourcesScrapeHandler(aggregator rss.Aggregator, limiter ratelimit.Limiter, schema *gojsonschema.Schema, authHandler auth.Handler) http.Handler {
+	return &sourcesScrapeHandler{
+		aggregator:  aggregator,
+		limiter:     limiter,
+		schema:      schema,
+		authHandler: authHandler,
+	}
+}
+
+func (h *sourcesScrapeHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	email, err := h.authHandler.GetEmail(writer, req)
+	if err != nil || len(email) == 0 {
+		writeBadRequest(writer, "failed to get email", errorValue(err))
+		return
+	}
+
+	in := &dto.SourcesScrapeIn{}
+	if !readJsonInput(writer, req, h.schema, in) {
+		return
+	}
+
+	scraped := &rss.ScrapedSource{
+		Url:     in.Url,
+		Item:    in.Item,
+		Title:   in.Title,
+		Link:    in.Link,
+		Date:    in.Date,
+		Summary: in.Summary,
+	}
+	source := scraped.String()
+	if _, err = rss.ParseScrapedSource(source); err != nil {
+		writeBadRequest(writer, "malformed scraped source", err.Error())
+		return
+	}
+
+	// scraping fetches page, so it shares limits with preview
+	if ok, retryAfter := h.limiter.Allow(email); !ok {
+		writeTooManyRequests(writer, "too many preview requests", retryAfter)
+		return
+	}
+
+	// page is scraped by aggregator the same way as for rss with that source
+	feed, diagnostics := h.aggregator.Preview(&database.Rss{
+		Email:   email,
+		Name:    "scrape",
+		Sources: []string{source},
+	})
+	if feed == nil {
+		writeInternalError(writer, "failed to aggregate rss", fmt.Errorf("empty feed of %s", in.Url))
+		return
+	}
+
+	writeJsonResponse(writer, toSourcesScrapeOut(source, feed, diagnostics))
+}
+
+func toSourcesScrapeOut(source string, feed *dto.RssFeed, diagnostics []*rss.SourceDiagnostic) *dto.SourcesScrapeOut {
+	items := feed.Channel.Items
+	if len(items) > maxPreviewItems {
+		items = items[:maxPreviewItems]
+	}
+
+	out := &dto.SourcesScrapeOut{
+		Source: source,
+		Items:  make([]*dto.ScrapedItemOut, 0, len(items)),
+	}
+
+	for _, diagnostic := range diagnostics {
+		out.Error = diagnostic.Error
+	}
+
+	for _, item := range items {
+		out.Items = append(out.Items, &dto.ScrapedItemOut{
+			Title:   item.Title,
+			Link:    item.Link,
+			PubDate: item.PubDate,
+			Summary: item.Description,
+		})
+	}
+
+	return out
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/xeipuuv/gojsonschema"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+	"service-rss/internal/ratelimit"
+	"service-rss/internal/rss"
+)
+
+const (
+	scrapeSchema = "{\"type\":\"object\",\"required\":[\"url\",\"item\",\"title\"],\"additionalProperties\":false,\"properties\":{\"url\":{\"type\":\"string\",\"minLength\":1},\"item\":{\"type\":\"string\",\"minLength\":1},\"title\":{\"type\":\"string\",\"minLength\":1},\"link\":{\"type\":\"string\"},\"date\":{\"type\":\"string\"},\"summary\":{\"type\":\"string\"}}}"
+)
+
+func TestSourcesScrapeHandler_ServeHTTP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	source := "scrape:item=li.entry&title=h2&url=http%3A%2F%2Fstatus.example.com%2F"
+
+	aggregator := rss.NewMockAggregator(ctrl)
+	aggregator.EXPECT().Preview(&database.Rss{
+		Email:   "example@gmail.com",
+		Name:    "scrape",
+		Sources: []string{source},
+	}).Return(&dto.RssFeed{Channel: &dto.RssFeedChannel{
+		Items: []*dto.RssFeedItem{
+			{Title: "Outage resolved", Link: "http://status.example.com/1", Description: "<p>all good</p>"},
+		},
+	}}, []*rss.SourceDiagnostic{{Url: source, Items: 1}}).Times(2)
+
+	loader := gojsonschema.NewStringLoader(scrapeSchema)
+	jsonSchema, err := gojsonschema.NewSchema(loader)
+	assert.NoError(t, err)
+
+	authHandler := auth.NewMockHandler(ctrl)
+	authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).AnyTimes().Return("example@gmail.com", nil)
+
+	defaultHandler := NewSourcesScrapeHandler(aggregator, ratelimit.New(100, 100), jsonSchema, authHandler)
+
+	t.Run("auth error", func(t *testing.T) {
+		authHandler := auth.NewMockHandler(ctrl)
+		authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).Return("", errors.New("err"))
+
+		handler := NewSourcesScrapeHandler(aggregator, ratelimit.New(100, 100), jsonSchema, authHandler)
+
+		req := httptest.NewRequest("POST", "/api/sources/scrape", nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 400, rr.Code)
+		assert.Contains(t, rr.Body.String(), "failed to get email")
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		handler := NewSourcesScrapeHandler(aggregator, ratelimit.New(1, 100), jsonSchema, authHandler)
+
+		body := "{\"url\":\"http://status.example.com/\",\"item\":\"li.entry\",\"title\":\"h2\"}"
+
+		// malformed input is rejected before limit is taken
+		req := httptest.NewRequest("POST", "/api/sources/scrape", strings.NewReader("{}"))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, 400, rr.Code)
+
+		req = httptest.NewRequest("POST", "/api/sources/scrape", strings.NewReader(body))
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, 200, rr.Code)
+
+		req = httptest.NewRequest("POST", "/api/sources/scrape", strings.NewReader(body))
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 429, rr.Code)
+	})
+
+	t.Run("malformed selector", func(t *testing.T) {
+		body := strings.NewReader("{\"url\":\"http://status.example.com/\",\"item\":\"li[\",\"title\":\"h2\"}")
+		req := httptest.NewRequest("POST", "/api/sources/scrape", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 400, rr.Code)
+		assert.Contains(t, rr.Body.String(), "malformed scraped source")
+	})
+
+	t.Run("malformed url", func(t *testing.T) {
+		body := strings.NewReader("{\"url\":\"ftp://status.example.com/\",\"item\":\"li\",\"title\":\"h2\"}")
+		req := httptest.NewRequest("POST", "/api/sources/scrape", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 400, rr.Code)
+		assert.Contains(t, rr.Body.String(), "malformed scraped source")
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		body := strings.NewReader("{\"url\":\"http://status.example.com/\",\"item\":\"li.entry\",\"title\":\"h2\"}")
+		req := httptest.NewRequest("POST", "/api/sources/scrape", body)
+		rr := httptest.NewRecorder()
+		defaultHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 200, rr.Code)
+		assert.JSONEq(t, `{
+			"source": "scrape:item=li.entry&title=h2&url=http%3A%2F%2Fstatus.example.com%2F",
+			"items": [{"title": "Outage resolved", "link": "http://status.example.com/1", "summary": "<p>all good</p>"}]
+		}`, rr.Body.String())
+	})
+}
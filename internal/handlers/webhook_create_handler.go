@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/xeipuuv/gojsonschema"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+	"service-rss/internal/rss"
+)
+
+type webhookCreateHandler struct {
+	db          database.Database
+	schema      *gojsonschema.Schema
+	authHandler auth.Handler
+}
+
+func NewWebhookCreateHandler(db database.Database, schema *gojsonschema.Schema, authHandler auth.Handler) http.Handler {
+	return &webhookCreateHandler{
+		db:          db,
+		schema:      schema,
+		authHandler: authHandler,
+	}
+}
+
+func (h *webhookCreateHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	email, err := h.authHandler.GetEmail(writer, req)
+	if err != nil || len(email) == 0 {
+		writeBadRequest(writer, "failed to get email", errorValue(err))
+		return
+	}
+
+	in := &dto.WebhookCreateIn{}
+	if !readJsonInput(writer, req, h.schema, in) {
+		return
+	}
+
+	webhook, err := rss.NewWebhook(in.Url, in.Secret, in.Template)
+	if err != nil {
+		if errors.Is(err, rss.ErrInvalidWebhook) {
+			writeBadRequest(writer, err.Error(), in.Url)
+			return
+		}
+
+		writeInternalError(writer, "failed to create webhook", err)
+		return
+	}
+
+	err = h.db.CreateWebhook(email, in.Name, webhook)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeNotFound(writer, "rss feed was not found", in.Name)
+			return
+		}
+
+		writeInternalError(writer, "failed to create webhook", err)
+		return
+	}
+
+	// secret is shown once, payloads are signed by it
+	out := toWebhookOut(webhook)
+	out.Secret = webhook.Secret
+	writeJsonResponseWithStatus(writer, http.StatusCreated, out)
+}
+
+func toWebhookOut(webhook *database.Webhook) *dto.WebhookOut {
+	return &dto.WebhookOut{
+		ID:          webhook.ID,
+		Name:        webhook.Name,
+		Url:         webhook.Url,
+		Template:    webhook.Template,
+		CreatedTime: webhook.CreatedTime.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/xeipuuv/gojsonschema"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+)
+
+const (
+	webhookCreateSchema = "{\"type\":\"object\",\"required\":[\"name\",\"url\"],\"additionalProperties\":false,\"properties\":{\"name\":{\"type\":\"string\"},\"url\":{\"type\":\"string\",\"minLength\":1},\"secret\":{\"type\":\"string\"},\"template\":{\"type\":\"string\"}}}"
+)
+
+func TestWebhookCreateHandler_ServeHTTP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().CreateWebhook("example@gmail.com", "feed", gomock.Any()).DoAndReturn(func(email string, name string, webhook *database.Webhook) error {
+		assert.Equal(t, "https://one.com/hook", webhook.Url)
+		assert.Equal(t, "secret", webhook.Secret)
+		assert.Equal(t, `{"text": {{json .Item.Title}}}`, webhook.Template)
+		webhook.ID = 3
+		webhook.Name = name
+		webhook.CreatedTime = time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+		return nil
+	})
+	db.EXPECT().CreateWebhook("example@gmail.com", "missing", gomock.Any()).Return(sql.ErrNoRows)
+	db.EXPECT().CreateWebhook("example@gmail.com", "error", gomock.Any()).Return(errors.New("error"))
+
+	loader := gojsonschema.NewStringLoader(webhookCreateSchema)
+	jsonSchema, err := gojsonschema.NewSchema(loader)
+	assert.NoError(t, err)
+
+	authHandler := auth.NewMockHandler(ctrl)
+	authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).AnyTimes().Return("example@gmail.com", nil)
+
+	handler := NewWebhookCreateHandler(db, jsonSchema, authHandler)
+
+	tests := []struct {
+		name   string
+		body   string
+		code   int
+		result string
+	}{
+		{name: "ok", code: 201, body: `{"name":"feed","url":"https://one.com/hook","secret":"secret","template":"{\"text\": {{json .Item.Title}}}"}`,
+			result: `{"id":3,"name":"feed","url":"https://one.com/hook","secret":"secret","template":"{\"text\": {{json .Item.Title}}}","created_time":"2021-01-02T03:04:05Z"}`},
+		{name: "malformed input", code: 400, body: `{"name":"feed"}`, result: "url is required"},
+		{name: "invalid url", code: 400, body: `{"name":"feed","url":"one.com"}`, result: "invalid webhook: url should be absolute http url"},
+		{name: "invalid template", code: 400, body: `{"name":"feed","url":"https://one.com/hook","template":"{{.Item.Title}}"}`,
+			result: "invalid webhook: template should render json"},
+		{name: "not found", code: 404, body: `{"name":"missing","url":"https://one.com/hook"}`, result: "rss feed was not found"},
+		{name: "error", code: 500, body: `{"name":"error","url":"https://one.com/hook"}`, result: "failed to create webhook"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/webhooks/create", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.code, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.result)
+		})
+	}
+}
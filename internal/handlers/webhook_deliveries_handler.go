@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+)
+
+const (
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 500
+)
+
+type webhookDeliveriesHandler struct {
+	db          database.Database
+	authHandler auth.Handler
+}
+
+// NewWebhookDeliveriesHandler serves delivery log of webhook, state=dead lists dead letters only
+func NewWebhookDeliveriesHandler(db database.Database, authHandler auth.Handler) http.Handler {
+	return &webhookDeliveriesHandler{
+		db:          db,
+		authHandler: authHandler,
+	}
+}
+
+func (h *webhookDeliveriesHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	email, err := h.authHandler.GetEmail(writer, req)
+	if err != nil || len(email) == 0 {
+		writeBadRequest(writer, "failed to get email", errorValue(err))
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(req, "id"), 10, 64)
+	if err != nil {
+		writeNotFound(writer, "webhook was not found", chi.URLParam(req, "id"))
+		return
+	}
+
+	params := req.URL.Query()
+
+	state := params.Get("state")
+	switch state {
+	case "", database.DeliveryPending, database.DeliveryDelivered, database.DeliveryDead:
+	default:
+		writeBadRequest(writer, "state should be pending, delivered or dead", state)
+		return
+	}
+
+	limit := defaultDeliveriesLimit
+	if value := params.Get("limit"); len(value) > 0 {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxDeliveriesLimit {
+			writeBadRequest(writer, "limit should be between 1 and 500", value)
+			return
+		}
+	}
+
+	deliveries, err := h.db.GetWebhookDeliveries(email, id, state, limit)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeNotFound(writer, "webhook was not found", strconv.FormatInt(id, 10))
+			return
+		}
+
+		writeInternalError(writer, "failed to get webhook deliveries", err)
+		return
+	}
+
+	out := &dto.WebhookDeliveriesOut{
+		Deliveries: make([]*dto.WebhookDeliveryOut, 0, len(deliveries)),
+	}
+	for _, delivery := range deliveries {
+		out.Deliveries = append(out.Deliveries, &dto.WebhookDeliveryOut{
+			ID:          delivery.ID,
+			State:       delivery.State,
+			Attempts:    delivery.Attempts,
+			StatusCode:  delivery.StatusCode,
+			Error:       delivery.LastError,
+			Payload:     delivery.Payload,
+			CreatedTime: delivery.CreatedTime.Format(time.RFC3339),
+			UpdatedTime: delivery.UpdatedTime.Format(time.RFC3339),
+		})
+	}
+
+	writeJsonResponse(writer, out)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+)
+
+func TestWebhookDeliveriesHandler_ServeHTTP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	created := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().GetWebhookDeliveries("example@gmail.com", int64(1), "", 50).Return([]*database.WebhookDelivery{}, nil)
+	db.EXPECT().GetWebhookDeliveries("example@gmail.com", int64(1), "dead", 10).Return([]*database.WebhookDelivery{{
+		ID:          7,
+		WebhookID:   1,
+		Payload:     "{}",
+		State:       database.DeliveryDead,
+		Attempts:    8,
+		StatusCode:  503,
+		LastError:   "unexpected http status 503",
+		CreatedTime: created,
+		UpdatedTime: created.Add(time.Hour),
+	}}, nil)
+	db.EXPECT().GetWebhookDeliveries("example@gmail.com", int64(2), "", 50).Return(nil, sql.ErrNoRows)
+	db.EXPECT().GetWebhookDeliveries("example@gmail.com", int64(3), "", 50).Return(nil, errors.New("error"))
+
+	authHandler := auth.NewMockHandler(ctrl)
+	authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).AnyTimes().Return("example@gmail.com", nil)
+
+	handler := NewWebhookDeliveriesHandler(db, authHandler)
+
+	tests := []struct {
+		name   string
+		id     string
+		query  string
+		code   int
+		result string
+	}{
+		{name: "empty log", id: "1", code: 200, result: `{"deliveries":[]}`},
+		{name: "dead letters", id: "1", query: "state=dead&limit=10", code: 200,
+			result: `{"deliveries":[{"id":7,"state":"dead","attempts":8,"status_code":503,"error":"unexpected http status 503",` +
+				`"payload":"{}","created_time":"2021-01-02T03:04:05Z","updated_time":"2021-01-02T04:04:05Z"}]}`},
+		{name: "malformed state", id: "1", query: "state=lost", code: 400, result: "state should be pending, delivered or dead"},
+		{name: "malformed limit", id: "1", query: "limit=0", code: 400, result: "limit should be between 1 and 500"},
+		{name: "malformed id", id: "one", code: 404, result: "webhook was not found"},
+		{name: "not found", id: "2", code: 404, result: "webhook was not found"},
+		{name: "error", id: "3", code: 500, result: "failed to get webhook deliveries"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/webhooks/"+tt.id+"/deliveries?"+tt.query, nil)
+
+			routeContext := &chi.Context{
+				URLParams: chi.RouteParams{
+					Keys:   []string{"id"},
+					Values: []string{tt.id},
+				},
+			}
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeContext))
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.code, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.result)
+		})
+	}
+}
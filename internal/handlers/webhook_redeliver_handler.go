@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/xeipuuv/gojsonschema"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+)
+
+type webhookRedeliverHandler struct {
+	db          database.Database
+	schema      *gojsonschema.Schema
+	authHandler auth.Handler
+}
+
+// NewWebhookRedeliverHandler queues dead letters of webhook again, their attempts start from zero
+func NewWebhookRedeliverHandler(db database.Database, schema *gojsonschema.Schema, authHandler auth.Handler) http.Handler {
+	return &webhookRedeliverHandler{
+		db:          db,
+		schema:      schema,
+		authHandler: authHandler,
+	}
+}
+
+func (h *webhookRedeliverHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	email, err := h.authHandler.GetEmail(writer, req)
+	if err != nil || len(email) == 0 {
+		writeBadRequest(writer, "failed to get email", errorValue(err))
+		return
+	}
+
+	in := &dto.WebhookRedeliverIn{}
+	if !readJsonInput(writer, req, h.schema, in) {
+		return
+	}
+
+	count, err := h.db.RedeliverWebhookDeliveries(email, in.ID, in.Delivery)
+	if err != nil {
+		writeInternalError(writer, "failed to redeliver webhook deliveries", err)
+		return
+	}
+
+	// webhook of other owner has no dead deliveries either
+	if count == 0 && in.Delivery > 0 {
+		writeNotFound(writer, "dead delivery was not found", strconv.FormatInt(in.Delivery, 10))
+		return
+	}
+
+	writeJsonResponse(writer, &dto.WebhookRedeliverOut{Redelivered: count})
+}
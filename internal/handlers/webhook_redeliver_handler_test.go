@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/xeipuuv/gojsonschema"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+)
+
+const (
+	webhookRedeliverSchema = "{\"type\":\"object\",\"required\":[\"id\"],\"additionalProperties\":false,\"properties\":{\"id\":{\"type\":\"integer\",\"minimum\":1},\"delivery\":{\"type\":\"integer\",\"minimum\":1}}}"
+)
+
+func TestWebhookRedeliverHandler_ServeHTTP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().RedeliverWebhookDeliveries("example@gmail.com", int64(1), int64(0)).Return(3, nil)
+	db.EXPECT().RedeliverWebhookDeliveries("example@gmail.com", int64(1), int64(7)).Return(1, nil)
+	db.EXPECT().RedeliverWebhookDeliveries("example@gmail.com", int64(1), int64(8)).Return(0, nil)
+	db.EXPECT().RedeliverWebhookDeliveries("example@gmail.com", int64(2), int64(0)).Return(0, errors.New("error"))
+
+	loader := gojsonschema.NewStringLoader(webhookRedeliverSchema)
+	jsonSchema, err := gojsonschema.NewSchema(loader)
+	assert.NoError(t, err)
+
+	authHandler := auth.NewMockHandler(ctrl)
+	authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).AnyTimes().Return("example@gmail.com", nil)
+
+	handler := NewWebhookRedeliverHandler(db, jsonSchema, authHandler)
+
+	tests := []struct {
+		name   string
+		body   string
+		code   int
+		result string
+	}{
+		{name: "all dead letters", code: 200, body: `{"id":1}`, result: `{"redelivered":3}`},
+		{name: "one dead letter", code: 200, body: `{"id":1,"delivery":7}`, result: `{"redelivered":1}`},
+		{name: "not dead", code: 404, body: `{"id":1,"delivery":8}`, result: "dead delivery was not found"},
+		{name: "error", code: 500, body: `{"id":2}`, result: "failed to redeliver webhook deliveries"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/webhooks/redeliver", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.code, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.result)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+)
+
+type webhooksGetHandler struct {
+	db          database.Database
+	authHandler auth.Handler
+}
+
+// NewWebhooksGetHandler lists webhooks of all rss of owner, secrets are not listed
+func NewWebhooksGetHandler(db database.Database, authHandler auth.Handler) http.Handler {
+	return &webhooksGetHandler{
+		db:          db,
+		authHandler: authHandler,
+	}
+}
+
+func (h *webhooksGetHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	email, err := h.authHandler.GetEmail(writer, req)
+	if err != nil || len(email) == 0 {
+		writeBadRequest(writer, "failed to get email", errorValue(err))
+		return
+	}
+
+	webhooks, err := h.db.GetWebhooks(email)
+	if err != nil {
+		writeInternalError(writer, "failed to get webhooks", err)
+		return
+	}
+
+	out := &dto.WebhooksOut{
+		Webhooks: make([]*dto.WebhookOut, 0, len(webhooks)),
+	}
+	for _, webhook := range webhooks {
+		out.Webhooks = append(out.Webhooks, toWebhookOut(webhook))
+	}
+
+	writeJsonResponse(writer, out)
+}
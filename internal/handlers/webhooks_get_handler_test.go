@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/auth"
+	"service-rss/internal/database"
+)
+
+func TestWebhooksGetHandler_ServeHTTP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	authHandler := auth.NewMockHandler(ctrl)
+	authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).Return("example@gmail.com", nil)
+	authHandler.EXPECT().GetEmail(gomock.Any(), gomock.Any()).Return("error@gmail.com", nil)
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().GetWebhooks("example@gmail.com").Return([]*database.Webhook{{
+		ID:          1,
+		Name:        "feed",
+		Url:         "https://one.com/hook",
+		Secret:      "secret",
+		Template:    "{}",
+		CreatedTime: time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+	}}, nil)
+	db.EXPECT().GetWebhooks("error@gmail.com").Return(nil, errors.New("error"))
+
+	handler := NewWebhooksGetHandler(db, authHandler)
+
+	t.Run("ok", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/webhooks", nil))
+
+		assert.Equal(t, 200, rr.Code)
+		// secret is not listed
+		assert.Equal(t, `{"webhooks":[{"id":1,"name":"feed","url":"https://one.com/hook","template":"{}","created_time":"2021-01-02T03:04:05Z"}]}`,
+			rr.Body.String())
+	})
+
+	t.Run("error", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/webhooks", nil))
+
+		assert.Equal(t, 500, rr.Code)
+		assert.Contains(t, rr.Body.String(), "failed to get webhooks")
+	})
+}
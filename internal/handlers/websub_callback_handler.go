@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+
+	"service-rss/internal/rss"
+)
+
+const (
+	maxPushBodySize = 5 << 20
+)
+
+type webSubCallbackHandler struct {
+	subscriber rss.Subscriber
+}
+
+// NewWebSubCallbackHandler serves intent verifications of hubs on GET and pushed content on POST,
+// callbacks without token are left from older subscriptions and are refused like unknown ones
+func NewWebSubCallbackHandler(subscriber rss.Subscriber) http.Handler {
+	return &webSubCallbackHandler{
+		subscriber: subscriber,
+	}
+}
+
+func (h *webSubCallbackHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(req, "id"), 10, 64)
+	if err != nil {
+		writeNotFound(writer, "subscription was not found", chi.URLParam(req, "id"))
+		return
+	}
+
+	token := chi.URLParam(req, "token")
+
+	if req.Method == http.MethodGet {
+		h.verify(writer, req, id, token)
+		return
+	}
+
+	h.receive(writer, req, id, token)
+}
+
+func (h *webSubCallbackHandler) verify(writer http.ResponseWriter, req *http.Request, id int64, token string) {
+	query := req.URL.Query()
+	mode := query.Get("hub.mode")
+	challenge := query.Get("hub.challenge")
+
+	if mode != rss.WebSubModeDenied && len(challenge) == 0 {
+		writeBadRequest(writer, "challenge should be specified", mode)
+		return
+	}
+
+	leaseSeconds, _ := strconv.ParseInt(query.Get("hub.lease_seconds"), 10, 64)
+	err := h.subscriber.Verify(id, token, mode, query.Get("hub.topic"), leaseSeconds, query.Get("hub.reason"))
+	if err != nil {
+		if err == rss.ErrUnknownSubscription {
+			writeNotFound(writer, "subscription was not found", query.Get("hub.topic"))
+			return
+		}
+
+		writeInternalError(writer, "failed to verify subscription", err)
+		return
+	}
+
+	// hub confirms intent by challenge echoed in body
+	writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writer.WriteHeader(http.StatusOK)
+
+	_, err = writer.Write([]byte(challenge))
+	if err != nil {
+		log.WithError(err).Warn("failed to write response")
+	}
+}
+
+func (h *webSubCallbackHandler) receive(writer http.ResponseWriter, req *http.Request, id int64, token string) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(writer, req.Body, maxPushBodySize))
+	if err != nil {
+		writeBadRequest(writer, "failed to read request body", "")
+		return
+	}
+
+	err = h.subscriber.Receive(id, token, body, req.Header.Get("X-Hub-Signature"))
+	switch err {
+	case nil:
+	case rss.ErrInvalidSignature:
+		// content is ignored, but hub should not learn that signature is checked
+		log.WithField("id", id).Warn("websub content with invalid signature was ignored")
+	case rss.ErrUnknownSubscription:
+		// hub drops subscription on gone status
+		writeGone(writer, "subscription was not found", strconv.FormatInt(id, 10))
+		return
+	case rss.ErrMalformedContent:
+		writeBadRequest(writer, "malformed content", strconv.FormatInt(id, 10))
+		return
+	default:
+		writeInternalError(writer, "failed to receive content", err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/rss"
+)
+
+func TestWebSubCallbackHandler_ServeHTTP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	subscriber := rss.NewMockSubscriber(ctrl)
+	subscriber.EXPECT().Verify(int64(1), "token", "subscribe", "https://one.com/feed", int64(3600), "").Return(nil)
+	subscriber.EXPECT().Verify(int64(2), "token", "subscribe", "https://one.com/feed", int64(0), "").Return(rss.ErrUnknownSubscription)
+	subscriber.EXPECT().Verify(int64(1), "token", "denied", "https://one.com/feed", int64(0), "spam").Return(nil)
+	subscriber.EXPECT().Receive(int64(1), "token", []byte("feed"), "sha1=abc").Return(nil)
+	subscriber.EXPECT().Receive(int64(1), "token", []byte("forged"), "sha1=abc").Return(rss.ErrInvalidSignature)
+	subscriber.EXPECT().Receive(int64(2), "token", []byte("feed"), "sha1=abc").Return(rss.ErrUnknownSubscription)
+	subscriber.EXPECT().Receive(int64(1), "token", []byte("malformed"), "sha1=abc").Return(rss.ErrMalformedContent)
+	subscriber.EXPECT().Receive(int64(1), "token", []byte("error"), "sha1=abc").Return(errors.New("error"))
+	subscriber.EXPECT().Verify(int64(1), "", "subscribe", "https://one.com/feed", int64(0), "").Return(rss.ErrUnknownSubscription)
+	subscriber.EXPECT().Receive(int64(1), "", []byte("feed"), "sha1=abc").Return(rss.ErrUnknownSubscription)
+
+	handler := NewWebSubCallbackHandler(subscriber)
+
+	tests := []struct {
+		name   string
+		method string
+		id     string
+		token  string
+		query  string
+		body   string
+		code   int
+		result string
+	}{
+		{name: "verify", method: "GET", id: "1", code: 200, result: "challenge",
+			query: "hub.mode=subscribe&hub.topic=https://one.com/feed&hub.challenge=challenge&hub.lease_seconds=3600"},
+		{name: "verify unknown", method: "GET", id: "2", code: 404, result: "subscription was not found",
+			query: "hub.mode=subscribe&hub.topic=https://one.com/feed&hub.challenge=challenge"},
+		{name: "verify without challenge", method: "GET", id: "1", code: 400, result: "challenge should be specified",
+			query: "hub.mode=subscribe&hub.topic=https://one.com/feed"},
+		{name: "denied", method: "GET", id: "1", code: 200,
+			query: "hub.mode=denied&hub.topic=https://one.com/feed&hub.reason=spam"},
+		{name: "malformed id", method: "GET", id: "one", code: 404, result: "subscription was not found"},
+		{name: "push", method: "POST", id: "1", body: "feed", code: 202},
+		{name: "invalid signature is ignored", method: "POST", id: "1", body: "forged", code: 202},
+		{name: "push unknown", method: "POST", id: "2", body: "feed", code: 410, result: "subscription was not found"},
+		{name: "push malformed", method: "POST", id: "1", body: "malformed", code: 400, result: "malformed content"},
+		{name: "push error", method: "POST", id: "1", body: "error", code: 500, result: "failed to receive content"},
+		{name: "verify without token", method: "GET", id: "1", token: "-", code: 404, result: "subscription was not found",
+			query: "hub.mode=subscribe&hub.topic=https://one.com/feed&hub.challenge=challenge"},
+		{name: "push without token", method: "POST", id: "1", token: "-", body: "feed", code: 410, result: "subscription was not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if tt.method == "POST" {
+				body = strings.NewReader(tt.body)
+			}
+
+			// callbacks of older subscriptions have no token
+			routeContext := &chi.Context{
+				URLParams: chi.RouteParams{
+					Keys:   []string{"id"},
+					Values: []string{tt.id},
+				},
+			}
+			path := "/websub/" + tt.id
+			if tt.token != "-" {
+				routeContext.URLParams.Add("token", "token")
+				path += "/token"
+			}
+
+			req := httptest.NewRequest(tt.method, path+"?"+tt.query, body)
+			req.Header.Set("X-Hub-Signature", "sha1=abc")
+
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeContext))
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.code, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.result)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"service-rss/internal/ratelimit"
+	"service-rss/internal/rss"
+)
+
+const (
+	maxHubRequestSize = 10 << 10
+	hubBusyRetryAfter = 10 * time.Second
+)
+
+type webSubHubHandler struct {
+	hub     rss.Hub
+	limiter ratelimit.Limiter
+}
+
+// NewWebSubHubHandler serves subscribe and unsubscribe requests to our hub, intents are verified asynchronously
+func NewWebSubHubHandler(hub rss.Hub, limiter ratelimit.Limiter) http.Handler {
+	return &webSubHubHandler{
+		hub:     hub,
+		limiter: limiter,
+	}
+}
+
+func (h *webSubHubHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	req.Body = http.MaxBytesReader(writer, req.Body, maxHubRequestSize)
+	if err := req.ParseForm(); err != nil {
+		writeBadRequest(writer, "failed to parse form", "")
+		return
+	}
+
+	hubRequest := &rss.HubRequest{
+		Mode:     req.PostForm.Get("hub.mode"),
+		Topic:    req.PostForm.Get("hub.topic"),
+		Callback: req.PostForm.Get("hub.callback"),
+		Secret:   req.PostForm.Get("hub.secret"),
+	}
+
+	if leaseSeconds := req.PostForm.Get("hub.lease_seconds"); len(leaseSeconds) > 0 {
+		value, err := strconv.ParseInt(leaseSeconds, 10, 64)
+		if err != nil || value < 0 {
+			writeBadRequest(writer, "lease seconds should be positive number", leaseSeconds)
+			return
+		}
+		hubRequest.LeaseSeconds = value
+	}
+
+	// every request makes verification request to callback, so it is limited per callback host and in total
+	callback, err := url.Parse(hubRequest.Callback)
+	if err != nil {
+		writeBadRequest(writer, "invalid callback", hubRequest.Callback)
+		return
+	}
+	if ok, retryAfter := h.limiter.Allow(callback.Hostname()); !ok {
+		writeTooManyRequests(writer, "too many hub requests", retryAfter)
+		return
+	}
+
+	err = h.hub.Request(hubRequest)
+	switch {
+	case err == nil:
+	case errors.Is(err, rss.ErrInvalidHubRequest):
+		writeBadRequest(writer, err.Error(), hubRequest.Callback)
+		return
+	case err == rss.ErrUnknownTopic:
+		writeNotFound(writer, "topic was not found", hubRequest.Topic)
+		return
+	case err == rss.ErrHubBusy:
+		writeServiceUnavailable(writer, "hub is busy", hubRequest.Callback, hubBusyRetryAfter)
+		return
+	default:
+		writeInternalError(writer, "failed to process hub request", err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusAccepted)
+}
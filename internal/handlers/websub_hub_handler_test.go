@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/ratelimit"
+	"service-rss/internal/rss"
+)
+
+func TestWebSubHubHandler_ServeHTTP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	const topic = "http://localhost/example@gmail.com/test"
+
+	hub := rss.NewMockHub(ctrl)
+	hub.EXPECT().Request(&rss.HubRequest{Mode: "subscribe", Topic: topic, Callback: "https://one.com/cb", Secret: "secret", LeaseSeconds: 3600}).Return(nil)
+	hub.EXPECT().Request(&rss.HubRequest{Mode: "unsubscribe", Topic: topic, Callback: "https://one.com/cb"}).Return(nil)
+	hub.EXPECT().Request(&rss.HubRequest{Mode: "publish", Topic: topic, Callback: "https://two.com/cb"}).
+		Return(fmt.Errorf("%w: unsupported mode", rss.ErrInvalidHubRequest))
+	hub.EXPECT().Request(&rss.HubRequest{Mode: "subscribe", Topic: "http://localhost/unknown", Callback: "https://two.com/cb"}).
+		Return(rss.ErrUnknownTopic)
+	hub.EXPECT().Request(&rss.HubRequest{Mode: "subscribe", Topic: topic, Callback: "https://three.com/cb"}).Return(rss.ErrHubBusy)
+	hub.EXPECT().Request(&rss.HubRequest{Mode: "subscribe", Topic: topic, Callback: "https://four.com/cb"}).Return(errors.New("error"))
+
+	handler := NewWebSubHubHandler(hub, ratelimit.New(2, 100))
+
+	tests := []struct {
+		name   string
+		form   url.Values
+		code   int
+		result string
+	}{
+		{name: "subscribe", code: 202, form: url.Values{"hub.mode": {"subscribe"}, "hub.topic": {topic},
+			"hub.callback": {"https://one.com/cb"}, "hub.secret": {"secret"}, "hub.lease_seconds": {"3600"}}},
+		{name: "unsubscribe", code: 202, form: url.Values{"hub.mode": {"unsubscribe"}, "hub.topic": {topic},
+			"hub.callback": {"https://one.com/cb"}}},
+		{name: "rate limited callback", code: 429, result: "too many hub requests", form: url.Values{"hub.mode": {"subscribe"},
+			"hub.topic": {topic}, "hub.callback": {"https://one.com/other"}}},
+		{name: "malformed lease", code: 400, result: "lease seconds should be positive number", form: url.Values{"hub.mode": {"subscribe"},
+			"hub.topic": {topic}, "hub.callback": {"https://two.com/cb"}, "hub.lease_seconds": {"-1"}}},
+		{name: "invalid request", code: 400, result: "invalid hub request: unsupported mode", form: url.Values{"hub.mode": {"publish"},
+			"hub.topic": {topic}, "hub.callback": {"https://two.com/cb"}}},
+		{name: "unknown topic", code: 404, result: "topic was not found", form: url.Values{"hub.mode": {"subscribe"},
+			"hub.topic": {"http://localhost/unknown"}, "hub.callback": {"https://two.com/cb"}}},
+		{name: "busy", code: 503, result: "hub is busy", form: url.Values{"hub.mode": {"subscribe"},
+			"hub.topic": {topic}, "hub.callback": {"https://three.com/cb"}}},
+		{name: "error", code: 500, result: "failed to process hub request", form: url.Values{"hub.mode": {"subscribe"},
+			"hub.topic": {topic}, "hub.callback": {"https://four.com/cb"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/websub/hub", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.code, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.result)
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package netguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"service-rss/internal/config"
+)
+
+const (
+	dialTimeout = 10 * time.Second
+)
+
+var (
+	// ErrPrivateAddress means url resolves to private, loopback or link-local address
+	ErrPrivateAddress = errors.New("private addresses are not allowed")
+
+	// blocked are networks of the service itself, its neighbours and cloud metadata
+	blocked = parseNetworks(
+		"0.0.0.0/8",      // this network
+		"10.0.0.0/8",     // private
+		"100.64.0.0/10",  // carrier-grade nat
+		"127.0.0.0/8",    // loopback
+		"169.254.0.0/16", // link-local and metadata
+		"172.16.0.0/12",  // private
+		"192.0.0.0/24",   // protocol assignments
+		"192.168.0.0/16", // private
+		"198.18.0.0/15",  // benchmarking
+		"224.0.0.0/4",    // multicast
+		"240.0.0.0/4",    // reserved and broadcast
+		"::/128",         // unspecified
+		"::1/128",        // loopback
+		"64:ff9b::/96",   // nat64 embeds ipv4 addresses
+		"fc00::/7",       // unique local
+		"fe80::/10",      // link-local
+		"ff00::/8",       // multicast
+	)
+)
+
+// Guard refuses outbound connections to private addresses, since urls of sources, hubs, callbacks and webhooks
+// are given by users. They are allowed for deployments inside private networks and for tests
+type Guard struct {
+	allowPrivate bool
+	dialer       *net.Dialer
+}
+
+func New(cfg *config.Config) *Guard {
+	g := &Guard{allowPrivate: cfg.AllowPrivateNetworks}
+
+	// address is checked after resolving, so host can't be resolved to other address on connect
+	g.dialer = &net.Dialer{
+		Timeout: dialTimeout,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			return g.checkAddress(address)
+		},
+	}
+
+	return g
+}
+
+// Client makes http client with given timeout, redirects are checked by the same dialer
+func (g *Guard) Client(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// proxy would hide destination address from dialer
+			Proxy:                 nil,
+			DialContext:           g.dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
+}
+
+// CheckUrl resolves host of url, so private urls are refused before anything is sent to them
+func (g *Guard) CheckUrl(ctx context.Context, rawUrl string) error {
+	if g.allowPrivate {
+		return nil
+	}
+
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return err
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return err
+	}
+
+	for _, addr := range addrs {
+		if IsPrivate(addr.IP) {
+			return fmt.Errorf("%w: %s", ErrPrivateAddress, u.Hostname())
+		}
+	}
+
+	return nil
+}
+
+func (g *Guard) checkAddress(address string) error {
+	if g.allowPrivate {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || IsPrivate(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+
+	return nil
+}
+
+// IsPrivate tells that ip isn't public, ipv4 addresses mapped to ipv6 are checked as ipv4
+func IsPrivate(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	for _, network := range blocked {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks
+}
@@ -0,0 +1,58 @@
+package netguard
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/config"
+)
+
+func TestIsPrivate(t *testing.T) {
+	for _, ip := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1",
+		"0.0.0.0", "::1", "fe80::1", "fd00:ec2::254", "::ffff:127.0.0.1"} {
+		assert.True(t, IsPrivate(net.ParseIP(ip)), ip)
+	}
+
+	for _, ip := range []string{"8.8.8.8", "1.1.1.1", "172.32.0.1", "2001:4860:4860::8888"} {
+		assert.False(t, IsPrivate(net.ParseIP(ip)), ip)
+	}
+}
+
+func TestGuard_Client(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	t.Run("private address is refused", func(t *testing.T) {
+		_, err := New(&config.Config{}).Client(time.Second).Get(server.URL)
+		assert.True(t, errors.Is(err, ErrPrivateAddress))
+	})
+
+	t.Run("private networks are allowed", func(t *testing.T) {
+		resp, err := New(&config.Config{AllowPrivateNetworks: true}).Client(time.Second).Get(server.URL)
+		if assert.NoError(t, err) {
+			resp.Body.Close()
+			assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		}
+	})
+}
+
+func TestGuard_CheckUrl(t *testing.T) {
+	guard := New(&config.Config{})
+
+	for _, rawUrl := range []string{"http://127.0.0.1:8080/", "http://[::1]/", "http://169.254.169.254/latest/meta-data/", "http://localhost/"} {
+		err := guard.CheckUrl(context.Background(), rawUrl)
+		assert.True(t, errors.Is(err, ErrPrivateAddress), rawUrl)
+	}
+
+	assert.NoError(t, guard.CheckUrl(context.Background(), "http://8.8.8.8/"))
+	assert.NoError(t, New(&config.Config{AllowPrivateNetworks: true}).CheckUrl(context.Background(), "http://127.0.0.1/"))
+}
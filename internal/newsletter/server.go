@@ -0,0 +1,321 @@
+package newsletter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"service-rss/internal/config"
+	"service-rss/internal/database"
+	"service-rss/internal/rss"
+	"service-rss/internal/safe"
+)
+
+const (
+	// newsletter is usually sent to one address, more recipients are deferred by smtp
+	maxRecipients = 10
+	// rfc 5321 limits command lines to 512 octets with crlf, so longer lines are not read into memory
+	maxCommandLength = 512
+)
+
+// Server is inbound smtp listener, it accepts emails to addresses of newsletters only, so it is not open relay
+type Server struct {
+	listener    net.Listener
+	newsletters rss.Newsletters
+	domain      string
+	maxBytes    int64
+	timeout     time.Duration
+
+	// slots limits concurrent connections
+	slots      chan struct{}
+	conns      map[net.Conn]struct{}
+	connsMutex sync.Mutex
+	connsWait  sync.WaitGroup
+
+	// graceful shutdown helper-channels
+	shutdownChan     chan interface{}
+	shutdownWaitChan chan interface{}
+}
+
+// NewServer listens at smtp port, so port conflicts are reported on start of service
+func NewServer(cfg *config.Config, newsletters rss.Newsletters) (*Server, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.NewsletterSmtpPort))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		listener:    listener,
+		newsletters: newsletters,
+		domain:      cfg.NewsletterDomain,
+		maxBytes:    cfg.NewsletterMaxBytes,
+		timeout:     cfg.NewsletterTimeout,
+		slots:       make(chan struct{}, cfg.NewsletterMaxConns),
+		conns:       make(map[net.Conn]struct{}),
+
+		shutdownChan:     make(chan interface{}),
+		shutdownWaitChan: make(chan interface{}),
+	}, nil
+}
+
+func (s *Server) Start() {
+	defer close(s.shutdownWaitChan)
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.shutdownChan:
+				return
+			default:
+			}
+
+			log.WithError(err).Error("failed to accept smtp connection")
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		select {
+		case s.slots <- struct{}{}:
+		default:
+			// connections over limit are refused, senders retry them later
+			conn.SetDeadline(time.Now().Add(s.timeout))
+			fmt.Fprintf(conn, "421 %s too many connections, try again later\r\n", s.domain)
+			conn.Close()
+			continue
+		}
+
+		s.connsMutex.Lock()
+		s.conns[conn] = struct{}{}
+		s.connsMutex.Unlock()
+
+		s.connsWait.Add(1)
+		go safe.Do(func() {
+			defer s.connsWait.Done()
+			defer func() { <-s.slots }()
+			s.serve(conn)
+		})
+	}
+}
+
+// Shutdown closes open connections, senders retry emails which were not accepted yet
+func (s *Server) Shutdown() {
+	close(s.shutdownChan)
+	s.listener.Close()
+	<-s.shutdownWaitChan
+
+	s.connsMutex.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.connsMutex.Unlock()
+
+	s.connsWait.Wait()
+}
+
+// session is state of smtp transaction
+type session struct {
+	reader     *bufio.Reader
+	text       *textproto.Writer
+	from       bool
+	recipients []*database.Newsletter
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer func() {
+		s.connsMutex.Lock()
+		delete(s.conns, conn)
+		s.connsMutex.Unlock()
+		conn.Close()
+	}()
+
+	sess := &session{
+		reader: bufio.NewReaderSize(conn, maxCommandLength),
+		text:   textproto.NewWriter(bufio.NewWriter(conn)),
+	}
+	sess.reply(220, s.domain+" ESMTP")
+
+	for {
+		conn.SetDeadline(time.Now().Add(s.timeout))
+
+		line, err := sess.readCommand()
+		if err == bufio.ErrBufferFull {
+			// rest of line can't be skipped reliably, so connection is closed
+			sess.reply(500, "line too long")
+			return
+		}
+		if err != nil {
+			return
+		}
+
+		verb, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			verb, arg = line[:i], strings.TrimSpace(line[i+1:])
+		}
+
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			sess.text.PrintfLine("250-%s", s.domain)
+			sess.text.PrintfLine("250-SIZE %d", s.maxBytes)
+			sess.reply(250, "8BITMIME")
+		case "HELO":
+			sess.reply(250, s.domain)
+		case "MAIL":
+			s.mail(sess, arg)
+		case "RCPT":
+			s.rcpt(sess, arg)
+		case "DATA":
+			if !s.data(sess) {
+				return
+			}
+		case "RSET":
+			sess.reset()
+			sess.reply(250, "OK")
+		case "NOOP":
+			sess.reply(250, "OK")
+		case "VRFY":
+			sess.reply(252, "cannot verify user")
+		case "QUIT":
+			sess.reply(221, "bye")
+			return
+		default:
+			sess.reply(502, "command not recognized")
+		}
+	}
+}
+
+func (s *Server) mail(sess *session, arg string) {
+	if !strings.HasPrefix(strings.ToUpper(arg), "FROM:") {
+		sess.reply(501, "syntax: MAIL FROM:<address>")
+		return
+	}
+
+	for _, param := range strings.Fields(arg[len("FROM:"):]) {
+		if !strings.HasPrefix(strings.ToUpper(param), "SIZE=") {
+			continue
+		}
+		if size, err := strconv.ParseInt(param[len("SIZE="):], 10, 64); err == nil && size > s.maxBytes {
+			sess.reply(552, "message size exceeds limit")
+			return
+		}
+	}
+
+	sess.reset()
+	sess.from = true
+	sess.reply(250, "OK")
+}
+
+func (s *Server) rcpt(sess *session, arg string) {
+	if !sess.from {
+		sess.reply(503, "need MAIL command")
+		return
+	}
+
+	if !strings.HasPrefix(strings.ToUpper(arg), "TO:") {
+		sess.reply(501, "syntax: RCPT TO:<address>")
+		return
+	}
+
+	if len(sess.recipients) >= maxRecipients {
+		sess.reply(452, "too many recipients")
+		return
+	}
+
+	address := strings.TrimSpace(arg[len("TO:"):])
+	if i := strings.IndexByte(address, '>'); i >= 0 {
+		address = address[:i]
+	}
+	address = strings.TrimPrefix(address, "<")
+
+	newsletter, err := s.newsletters.Recipient(address)
+	if err != nil {
+		if errors.Is(err, rss.ErrUnknownNewsletter) {
+			sess.reply(550, "no such newsletter")
+			return
+		}
+
+		log.WithError(err).WithField("address", address).Error("failed to find newsletter")
+		sess.reply(451, "try again later")
+		return
+	}
+
+	sess.recipients = append(sess.recipients, newsletter)
+	sess.reply(250, "OK")
+}
+
+// data reads message and ingests it for every recipient, it returns false if connection is broken
+func (s *Server) data(sess *session) bool {
+	if len(sess.recipients) == 0 {
+		sess.reply(503, "need RCPT command")
+		return true
+	}
+
+	sess.reply(354, "end data with <CR><LF>.<CR><LF>")
+
+	reader := textproto.NewReader(sess.reader).DotReader()
+	message, err := ioutil.ReadAll(io.LimitReader(reader, s.maxBytes+1))
+	if err != nil {
+		return false
+	}
+
+	recipients := sess.recipients
+	sess.reset()
+
+	if int64(len(message)) > s.maxBytes {
+		// rest of message is read, so the next command is parsed
+		if _, err = io.Copy(ioutil.Discard, reader); err != nil {
+			return false
+		}
+		sess.reply(552, "message size exceeds limit")
+		return true
+	}
+
+	// items are unique by message id, so retried email is not duplicated for recipients which ingested it
+	for _, newsletter := range recipients {
+		err = s.newsletters.Ingest(newsletter, message)
+		if err == nil {
+			continue
+		}
+
+		if errors.Is(err, rss.ErrMalformedNewsletter) {
+			sess.reply(554, err.Error())
+			return true
+		}
+
+		log.WithError(err).WithField("id", newsletter.ID).Error("failed to ingest newsletter")
+		sess.reply(451, "try again later")
+		return true
+	}
+
+	sess.reply(250, "OK")
+	return true
+}
+
+// readCommand reads line of command without crlf, it returns bufio.ErrBufferFull for lines over max command length
+func (sess *session) readCommand() (string, error) {
+	line, err := sess.reader.ReadSlice('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+func (sess *session) reset() {
+	sess.from = false
+	sess.recipients = nil
+}
+
+func (sess *session) reply(code int, message string) {
+	sess.text.PrintfLine("%d %s", code, message)
+}
@@ -0,0 +1,151 @@
+package newsletter
+
+import (
+	"errors"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/config"
+	"service-rss/internal/database"
+	"service-rss/internal/rss"
+)
+
+const testEmail = "From: news@example.com\r\nSubject: Issue 1\r\n\r\nHello reader\r\n"
+
+func newTestServer(t *testing.T, newsletters rss.Newsletters, maxConns int) *Server {
+	s, err := NewServer(&config.Config{
+		NewsletterDomain:   "in.example.com",
+		NewsletterSmtpPort: 0,
+		NewsletterMaxBytes: 1024,
+		NewsletterTimeout:  time.Second,
+		NewsletterMaxConns: maxConns,
+	}, newsletters)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Start()
+	return s
+}
+
+func smtpCode(err error) int {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code
+	}
+	return 0
+}
+
+func TestServer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	newsletter := &database.Newsletter{ID: 1, Token: "token", Source: "newsletter:token"}
+
+	newsletters := rss.NewMockNewsletters(ctrl)
+	newsletters.EXPECT().Recipient("token@in.example.com").AnyTimes().Return(newsletter, nil)
+	newsletters.EXPECT().Recipient("unknown@in.example.com").Return(nil, rss.ErrUnknownNewsletter)
+	newsletters.EXPECT().Recipient("broken@in.example.com").Return(nil, errors.New("error"))
+
+	s := newTestServer(t, newsletters, 10)
+	defer s.Shutdown()
+
+	addr := s.listener.Addr().String()
+
+	t.Run("accepted", func(t *testing.T) {
+		newsletters.EXPECT().Ingest(newsletter, gomock.Any()).Do(func(_ *database.Newsletter, message []byte) {
+			// dot reader turns crlf into lf
+			assert.Equal(t, strings.ReplaceAll(testEmail, "\r\n", "\n"), string(message))
+		}).Return(nil)
+
+		err := smtp.SendMail(addr, nil, "news@example.com", []string{"token@in.example.com"}, []byte(testEmail))
+		assert.NoError(t, err)
+	})
+
+	t.Run("unknown recipient", func(t *testing.T) {
+		err := smtp.SendMail(addr, nil, "news@example.com", []string{"unknown@in.example.com"}, []byte(testEmail))
+		assert.Equal(t, 550, smtpCode(err))
+	})
+
+	t.Run("recipient lookup error", func(t *testing.T) {
+		err := smtp.SendMail(addr, nil, "news@example.com", []string{"broken@in.example.com"}, []byte(testEmail))
+		assert.Equal(t, 451, smtpCode(err))
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		newsletters.EXPECT().Ingest(newsletter, gomock.Any()).Return(rss.ErrMalformedNewsletter)
+
+		err := smtp.SendMail(addr, nil, "news@example.com", []string{"token@in.example.com"}, []byte(testEmail))
+		assert.Equal(t, 554, smtpCode(err))
+	})
+
+	t.Run("too big", func(t *testing.T) {
+		big := testEmail + strings.Repeat("x", 2048) + "\r\n"
+
+		err := smtp.SendMail(addr, nil, "news@example.com", []string{"token@in.example.com"}, []byte(big))
+		assert.Equal(t, 552, smtpCode(err))
+	})
+
+	t.Run("long command", func(t *testing.T) {
+		conn, err := textproto.Dial("tcp", addr)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+
+		_, _, err = conn.ReadResponse(220)
+		assert.NoError(t, err)
+
+		err = conn.PrintfLine("HELO %s", strings.Repeat("x", 1024))
+		assert.NoError(t, err)
+		_, _, err = conn.ReadResponse(250)
+		assert.Equal(t, 500, smtpCode(err))
+
+		// connection is closed after long line
+		_, err = conn.ReadLine()
+		assert.Error(t, err)
+	})
+}
+
+func TestServer_MaxConns(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s := newTestServer(t, rss.NewMockNewsletters(ctrl), 1)
+	defer s.Shutdown()
+
+	addr := s.listener.Addr().String()
+
+	busy, err := textproto.Dial("tcp", addr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer busy.Close()
+
+	// greeting means that connection holds the slot
+	_, _, err = busy.ReadResponse(220)
+	assert.NoError(t, err)
+
+	_, err = smtp.Dial(addr)
+	assert.Equal(t, 421, smtpCode(err))
+
+	// slot is released on quit
+	assert.NoError(t, busy.PrintfLine("QUIT"))
+	_, _, err = busy.ReadResponse(221)
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		client, err := smtp.Dial(addr)
+		if err != nil {
+			return false
+		}
+		client.Quit()
+		return true
+	}, time.Second, 10*time.Millisecond)
+}
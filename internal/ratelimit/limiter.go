@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// limiters of keys not seen for this time are dropped, their buckets are full anyway
+	idleTimeout = 10 * time.Minute
+)
+
+// Limiter limits rate of events per key and in total
+type Limiter interface {
+	// Allow reports whether event of key may happen now, otherwise it returns delay to retry after
+	Allow(key string) (bool, time.Duration)
+}
+
+type keyLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+type limiter struct {
+	perKeyLimit rate.Limit
+	perKeyBurst int
+	total       *rate.Limiter
+
+	mutex     sync.Mutex
+	keys      map[string]*keyLimiter
+	lastPurge time.Time
+}
+
+// New creates limiter with per key and total limits in events per minute
+func New(perKeyPerMinute int, totalPerMinute int) Limiter {
+	return &limiter{
+		perKeyLimit: perMinute(perKeyPerMinute),
+		perKeyBurst: perKeyPerMinute,
+		total:       rate.NewLimiter(perMinute(totalPerMinute), totalPerMinute),
+		keys:        make(map[string]*keyLimiter),
+		lastPurge:   time.Now(),
+	}
+}
+
+func (l *limiter) Allow(key string) (bool, time.Duration) {
+	now := time.Now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.purge(now)
+
+	kl, ok := l.keys[key]
+	if !ok {
+		kl = &keyLimiter{limiter: rate.NewLimiter(l.perKeyLimit, l.perKeyBurst)}
+		l.keys[key] = kl
+	}
+	kl.lastSeen = now
+
+	keyReservation := kl.limiter.ReserveN(now, 1)
+	if delay := keyReservation.DelayFrom(now); !keyReservation.OK() || delay > 0 {
+		keyReservation.CancelAt(now)
+		return false, delay
+	}
+
+	totalReservation := l.total.ReserveN(now, 1)
+	if delay := totalReservation.DelayFrom(now); !totalReservation.OK() || delay > 0 {
+		totalReservation.CancelAt(now)
+		// key should not pay for event which has not happened
+		keyReservation.CancelAt(now)
+		return false, delay
+	}
+
+	return true, 0
+}
+
+func (l *limiter) purge(now time.Time) {
+	if now.Sub(l.lastPurge) < idleTimeout {
+		return
+	}
+	l.lastPurge = now
+
+	for key, kl := range l.keys {
+		if now.Sub(kl.lastSeen) > idleTimeout {
+			delete(l.keys, key)
+		}
+	}
+}
+
+func perMinute(events int) rate.Limit {
+	return rate.Limit(float64(events) / time.Minute.Seconds())
+}
@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	t.Run("per key", func(t *testing.T) {
+		l := New(2, 100)
+
+		for i := 0; i < 2; i++ {
+			ok, _ := l.Allow("first")
+			assert.True(t, ok)
+		}
+
+		ok, delay := l.Allow("first")
+		assert.False(t, ok)
+		assert.True(t, delay > 0 && delay <= 30*time.Second)
+
+		ok, _ = l.Allow("second")
+		assert.True(t, ok)
+	})
+
+	t.Run("total", func(t *testing.T) {
+		l := New(2, 3)
+
+		for _, key := range []string{"first", "first", "second"} {
+			ok, _ := l.Allow(key)
+			assert.True(t, ok)
+		}
+
+		ok, _ := l.Allow("third")
+		assert.False(t, ok)
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		l := New(1, 100).(*limiter)
+
+		ok, _ := l.Allow("first")
+		assert.True(t, ok)
+		assert.Len(t, l.keys, 1)
+
+		l.keys["first"].lastSeen = time.Now().Add(-2 * idleTimeout)
+		l.lastPurge = time.Now().Add(-2 * idleTimeout)
+
+		ok, _ = l.Allow("second")
+		assert.True(t, ok)
+		assert.Len(t, l.keys, 1)
+		assert.Contains(t, l.keys, "second")
+	})
+}
@@ -0,0 +1,90 @@
+//go:generate mockgen -package ${GOPACKAGE} -destination mock_recorder.go -source recorder.go
+package reads
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"service-rss/internal/config"
+	"service-rss/internal/database"
+	"service-rss/internal/safe"
+)
+
+// Recorder counts reads of rss in memory, so feeds are served without writes to db
+type Recorder interface {
+	Record(id int64)
+	Start()
+	Shutdown()
+}
+
+type recorder struct {
+	db     database.Database
+	period time.Duration
+
+	mutex sync.Mutex
+	reads map[int64]int64
+
+	// graceful shutdown helper-channels
+	shutdownChan     chan interface{}
+	shutdownWaitChan chan interface{}
+}
+
+// NewRecorder makes recorder which saves reads every flush period and on shutdown
+func NewRecorder(cfg *config.Config, db database.Database) Recorder {
+	return &recorder{
+		db:     db,
+		period: cfg.ReadsFlushPeriod,
+		reads:  make(map[int64]int64),
+
+		shutdownChan:     make(chan interface{}),
+		shutdownWaitChan: make(chan interface{}),
+	}
+}
+
+func (r *recorder) Record(id int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.reads[id]++
+}
+
+func (r *recorder) Start() {
+	defer close(r.shutdownWaitChan)
+
+	ticker := time.NewTicker(r.period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.shutdownChan:
+			r.flush()
+			return
+		case <-ticker.C:
+			safe.Do(r.flush)
+		}
+	}
+}
+
+func (r *recorder) Shutdown() {
+	close(r.shutdownChan)
+	<-r.shutdownWaitChan
+}
+
+// flush drops reads on failure, they only raise priority of caching
+func (r *recorder) flush() {
+	r.mutex.Lock()
+	reads := r.reads
+	r.reads = make(map[int64]int64)
+	r.mutex.Unlock()
+
+	if len(reads) == 0 {
+		return
+	}
+
+	err := r.db.RecordReads(reads)
+	if err != nil {
+		log.WithError(err).WithField("count", len(reads)).Error("failed to record reads of rss")
+	}
+}
@@ -0,0 +1,59 @@
+package reads
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/config"
+	"service-rss/internal/database"
+)
+
+func TestRecorder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	t.Run("reads are counted and flushed on shutdown", func(t *testing.T) {
+		db := database.NewMockDatabase(ctrl)
+		db.EXPECT().RecordReads(map[int64]int64{1: 2, 2: 1}).Return(nil)
+
+		r := NewRecorder(&config.Config{ReadsFlushPeriod: time.Hour}, db)
+		go r.Start()
+
+		r.Record(1)
+		r.Record(2)
+		r.Record(1)
+
+		r.Shutdown()
+	})
+
+	t.Run("reads are flushed periodically", func(t *testing.T) {
+		flushed := make(chan interface{})
+
+		db := database.NewMockDatabase(ctrl)
+		db.EXPECT().RecordReads(map[int64]int64{1: 1}).DoAndReturn(func(reads map[int64]int64) error {
+			close(flushed)
+			return errors.New("error")
+		})
+
+		r := NewRecorder(&config.Config{ReadsFlushPeriod: 10 * time.Millisecond}, db)
+		r.Record(1)
+		go r.Start()
+		defer r.Shutdown()
+
+		select {
+		case <-time.After(time.Second):
+			t.Fatal("reads were not flushed in time")
+		case <-flushed:
+		}
+
+		// failed reads are dropped
+		rec := r.(*recorder)
+		rec.mutex.Lock()
+		assert.Empty(t, rec.reads)
+		rec.mutex.Unlock()
+	})
+}
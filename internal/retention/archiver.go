@@ -0,0 +1,89 @@
+//go:generate mockgen -package ${GOPACKAGE} -destination mock_archiver.go -source archiver.go
+package retention
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"service-rss/internal/database"
+)
+
+type Archiver interface {
+	// Archive returns after items are written to disk, so they can be deleted safely
+	Archive(items []*database.Item) error
+}
+
+type archivedItem struct {
+	Source        string          `json:"source"`
+	Hash          string          `json:"hash"`
+	Guid          string          `json:"guid,omitempty"`
+	Link          string          `json:"link,omitempty"`
+	Title         string          `json:"title,omitempty"`
+	PublishedTime *time.Time      `json:"published_time,omitempty"`
+	FirstSeenTime time.Time       `json:"first_seen_time"`
+	UpdatedTime   time.Time       `json:"updated_time"`
+	PrunedTime    time.Time       `json:"pruned_time"`
+	Item          json.RawMessage `json:"item"`
+}
+
+type fileArchiver struct {
+	dir   string
+	mutex sync.Mutex
+}
+
+// NewFileArchiver writes items to daily gzipped jsonl files, every batch is appended as separate gzip member
+func NewFileArchiver(dir string) Archiver {
+	return &fileArchiver{
+		dir: dir,
+	}
+}
+
+func (a *fileArchiver) Archive(items []*database.Item) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := time.Now().UTC()
+
+	err := os.MkdirAll(a.dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(a.dir, fmt.Sprintf("items-%s.jsonl.gz", now.Format("2006-01-02")))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := gzip.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, item := range items {
+		err = encoder.Encode(&archivedItem{
+			Source:        item.Source,
+			Hash:          item.Hash,
+			Guid:          item.Guid,
+			Link:          item.Link,
+			Title:         item.Title,
+			PublishedTime: item.PublishedTime,
+			FirstSeenTime: item.FirstSeenTime,
+			UpdatedTime:   item.UpdatedTime,
+			PrunedTime:    now,
+			Item:          json.RawMessage(item.Data),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
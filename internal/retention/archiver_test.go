@@ -0,0 +1,63 @@
+package retention
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/database"
+)
+
+func TestFileArchiver_Archive(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "archive")
+	archiver := NewFileArchiver(dir)
+
+	published := time.Date(2021, time.March, 10, 0, 0, 0, 0, time.UTC)
+
+	// every batch is appended as gzip member of the same daily file
+	err := archiver.Archive([]*database.Item{
+		{Source: "first", Hash: "1", Title: "one", PublishedTime: &published, Data: `{"Title":"one"}`},
+		{Source: "first", Hash: "2", Title: "two", Data: `{"Title":"two"}`},
+	})
+	assert.NoError(t, err)
+
+	err = archiver.Archive([]*database.Item{
+		{Source: "second", Hash: "3", Title: "three", Data: `{"Title":"three"}`},
+	})
+	assert.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "items-*.jsonl.gz"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	file, err := os.Open(files[0])
+	assert.NoError(t, err)
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	assert.NoError(t, err)
+
+	archived := make([]*archivedItem, 0)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		item := &archivedItem{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), item))
+		archived = append(archived, item)
+	}
+	assert.NoError(t, scanner.Err())
+
+	assert.Len(t, archived, 3)
+	assert.Equal(t, "first", archived[0].Source)
+	assert.Equal(t, "one", archived[0].Title)
+	assert.True(t, published.Equal(*archived[0].PublishedTime))
+	assert.JSONEq(t, `{"Title":"one"}`, string(archived[0].Item))
+	assert.Nil(t, archived[1].PublishedTime)
+	assert.Equal(t, "three", archived[2].Title)
+	assert.False(t, archived[2].PrunedTime.IsZero())
+}
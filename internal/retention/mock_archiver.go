@@ -0,0 +1,49 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: archiver.go
+
+// Package retention is a generated GoMock package.
+package retention
+
+import (
+	reflect "reflect"
+	database "service-rss/internal/database"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockArchiver is a mock of Archiver interface.
+type MockArchiver struct {
+	ctrl     *gomock.Controller
+	recorder *MockArchiverMockRecorder
+}
+
+// MockArchiverMockRecorder is the mock recorder for MockArchiver.
+type MockArchiverMockRecorder struct {
+	mock *MockArchiver
+}
+
+// NewMockArchiver creates a new mock instance.
+func NewMockArchiver(ctrl *gomock.Controller) *MockArchiver {
+	mock := &MockArchiver{ctrl: ctrl}
+	mock.recorder = &MockArchiverMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockArchiver) EXPECT() *MockArchiverMockRecorder {
+	return m.recorder
+}
+
+// Archive mocks base method.
+func (m *MockArchiver) Archive(items []*database.Item) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Archive", items)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Archive indicates an expected call of Archive.
+func (mr *MockArchiverMockRecorder) Archive(items interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Archive", reflect.TypeOf((*MockArchiver)(nil).Archive), items)
+}
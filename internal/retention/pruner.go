@@ -0,0 +1,192 @@
+package retention
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"service-rss/internal/config"
+	"service-rss/internal/database"
+	"service-rss/internal/safe"
+)
+
+var (
+	// keepSince for policies without age limit, items are never published after it
+	maxTime = time.Date(9999, time.January, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// policy keeps items which are among keepItems newest or published after keepSince
+type policy struct {
+	keepItems int
+	keepSince time.Time
+}
+
+// limits are zero when unlimited
+type limits struct {
+	maxItems int
+	maxDays  int
+}
+
+type Pruner struct {
+	db        database.Database
+	archiver  Archiver
+	global    limits
+	period    time.Duration
+	batchSize int
+
+	// graceful shutdown helper-channels
+	shutdownChan     chan interface{}
+	shutdownWaitChan chan interface{}
+}
+
+func NewPruner(cfg *config.Config, db database.Database) *Pruner {
+	var archiver Archiver
+	if len(cfg.RetentionArchiveDir) > 0 {
+		archiver = NewFileArchiver(cfg.RetentionArchiveDir)
+	}
+
+	return &Pruner{
+		db:       db,
+		archiver: archiver,
+		global: limits{
+			maxItems: cfg.RetentionMaxItems,
+			maxDays:  cfg.RetentionMaxDays,
+		},
+		period:    cfg.RetentionPeriod,
+		batchSize: cfg.RetentionBatchSize,
+
+		shutdownChan:     make(chan interface{}),
+		shutdownWaitChan: make(chan interface{}),
+	}
+}
+
+func (p *Pruner) Start() {
+	defer close(p.shutdownWaitChan)
+
+	ticker := time.NewTicker(p.period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.shutdownChan:
+			return
+		case <-ticker.C:
+			safe.Do(p.prune)
+		}
+	}
+}
+
+func (p *Pruner) Shutdown() {
+	close(p.shutdownChan)
+	<-p.shutdownWaitChan
+}
+
+func (p *Pruner) prune() {
+	rssSlice, err := p.db.GetRssForIndex()
+	if err != nil {
+		log.WithError(err).Error("failed to get rss for pruning")
+		return
+	}
+
+	sources, err := p.db.GetItemSources()
+	if err != nil {
+		log.WithError(err).Error("failed to get item sources for pruning")
+		return
+	}
+
+	var archive func([]*database.Item) error
+	if p.archiver != nil {
+		archive = p.archiver.Archive
+	}
+
+	total := 0
+	for source, pol := range p.policies(rssSlice, sources, time.Now()) {
+		// batches are deleted in separate transactions to avoid long locks
+		for {
+			select {
+			case <-p.shutdownChan:
+				return
+			default:
+			}
+
+			count, err := p.db.PruneItems(source, pol.keepItems, pol.keepSince, p.batchSize, archive)
+			if err != nil {
+				log.WithError(err).WithField("source", source).Error("failed to prune items")
+				break
+			}
+
+			total += count
+			if count < p.batchSize {
+				break
+			}
+		}
+	}
+
+	log.WithField("count", total).Info("items were pruned")
+
+	forgotten, err := p.db.ForgetPrunedItems()
+	if err != nil {
+		log.WithError(err).Error("failed to forget pruned items")
+		return
+	}
+	log.WithField("count", forgotten).Info("pruned items of removed sources were forgotten")
+}
+
+// policies returns the most generous policy of rss with the source, items of sources without rss are pruned entirely
+func (p *Pruner) policies(rssSlice []*database.Rss, sources []string, now time.Time) map[string]*policy {
+	sourceLimits := make(map[string]*limits)
+	for _, rss := range rssSlice {
+		rssLimits := p.global
+		if rss.Retention != nil && rss.Retention.MaxItems > 0 {
+			rssLimits.maxItems = rss.Retention.MaxItems
+		}
+		if rss.Retention != nil && rss.Retention.MaxDays > 0 {
+			rssLimits.maxDays = rss.Retention.MaxDays
+		}
+
+		for _, source := range rss.Sources {
+			l, ok := sourceLimits[source]
+			if !ok {
+				l = &limits{maxItems: rssLimits.maxItems, maxDays: rssLimits.maxDays}
+				sourceLimits[source] = l
+				continue
+			}
+
+			l.maxItems = mostGenerous(l.maxItems, rssLimits.maxItems)
+			l.maxDays = mostGenerous(l.maxDays, rssLimits.maxDays)
+		}
+	}
+
+	policies := make(map[string]*policy)
+	for _, source := range sources {
+		l, ok := sourceLimits[source]
+		if !ok {
+			policies[source] = &policy{keepItems: 0, keepSince: maxTime}
+			continue
+		}
+
+		if l.maxItems == 0 && l.maxDays == 0 {
+			continue
+		}
+
+		pol := &policy{keepItems: l.maxItems, keepSince: maxTime}
+		if l.maxDays > 0 {
+			pol.keepSince = now.AddDate(0, 0, -l.maxDays)
+		}
+		policies[source] = pol
+	}
+
+	return policies
+}
+
+func mostGenerous(a int, b int) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+
+	if a > b {
+		return a
+	}
+
+	return b
+}
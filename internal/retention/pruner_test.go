@@ -0,0 +1,124 @@
+package retention
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/config"
+	"service-rss/internal/database"
+)
+
+func TestPruner_Policies(t *testing.T) {
+	now := time.Date(2021, time.March, 10, 0, 0, 0, 0, time.UTC)
+
+	p := &Pruner{
+		global: limits{maxItems: 100, maxDays: 30},
+	}
+
+	rssSlice := []*database.Rss{
+		{Sources: []string{"global", "shared"}},
+		{Sources: []string{"shared", "custom"}, Retention: &database.RetentionSettings{MaxItems: 500, MaxDays: 7}},
+		{Sources: []string{"days only"}, Retention: &database.RetentionSettings{MaxDays: 1}},
+	}
+	sources := []string{"global", "shared", "custom", "days only", "orphan"}
+
+	policies := p.policies(rssSlice, sources, now)
+
+	assert.Equal(t, map[string]*policy{
+		"global":    {keepItems: 100, keepSince: now.AddDate(0, 0, -30)},
+		"shared":    {keepItems: 500, keepSince: now.AddDate(0, 0, -30)},
+		"custom":    {keepItems: 500, keepSince: now.AddDate(0, 0, -7)},
+		"days only": {keepItems: 100, keepSince: now.AddDate(0, 0, -1)},
+		"orphan":    {keepItems: 0, keepSince: maxTime},
+	}, policies)
+
+	t.Run("unlimited", func(t *testing.T) {
+		p := &Pruner{
+			global: limits{maxItems: 100},
+		}
+
+		policies := p.policies([]*database.Rss{
+			{Sources: []string{"items only"}},
+		}, []string{"items only"}, now)
+		assert.Equal(t, map[string]*policy{
+			"items only": {keepItems: 100, keepSince: maxTime},
+		}, policies)
+
+		p.global = limits{}
+		policies = p.policies([]*database.Rss{
+			{Sources: []string{"items only"}},
+		}, []string{"items only"}, now)
+		assert.Empty(t, policies)
+	})
+}
+
+func TestPruner_Prune(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().GetRssForIndex().Return([]*database.Rss{
+		{Sources: []string{"first", "second"}},
+	}, nil)
+	db.EXPECT().GetItemSources().Return([]string{"first", "second"}, nil)
+
+	// batches are repeated until the last one is not full
+	gomock.InOrder(
+		db.EXPECT().PruneItems("first", 10, gomock.Any(), 2, gomock.Any()).Return(2, nil),
+		db.EXPECT().PruneItems("first", 10, gomock.Any(), 2, gomock.Any()).Return(1, nil),
+	)
+	db.EXPECT().PruneItems("second", 10, gomock.Any(), 2, gomock.Any()).Return(0, errors.New("error"))
+	db.EXPECT().ForgetPrunedItems().Return(1, nil)
+
+	p := NewPruner(&config.Config{RetentionMaxItems: 10, RetentionBatchSize: 2}, db)
+	p.prune()
+}
+
+func TestPruner_Archive(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	items := []*database.Item{{ID: 1, Source: "first"}}
+
+	archiver := NewMockArchiver(ctrl)
+	archiver.EXPECT().Archive(items).Return(nil)
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().GetRssForIndex().Return([]*database.Rss{}, nil)
+	db.EXPECT().GetItemSources().Return([]string{"first"}, nil)
+	db.EXPECT().PruneItems("first", 0, maxTime, 10, gomock.Any()).
+		DoAndReturn(func(source string, keepItems int, keepSince time.Time, batchSize int, archive func([]*database.Item) error) (int, error) {
+			return len(items), archive(items)
+		})
+	db.EXPECT().ForgetPrunedItems().Return(0, nil)
+
+	p := NewPruner(&config.Config{RetentionBatchSize: 10}, db)
+	p.archiver = archiver
+	p.prune()
+}
+
+func TestPruner_Shutdown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	p := NewPruner(&config.Config{RetentionPeriod: time.Hour}, database.NewMockDatabase(ctrl))
+
+	timeout := time.After(1 * time.Second)
+	done := make(chan bool)
+	go func() {
+		go p.Start()
+		p.Shutdown()
+
+		done <- true
+	}()
+
+	select {
+	case <-timeout:
+		t.Fatal("test didn't finish in time")
+	case <-done:
+	}
+}
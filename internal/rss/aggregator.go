@@ -1,7 +1,9 @@
+//go:generate mockgen -package ${GOPACKAGE} -destination mock_aggregator.go -source aggregator.go
 package rss
 
 import (
 	"encoding/xml"
+	"errors"
 	"math"
 	"sort"
 	"time"
@@ -9,24 +11,71 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 
+	"service-rss/internal/config"
 	"service-rss/internal/database"
 	"service-rss/internal/dto"
+	"service-rss/internal/safe"
 )
 
 const (
 	defaultTtl = 5 // rss ttl is in minutes according to specification
+
+	// sources of rss are fetched concurrently, but not all at once
+	maxConcurrentFetches = 8
+
+	defaultLanguage    = "en"
+	defaultDescription = "Aggregated feed from different rss sources."
 )
 
 type Aggregator interface {
-	Aggregate(rss *database.Rss) *dto.RssFeed
+	// Aggregate fetches sources which are due by their schedules, force fetches all of them out of schedule
+	Aggregate(rss *database.Rss, force bool) *dto.RssFeed
+	// Preview aggregates rss same way and reports how each of sources was fetched
+	Preview(rss *database.Rss) (*dto.RssFeed, []*SourceDiagnostic)
+}
+
+var (
+	// errFetchTimeout is reported for sources which are not fetched in preview timeout
+	errFetchTimeout = errors.New("fetch timed out")
+	errFetchPanic   = errors.New("fetch failed unexpectedly")
+)
+
+type SourceDiagnostic struct {
+	Url      string
+	Error    string
+	Items    int
+	Duration time.Duration
 }
 
 type aggregator struct {
-	fetcher   Fetcher
-	histogram *prometheus.HistogramVec
+	db         database.Database
+	fetcher    Fetcher
+	scheduler  Scheduler
+	subscriber Subscriber // nil if websub is disabled
+	publicUrl  string
+	hubUrl     string // empty if our hub is disabled
+	itemsLimit int
+	// previewTimeout is time to wait for all sources of preview, zero means fetcher timeout only
+	previewTimeout time.Duration
+	histogram      *prometheus.HistogramVec
 }
 
-func NewAggregator(fetcher Fetcher) (Aggregator, error) {
+// fetchResult is feed of source or error of its fetch
+type fetchResult struct {
+	feed     *dto.RssFeed
+	err      error
+	duration time.Duration
+}
+
+// fetchedItem is item prepared for storing, it doesn't depend on channel of source anymore
+type fetchedItem struct {
+	source   string
+	language string
+	item     *dto.RssFeedItem
+}
+
+// NewAggregator makes aggregator which subscribes sources to their websub hubs if subscriber is not nil
+func NewAggregator(cfg *config.Config, db database.Database, fetcher Fetcher, subscriber Subscriber) (Aggregator, error) {
 	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "aggregation_duration_seconds",
 		Help:    "Histogram of aggregation time in seconds",
@@ -38,16 +87,29 @@ func NewAggregator(fetcher Fetcher) (Aggregator, error) {
 		return nil, err
 	}
 
+	var hubUrl string
+	if cfg.WebSubHubEnabled {
+		hubUrl = HubUrl(cfg.ServerPublicUrl)
+	}
+
 	return &aggregator{
-		fetcher:   fetcher,
-		histogram: histogram,
+		db:         db,
+		fetcher:    fetcher,
+		scheduler:  NewScheduler(cfg),
+		subscriber: subscriber,
+		publicUrl:  cfg.ServerPublicUrl,
+		hubUrl:     hubUrl,
+		itemsLimit: cfg.FeedItemsLimit,
+
+		previewTimeout: cfg.PreviewTimeout,
+		histogram:      histogram,
 	}, nil
 }
 
-func (a *aggregator) Aggregate(rss *database.Rss) *dto.RssFeed {
+func (a *aggregator) Aggregate(rss *database.Rss, force bool) *dto.RssFeed {
 	start := time.Now()
 
-	feed := a.aggregate(rss)
+	feed := a.aggregate(rss, force)
 
 	status := "ok"
 	if feed == nil {
@@ -58,17 +120,169 @@ func (a *aggregator) Aggregate(rss *database.Rss) *dto.RssFeed {
 	return feed
 }
 
-func (a *aggregator) aggregate(rss *database.Rss) *dto.RssFeed {
+func (a *aggregator) Preview(rss *database.Rss) (*dto.RssFeed, []*SourceDiagnostic) {
+	start := time.Now()
+
+	feed, diagnostics := a.preview(rss)
+
+	status := "ok"
+	if feed == nil {
+		status = "error"
+	}
+	a.histogram.WithLabelValues(status).Observe(time.Since(start).Seconds())
+
+	return feed, diagnostics
+}
+
+// aggregate saves fetched items and renders feed from item store, so items are kept after they leave source feed
+func (a *aggregator) aggregate(rss *database.Rss, force bool) *dto.RssFeed {
 	if rss == nil {
 		log.Error("empty rss")
 		return nil
 	}
 
+	if rss.Search != nil {
+		return a.renderSearch(rss)
+	}
+
+	// sources are fetched by their own schedules unless rss is refreshed, items of others are taken from item store
+	now := time.Now()
+	states := a.sourceStates(rss)
+	due := make([]string, 0, len(rss.Sources))
+	nested := make([]string, 0)
+	for _, source := range rss.Sources {
+		// newsletters are emailed into item store
+		if IsNewsletterSource(source) {
+			continue
+		}
+
+		// nested rss are read from storage every time, parent is outdated on their changes
+		if IsNestedSource(source) {
+			nested = append(nested, source)
+			continue
+		}
+
+		state, ok := states[source]
+		if force || !ok || !state.NextFetchTime.After(now) {
+			due = append(due, source)
+		}
+	}
+
+	fetched, _, _ := a.fetchSources(rss, append(nested, due...), 0, func(source string, feed *dto.RssFeed, err error) {
+		if IsNestedSource(source) {
+			return
+		}
+
+		state, ok := states[source]
+		if !ok {
+			state = &database.SourceState{Url: source}
+			states[source] = state
+		}
+		a.scheduler.Schedule(state, feed, err, time.Now())
+
+		if err == nil && a.subscriber != nil {
+			a.subscriber.Discover(source, feed)
+		}
+	})
+
+	scheduled := make([]*database.SourceState, 0, len(due))
+	for _, source := range due {
+		scheduled = append(scheduled, states[source])
+	}
+	if err := a.db.SaveSourceStates(scheduled); err != nil {
+		log.WithError(err).
+			WithField("name", rss.Name).
+			WithField("email", rss.Email).
+			Error("failed to save source states")
+	}
+
+	items, err := a.storeItems(rss, fetched)
+	if err != nil {
+		log.WithError(err).
+			WithField("name", rss.Name).
+			WithField("email", rss.Email).
+			Error("failed to use item store, feed is built from fetched items")
+
+		items = make([]*dto.RssFeedItem, 0, len(fetched))
+		for _, f := range fetched {
+			items = append(items, f.item)
+		}
+	}
+
+	return a.render(rss, scheduledTtl(rss.Sources, states, time.Now()), items)
+}
+
+func (a *aggregator) preview(rss *database.Rss) (*dto.RssFeed, []*SourceDiagnostic) {
+	if rss == nil {
+		log.Error("empty rss")
+		return nil, nil
+	}
+
+	if rss.Search != nil {
+		return a.renderSearch(rss), []*SourceDiagnostic{}
+	}
+
+	// preview is fetched within request, so slow sources are not waited for
+	fetched, ttl, diagnostics := a.fetchSources(rss, fetchedSources(rss.Sources), a.previewTimeout, nil)
+
+	items := make([]*dto.RssFeedItem, 0, len(fetched))
+	for _, f := range fetched {
+		items = append(items, f.item)
+	}
+
+	return a.render(rss, ttl, items), diagnostics
+}
+
+// fetchSources fetches given sources of rss concurrently, result of every fetch is passed to onFetch if it is set.
+// Sources which are not fetched in timeout are reported as failed, zero timeout waits for all of them
+func (a *aggregator) fetchSources(rss *database.Rss, sources []string, timeout time.Duration,
+	onFetch func(source string, feed *dto.RssFeed, err error)) ([]*fetchedItem, int64, []*SourceDiagnostic) {
 	ttl := int64(math.MaxInt64)
-	inputFeeds := make([]*dto.RssFeed, 0, len(rss.Sources))
-	for _, rssUrl := range rss.Sources {
-		feed, err := a.fetcher.Fetch(rssUrl)
+
+	start := time.Now()
+	results := a.startFetches(rss, sources)
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	fetched := make([]*fetchedItem, 0, 5*len(sources))
+	diagnostics := make([]*SourceDiagnostic, 0, len(sources))
+	timedOut := false
+	for i, rssUrl := range sources {
+		var result *fetchResult
+		if timedOut {
+			select {
+			case result = <-results[i]:
+			default:
+			}
+		} else {
+			select {
+			case result = <-results[i]:
+			case <-deadline:
+				timedOut = true
+			}
+		}
+		if result == nil {
+			result = &fetchResult{err: errFetchTimeout, duration: time.Since(start)}
+		}
+
+		feed, err := result.feed, result.err
+		if onFetch != nil {
+			onFetch(rssUrl, feed, err)
+		}
+
+		diagnostic := &SourceDiagnostic{
+			Url:      rssUrl,
+			Duration: result.duration,
+		}
+		diagnostics = append(diagnostics, diagnostic)
+
 		if err != nil {
+			diagnostic.Error = err.Error()
 			ttl = defaultTtl
 			log.WithError(err).
 				WithField("url", rssUrl).
@@ -78,44 +292,299 @@ func (a *aggregator) aggregate(rss *database.Rss) *dto.RssFeed {
 			continue
 		}
 
-		inputFeeds = append(inputFeeds, feed)
-	}
-
-	allItems := make([]*dto.RssFeedItem, 0, 5*len(inputFeeds))
-	for _, feed := range inputFeeds {
 		if feed.Channel.Ttl > 0 && feed.Channel.Ttl < ttl {
 			ttl = feed.Channel.Ttl
 		}
-		allItems = append(allItems, feed.Channel.Items...)
+
+		for _, item := range feed.Channel.Items {
+			fetched = append(fetched, &fetchedItem{
+				source:   rssUrl,
+				language: feed.Channel.Language,
+				item:     withSourceFallbacks(publicSourceUrl(a.publicUrl, rssUrl), feed.Channel, item),
+			})
+			diagnostic.Items++
+		}
 	}
 
 	if ttl == math.MaxInt64 {
 		ttl = defaultTtl
 	}
 
+	return fetched, ttl, diagnostics
+}
+
+// startFetches fetches sources in background, result of every source is sent to its buffered channel,
+// so fetches which are not waited for anymore finish by fetcher timeout
+func (a *aggregator) startFetches(rss *database.Rss, sources []string) []chan *fetchResult {
+	results := make([]chan *fetchResult, len(sources))
+	for i := range sources {
+		results[i] = make(chan *fetchResult, 1)
+	}
+
+	go safe.Do(func() {
+		limit := make(chan struct{}, maxConcurrentFetches)
+		for i, source := range sources {
+			limit <- struct{}{}
+
+			i, source := i, source
+			go safe.Do(func() {
+				start := time.Now()
+
+				// result is sent even if fetch panics, so nobody waits for it forever
+				result := &fetchResult{err: errFetchPanic}
+				defer func() {
+					result.duration = time.Since(start)
+					results[i] <- result
+					<-limit
+				}()
+
+				feed, err := a.fetch(rss, source)
+				result = &fetchResult{feed: feed, err: err}
+			})
+		}
+	})
+
+	return results
+}
+
+func (a *aggregator) fetch(rss *database.Rss, source string) (*dto.RssFeed, error) {
+	if IsNestedSource(source) {
+		return a.nestedFeed(rss.Email, source)
+	}
+
+	return a.fetcher.Fetch(source)
+}
+
+// sourceStates returns states of known sources, all sources are due if states can't be read
+func (a *aggregator) sourceStates(rss *database.Rss) map[string]*database.SourceState {
+	states, err := a.db.GetSourceStates(rss.Sources)
+	if err != nil {
+		log.WithError(err).
+			WithField("name", rss.Name).
+			WithField("email", rss.Email).
+			Error("failed to get source states, all sources are fetched")
+		return make(map[string]*database.SourceState)
+	}
+
+	return states
+}
+
+// scheduledTtl is time in minutes until the earliest source should be fetched again, so cacher rebuilds rss then
+func scheduledTtl(sources []string, states map[string]*database.SourceState, now time.Time) int64 {
+	var next *time.Time
+	for _, source := range sources {
+		if IsNewsletterSource(source) || IsNestedSource(source) {
+			continue
+		}
+
+		state, ok := states[source]
+		if !ok {
+			return defaultTtl
+		}
+		if next == nil || state.NextFetchTime.Before(*next) {
+			next = &state.NextFetchTime
+		}
+	}
+
+	if next == nil {
+		return defaultTtl
+	}
+
+	ttl := int64(math.Ceil(next.Sub(now).Minutes()))
+	if ttl < 1 {
+		return 1
+	}
+
+	return ttl
+}
+
+// fetchedSources returns sources except newsletters, they are not fetched
+func fetchedSources(sources []string) []string {
+	fetched := make([]string, 0, len(sources))
+	for _, source := range sources {
+		if !IsNewsletterSource(source) {
+			fetched = append(fetched, source)
+		}
+	}
+
+	return fetched
+}
+
+// storeItems saves fetched items and returns stored ones. Items of nested rss are kept by their own store and retention,
+// so they are merged into feed without storing them again
+func (a *aggregator) storeItems(rss *database.Rss, fetched []*fetchedItem) ([]*dto.RssFeedItem, error) {
+	nested := make([]*dto.RssFeedItem, 0)
+	toSave := make([]*database.Item, 0, len(fetched))
+	for _, f := range fetched {
+		if IsNestedSource(f.source) {
+			nested = append(nested, f.item)
+			continue
+		}
+
+		item, err := toStoredItem(f.source, f.language, f.item)
+		if err != nil {
+			return nil, err
+		}
+		toSave = append(toSave, item)
+	}
+
+	if len(toSave) > 0 {
+		err := a.db.SaveItems(toSave)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	stored, err := a.db.GetItems(rss.Sources, a.itemsLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*dto.RssFeedItem, 0, len(stored)+len(nested))
+	for _, s := range stored {
+		item, err := fromStoredItem(s)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return append(items, nested...), nil
+}
+
+// renderSearch builds feed of saved search from stored items, they are kept fresh by aggregation of searched rss
+func (a *aggregator) renderSearch(rss *database.Rss) *dto.RssFeed {
+	limit := a.itemsLimit
+	if limit <= 0 {
+		limit = math.MaxInt32
+	}
+
+	results, err := a.db.SearchItems(&database.SearchQuery{
+		Text:   rss.Search.Query,
+		Email:  rss.Email,
+		Names:  rss.Search.Feeds,
+		Newest: true,
+		Limit:  limit,
+	})
+	if err != nil {
+		log.WithError(err).
+			WithField("name", rss.Name).
+			WithField("email", rss.Email).
+			Error("failed to search items, feed is built without items")
+		results = []*database.SearchResult{}
+	}
+
+	items := make([]*dto.RssFeedItem, 0, len(results))
+	for _, result := range results {
+		item, err := fromStoredItem(&result.Item)
+		if err != nil {
+			log.WithError(err).WithField("source", result.Source).Warn("failed to decode stored item")
+			continue
+		}
+		items = append(items, item)
+	}
+
+	return a.render(rss, defaultTtl, items)
+}
+
+func (a *aggregator) render(rss *database.Rss, ttl int64, items []*dto.RssFeedItem) *dto.RssFeed {
+	isPodcast := rss.Mode == database.ModePodcast
+
+	allItems := make([]*dto.RssFeedItem, 0, len(items))
+	for _, item := range items {
+		if isPodcast {
+			item = toEpisode(item)
+		} else {
+			item = withoutPodcastFields(item)
+		}
+
+		if item == nil {
+			continue
+		}
+
+		allItems = append(allItems, item)
+	}
+
 	sort.SliceStable(allItems, func(i, j int) bool {
 		return getTimestamp(allItems[i].PubDate) > getTimestamp(allItems[j].PubDate)
 	})
 
+	if a.itemsLimit > 0 && len(allItems) > a.itemsLimit {
+		allItems = allItems[:a.itemsLimit]
+	}
+
+	feed := a.feed(rss, ttl, allItems)
+	if isPodcast {
+		a.addPodcastSettings(feed, rss)
+	}
+
+	return feed
+}
+
+func (a *aggregator) feed(rss *database.Rss, ttl int64, items []*dto.RssFeedItem) *dto.RssFeed {
+	settings := rss.Channel
+	if settings == nil {
+		settings = &database.ChannelSettings{}
+	}
+
+	channel := &dto.RssFeedChannel{
+		Title:         valueOrDefault(settings.Title, rss.Name),
+		Link:          valueOrDefault(settings.Link, a.publicUrl),
+		Description:   valueOrDefault(settings.Description, defaultDescription),
+		Language:      settings.Language,
+		Copyright:     settings.Copyright,
+		LastBuildDate: time.Now().Format(time.RFC1123),
+		Ttl:           ttl,
+		Items:         items,
+		AtomLink: []*dto.AtomLink{
+			{
+				Href: FeedUrl(a.publicUrl, rss.Email, rss.Name),
+				Rel:  "self",
+				Type: "application/rss+xml",
+			},
+		},
+		AtomIcon: settings.Icon,
+	}
+
+	if len(a.hubUrl) > 0 {
+		channel.AtomLink = append(channel.AtomLink, &dto.AtomLink{Href: a.hubUrl, Rel: "hub"})
+	}
+
+	if len(settings.Category) > 0 {
+		channel.Category = []string{settings.Category}
+	}
+
+	if len(settings.Image) > 0 {
+		channel.Image = &dto.RssFeedImage{
+			Url:   settings.Image,
+			Title: channel.Title,
+			Link:  channel.Link,
+		}
+	}
+
 	return &dto.RssFeed{
 		XMLName: xml.Name{
 			Local: "rss",
 		},
-		Channel: &dto.RssFeedChannel{
-			Title:         "RSS Aggregator",
-			Description:   "Aggregated feed from different rss sources.",
-			LastBuildDate: time.Now().Format(time.RFC1123),
-			Ttl:           ttl,
-			Items:         allItems,
-		},
+		Version:       "2.0",
+		NamespaceAtom: dto.NamespaceAtom,
+		Channel:       channel,
 	}
 }
 
 func getTimestamp(pubDate string) int64 {
-	t, err := time.Parse(time.RFC1123, pubDate)
-	if err != nil {
+	t := parsePubDate(pubDate)
+	if t == nil {
 		return 0
 	}
 
 	return t.Unix()
 }
+
+func valueOrDefault(value string, defaultValue string) string {
+	if len(value) == 0 {
+		return defaultValue
+	}
+
+	return value
+}
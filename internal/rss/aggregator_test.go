@@ -10,6 +10,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 
+	"service-rss/internal/config"
 	"service-rss/internal/database"
 	"service-rss/internal/dto"
 )
@@ -18,7 +19,8 @@ var (
 	data = map[string]*dto.RssFeed{
 		"https://one.com/": {
 			Channel: &dto.RssFeedChannel{
-				Ttl: 30,
+				Title: "One",
+				Ttl:   30,
 				Items: []*dto.RssFeedItem{
 					{
 						Title:   "second",
@@ -32,7 +34,8 @@ var (
 		},
 		"https://two.com/": {
 			Channel: &dto.RssFeedChannel{
-				Ttl: 25,
+				Title: "Two",
+				Ttl:   25,
 				Items: []*dto.RssFeedItem{
 					{
 						Title:   "third",
@@ -43,7 +46,8 @@ var (
 		},
 		"https://three.com/": {
 			Channel: &dto.RssFeedChannel{
-				Ttl: 10,
+				Title: "Three",
+				Ttl:   10,
 				Items: []*dto.RssFeedItem{
 					{
 						Title:   "first",
@@ -58,26 +62,77 @@ var (
 		XMLName: xml.Name{
 			Local: "rss",
 		},
+		Version:       "2.0",
+		NamespaceAtom: dto.NamespaceAtom,
 		Channel: &dto.RssFeedChannel{
-			Title:       "RSS Aggregator",
+			AtomLink: []*dto.AtomLink{
+				{
+					Href: "http://localhost/example@gmail.com/test",
+					Rel:  "self",
+					Type: "application/rss+xml",
+				},
+			},
+			Title:       "test",
+			Link:        "http://localhost",
 			Description: "Aggregated feed from different rss sources.",
 			Ttl:         10,
 			Items: []*dto.RssFeedItem{
 				{
 					Title:   "first",
 					PubDate: "Mon, 02 Jan 2006 15:04:07 MST",
+					Source:  &dto.RssFeedSource{Url: "https://three.com/", Title: "Three"},
 				},
 				{
 					Title:   "second",
 					PubDate: "Mon, 02 Jan 2006 15:04:06 MST",
+					Source:  &dto.RssFeedSource{Url: "https://one.com/", Title: "One"},
 				},
 				{
 					Title:   "third",
 					PubDate: "Mon, 02 Jan 2006 15:04:05 MST",
+					Source:  &dto.RssFeedSource{Url: "https://two.com/", Title: "Two"},
 				},
 
 				{
-					Title: "fourth",
+					Title:  "fourth",
+					Source: &dto.RssFeedSource{Url: "https://one.com/", Title: "One"},
+				},
+			},
+		},
+	}
+
+	expectedCustomFeed = &dto.RssFeed{
+		XMLName: xml.Name{
+			Local: "rss",
+		},
+		Version:       "2.0",
+		NamespaceAtom: dto.NamespaceAtom,
+		Channel: &dto.RssFeedChannel{
+			AtomLink: []*dto.AtomLink{
+				{
+					Href: "http://localhost/example@gmail.com/custom",
+					Rel:  "self",
+					Type: "application/rss+xml",
+				},
+			},
+			AtomIcon:    "https://example.com/favicon.ico",
+			Title:       "Custom",
+			Link:        "https://example.com/",
+			Description: "Custom feed",
+			Language:    "de",
+			Copyright:   "Example",
+			Category:    []string{"News"},
+			Image: &dto.RssFeedImage{
+				Url:   "https://example.com/logo.png",
+				Title: "Custom",
+				Link:  "https://example.com/",
+			},
+			Ttl: 25,
+			Items: []*dto.RssFeedItem{
+				{
+					Title:   "third",
+					PubDate: "Mon, 02 Jan 2006 15:04:05 MST",
+					Source:  &dto.RssFeedSource{Url: "https://two.com/", Title: "Two"},
 				},
 			},
 		},
@@ -87,8 +142,18 @@ var (
 		XMLName: xml.Name{
 			Local: "rss",
 		},
+		Version:       "2.0",
+		NamespaceAtom: dto.NamespaceAtom,
 		Channel: &dto.RssFeedChannel{
-			Title:       "RSS Aggregator",
+			AtomLink: []*dto.AtomLink{
+				{
+					Href: "http://localhost/example@gmail.com/test",
+					Rel:  "self",
+					Type: "application/rss+xml",
+				},
+			},
+			Title:       "test",
+			Link:        "http://localhost",
 			Description: "Aggregated feed from different rss sources.",
 			Ttl:         defaultTtl,
 			Items:       []*dto.RssFeedItem{},
@@ -96,7 +161,7 @@ var (
 	}
 )
 
-func NewTestAggregator(fetcher Fetcher) Aggregator {
+func NewTestAggregator(fetcher Fetcher, db database.Database) Aggregator {
 	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "aggregation_duration_seconds",
 		Help:    "Histogram of aggregation time in seconds",
@@ -104,11 +169,68 @@ func NewTestAggregator(fetcher Fetcher) Aggregator {
 	}, []string{"status"})
 
 	return &aggregator{
-		fetcher:   fetcher,
-		histogram: histogram,
+		db:      db,
+		fetcher: fetcher,
+		scheduler: NewScheduler(&config.Config{
+			SchedulerMinInterval: 5 * time.Minute,
+			SchedulerMaxInterval: 6 * time.Hour,
+			SchedulerBackoff:     defaultTtl * time.Minute,
+			SchedulerMaxBackoff:  24 * time.Hour,
+		}),
+		publicUrl:  "http://localhost",
+		itemsLimit: 200,
+		histogram:  histogram,
 	}
 }
 
+// expectItemStore makes database mock keep saved items in memory in order of saving
+func expectItemStore(db *database.MockDatabase) {
+	items := make([]*database.Item, 0)
+
+	db.EXPECT().SaveItems(gomock.Any()).AnyTimes().DoAndReturn(func(saved []*database.Item) error {
+		for _, item := range saved {
+			replaced := false
+			for i, existing := range items {
+				if existing.Source == item.Source && existing.Hash == item.Hash {
+					items[i] = item
+					replaced = true
+				}
+			}
+			if !replaced {
+				items = append(items, item)
+			}
+		}
+		return nil
+	})
+
+	db.EXPECT().GetItems(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(func(sources []string, limit int) ([]*database.Item, error) {
+		result := make([]*database.Item, 0)
+		for _, item := range items {
+			for _, source := range sources {
+				if item.Source == source && len(result) < limit {
+					result = append(result, item)
+				}
+			}
+		}
+		return result, nil
+	})
+}
+
+// expectSourceStates makes every source due, states are not kept
+func expectSourceStates(db *database.MockDatabase) {
+	db.EXPECT().GetSourceStates(gomock.Any()).AnyTimes().DoAndReturn(func(urls []string) (map[string]*database.SourceState, error) {
+		return map[string]*database.SourceState{}, nil
+	})
+	db.EXPECT().SaveSourceStates(gomock.Any()).AnyTimes().Return(nil)
+}
+
+func newItemStore(ctrl *gomock.Controller) database.Database {
+	db := database.NewMockDatabase(ctrl)
+	expectItemStore(db)
+	expectSourceStates(db)
+	return db
+}
+
 func TestBuilder_Build(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -119,13 +241,14 @@ func TestBuilder_Build(t *testing.T) {
 			f.EXPECT().Fetch(url).Return(feed, nil)
 		}
 
-		a := NewTestAggregator(f)
+		a := NewTestAggregator(f, newItemStore(ctrl))
 
 		rss := &database.Rss{
+			Email:   "example@gmail.com",
 			Name:    "test",
 			Sources: []string{"https://one.com/", "https://two.com/", "https://three.com/"},
 		}
-		feed := a.Aggregate(rss)
+		feed := a.Aggregate(rss, false)
 
 		buildDate := feed.Channel.LastBuildDate
 		_, err := time.Parse(time.RFC1123, buildDate)
@@ -136,20 +259,332 @@ func TestBuilder_Build(t *testing.T) {
 		assert.Equal(t, expectedOkFeed, feed)
 	})
 
+	t.Run("channel settings", func(t *testing.T) {
+		f := NewMockFetcher(ctrl)
+		f.EXPECT().Fetch("https://two.com/").Return(data["https://two.com/"], nil)
+
+		a := NewTestAggregator(f, newItemStore(ctrl))
+
+		rss := &database.Rss{
+			Email:   "example@gmail.com",
+			Name:    "custom",
+			Sources: []string{"https://two.com/"},
+			Channel: &database.ChannelSettings{
+				Title:       "Custom",
+				Description: "Custom feed",
+				Link:        "https://example.com/",
+				Language:    "de",
+				Image:       "https://example.com/logo.png",
+				Icon:        "https://example.com/favicon.ico",
+				Copyright:   "Example",
+				Category:    "News",
+			},
+		}
+
+		feed := a.Aggregate(rss, false)
+		feed.Channel.LastBuildDate = ""
+
+		assert.Equal(t, expectedCustomFeed, feed)
+	})
+
 	t.Run("with error", func(t *testing.T) {
 		f := NewMockFetcher(ctrl)
 		f.EXPECT().Fetch(gomock.Any()).Return(nil, errors.New("error"))
 
-		a := NewTestAggregator(f)
+		a := NewTestAggregator(f, newItemStore(ctrl))
 
 		rss := &database.Rss{
+			Email:   "example@gmail.com",
 			Name:    "test",
 			Sources: []string{"https://one.com/"},
 		}
-		feed := a.Aggregate(rss)
+		feed := a.Aggregate(rss, false)
 
 		feed.Channel.LastBuildDate = ""
 
 		assert.Equal(t, expectedErrorFeed, feed)
 	})
+
+	t.Run("with hub", func(t *testing.T) {
+		f := NewMockFetcher(ctrl)
+		f.EXPECT().Fetch(gomock.Any()).Return(nil, errors.New("error"))
+
+		a := NewTestAggregator(f, newItemStore(ctrl))
+		a.(*aggregator).hubUrl = HubUrl("http://localhost")
+
+		rss := &database.Rss{
+			Email:   "example@gmail.com",
+			Name:    "test",
+			Sources: []string{"https://one.com/"},
+		}
+		feed := a.Aggregate(rss, false)
+
+		assert.Equal(t, []*dto.AtomLink{
+			{Href: "http://localhost/example@gmail.com/test", Rel: "self", Type: "application/rss+xml"},
+			{Href: "http://localhost/websub/hub", Rel: "hub"},
+		}, feed.Channel.AtomLink)
+	})
+}
+
+func TestAggregator_Preview(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	f := NewMockFetcher(ctrl)
+	f.EXPECT().Fetch("https://two.com/").Return(data["https://two.com/"], nil)
+	f.EXPECT().Fetch("https://broken.com/").Return(nil, errors.New("malformed rss feed"))
+
+	a := NewTestAggregator(f, newItemStore(ctrl))
+
+	rss := &database.Rss{
+		Email:   "example@gmail.com",
+		Name:    "preview",
+		Sources: []string{"https://two.com/", "https://broken.com/"},
+	}
+	feed, diagnostics := a.Preview(rss)
+
+	assert.Equal(t, "preview", feed.Channel.Title)
+	assert.Len(t, feed.Channel.Items, len(data["https://two.com/"].Channel.Items))
+
+	assert.Len(t, diagnostics, 2)
+	assert.Equal(t, "https://two.com/", diagnostics[0].Url)
+	assert.Empty(t, diagnostics[0].Error)
+	assert.Equal(t, len(data["https://two.com/"].Channel.Items), diagnostics[0].Items)
+	assert.Equal(t, "https://broken.com/", diagnostics[1].Url)
+	assert.Equal(t, "malformed rss feed", diagnostics[1].Error)
+	assert.Equal(t, 0, diagnostics[1].Items)
+}
+
+func TestAggregator_PreviewTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	f := NewMockFetcher(ctrl)
+	f.EXPECT().Fetch("https://slow.com/").DoAndReturn(func(url string) (*dto.RssFeed, error) {
+		<-release
+		return data["https://one.com/"], nil
+	})
+	f.EXPECT().Fetch("https://two.com/").Return(data["https://two.com/"], nil)
+
+	a := NewTestAggregator(f, newItemStore(ctrl))
+	a.(*aggregator).previewTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+	feed, diagnostics := a.Preview(&database.Rss{
+		Email:   "example@gmail.com",
+		Name:    "preview",
+		Sources: []string{"https://slow.com/", "https://two.com/"},
+	})
+
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	assert.Len(t, feed.Channel.Items, len(data["https://two.com/"].Channel.Items))
+	assert.Len(t, diagnostics, 2)
+	assert.Equal(t, "fetch timed out", diagnostics[0].Error)
+	assert.Empty(t, diagnostics[1].Error)
+}
+
+func TestAggregator_ItemStore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	rss := &database.Rss{
+		Email:   "example@gmail.com",
+		Name:    "history",
+		Sources: []string{"https://one.com/"},
+	}
+
+	t.Run("items are kept after they leave source", func(t *testing.T) {
+		f := NewMockFetcher(ctrl)
+		gomock.InOrder(
+			f.EXPECT().Fetch("https://one.com/").Return(&dto.RssFeed{Channel: &dto.RssFeedChannel{
+				Title: "One",
+				Items: []*dto.RssFeedItem{
+					{Title: "first", Guid: "1", PubDate: "Mon, 02 Jan 2006 15:04:05 MST"},
+				},
+			}}, nil),
+			f.EXPECT().Fetch("https://one.com/").Return(&dto.RssFeed{Channel: &dto.RssFeedChannel{
+				Title: "One",
+				Items: []*dto.RssFeedItem{
+					{Title: "second", Guid: "2", PubDate: "Tue, 03 Jan 2006 15:04:05 MST"},
+					{Title: "first updated", Guid: "1", PubDate: "Mon, 02 Jan 2006 15:04:05 MST"},
+				},
+			}}, nil),
+			f.EXPECT().Fetch("https://one.com/").Return(&dto.RssFeed{Channel: &dto.RssFeedChannel{
+				Title: "One",
+				Items: []*dto.RssFeedItem{
+					{Title: "third", Guid: "3", PubDate: "Wed, 04 Jan 2006 15:04:05 MST"},
+				},
+			}}, nil),
+		)
+
+		a := NewTestAggregator(f, newItemStore(ctrl))
+
+		titles := func(feed *dto.RssFeed) []string {
+			result := make([]string, 0, len(feed.Channel.Items))
+			for _, item := range feed.Channel.Items {
+				result = append(result, item.Title)
+			}
+			return result
+		}
+
+		assert.Equal(t, []string{"first"}, titles(a.Aggregate(rss, false)))
+		assert.Equal(t, []string{"second", "first updated"}, titles(a.Aggregate(rss, false)))
+		assert.Equal(t, []string{"third", "second", "first updated"}, titles(a.Aggregate(rss, false)))
+	})
+
+	t.Run("store error", func(t *testing.T) {
+		f := NewMockFetcher(ctrl)
+		f.EXPECT().Fetch("https://one.com/").Return(data["https://one.com/"], nil)
+
+		db := database.NewMockDatabase(ctrl)
+		db.EXPECT().SaveItems(gomock.Any()).Return(errors.New("error"))
+		expectSourceStates(db)
+
+		a := NewTestAggregator(f, db)
+
+		feed := a.Aggregate(rss, false)
+		assert.Len(t, feed.Channel.Items, len(data["https://one.com/"].Channel.Items))
+	})
+
+	t.Run("preview doesn't use store", func(t *testing.T) {
+		f := NewMockFetcher(ctrl)
+		f.EXPECT().Fetch("https://one.com/").Return(data["https://one.com/"], nil)
+
+		a := NewTestAggregator(f, database.NewMockDatabase(ctrl))
+
+		feed, _ := a.Preview(rss)
+		assert.Len(t, feed.Channel.Items, len(data["https://one.com/"].Channel.Items))
+	})
+
+	t.Run("fetched sources are discovered by subscriber", func(t *testing.T) {
+		f := NewMockFetcher(ctrl)
+		f.EXPECT().Fetch("https://one.com/").Return(data["https://one.com/"], nil)
+
+		subscriber := NewMockSubscriber(ctrl)
+		subscriber.EXPECT().Discover("https://one.com/", data["https://one.com/"])
+
+		a := NewTestAggregator(f, newItemStore(ctrl))
+		a.(*aggregator).subscriber = subscriber
+
+		a.Aggregate(rss, false)
+	})
+
+	t.Run("newsletter source is not fetched", func(t *testing.T) {
+		f := NewMockFetcher(ctrl)
+		f.EXPECT().Fetch("https://one.com/").Times(2).Return(data["https://one.com/"], nil)
+
+		db := newItemStore(ctrl)
+		emailed, err := toStoredItem("newsletter:token", "", &dto.RssFeedItem{
+			Title:   "emailed",
+			Guid:    "message@example.com",
+			PubDate: "Mon, 02 Jan 2006 15:04:08 MST",
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, db.SaveItems([]*database.Item{emailed}))
+
+		a := NewTestAggregator(f, db)
+
+		withNewsletter := &database.Rss{
+			Email:   "example@gmail.com",
+			Name:    "newsletter",
+			Sources: []string{"https://one.com/", "newsletter:token"},
+		}
+
+		feed := a.Aggregate(withNewsletter, false)
+		assert.Len(t, feed.Channel.Items, len(data["https://one.com/"].Channel.Items)+1)
+		assert.Equal(t, "emailed", feed.Channel.Items[0].Title)
+
+		_, diagnostics := a.Preview(withNewsletter)
+		assert.Len(t, diagnostics, 1)
+	})
+}
+
+func TestAggregator_Schedule(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	rss := &database.Rss{
+		Email:   "example@gmail.com",
+		Name:    "scheduled",
+		Sources: []string{"https://one.com/"},
+	}
+
+	newScheduledStore := func() database.Database {
+		db := database.NewMockDatabase(ctrl)
+		expectItemStore(db)
+		db.EXPECT().GetSourceStates(rss.Sources).Return(map[string]*database.SourceState{
+			"https://one.com/": {Url: "https://one.com/", NextFetchTime: time.Now().Add(time.Hour)},
+		}, nil)
+		db.EXPECT().SaveSourceStates(gomock.Any()).Return(nil)
+		return db
+	}
+
+	t.Run("source is not fetched before its time", func(t *testing.T) {
+		a := NewTestAggregator(NewMockFetcher(ctrl), newScheduledStore())
+
+		feed := a.Aggregate(rss, false)
+		assert.Empty(t, feed.Channel.Items)
+	})
+
+	t.Run("refresh fetches source out of schedule", func(t *testing.T) {
+		f := NewMockFetcher(ctrl)
+		f.EXPECT().Fetch("https://one.com/").Return(data["https://one.com/"], nil)
+
+		a := NewTestAggregator(f, newScheduledStore())
+
+		feed := a.Aggregate(rss, true)
+		assert.Len(t, feed.Channel.Items, len(data["https://one.com/"].Channel.Items))
+	})
+}
+
+func TestAggregator_SavedSearch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	rss := &database.Rss{
+		Email: "example@gmail.com",
+		Name:  "search",
+		Search: &database.SearchSettings{
+			Query: "kubernetes AND security",
+			Feeds: []string{"news", "blogs"},
+		},
+	}
+
+	query := &database.SearchQuery{
+		Text:   "kubernetes AND security",
+		Email:  "example@gmail.com",
+		Names:  []string{"news", "blogs"},
+		Newest: true,
+		Limit:  200,
+	}
+
+	t.Run("items are rendered from search results", func(t *testing.T) {
+		stored, err := toStoredItem("https://one.com/", "en", &dto.RssFeedItem{Title: "Kubernetes security", Guid: "1"})
+		assert.NoError(t, err)
+
+		db := database.NewMockDatabase(ctrl)
+		db.EXPECT().SearchItems(query).Return([]*database.SearchResult{{Item: *stored}}, nil)
+
+		// saved search doesn't fetch anything
+		a := NewTestAggregator(NewMockFetcher(ctrl), db)
+
+		feed := a.Aggregate(rss, false)
+		assert.Equal(t, int64(defaultTtl), feed.Channel.Ttl)
+		if assert.Len(t, feed.Channel.Items, 1) {
+			assert.Equal(t, "Kubernetes security", feed.Channel.Items[0].Title)
+		}
+	})
+
+	t.Run("search error", func(t *testing.T) {
+		db := database.NewMockDatabase(ctrl)
+		db.EXPECT().SearchItems(query).Return(nil, errors.New("error"))
+
+		a := NewTestAggregator(NewMockFetcher(ctrl), db)
+
+		feed := a.Aggregate(rss, false)
+		assert.Empty(t, feed.Channel.Items)
+	})
 }
@@ -1,67 +1,200 @@
+//go:generate mockgen -package ${GOPACKAGE} -destination mock_cacher.go -source cacher.go
 package rss
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/xml"
+	"errors"
 	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 
+	"service-rss/internal/compress"
 	"service-rss/internal/config"
 	"service-rss/internal/database"
 	"service-rss/internal/dto"
 	"service-rss/internal/safe"
 )
 
+var (
+	// ErrRefreshQueueFull means too many refreshes are waiting for workers
+	ErrRefreshQueueFull = errors.New("refresh queue is full")
+	// ErrCacherStopped means cacher is shut down and doesn't take refreshes anymore
+	ErrCacherStopped = errors.New("cacher is stopped")
+)
+
+// Refresher rebuilds rss out of turn
+type Refresher interface {
+	// Refresh queues rebuild of rss of owner, returned channel is closed when rss is cached,
+	// concurrent refreshes of the same rss share the queued one. Rss leased by other worker or replica
+	// is waited for until it is cached, ErrRssLeased is returned for it only if there are no notifications
+	Refresh(email string, name string) (<-chan struct{}, error)
+}
+
+// refreshTask is registered before rss is leased, rss is nil until then and while rss is cached by others
+type refreshTask struct {
+	key  string
+	rss  *database.Rss
+	done chan struct{}
+	// expire lets waiters go if rss leased by others is not cached in time
+	expire *time.Timer
+}
+
 type Cacher struct {
-	db           database.Database
-	aggregator   Aggregator
-	rssChan      chan *database.Rss
-	workersCount int
-	pullPeriod   time.Duration
-	batchSize    int
+	db               database.Database
+	aggregator       Aggregator
+	listener         database.RefreshListener
+	hub              Hub             // nil if our hub is disabled
+	webhooks         WebhookNotifier // nil if webhooks are disabled
+	rssChan          chan *database.Rss
+	refreshChan      chan *refreshTask
+	workersCount     int
+	maxSleep         time.Duration
+	batchSize        int
+	leaseDuration    time.Duration
+	leasedWait       time.Duration
+	heartbeatPeriod  time.Duration
+	queueDepthGauge  prometheus.Gauge
+	leasesGauge      prometheus.Gauge
+	oldestLeaseGauge prometheus.Gauge
+
+	// leased are ids of rss leased by this replica and not cached yet, they are extended by heartbeats
+	leased      map[int64]struct{}
+	leasedMutex sync.Mutex
+	// refreshing are queued refresh tasks by owner and name of rss, they are guarded by leased mutex
+	refreshing map[string]*refreshTask
+	// stopped is set on shutdown, refreshes are not queued after that, it is guarded by leased mutex
+	stopped bool
 
 	// graceful shutdown helper-channels
 	shutdownChan     chan interface{}
 	shutdownWaitChan chan interface{}
 }
 
-func NewCacher(cfg *config.Config, db database.Database, aggregator Aggregator) *Cacher {
+// NewCacher makes cacher woken by listener notifications, it works by due times only if listener is nil.
+// Changed feeds are published to hub and new items are delivered to webhooks if they are not nil
+func NewCacher(cfg *config.Config, db database.Database, aggregator Aggregator, listener database.RefreshListener, hub Hub,
+	webhooks WebhookNotifier) (*Cacher, error) {
+	queueDepthGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cache_queue_depth",
+		Help: "Count of outdated rss which are not leased by any replica",
+	})
+
+	leasesGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cache_leases",
+		Help: "Count of active leases of all replicas",
+	})
+
+	oldestLeaseGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cache_oldest_lease_age_seconds",
+		Help: "Age of the oldest active lease in seconds",
+	})
+
+	// waiters of rss leased by others are not kept longer than handlers wait for them
+	leasedWait := cfg.RefreshWaitTimeout
+	if cfg.CacheMissWaitTimeout > leasedWait {
+		leasedWait = cfg.CacheMissWaitTimeout
+	}
+
+	for _, collector := range []prometheus.Collector{queueDepthGauge, leasesGauge, oldestLeaseGauge} {
+		err := prometheus.Register(collector)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &Cacher{
-		db:           db,
-		aggregator:   aggregator,
-		rssChan:      make(chan *database.Rss, cfg.CacherWorkersCount),
-		workersCount: cfg.CacherWorkersCount,
-		pullPeriod:   cfg.CacherPullPeriod,
-		batchSize:    cfg.CacherBatchSize,
+		db:               db,
+		aggregator:       aggregator,
+		listener:         listener,
+		hub:              hub,
+		webhooks:         webhooks,
+		rssChan:          make(chan *database.Rss, cfg.CacherWorkersCount),
+		refreshChan:      make(chan *refreshTask, cfg.CacherBatchSize),
+		workersCount:     cfg.CacherWorkersCount,
+		maxSleep:         cfg.CacherMaxSleep,
+		batchSize:        cfg.CacherBatchSize,
+		leaseDuration:    cfg.CacherLeaseDuration,
+		leasedWait:       leasedWait,
+		heartbeatPeriod:  cfg.CacherHeartbeatPeriod,
+		queueDepthGauge:  queueDepthGauge,
+		leasesGauge:      leasesGauge,
+		oldestLeaseGauge: oldestLeaseGauge,
+
+		leased:     make(map[int64]struct{}),
+		refreshing: make(map[string]*refreshTask),
 
 		shutdownChan:     make(chan interface{}),
 		shutdownWaitChan: make(chan interface{}),
-	}
+	}, nil
 }
 
 func (c *Cacher) Start() {
 	defer close(c.shutdownWaitChan)
 
-	ticker := time.NewTicker(c.pullPeriod)
+	var refresh <-chan struct{}
+	var cached <-chan string
+	if c.listener != nil {
+		refresh = c.listener.Refresh()
+		cached = c.listener.Cached()
+	}
 
 	// push tasks
+	pushDone := make(chan interface{})
+	go safe.Do(func() {
+		defer close(pushDone)
+
+		// pushTasks at the start
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-c.shutdownChan:
+				return
+			case <-timer.C:
+			case <-refresh:
+				if !timer.Stop() {
+					<-timer.C
+				}
+			}
+
+			timer.Reset(c.pushTasks())
+		}
+	})
+
+	// extend leases while they are queued or processed
+	heartbeatDone := make(chan interface{})
 	go safe.Do(func() {
-		defer close(c.rssChan)
+		defer close(heartbeatDone)
+
+		heartbeat := time.NewTicker(c.heartbeatPeriod)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-c.shutdownChan:
+				return
+			case <-heartbeat.C:
+				c.heartbeat()
+			}
+		}
+	})
 
-		first := make(chan interface{}, 1)
-		defer close(first)
-		first <- nil
+	// let waiters of rss cached by others go
+	cachedDone := make(chan interface{})
+	go safe.Do(func() {
+		defer close(cachedDone)
 
 		for {
 			select {
-			// pushTasks at the start
-			case <-first:
-				c.pushTasks()
 			case <-c.shutdownChan:
 				return
-			case <-ticker.C:
-				c.pushTasks()
+			case key := <-cached:
+				c.cached(key)
 			}
 		}
 	})
@@ -74,17 +207,29 @@ func (c *Cacher) Start() {
 			defer wg.Done()
 
 			for {
-				select {
-				case <-c.shutdownChan:
+				rss, task, ok := c.nextTask()
+				if !ok {
 					return
-				case rss := <-c.rssChan:
-					c.processTask(rss)
+				}
+
+				// refreshed rss is expected to have the newest items, so its sources are fetched out of schedule
+				c.processTask(rss, task != nil)
+				if task != nil {
+					c.finishRefresh(task)
 				}
 			}
 		})
 	}
 
 	wg.Wait()
+	<-pushDone
+	<-heartbeatDone
+	<-cachedDone
+
+	c.stopRefreshes()
+
+	// queued rss are not processed anymore, so other replicas may take them without waiting for expiration
+	c.releaseLeases()
 }
 
 func (c *Cacher) Shutdown() {
@@ -92,20 +237,205 @@ func (c *Cacher) Shutdown() {
 	<-c.shutdownWaitChan
 }
 
-func (c *Cacher) pushTasks() {
-	rssSlice, err := c.db.GetItemsToCache(c.batchSize)
+func (c *Cacher) Refresh(email string, name string) (<-chan struct{}, error) {
+	key := email + "/" + name
+
+	// task is registered before rss is leased, so concurrent refreshes wait for it instead of leasing rss again
+	c.leasedMutex.Lock()
+	if task, ok := c.refreshing[key]; ok {
+		c.leasedMutex.Unlock()
+		return task.done, nil
+	}
+	if c.stopped {
+		c.leasedMutex.Unlock()
+		return nil, ErrCacherStopped
+	}
+	task := &refreshTask{key: key, done: make(chan struct{})}
+	c.refreshing[key] = task
+	c.leasedMutex.Unlock()
+
+	rss, err := c.db.LeaseRss(email, name, c.leaseDuration)
+	if err == database.ErrRssLeased && c.listener != nil {
+		// rss is cached by other worker or replica, waiters go on its cached notification,
+		// it is not sent if feed is not changed, so waiting is limited
+		c.leasedMutex.Lock()
+		if c.refreshing[key] == task {
+			task.expire = time.AfterFunc(c.leasedWait, func() {
+				c.finishRefresh(task)
+			})
+		}
+		c.leasedMutex.Unlock()
+		return task.done, nil
+	}
 	if err != nil {
-		log.WithError(err).Error("failed to get items to cache")
+		c.finishRefresh(task)
+		return nil, err
+	}
+
+	// task is queued under lock, so it is either drained on shutdown or not queued at all
+	c.leasedMutex.Lock()
+	queued := false
+	if !c.stopped {
+		task.rss = rss
+		select {
+		case c.refreshChan <- task:
+			c.leased[rss.ID] = struct{}{}
+			queued = true
+		default:
+			task.rss = nil
+		}
+	}
+	stopped := c.stopped
+	if !queued {
+		c.dropRefresh(task)
+	}
+	c.leasedMutex.Unlock()
+
+	if queued {
+		return task.done, nil
+	}
+
+	if err = c.db.ReleaseLeases([]int64{rss.ID}); err != nil {
+		log.WithError(err).WithField("id", rss.ID).Error("failed to release lease of rss")
+	}
+
+	if stopped {
+		return nil, ErrCacherStopped
+	}
+	return nil, ErrRefreshQueueFull
+}
+
+// finishRefresh lets waiters of refresh go, the next refresh of rss leases it again
+func (c *Cacher) finishRefresh(task *refreshTask) {
+	c.leasedMutex.Lock()
+	defer c.leasedMutex.Unlock()
+
+	c.dropRefresh(task)
+}
+
+// dropRefresh forgets task and closes its done channel once, leased mutex should be held
+func (c *Cacher) dropRefresh(task *refreshTask) {
+	if c.refreshing[task.key] != task {
 		return
 	}
 
+	delete(c.refreshing, task.key)
+	if task.rss != nil {
+		delete(c.leased, task.rss.ID)
+	}
+	if task.expire != nil {
+		task.expire.Stop()
+	}
+	close(task.done)
+}
+
+// cached lets waiters of rss cached by others go, empty key means that notifications could be lost
+func (c *Cacher) cached(key string) {
+	c.leasedMutex.Lock()
+	defer c.leasedMutex.Unlock()
+
+	for _, task := range c.refreshing {
+		if task.expire != nil && (len(key) == 0 || task.key == key) {
+			c.dropRefresh(task)
+		}
+	}
+}
+
+// stopRefreshes lets all waiters of refreshes go, leases of queued ones are released together with others
+func (c *Cacher) stopRefreshes() {
+	c.leasedMutex.Lock()
+	defer c.leasedMutex.Unlock()
+
+	c.stopped = true
+drain:
+	for {
+		select {
+		case <-c.refreshChan:
+		default:
+			break drain
+		}
+	}
+
+	for key, task := range c.refreshing {
+		delete(c.refreshing, key)
+		if task.expire != nil {
+			task.expire.Stop()
+		}
+		close(task.done)
+	}
+}
+
+// nextTask prefers refreshed rss to outdated ones, refresh task is set for refreshed rss only,
+// it returns false on shutdown
+func (c *Cacher) nextTask() (*database.Rss, *refreshTask, bool) {
+	var task *refreshTask
+	var rss *database.Rss
+
+	select {
+	case task = <-c.refreshChan:
+	default:
+		select {
+		case <-c.shutdownChan:
+			return nil, nil, false
+		case task = <-c.refreshChan:
+		case rss = <-c.rssChan:
+		}
+	}
+
+	// select picks ready case randomly, so shutdown is checked again before long processing
+	select {
+	case <-c.shutdownChan:
+		return nil, nil, false
+	default:
+	}
+
+	if task != nil {
+		return task.rss, task, true
+	}
+
+	return rss, nil, true
+}
+
+// pushTasks returns delay until the next rss should be cached
+func (c *Cacher) pushTasks() time.Duration {
+	rssSlice, err := c.db.LeaseItemsToCache(c.batchSize, c.leaseDuration)
+	if err != nil {
+		log.WithError(err).Error("failed to lease items to cache")
+		return c.maxSleep
+	}
+
+	c.leasedMutex.Lock()
 	for _, rss := range rssSlice {
-		c.rssChan <- rss
+		c.leased[rss.ID] = struct{}{}
 	}
+	c.leasedMutex.Unlock()
+
+	for _, rss := range rssSlice {
+		select {
+		case c.rssChan <- rss:
+		case <-c.shutdownChan:
+			return 0
+		}
+	}
+
+	// full batch means there are more outdated rss
+	if len(rssSlice) == c.batchSize {
+		return 0
+	}
+
+	delay, err := c.db.GetNextCacheDelay(c.maxSleep)
+	if err != nil {
+		log.WithError(err).Error("failed to get next cache delay")
+		return c.maxSleep
+	}
+
+	return delay
 }
 
-func (c *Cacher) processTask(rss *database.Rss) {
-	rssFeed := c.aggregator.Aggregate(rss)
+func (c *Cacher) processTask(rss *database.Rss, force bool) {
+	defer c.forget(rss.ID)
+
+	rssFeed := c.aggregator.Aggregate(rss, force)
 
 	rssFeedRaw, err := xml.Marshal(rssFeed)
 	if err != nil {
@@ -113,16 +443,119 @@ func (c *Cacher) processTask(rss *database.Rss) {
 		return
 	}
 
+	// feed is compressed once here instead of on every read
+	encoded, err := compress.Encode(rssFeedRaw)
+	if err != nil {
+		log.WithError(err).Error("failed to compress rss feed")
+		return
+	}
+
 	validUntil := GetValidUntil(rssFeed)
 
-	err = c.db.SaveCachedRss(rss.ID, string(rssFeedRaw), validUntil)
+	contentHash, err := feedHash(rssFeed)
+	if err != nil {
+		log.WithError(err).Error("failed to hash rss feed")
+		return
+	}
+
+	// lease is released together with saving
+	changed, err := c.db.SaveCachedRss(rss.ID, encoded, contentHash, validUntil)
 	if err != nil {
 		log.WithError(err).Error("failed to save cached rss feed")
 	}
 
+	if changed && c.hub != nil {
+		c.hub.Publish(rss.ID)
+	}
+
+	// parents read nested rss from storage, so they are rebuilt with its changes
+	if changed {
+		if err := c.db.InvalidateSourceRss(NestedSource(rss.Email, rss.Name)); err != nil {
+			log.WithError(err).WithField("name", rss.Name).WithField("email", rss.Email).Error("failed to invalidate parent rss")
+		}
+	}
+
+	// webhooks compare items with their own last feed, so the first feed after webhook is created is seen even if it is not changed
+	if err == nil && c.webhooks != nil {
+		c.webhooks.Notify(rss, rssFeed)
+	}
+
 	log.WithField("name", rss.Name).WithField("email", rss.Email).Info("rss was processed")
 }
 
+func (c *Cacher) heartbeat() {
+	ids := c.leasedIds()
+	if len(ids) > 0 {
+		err := c.db.ExtendLeases(ids, c.leaseDuration)
+		if err != nil {
+			log.WithError(err).WithField("count", len(ids)).Error("failed to extend leases")
+		}
+	}
+
+	stats, err := c.db.GetCacheQueueStats()
+	if err != nil {
+		log.WithError(err).Error("failed to get cache queue stats")
+		return
+	}
+
+	c.queueDepthGauge.Set(float64(stats.Pending))
+	c.leasesGauge.Set(float64(stats.Leased))
+	c.oldestLeaseGauge.Set(stats.OldestLeaseAge.Seconds())
+}
+
+func (c *Cacher) releaseLeases() {
+	ids := c.leasedIds()
+	if len(ids) == 0 {
+		return
+	}
+
+	err := c.db.ReleaseLeases(ids)
+	if err != nil {
+		log.WithError(err).WithField("count", len(ids)).Error("failed to release leases")
+		return
+	}
+
+	log.WithField("count", len(ids)).Info("leases were released")
+}
+
+func (c *Cacher) leasedIds() []int64 {
+	c.leasedMutex.Lock()
+	defer c.leasedMutex.Unlock()
+
+	ids := make([]int64, 0, len(c.leased))
+	for id := range c.leased {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+func (c *Cacher) forget(id int64) {
+	c.leasedMutex.Lock()
+	defer c.leasedMutex.Unlock()
+
+	delete(c.leased, id)
+}
+
 func GetValidUntil(rssFeed *dto.RssFeed) time.Time {
 	return time.Now().Add(time.Duration(rssFeed.Channel.Ttl) * time.Minute)
 }
+
+// feedHash is hash of feed content, build date and ttl are ignored as they change on every build,
+// so feed with the same items is not written again and its readers are not notified
+func feedHash(feed *dto.RssFeed) (string, error) {
+	channel := *feed.Channel
+	channel.LastBuildDate = ""
+	channel.Ttl = 0
+
+	content := *feed
+	content.Channel = &channel
+
+	raw, err := xml.Marshal(&content)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha1.Sum(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -1,16 +1,21 @@
 package rss
 
 import (
+	"errors"
 	"sort"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	promdto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 
+	"service-rss/internal/compress"
 	"service-rss/internal/config"
 	"service-rss/internal/database"
+	"service-rss/internal/dto"
 )
 
 func TestCacher_Shutdown(t *testing.T) {
@@ -20,17 +25,24 @@ func TestCacher_Shutdown(t *testing.T) {
 	f := NewMockFetcher(ctrl)
 	f.EXPECT().Fetch(gomock.Any()).AnyTimes().Return(nil, nil)
 
-	a := NewTestAggregator(f)
-
 	db := database.NewMockDatabase(ctrl)
-	db.EXPECT().GetItemsToCache(gomock.Any()).AnyTimes().Return(nil, nil)
+	expectItemStore(db)
+	expectSourceStates(db)
+
+	a := NewTestAggregator(f, db)
+	db.EXPECT().LeaseItemsToCache(gomock.Any(), gomock.Any()).AnyTimes().Return(nil, nil)
 
 	cfg := &config.Config{
-		CacherPullPeriod:   30 * time.Second,
-		CacherWorkersCount: 4,
+		CacherMaxSleep:        30 * time.Second,
+		CacherWorkersCount:    4,
+		CacherLeaseDuration:   time.Minute,
+		CacherHeartbeatPeriod: 30 * time.Second,
 	}
 
-	h := NewCacher(cfg, db, a)
+	db.EXPECT().GetNextCacheDelay(30*time.Second).AnyTimes().Return(30*time.Second, nil)
+
+	h, err := NewCacher(cfg, db, a, nil, nil, nil)
+	assert.NoError(t, err)
 
 	timeout := time.After(1 * time.Second)
 	done := make(chan bool)
@@ -53,7 +65,7 @@ func TestCacher_PushTasks(t *testing.T) {
 	defer ctrl.Finish()
 
 	db := database.NewMockDatabase(ctrl)
-	db.EXPECT().GetItemsToCache(gomock.Any()).AnyTimes().Return([]*database.Rss{
+	db.EXPECT().LeaseItemsToCache(gomock.Any(), gomock.Any()).AnyTimes().Return([]*database.Rss{
 		{
 			ID:   1,
 			Name: "first",
@@ -64,15 +76,15 @@ func TestCacher_PushTasks(t *testing.T) {
 		},
 	}, nil)
 
-	h := &Cacher{
-		db:      db,
-		rssChan: make(chan *database.Rss, 2),
-	}
+	db.EXPECT().GetNextCacheDelay(time.Hour).Return(time.Minute, nil)
+
+	h := NewTestCacher(db, nil)
+	h.rssChan = make(chan *database.Rss, 2)
 
 	timeout := time.After(1 * time.Second)
 	resultChan := make(chan []*database.Rss)
 	go func() {
-		h.pushTasks()
+		assert.Equal(t, time.Minute, h.pushTasks())
 
 		result := make([]*database.Rss, 0, 2)
 		for i := 0; i < 2; i++ {
@@ -111,24 +123,488 @@ func TestCacher_ProcessTask(t *testing.T) {
 
 	f := NewMockFetcher(ctrl)
 
-	a := NewTestAggregator(f)
-
 	db := database.NewMockDatabase(ctrl)
-	db.EXPECT().SaveCachedRss(gomock.Any(), gomock.Any(), gomock.Any()).Do(func(id int64, rssFeed string, validUntil time.Time) {
+	expectItemStore(db)
+	expectSourceStates(db)
+
+	a := NewTestAggregator(f, db)
+	db.EXPECT().SaveCachedRss(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(id int64, encoded *compress.Encoded, contentHash string, validUntil time.Time) (bool, error) {
 		assert.Equal(t, int64(1), id)
-		assert.True(t, strings.HasPrefix(rssFeed, "<rss><channel><title>RSS Aggregator</title><link></link><description>Aggregated feed from different rss sources.</description><lastBuildDate>"))
+		raw, err := compress.Decode(encoded)
+		assert.NoError(t, err)
+		rssFeed := string(raw)
+		assert.True(t, strings.HasPrefix(rssFeed, "<rss version=\"2.0\" xmlns:atom=\"http://www.w3.org/2005/Atom\"><channel><title>name</title><atom:link href=\"http://localhost/example@gmail.com/name\" rel=\"self\" type=\"application/rss+xml\"></atom:link><link>http://localhost</link><description>Aggregated feed from different rss sources.</description><lastBuildDate>"))
 		assert.True(t, strings.HasSuffix(rssFeed, "</lastBuildDate><ttl>5</ttl></channel></rss>"))
 		assert.True(t, time.Now().Before(validUntil))
+		assert.Len(t, contentHash, 40)
+		return true, nil
 	})
 
-	h := &Cacher{
-		db:         db,
-		aggregator: a,
-	}
+	// changed feed outdates rss which include it
+	db.EXPECT().InvalidateSourceRss("aggregate:example@gmail.com/name").Return(nil)
+
+	hub := NewMockHub(ctrl)
+	hub.EXPECT().Publish(int64(1))
+
+	webhooks := NewMockWebhookNotifier(ctrl)
+	webhooks.EXPECT().Notify(gomock.Any(), gomock.Any()).Do(func(rss *database.Rss, feed *dto.RssFeed) {
+		assert.Equal(t, int64(1), rss.ID)
+		assert.Equal(t, "name", feed.Channel.Title)
+	})
+
+	h := NewTestCacher(db, a)
+	h.hub = hub
+	h.webhooks = webhooks
+	h.leased[1] = struct{}{}
 
 	rss := &database.Rss{
-		ID:   1,
-		Name: "name",
+		ID:    1,
+		Email: "example@gmail.com",
+		Name:  "name",
 	}
-	h.processTask(rss)
+	h.processTask(rss, false)
+
+	assert.Empty(t, h.leasedIds())
+}
+
+func TestCacher_UnchangedFeedIsNotPublished(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	a := NewMockAggregator(ctrl)
+	a.EXPECT().Aggregate(gomock.Any(), false).Return(&dto.RssFeed{Channel: &dto.RssFeedChannel{Title: "one"}})
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().SaveCachedRss(int64(1), gomock.Any(), gomock.Any(), gomock.Any()).Return(false, nil)
+
+	h := NewTestCacher(db, a)
+	h.hub = NewMockHub(ctrl)
+	h.processTask(&database.Rss{ID: 1}, false)
+}
+
+func TestCacher_RebuiltChildDoesNotInvalidateParents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// child is rebuilt with the same items, but its ttl follows schedule of sources
+	a := NewMockAggregator(ctrl)
+	for _, ttl := range []int64{30, 47} {
+		a.EXPECT().Aggregate(gomock.Any(), false).Return(&dto.RssFeed{Channel: &dto.RssFeedChannel{
+			Title:         "go",
+			LastBuildDate: time.Now().Format(time.RFC1123),
+			Ttl:           ttl,
+			Items:         []*dto.RssFeedItem{{Title: "one", Guid: "1"}},
+		}})
+	}
+
+	// storage reports feed as changed when its hash differs from the stored one
+	stored := ""
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().SaveCachedRss(int64(1), gomock.Any(), gomock.Any(), gomock.Any()).Times(2).DoAndReturn(func(id int64, encoded *compress.Encoded, contentHash string, validUntil time.Time) (bool, error) {
+		changed := contentHash != stored
+		stored = contentHash
+		return changed, nil
+	})
+	db.EXPECT().InvalidateSourceRss("aggregate:example@gmail.com/go").Times(1).Return(nil)
+
+	h := NewTestCacher(db, a)
+	rss := &database.Rss{ID: 1, Email: "example@gmail.com", Name: "go"}
+	h.processTask(rss, false)
+	h.processTask(rss, false)
+}
+
+func TestFeedHash(t *testing.T) {
+	one, err := feedHash(&dto.RssFeed{Channel: &dto.RssFeedChannel{Title: "one", LastBuildDate: "Mon, 02 Jan 2006 15:04:05 MST"}})
+	assert.NoError(t, err)
+
+	rebuilt := &dto.RssFeed{Channel: &dto.RssFeedChannel{Title: "one", LastBuildDate: "Tue, 03 Jan 2006 15:04:05 MST"}}
+	same, err := feedHash(rebuilt)
+	assert.NoError(t, err)
+	assert.Equal(t, one, same)
+	// build date of hashed feed is kept
+	assert.Equal(t, "Tue, 03 Jan 2006 15:04:05 MST", rebuilt.Channel.LastBuildDate)
+
+	other, err := feedHash(&dto.RssFeed{Channel: &dto.RssFeedChannel{Title: "two"}})
+	assert.NoError(t, err)
+	assert.NotEqual(t, one, other)
+}
+
+func TestFeedHash_Rebuilt(t *testing.T) {
+	a := NewTestAggregator(nil, nil).(*aggregator)
+	rss := &database.Rss{Email: "example@gmail.com", Name: "backend"}
+	items := []*dto.RssFeedItem{{Title: "one", Guid: "1", PubDate: "Mon, 02 Jan 2006 15:04:05 MST"}}
+
+	// ttl follows schedule of sources and build date follows clock, both of them differ between builds
+	first := a.feed(rss, 30, items)
+	rebuilt := a.feed(rss, 47, items)
+	rebuilt.Channel.LastBuildDate = "Tue, 03 Jan 2006 15:04:05 MST"
+
+	one, err := feedHash(first)
+	assert.NoError(t, err)
+	same, err := feedHash(rebuilt)
+	assert.NoError(t, err)
+	assert.Equal(t, one, same)
+	assert.Equal(t, int64(47), rebuilt.Channel.Ttl)
+
+	changed, err := feedHash(a.feed(rss, 30, append(items, &dto.RssFeedItem{Title: "two", Guid: "2"})))
+	assert.NoError(t, err)
+	assert.NotEqual(t, one, changed)
+}
+
+func NewTestCacher(db database.Database, aggregator Aggregator) *Cacher {
+	return &Cacher{
+		db:               db,
+		aggregator:       aggregator,
+		rssChan:          make(chan *database.Rss, 1),
+		refreshChan:      make(chan *refreshTask, 1),
+		workersCount:     1,
+		maxSleep:         time.Hour,
+		batchSize:        10,
+		leaseDuration:    time.Minute,
+		leasedWait:       time.Second,
+		heartbeatPeriod:  time.Hour,
+		queueDepthGauge:  prometheus.NewGauge(prometheus.GaugeOpts{Name: "cache_queue_depth"}),
+		leasesGauge:      prometheus.NewGauge(prometheus.GaugeOpts{Name: "cache_leases"}),
+		oldestLeaseGauge: prometheus.NewGauge(prometheus.GaugeOpts{Name: "cache_oldest_lease_age_seconds"}),
+
+		leased:     make(map[int64]struct{}),
+		refreshing: make(map[string]*refreshTask),
+
+		shutdownChan:     make(chan interface{}),
+		shutdownWaitChan: make(chan interface{}),
+	}
+}
+
+func TestCacher_Heartbeat(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().ExtendLeases([]int64{7}, time.Minute).Return(nil)
+	db.EXPECT().GetCacheQueueStats().Return(&database.CacheQueueStats{
+		Pending:        3,
+		Leased:         2,
+		OldestLeaseAge: 90 * time.Second,
+	}, nil)
+
+	h := NewTestCacher(db, nil)
+	h.leased[7] = struct{}{}
+
+	h.heartbeat()
+
+	assert.Equal(t, float64(3), gaugeValue(t, h.queueDepthGauge))
+	assert.Equal(t, float64(2), gaugeValue(t, h.leasesGauge))
+	assert.Equal(t, float64(90), gaugeValue(t, h.oldestLeaseGauge))
+}
+
+func TestCacher_ReleaseLeasesOnShutdown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	processing := make(chan interface{})
+	finish := make(chan interface{})
+
+	a := NewMockAggregator(ctrl)
+	a.EXPECT().Aggregate(gomock.Any(), false).DoAndReturn(func(rss *database.Rss, force bool) *dto.RssFeed {
+		close(processing)
+		<-finish
+		return &dto.RssFeed{Channel: &dto.RssFeedChannel{}}
+	})
+
+	db := database.NewMockDatabase(ctrl)
+	gomock.InOrder(
+		db.EXPECT().LeaseItemsToCache(10, time.Minute).Return([]*database.Rss{{ID: 1}, {ID: 2}, {ID: 3}}, nil),
+		db.EXPECT().LeaseItemsToCache(10, time.Minute).AnyTimes().Return(nil, nil),
+	)
+	db.EXPECT().GetNextCacheDelay(gomock.Any()).AnyTimes().Return(time.Hour, nil)
+	db.EXPECT().SaveCachedRss(int64(1), gomock.Any(), gomock.Any(), gomock.Any()).Return(true, nil)
+	db.EXPECT().InvalidateSourceRss(gomock.Any()).Return(nil)
+	// the second rss waits in channel and the third one is not pushed before shutdown
+	db.EXPECT().ReleaseLeases(gomock.Any()).Do(func(ids []int64) {
+		sort.Slice(ids, func(i, j int) bool {
+			return ids[i] < ids[j]
+		})
+		assert.Equal(t, []int64{2, 3}, ids)
+	}).Return(nil)
+
+	h := NewTestCacher(db, a)
+
+	go h.Start()
+	<-processing
+
+	shutdown := make(chan interface{})
+	go func() {
+		h.Shutdown()
+		close(shutdown)
+	}()
+
+	// let shutdown begin before current task is finished
+	time.Sleep(10 * time.Millisecond)
+	close(finish)
+
+	select {
+	case <-time.After(time.Second):
+		t.Fatal("test didn't finish in time")
+	case <-shutdown:
+	}
+}
+
+func gaugeValue(t *testing.T, gauge prometheus.Gauge) float64 {
+	metric := &promdto.Metric{}
+	assert.NoError(t, gauge.Write(metric))
+	return metric.GetGauge().GetValue()
+}
+
+func TestCacher_Wakeup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	t.Run("full batch is followed by next one", func(t *testing.T) {
+		db := database.NewMockDatabase(ctrl)
+		db.EXPECT().LeaseItemsToCache(1, time.Minute).Return([]*database.Rss{{ID: 1}}, nil)
+
+		h := NewTestCacher(db, nil)
+		h.batchSize = 1
+
+		assert.Equal(t, time.Duration(0), h.pushTasks())
+	})
+
+	t.Run("lease error", func(t *testing.T) {
+		db := database.NewMockDatabase(ctrl)
+		db.EXPECT().LeaseItemsToCache(10, time.Minute).Return(nil, errors.New("error"))
+
+		h := NewTestCacher(db, nil)
+
+		assert.Equal(t, time.Hour, h.pushTasks())
+	})
+
+	t.Run("notification", func(t *testing.T) {
+		refresh := make(chan struct{}, 1)
+		listener := database.NewMockRefreshListener(ctrl)
+		listener.EXPECT().Refresh().Return(refresh)
+		listener.EXPECT().Cached().Return(make(chan string))
+
+		leased := make(chan interface{}, 2)
+		db := database.NewMockDatabase(ctrl)
+		db.EXPECT().LeaseItemsToCache(10, time.Minute).Times(2).DoAndReturn(func(batchSize int, lease time.Duration) ([]*database.Rss, error) {
+			leased <- nil
+			return nil, nil
+		})
+		db.EXPECT().GetNextCacheDelay(time.Hour).AnyTimes().Return(time.Hour, nil)
+
+		h := NewTestCacher(db, nil)
+		h.listener = listener
+
+		go h.Start()
+		defer h.Shutdown()
+
+		timeout := time.After(time.Second)
+		select {
+		case <-timeout:
+			t.Fatal("cacher didn't lease at start")
+		case <-leased:
+		}
+
+		refresh <- struct{}{}
+
+		select {
+		case <-timeout:
+			t.Fatal("cacher didn't wake up on notification")
+		case <-leased:
+		}
+	})
+}
+
+func TestCacher_Refresh(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	t.Run("refresh goes before outdated rss", func(t *testing.T) {
+		db := database.NewMockDatabase(ctrl)
+		db.EXPECT().LeaseRss("example@gmail.com", "test", time.Minute).Return(&database.Rss{ID: 2}, nil)
+
+		h := NewTestCacher(db, nil)
+		h.rssChan <- &database.Rss{ID: 1}
+
+		done, err := h.Refresh("example@gmail.com", "test")
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{2}, h.leasedIds())
+
+		rss, task, ok := h.nextTask()
+		assert.True(t, ok)
+		assert.Equal(t, int64(2), rss.ID)
+		assert.Equal(t, done, (<-chan struct{})(task.done))
+
+		rss, task, ok = h.nextTask()
+		assert.True(t, ok)
+		assert.Equal(t, int64(1), rss.ID)
+		assert.Nil(t, task)
+	})
+
+	t.Run("concurrent refreshes share queued one", func(t *testing.T) {
+		db := database.NewMockDatabase(ctrl)
+		db.EXPECT().LeaseRss("example@gmail.com", "test", time.Minute).Times(2).Return(&database.Rss{ID: 2}, nil)
+
+		h := NewTestCacher(db, nil)
+
+		first, err := h.Refresh("example@gmail.com", "test")
+		assert.NoError(t, err)
+		second, err := h.Refresh("example@gmail.com", "test")
+		assert.NoError(t, err)
+		assert.Equal(t, first, second)
+
+		_, task, _ := h.nextTask()
+		h.finishRefresh(task)
+		<-second
+
+		third, err := h.Refresh("example@gmail.com", "test")
+		assert.NoError(t, err)
+		assert.NotEqual(t, first, third)
+	})
+
+	t.Run("done is closed after rss is cached", func(t *testing.T) {
+		a := NewMockAggregator(ctrl)
+		a.EXPECT().Aggregate(&database.Rss{ID: 2}, true).Return(&dto.RssFeed{Channel: &dto.RssFeedChannel{}})
+
+		db := database.NewMockDatabase(ctrl)
+		db.EXPECT().LeaseItemsToCache(10, time.Minute).AnyTimes().Return(nil, nil)
+		db.EXPECT().GetNextCacheDelay(gomock.Any()).AnyTimes().Return(time.Hour, nil)
+		db.EXPECT().LeaseRss("example@gmail.com", "test", time.Minute).Return(&database.Rss{ID: 2}, nil)
+		db.EXPECT().SaveCachedRss(int64(2), gomock.Any(), gomock.Any(), gomock.Any()).Return(true, nil)
+		db.EXPECT().InvalidateSourceRss(gomock.Any()).Return(nil)
+
+		h := NewTestCacher(db, a)
+		go h.Start()
+		defer h.Shutdown()
+
+		done, err := h.Refresh("example@gmail.com", "test")
+		assert.NoError(t, err)
+
+		select {
+		case <-time.After(time.Second):
+			t.Fatal("rss was not refreshed in time")
+		case <-done:
+		}
+		assert.Empty(t, h.leasedIds())
+	})
+
+	t.Run("queue is full", func(t *testing.T) {
+		db := database.NewMockDatabase(ctrl)
+		db.EXPECT().LeaseRss("example@gmail.com", "test", time.Minute).Return(&database.Rss{ID: 3}, nil)
+		db.EXPECT().ReleaseLeases([]int64{3}).Return(nil)
+
+		h := NewTestCacher(db, nil)
+		h.refreshChan <- &refreshTask{key: "example@gmail.com/other", rss: &database.Rss{ID: 1}}
+
+		_, err := h.Refresh("example@gmail.com", "test")
+		assert.Equal(t, ErrRefreshQueueFull, err)
+		assert.Empty(t, h.leasedIds())
+	})
+
+	t.Run("queued refreshes are let go on shutdown", func(t *testing.T) {
+		db := database.NewMockDatabase(ctrl)
+		db.EXPECT().LeaseItemsToCache(10, time.Minute).AnyTimes().Return(nil, nil)
+		db.EXPECT().GetNextCacheDelay(gomock.Any()).AnyTimes().Return(time.Hour, nil)
+		db.EXPECT().LeaseRss("example@gmail.com", "test", time.Minute).Return(&database.Rss{ID: 2}, nil)
+		db.EXPECT().ReleaseLeases([]int64{2}).Return(nil)
+
+		// no workers, so refresh stays in queue
+		h := NewTestCacher(db, nil)
+		h.workersCount = 0
+
+		done, err := h.Refresh("example@gmail.com", "test")
+		assert.NoError(t, err)
+
+		go h.Start()
+		h.Shutdown()
+
+		select {
+		case <-time.After(time.Second):
+			t.Fatal("refresh waiter was not let go on shutdown")
+		case <-done:
+		}
+
+		_, err = h.Refresh("example@gmail.com", "test")
+		assert.Equal(t, ErrCacherStopped, err)
+	})
+
+	t.Run("rss is leased", func(t *testing.T) {
+		db := database.NewMockDatabase(ctrl)
+		db.EXPECT().LeaseRss("example@gmail.com", "test", time.Minute).Return(nil, database.ErrRssLeased)
+
+		h := NewTestCacher(db, nil)
+
+		_, err := h.Refresh("example@gmail.com", "test")
+		assert.Equal(t, database.ErrRssLeased, err)
+		assert.Empty(t, h.refreshing)
+	})
+
+	t.Run("concurrent refreshes wait for leasing one", func(t *testing.T) {
+		leasing := make(chan interface{})
+		leased := make(chan interface{})
+
+		db := database.NewMockDatabase(ctrl)
+		db.EXPECT().LeaseRss("example@gmail.com", "test", time.Minute).DoAndReturn(func(email string, name string, lease time.Duration) (*database.Rss, error) {
+			close(leasing)
+			<-leased
+			return &database.Rss{ID: 2}, nil
+		})
+
+		h := NewTestCacher(db, nil)
+
+		first := make(chan (<-chan struct{}))
+		go func() {
+			done, err := h.Refresh("example@gmail.com", "test")
+			assert.NoError(t, err)
+			first <- done
+		}()
+
+		<-leasing
+		second, err := h.Refresh("example@gmail.com", "test")
+		assert.NoError(t, err)
+		close(leased)
+
+		assert.Equal(t, <-first, second)
+	})
+
+	t.Run("rss leased by others is waited for until it is cached", func(t *testing.T) {
+		cached := make(chan string, 1)
+		listener := database.NewMockRefreshListener(ctrl)
+		listener.EXPECT().Refresh().Return(make(chan struct{}))
+		listener.EXPECT().Cached().Return(cached)
+
+		db := database.NewMockDatabase(ctrl)
+		db.EXPECT().LeaseItemsToCache(10, time.Minute).AnyTimes().Return(nil, nil)
+		db.EXPECT().GetNextCacheDelay(gomock.Any()).AnyTimes().Return(time.Hour, nil)
+		db.EXPECT().LeaseRss("example@gmail.com", "test", time.Minute).Return(nil, database.ErrRssLeased)
+		db.EXPECT().LeaseRss("example@gmail.com", "other", time.Minute).Return(nil, database.ErrRssLeased)
+
+		h := NewTestCacher(db, nil)
+		h.listener = listener
+		h.leasedWait = 50 * time.Millisecond
+		go h.Start()
+		defer h.Shutdown()
+
+		first, err := h.Refresh("example@gmail.com", "test")
+		assert.NoError(t, err)
+		second, err := h.Refresh("example@gmail.com", "test")
+		assert.NoError(t, err)
+		assert.Equal(t, first, second)
+
+		cached <- "example@gmail.com/test"
+		select {
+		case <-time.After(time.Second):
+			t.Fatal("waiters were not let go on cached notification")
+		case <-first:
+		}
+
+		// feed of other rss is not changed, so there is no notification
+		other, err := h.Refresh("example@gmail.com", "other")
+		assert.NoError(t, err)
+		select {
+		case <-time.After(time.Second):
+			t.Fatal("waiters were not let go after timeout")
+		case <-other:
+		}
+	})
 }
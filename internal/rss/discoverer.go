@@ -0,0 +1,328 @@
+//go:generate mockgen -package ${GOPACKAGE} -destination mock_discoverer.go -source discoverer.go
+package rss
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/html"
+
+	"service-rss/internal/config"
+	"service-rss/internal/netguard"
+	"service-rss/internal/safe"
+)
+
+const (
+	FeedTypeRss  = "rss"
+	FeedTypeAtom = "atom"
+	FeedTypeJson = "json"
+
+	maxDiscoveryBodySize = 2 << 20
+)
+
+var (
+	alternateTypes = map[string]string{
+		"application/rss+xml":   FeedTypeRss,
+		"application/atom+xml":  FeedTypeAtom,
+		"application/feed+json": FeedTypeJson,
+	}
+
+	// most popular feed locations of blog engines and static site generators
+	commonFeedPaths = []string{
+		"/feed",
+		"/rss",
+		"/rss.xml",
+		"/feed.xml",
+		"/atom.xml",
+		"/index.xml",
+		"/feed.json",
+	}
+)
+
+type HttpError struct {
+	StatusCode int
+	RetryAfter time.Duration // zero if server didn't ask to retry later
+}
+
+func (e *HttpError) Error() string {
+	return fmt.Sprintf("unexpected http status %d", e.StatusCode)
+}
+
+type DiscoveredFeed struct {
+	Url   string
+	Title string
+	Type  string
+}
+
+type Discoverer interface {
+	// Discover returns url itself if it is a feed, otherwise feeds found on the page or common paths of the site
+	Discover(url string) ([]*DiscoveredFeed, error)
+}
+
+type discoverer struct {
+	client    *http.Client
+	histogram *prometheus.HistogramVec
+}
+
+func NewDiscoverer(cfg *config.Config) (Discoverer, error) {
+	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "discovery_duration_seconds",
+		Help:    "Histogram of feed discovery time in seconds",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"status"})
+
+	err := prometheus.Register(histogram)
+	if err != nil {
+		return nil, err
+	}
+
+	return &discoverer{
+		client:    netguard.New(cfg).Client(cfg.DiscoveryTimeout),
+		histogram: histogram,
+	}, nil
+}
+
+func (d *discoverer) Discover(url string) ([]*DiscoveredFeed, error) {
+	start := time.Now()
+
+	// page and probes of common paths share one deadline, so discovery takes about one timeout at most
+	ctx, cancel := context.WithTimeout(context.Background(), d.client.Timeout)
+	defer cancel()
+
+	feeds, err := d.discover(ctx, url)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	d.histogram.WithLabelValues(status).Observe(time.Since(start).Seconds())
+
+	return feeds, err
+}
+
+func (d *discoverer) discover(ctx context.Context, rawUrl string) ([]*DiscoveredFeed, error) {
+	pageUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	body, contentType, err := d.get(ctx, rawUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if feed := sniffFeed(body, contentType); feed != nil {
+		feed.Url = rawUrl
+		return []*DiscoveredFeed{feed}, nil
+	}
+
+	feeds := findAlternateLinks(pageUrl, body)
+	if len(feeds) > 0 {
+		return feeds, nil
+	}
+
+	return d.probeCommonPaths(ctx, pageUrl), nil
+}
+
+// probeCommonPaths requests paths concurrently within deadline of discovery
+func (d *discoverer) probeCommonPaths(ctx context.Context, pageUrl *url.URL) []*DiscoveredFeed {
+	probed := make([]*DiscoveredFeed, len(commonFeedPaths))
+
+	wg := sync.WaitGroup{}
+	for i, path := range commonFeedPaths {
+		wg.Add(1)
+		i, probeUrl := i, pageUrl.ResolveReference(&url.URL{Path: path}).String()
+		go safe.Do(func() {
+			defer wg.Done()
+
+			body, contentType, err := d.get(ctx, probeUrl)
+			if err != nil {
+				return
+			}
+
+			if feed := sniffFeed(body, contentType); feed != nil {
+				feed.Url = probeUrl
+				probed[i] = feed
+			}
+		})
+	}
+	wg.Wait()
+
+	feeds := make([]*DiscoveredFeed, 0)
+	for _, feed := range probed {
+		if feed != nil {
+			feeds = append(feeds, feed)
+		}
+	}
+
+	return feeds
+}
+
+func (d *discoverer) get(ctx context.Context, rawUrl string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawUrl, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", &HttpError{StatusCode: resp.StatusCode}
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxDiscoveryBodySize))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return body, resp.Header.Get("Content-Type"), nil
+}
+
+// sniffFeed returns feed without url if body is a feed of any supported type
+func sniffFeed(body []byte, contentType string) *DiscoveredFeed {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return nil
+	}
+
+	if trimmed[0] == '{' {
+		jsonFeed := &struct {
+			Version string `json:"version"`
+			Title   string `json:"title"`
+		}{}
+		if json.Unmarshal(trimmed, jsonFeed) != nil || !strings.Contains(jsonFeed.Version, "jsonfeed.org") {
+			return nil
+		}
+
+		return &DiscoveredFeed{Title: jsonFeed.Title, Type: FeedTypeJson}
+	}
+
+	if strings.Contains(contentType, "html") {
+		return nil
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(trimmed))
+	decoder.Strict = false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "rss":
+			feed := &rssFeedTitle{}
+			if decoder.DecodeElement(feed, &start) != nil {
+				return nil
+			}
+			return &DiscoveredFeed{Title: feed.Channel.Title, Type: FeedTypeRss}
+		case "feed":
+			feed := &atomFeedTitle{}
+			if decoder.DecodeElement(feed, &start) != nil {
+				return nil
+			}
+			return &DiscoveredFeed{Title: feed.Title, Type: FeedTypeAtom}
+		default:
+			return nil
+		}
+	}
+}
+
+type rssFeedTitle struct {
+	Channel struct {
+		Title string `xml:"title"`
+	} `xml:"channel"`
+}
+
+type atomFeedTitle struct {
+	Title string `xml:"title"`
+}
+
+// findAlternateLinks looks for <link rel="alternate"> with feed types in html page
+func findAlternateLinks(pageUrl *url.URL, body []byte) []*DiscoveredFeed {
+	document, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil
+	}
+
+	baseUrl := pageUrl
+	feeds := make([]*DiscoveredFeed, 0)
+	seen := make(map[string]bool)
+
+	var visit func(node *html.Node)
+	visit = func(node *html.Node) {
+		if node.Type == html.ElementNode && node.Data == "base" {
+			if href, err := url.Parse(attr(node, "href")); err == nil && len(href.String()) > 0 {
+				baseUrl = pageUrl.ResolveReference(href)
+			}
+		}
+
+		if node.Type == html.ElementNode && node.Data == "link" && hasToken(attr(node, "rel"), "alternate") {
+			feedType, ok := alternateTypes[strings.ToLower(strings.TrimSpace(attr(node, "type")))]
+			href, err := url.Parse(strings.TrimSpace(attr(node, "href")))
+			if ok && err == nil && len(href.String()) > 0 {
+				feedUrl := baseUrl.ResolveReference(href).String()
+				if !seen[feedUrl] {
+					seen[feedUrl] = true
+					feeds = append(feeds, &DiscoveredFeed{
+						Url:   feedUrl,
+						Title: attr(node, "title"),
+						Type:  feedType,
+					})
+				}
+			}
+		}
+
+		// links are expected in head, body is skipped to avoid walking through large pages
+		if node.Type == html.ElementNode && node.Data == "body" {
+			return
+		}
+
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			visit(child)
+		}
+	}
+	visit(document)
+
+	return feeds
+}
+
+func attr(node *html.Node, key string) string {
+	for _, a := range node.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val
+		}
+	}
+
+	return ""
+}
+
+func hasToken(value string, token string) bool {
+	for _, field := range strings.Fields(value) {
+		if strings.EqualFold(field, token) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,148 @@
+package rss
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testRssFeed  = `<?xml version="1.0" encoding="UTF-8"?><rss version="2.0"><channel><title>Rss Blog</title></channel></rss>`
+	testAtomFeed = `<?xml version="1.0" encoding="utf-8"?><feed xmlns="http://www.w3.org/2005/Atom"><title>Atom Blog</title></feed>`
+	testJsonFeed = `{"version":"https://jsonfeed.org/version/1.1","title":"Json Blog","items":[]}`
+	testPage     = `<!DOCTYPE html>
+<html>
+<head>
+	<title>Blog</title>
+	<link rel="stylesheet" href="/style.css">
+	<link rel="alternate" type="application/rss+xml" title="Rss" href="/feed.xml">
+	<link rel="alternate" type="application/atom+xml" title="Atom" href="https://other.example.com/atom.xml">
+	<link rel="alternate" type="application/rss+xml" title="Duplicate" href="/feed.xml">
+</head>
+<body>
+	<link rel="alternate" type="application/feed+json" href="/body.json">
+</body>
+</html>`
+	testPageWithoutLinks = `<!DOCTYPE html><html><head><title>Blog</title></head><body></body></html>`
+)
+
+func NewTestDiscoverer(timeout time.Duration) Discoverer {
+	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "discovery_duration_seconds",
+		Help:    "Histogram of feed discovery time in seconds",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"status"})
+
+	return &discoverer{
+		client:    &http.Client{Timeout: timeout},
+		histogram: histogram,
+	}
+}
+
+func serve(contentType string, body string) http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		writer.Header().Set("Content-Type", contentType)
+		_, _ = writer.Write([]byte(body))
+	}
+}
+
+func TestDiscoverer_Discover(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", serve("text/html; charset=utf-8", testPage))
+	mux.HandleFunc("/rss", serve("application/rss+xml", testRssFeed))
+	mux.HandleFunc("/atom", serve("text/xml", testAtomFeed))
+	mux.HandleFunc("/json", serve("application/json", testJsonFeed))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	d := NewTestDiscoverer(time.Second)
+
+	t.Run("rss feed", func(t *testing.T) {
+		feeds, err := d.Discover(server.URL + "/rss")
+		assert.NoError(t, err)
+		assert.Equal(t, []*DiscoveredFeed{{Url: server.URL + "/rss", Title: "Rss Blog", Type: FeedTypeRss}}, feeds)
+	})
+
+	t.Run("atom feed", func(t *testing.T) {
+		feeds, err := d.Discover(server.URL + "/atom")
+		assert.NoError(t, err)
+		assert.Equal(t, []*DiscoveredFeed{{Url: server.URL + "/atom", Title: "Atom Blog", Type: FeedTypeAtom}}, feeds)
+	})
+
+	t.Run("json feed", func(t *testing.T) {
+		feeds, err := d.Discover(server.URL + "/json")
+		assert.NoError(t, err)
+		assert.Equal(t, []*DiscoveredFeed{{Url: server.URL + "/json", Title: "Json Blog", Type: FeedTypeJson}}, feeds)
+	})
+
+	t.Run("alternate links", func(t *testing.T) {
+		feeds, err := d.Discover(server.URL + "/page")
+		assert.NoError(t, err)
+		assert.Equal(t, []*DiscoveredFeed{
+			{Url: server.URL + "/feed.xml", Title: "Rss", Type: FeedTypeRss},
+			{Url: "https://other.example.com/atom.xml", Title: "Atom", Type: FeedTypeAtom},
+		}, feeds)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := d.Discover(server.URL + "/missing")
+		assert.Equal(t, &HttpError{StatusCode: http.StatusNotFound}, err)
+	})
+}
+
+func TestDiscoverer_DiscoverCommonPaths(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(writer http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/" {
+			http.NotFound(writer, req)
+			return
+		}
+		serve("text/html", testPageWithoutLinks)(writer, req)
+	})
+	mux.HandleFunc("/index.xml", serve("application/xml", testRssFeed))
+	mux.HandleFunc("/feed.json", serve("application/feed+json", testJsonFeed))
+	// html pages on feed paths are not feeds
+	mux.HandleFunc("/feed", serve("text/html", testPageWithoutLinks))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	d := NewTestDiscoverer(time.Second)
+
+	feeds, err := d.Discover(server.URL + "/blog")
+	assert.Error(t, err)
+	assert.Nil(t, feeds)
+
+	feeds, err = d.Discover(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, []*DiscoveredFeed{
+		{Url: server.URL + "/index.xml", Title: "Rss Blog", Type: FeedTypeRss},
+		{Url: server.URL + "/feed.json", Title: "Json Blog", Type: FeedTypeJson},
+	}, feeds)
+}
+
+func TestDiscoverer_DiscoverDeadline(t *testing.T) {
+	// page and probes take most of timeout each, probes are cut by deadline of the whole discovery
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(writer http.ResponseWriter, req *http.Request) {
+		time.Sleep(400 * time.Millisecond)
+		if req.URL.Path != "/" {
+			serve("application/xml", testRssFeed)(writer, req)
+			return
+		}
+		serve("text/html", testPageWithoutLinks)(writer, req)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	d := NewTestDiscoverer(500 * time.Millisecond)
+
+	start := time.Now()
+	feeds, err := d.Discover(server.URL)
+	assert.NoError(t, err)
+	assert.Empty(t, feeds)
+	assert.Less(t, int64(time.Since(start)), int64(700*time.Millisecond))
+}
@@ -4,12 +4,16 @@ package rss
 import (
 	"encoding/xml"
 	"errors"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 
+	"service-rss/internal/config"
 	"service-rss/internal/dto"
+	"service-rss/internal/netguard"
 )
 
 type Fetcher interface {
@@ -17,10 +21,11 @@ type Fetcher interface {
 }
 
 type fetcher struct {
+	client    *http.Client
 	histogram *prometheus.HistogramVec
 }
 
-func NewFetcher() (Fetcher, error) {
+func NewFetcher(cfg *config.Config) (Fetcher, error) {
 	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "fetch_duration_seconds",
 		Help:    "Histogram of fetch time in seconds",
@@ -33,6 +38,7 @@ func NewFetcher() (Fetcher, error) {
 	}
 
 	return &fetcher{
+		client:    netguard.New(cfg).Client(cfg.FetchTimeout),
 		histogram: histogram,
 	}, nil
 }
@@ -52,14 +58,19 @@ func (f *fetcher) Fetch(url string) (*dto.RssFeed, error) {
 }
 
 func (f *fetcher) fetch(url string) (*dto.RssFeed, error) {
-	resp, err := http.Get(url)
+	// scraped source is not url, page url is kept in it together with selectors
+	if IsScrapedSource(url) {
+		return f.scrape(url)
+	}
+
+	body, err := f.get(url)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	defer body.Close()
 
 	feed := &dto.RssFeed{}
-	err = xml.NewDecoder(resp.Body).Decode(feed)
+	err = xml.NewDecoder(body).Decode(feed)
 	if err != nil {
 		return nil, err
 	}
@@ -70,3 +81,53 @@ func (f *fetcher) fetch(url string) (*dto.RssFeed, error) {
 
 	return feed, nil
 }
+
+func (f *fetcher) scrape(source string) (*dto.RssFeed, error) {
+	scraped, err := ParseScrapedSource(source)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := f.get(scraped.Url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return scrape(scraped, body)
+}
+
+// get returns body of successful response, status of failed one is returned as HttpError
+func (f *fetcher) get(url string) (io.ReadCloser, error) {
+	resp, err := f.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		resp.Body.Close()
+		return nil, &HttpError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+
+	return resp.Body, nil
+}
+
+// parseRetryAfter supports both delay in seconds and http date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if len(value) == 0 {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+
+	return 0
+}
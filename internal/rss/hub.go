@@ -0,0 +1,396 @@
+//go:generate mockgen -package ${GOPACKAGE} -destination mock_hub.go -source hub.go
+package rss
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+
+	"service-rss/internal/compress"
+	"service-rss/internal/config"
+	"service-rss/internal/database"
+	"service-rss/internal/netguard"
+	"service-rss/internal/safe"
+)
+
+const (
+	pushBatchSize = 20
+	// push is retried if replica fails before it is finished
+	pushLease = time.Minute
+
+	minHubLease     = time.Hour
+	maxSecretLength = 200
+	maxChallengeLen = 1 << 10
+)
+
+var (
+	// ErrInvalidHubRequest means subscription request is malformed, it is wrapped with the reason
+	ErrInvalidHubRequest = errors.New("invalid hub request")
+	// ErrUnknownTopic means topic is not url of any of our feeds
+	ErrUnknownTopic = errors.New("unknown topic")
+	// ErrHubBusy means too many intents are being verified
+	ErrHubBusy = errors.New("hub is busy")
+)
+
+// HubRequest is subscribe or unsubscribe request of websub subscriber
+type HubRequest struct {
+	Mode         string
+	Topic        string
+	Callback     string
+	Secret       string
+	LeaseSeconds int64 // zero if subscriber didn't ask for lease
+}
+
+// Hub is websub hub of our own feeds, subscribers are pushed when cacher saves changed feed
+type Hub interface {
+	// Request validates request of subscriber, intent is verified asynchronously
+	Request(req *HubRequest) error
+	// Publish queues push of rss to its subscribers
+	Publish(rssID int64)
+	Start()
+	Shutdown()
+}
+
+type hub struct {
+	db          database.Database
+	guard       *netguard.Guard
+	client      *http.Client
+	publicUrl   string
+	lease       time.Duration
+	maxLease    time.Duration
+	checkPeriod time.Duration
+	retry       time.Duration
+	maxRetry    time.Duration
+	maxAttempts int
+	counter     *prometheus.CounterVec
+
+	// verifications limits concurrent verifications of intents
+	verifications chan struct{}
+	verifying     sync.WaitGroup
+	wakeChan      chan struct{}
+
+	// graceful shutdown helper-channels
+	shutdownChan     chan interface{}
+	shutdownWaitChan chan interface{}
+}
+
+// NewHub makes hub of our feeds at public url
+func NewHub(cfg *config.Config, db database.Database) (Hub, error) {
+	h := newHub(cfg, db)
+
+	err := prometheus.Register(h.counter)
+	if err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// newHub makes hub without registering its metrics
+func newHub(cfg *config.Config, db database.Database) *hub {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "websub_hub_events_counter",
+		Help: "Counter of websub hub subscriptions and pushes by event",
+	}, []string{"event"})
+
+	guard := netguard.New(cfg)
+
+	return &hub{
+		db:          db,
+		guard:       guard,
+		client:      guard.Client(subscribeTimeout),
+		publicUrl:   cfg.ServerPublicUrl,
+		lease:       cfg.WebSubHubLease,
+		maxLease:    cfg.WebSubHubMaxLease,
+		checkPeriod: cfg.WebSubCheckPeriod,
+		retry:       cfg.WebSubHubRetry,
+		maxRetry:    cfg.WebSubMaxRetry,
+		maxAttempts: cfg.WebSubHubMaxAttempts,
+		counter:     counter,
+
+		verifications: make(chan struct{}, cfg.WebSubHubVerifications),
+		wakeChan:      make(chan struct{}, 1),
+
+		shutdownChan:     make(chan interface{}),
+		shutdownWaitChan: make(chan interface{}),
+	}
+}
+
+// HubUrl is url of our hub advertised in feeds
+func HubUrl(publicUrl string) string {
+	return strings.TrimRight(publicUrl, "/") + "/websub/hub"
+}
+
+// ParseFeedUrl returns owner and name of rss by its url made by FeedUrl
+func ParseFeedUrl(publicUrl string, feedUrl string) (string, string, bool) {
+	prefix := strings.TrimRight(publicUrl, "/") + "/"
+	if !strings.HasPrefix(feedUrl, prefix) {
+		return "", "", false
+	}
+
+	parts := strings.Split(feedUrl[len(prefix):], "/")
+	if len(parts) != 2 {
+		return "", "", false
+	}
+
+	email, err := url.PathUnescape(parts[0])
+	if err != nil || len(email) == 0 {
+		return "", "", false
+	}
+
+	name, err := url.PathUnescape(parts[1])
+	if err != nil || len(name) == 0 {
+		return "", "", false
+	}
+
+	return email, name, true
+}
+
+func (h *hub) Request(req *HubRequest) error {
+	if req.Mode != WebSubModeSubscribe && req.Mode != WebSubModeUnsubscribe {
+		return fmt.Errorf("%w: unsupported mode %q", ErrInvalidHubRequest, req.Mode)
+	}
+
+	callback, err := url.Parse(req.Callback)
+	if err != nil || (callback.Scheme != "http" && callback.Scheme != "https") || len(callback.Host) == 0 {
+		return fmt.Errorf("%w: callback should be absolute http url", ErrInvalidHubRequest)
+	}
+
+	if len(req.Secret) >= maxSecretLength {
+		return fmt.Errorf("%w: secret should be shorter than %d bytes", ErrInvalidHubRequest, maxSecretLength)
+	}
+
+	email, name, ok := ParseFeedUrl(h.publicUrl, req.Topic)
+	if !ok {
+		return ErrUnknownTopic
+	}
+
+	rssID, err := h.db.GetRssID(email, name)
+	if err == sql.ErrNoRows {
+		return ErrUnknownTopic
+	}
+	if err != nil {
+		return err
+	}
+
+	// hub is open to anyone, so it isn't used to reach private networks, dialer checks address again on verification
+	ctx, cancel := context.WithTimeout(context.Background(), subscribeTimeout)
+	defer cancel()
+	if err = h.guard.CheckUrl(ctx, req.Callback); err != nil {
+		return fmt.Errorf("%w: callback should be public url", ErrInvalidHubRequest)
+	}
+
+	select {
+	case h.verifications <- struct{}{}:
+	default:
+		return ErrHubBusy
+	}
+
+	h.verifying.Add(1)
+	go func() {
+		defer h.verifying.Done()
+		defer func() { <-h.verifications }()
+
+		safe.Do(func() {
+			h.verify(req, rssID, h.leaseOf(req))
+		})
+	}()
+
+	return nil
+}
+
+func (h *hub) Publish(rssID int64) {
+	err := h.db.QueueHubPushes(rssID)
+	if err != nil {
+		log.WithError(err).WithField("id", rssID).Error("failed to queue websub pushes")
+		return
+	}
+
+	select {
+	case h.wakeChan <- struct{}{}:
+	default:
+	}
+}
+
+func (h *hub) Start() {
+	defer close(h.shutdownWaitChan)
+
+	ticker := time.NewTicker(h.checkPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.shutdownChan:
+			return
+		case <-ticker.C:
+		case <-h.wakeChan:
+		}
+
+		safe.Do(h.pushDue)
+	}
+}
+
+func (h *hub) Shutdown() {
+	close(h.shutdownChan)
+	<-h.shutdownWaitChan
+	h.verifying.Wait()
+}
+
+// verify confirms intent by challenge echoed by subscriber, subscription is changed only if it is confirmed
+func (h *hub) verify(req *HubRequest, rssID int64, lease time.Duration) {
+	challenge, err := newSecret()
+	if err != nil {
+		log.WithError(err).Error("failed to generate websub challenge")
+		return
+	}
+
+	callback, _ := url.Parse(req.Callback)
+	query := callback.Query()
+	query.Set("hub.mode", req.Mode)
+	query.Set("hub.topic", req.Topic)
+	query.Set("hub.challenge", challenge)
+	if req.Mode == WebSubModeSubscribe {
+		query.Set("hub.lease_seconds", strconv.FormatInt(int64(lease.Seconds()), 10))
+	}
+	callback.RawQuery = query.Encode()
+
+	resp, err := h.client.Get(callback.String())
+	if err != nil {
+		h.counter.WithLabelValues("verification_failed").Inc()
+		log.WithError(err).WithField("callback", req.Callback).Warn("failed to verify websub intent")
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxChallengeLen))
+	if err != nil || resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices ||
+		string(body) != challenge {
+		h.counter.WithLabelValues("verification_failed").Inc()
+		log.WithField("callback", req.Callback).WithField("status", resp.StatusCode).Warn("websub intent was not confirmed")
+		return
+	}
+
+	if req.Mode == WebSubModeUnsubscribe {
+		err = h.db.DeleteHubSubscription(rssID, req.Callback)
+	} else {
+		err = h.db.SaveHubSubscription(&database.HubSubscription{
+			RssID:    rssID,
+			Callback: req.Callback,
+			Secret:   req.Secret,
+			Lease:    lease,
+		})
+	}
+	if err != nil {
+		log.WithError(err).WithField("callback", req.Callback).Error("failed to save websub hub subscription")
+		return
+	}
+
+	h.counter.WithLabelValues(req.Mode).Inc()
+}
+
+func (h *hub) pushDue() {
+	for {
+		pushes, err := h.db.LeaseHubPushes(pushBatchSize, pushLease)
+		if err != nil {
+			log.WithError(err).Error("failed to lease websub pushes")
+			return
+		}
+
+		for _, p := range pushes {
+			select {
+			case <-h.shutdownChan:
+				return
+			default:
+			}
+
+			err = h.db.FinishHubPush(p.ID, h.push(p))
+			if err != nil {
+				log.WithError(err).WithField("callback", p.Callback).Error("failed to finish websub push")
+			}
+		}
+
+		if len(pushes) < pushBatchSize {
+			return
+		}
+	}
+}
+
+// push sends current feed to subscriber, it returns delay of retry or zero if push is done
+func (h *hub) push(p *database.HubPush) time.Duration {
+	// rss is pushed when it is cached
+	if p.Feed == nil {
+		return 0
+	}
+
+	body, err := compress.Decode(p.Feed)
+	if err != nil {
+		log.WithError(err).WithField("callback", p.Callback).Error("failed to decompress pushed feed")
+		return 0
+	}
+
+	topic := FeedUrl(h.publicUrl, p.Email, p.Name)
+	req, err := http.NewRequest(http.MethodPost, p.Callback, bytes.NewReader(body))
+	if err != nil {
+		return 0
+	}
+	req.Header.Set("Content-Type", "application/rss+xml")
+	req.Header.Set("Link", fmt.Sprintf(`<%s>; rel="hub", <%s>; rel="self"`, HubUrl(h.publicUrl), topic))
+	if len(p.Secret) > 0 {
+		mac := hmac.New(sha256.New, []byte(p.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Hub-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := h.client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices:
+			h.counter.WithLabelValues("pushed").Inc()
+			return 0
+		case resp.StatusCode == http.StatusGone:
+			// subscriber asks to drop subscription
+			h.counter.WithLabelValues("gone").Inc()
+			if err = h.db.DeleteHubSubscription(p.RssID, p.Callback); err != nil {
+				log.WithError(err).WithField("callback", p.Callback).Error("failed to delete websub hub subscription")
+			}
+			return 0
+		}
+		err = &HttpError{StatusCode: resp.StatusCode}
+	}
+
+	if p.Attempts >= h.maxAttempts {
+		h.counter.WithLabelValues("dropped").Inc()
+		log.WithError(err).WithField("callback", p.Callback).Warn("websub push was dropped after retries")
+		return 0
+	}
+
+	h.counter.WithLabelValues("push_failed").Inc()
+	return exponentialBackoff(h.retry, h.maxRetry, p.Attempts)
+}
+
+// leaseOf is lease asked by subscriber within limits of hub
+func (h *hub) leaseOf(req *HubRequest) time.Duration {
+	if req.LeaseSeconds <= 0 {
+		return h.lease
+	}
+
+	return clamp(time.Duration(req.LeaseSeconds)*time.Second, minHubLease, h.maxLease)
+}
@@ -0,0 +1,200 @@
+package rss
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/compress"
+	"service-rss/internal/config"
+	"service-rss/internal/database"
+	"service-rss/internal/netguard"
+)
+
+func newTestHub(db database.Database) *hub {
+	return newHub(&config.Config{
+		ServerPublicUrl: "http://localhost",
+		// test servers listen at loopback
+		AllowPrivateNetworks:   true,
+		WebSubHubLease:         240 * time.Hour,
+		WebSubHubMaxLease:      720 * time.Hour,
+		WebSubCheckPeriod:      time.Minute,
+		WebSubHubRetry:         time.Minute,
+		WebSubMaxRetry:         24 * time.Hour,
+		WebSubHubMaxAttempts:   3,
+		WebSubHubVerifications: 1,
+	}, db)
+}
+
+func TestParseFeedUrl(t *testing.T) {
+	email, name, ok := ParseFeedUrl("http://localhost/", FeedUrl("http://localhost", "example@gmail.com", "my feed"))
+	assert.True(t, ok)
+	assert.Equal(t, "example@gmail.com", email)
+	assert.Equal(t, "my feed", name)
+
+	_, _, ok = ParseFeedUrl("http://localhost", "https://other.com/example@gmail.com/test")
+	assert.False(t, ok)
+	_, _, ok = ParseFeedUrl("http://localhost", "http://localhost/websub/hub/extra")
+	assert.False(t, ok)
+	_, _, ok = ParseFeedUrl("http://localhost", "http://localhost/example@gmail.com/")
+	assert.False(t, ok)
+}
+
+func TestHub_Request(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().GetRssID("example@gmail.com", "unknown").Return(int64(0), sql.ErrNoRows)
+
+	h := newTestHub(db)
+	topic := "http://localhost/example@gmail.com/test"
+
+	err := h.Request(&HubRequest{Mode: "publish", Topic: topic, Callback: "https://one.com/"})
+	assert.ErrorIs(t, err, ErrInvalidHubRequest)
+	err = h.Request(&HubRequest{Mode: WebSubModeSubscribe, Topic: topic, Callback: "one.com"})
+	assert.ErrorIs(t, err, ErrInvalidHubRequest)
+	err = h.Request(&HubRequest{Mode: WebSubModeSubscribe, Topic: topic, Callback: "https://one.com/", Secret: string(make([]byte, 200))})
+	assert.ErrorIs(t, err, ErrInvalidHubRequest)
+
+	assert.Equal(t, ErrUnknownTopic, h.Request(&HubRequest{Mode: WebSubModeSubscribe, Topic: "https://one.com/feed", Callback: "https://one.com/"}))
+	assert.Equal(t, ErrUnknownTopic, h.Request(&HubRequest{Mode: WebSubModeSubscribe, Topic: "http://localhost/example@gmail.com/unknown", Callback: "https://one.com/"}))
+
+	// verifications are limited
+	db.EXPECT().GetRssID("example@gmail.com", "test").Return(int64(7), nil)
+	h.verifications <- struct{}{}
+	assert.Equal(t, ErrHubBusy, h.Request(&HubRequest{Mode: WebSubModeSubscribe, Topic: topic, Callback: "https://one.com/"}))
+
+	// callbacks at private addresses are refused before verification
+	h.guard = netguard.New(&config.Config{})
+	for _, callback := range []string{"http://127.0.0.1:8080/", "http://169.254.169.254/latest/meta-data/", "http://[::1]/", "http://10.0.0.1/"} {
+		db.EXPECT().GetRssID("example@gmail.com", "test").Return(int64(7), nil)
+		err = h.Request(&HubRequest{Mode: WebSubModeSubscribe, Topic: topic, Callback: callback})
+		assert.ErrorIs(t, err, ErrInvalidHubRequest, callback)
+	}
+}
+
+func TestHub_Verify(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// callback stands for subscriber which wants only subscriptions
+	callback := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		assert.Equal(t, "http://localhost/example@gmail.com/test", query.Get("hub.topic"))
+		assert.Equal(t, "1", query.Get("id"))
+
+		if query.Get("hub.mode") != WebSubModeSubscribe {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		assert.Equal(t, "3600", query.Get("hub.lease_seconds"))
+		_, _ = writer.Write([]byte(query.Get("hub.challenge")))
+	}))
+	defer callback.Close()
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().GetRssID("example@gmail.com", "test").Times(2).Return(int64(7), nil)
+	db.EXPECT().SaveHubSubscription(&database.HubSubscription{
+		RssID:    7,
+		Callback: callback.URL + "?id=1",
+		Secret:   "secret",
+		Lease:    time.Hour,
+	}).Return(nil)
+
+	h := newTestHub(db)
+
+	// lease shorter than minimum is extended
+	assert.NoError(t, h.Request(&HubRequest{
+		Mode:         WebSubModeSubscribe,
+		Topic:        "http://localhost/example@gmail.com/test",
+		Callback:     callback.URL + "?id=1",
+		Secret:       "secret",
+		LeaseSeconds: 60,
+	}))
+	h.verifying.Wait()
+
+	// unconfirmed unsubscription is ignored
+	assert.NoError(t, h.Request(&HubRequest{
+		Mode:     WebSubModeUnsubscribe,
+		Topic:    "http://localhost/example@gmail.com/test",
+		Callback: callback.URL + "?id=1",
+	}))
+	h.verifying.Wait()
+}
+
+func TestHub_PushDue(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	feed := `<rss version="2.0"><channel><title>test</title></channel></rss>`
+	encoded, err := compress.Encode([]byte(feed))
+	assert.NoError(t, err)
+
+	subscriber := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/ok":
+			body, _ := ioutil.ReadAll(req.Body)
+			assert.Equal(t, feed, string(body))
+			assert.Equal(t, "application/rss+xml", req.Header.Get("Content-Type"))
+			assert.Equal(t, `<http://localhost/websub/hub>; rel="hub", <http://localhost/example@gmail.com/test>; rel="self"`, req.Header.Get("Link"))
+			assert.True(t, validSignature("secret", body, req.Header.Get("X-Hub-Signature")))
+			writer.WriteHeader(http.StatusAccepted)
+		case "/gone":
+			writer.WriteHeader(http.StatusGone)
+		default:
+			writer.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer subscriber.Close()
+
+	push := func(id int64, path string, attempts int) *database.HubPush {
+		return &database.HubPush{
+			ID:       id,
+			RssID:    7,
+			Email:    "example@gmail.com",
+			Name:     "test",
+			Callback: subscriber.URL + path,
+			Secret:   "secret",
+			Attempts: attempts,
+			Feed:     encoded,
+		}
+	}
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().LeaseHubPushes(pushBatchSize, pushLease).Return([]*database.HubPush{
+		push(1, "/ok", 1),
+		push(2, "/gone", 1),
+		push(3, "/failed", 2),
+		push(4, "/failed", 3),
+	}, nil)
+	db.EXPECT().FinishHubPush(int64(1), time.Duration(0)).Return(nil)
+	db.EXPECT().DeleteHubSubscription(int64(7), subscriber.URL+"/gone").Return(nil)
+	db.EXPECT().FinishHubPush(int64(2), time.Duration(0)).Return(nil)
+	db.EXPECT().FinishHubPush(int64(3), 2*time.Minute).Return(nil)
+	// push is dropped after max attempts
+	db.EXPECT().FinishHubPush(int64(4), time.Duration(0)).Return(nil)
+
+	newTestHub(db).pushDue()
+}
+
+func TestHub_Publish(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().QueueHubPushes(int64(7)).Times(2).Return(nil)
+
+	h := newTestHub(db)
+	h.Publish(7)
+	// wake is not blocked by pending one
+	h.Publish(7)
+
+	assert.Len(t, h.wakeChan, 1)
+}
@@ -0,0 +1,154 @@
+package rss
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+)
+
+var (
+	pubDateLayouts = []string{
+		time.RFC1123,
+		time.RFC1123Z,
+		"Mon, 2 Jan 2006 15:04:05 MST",
+		"Mon, 2 Jan 2006 15:04:05 -0700",
+		time.RFC822,
+		time.RFC822Z,
+		time.RFC3339,
+	}
+)
+
+// withSourceFallbacks fills item with values of source channel, since items are stored and mixed without it.
+// Source url should be public one, source is left out without it
+func withSourceFallbacks(sourceUrl string, channel *dto.RssFeedChannel, item *dto.RssFeedItem) *dto.RssFeedItem {
+	result := *item
+
+	// keep source of nested aggregated feeds, it points to origin already
+	if result.Source == nil && len(sourceUrl) > 0 {
+		result.Source = &dto.RssFeedSource{
+			Url:   sourceUrl,
+			Title: channel.Title,
+		}
+	}
+
+	// keep artwork of source show, otherwise episode gets image of aggregated podcast
+	if result.ItunesImage == nil {
+		result.ItunesImage = channel.ItunesImage
+	}
+
+	return &result
+}
+
+// publicSourceUrl is url of source which readers can open. Scraped sources are replaced by url of page and nested
+// ones by url of nested feed, it is empty for malformed sources
+func publicSourceUrl(publicUrl string, source string) string {
+	if IsScrapedSource(source) {
+		scraped, err := ParseScrapedSource(source)
+		if err != nil {
+			return ""
+		}
+		return scraped.Url
+	}
+
+	if IsNestedSource(source) {
+		email, name, err := ParseNestedSource(source)
+		if err != nil {
+			return ""
+		}
+		return FeedUrl(publicUrl, email, name)
+	}
+
+	return source
+}
+
+func toStoredItem(source string, language string, item *dto.RssFeedItem) (*database.Item, error) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+
+	return &database.Item{
+		Source:        source,
+		Hash:          itemHash(item),
+		Guid:          item.Guid,
+		Link:          item.Link,
+		Title:         item.Title,
+		Description:   item.Description,
+		Content:       plainText(item.Description),
+		Language:      language,
+		PublishedTime: parsePubDate(item.PubDate),
+		Data:          string(data),
+	}, nil
+}
+
+func fromStoredItem(stored *database.Item) (*dto.RssFeedItem, error) {
+	item := &dto.RssFeedItem{}
+	err := json.Unmarshal([]byte(stored.Data), item)
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// itemHash identifies item within source by guid, link or content if feed has neither
+func itemHash(item *dto.RssFeedItem) string {
+	key := "guid:" + item.Guid
+	if len(item.Guid) == 0 {
+		key = "link:" + item.Link
+	}
+	if len(item.Guid) == 0 && len(item.Link) == 0 {
+		key = "content:" + item.Title + "\n" + item.Description + "\n" + item.PubDate
+	}
+
+	sum := sha1.Sum([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// parsePubDate returns nil if date has unknown format, feeds don't follow RFC 822 strictly
+func parsePubDate(pubDate string) *time.Time {
+	if len(pubDate) == 0 {
+		return nil
+	}
+
+	for _, layout := range pubDateLayouts {
+		t, err := time.Parse(layout, pubDate)
+		if err == nil {
+			return &t
+		}
+	}
+
+	return nil
+}
+
+// plainText strips markup of description, so tags and attributes are not searched
+func plainText(description string) string {
+	var builder strings.Builder
+
+	tokenizer := html.NewTokenizer(strings.NewReader(description))
+	skip := false
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return strings.Join(strings.Fields(builder.String()), " ")
+		case html.StartTagToken:
+			name, _ := tokenizer.TagName()
+			skip = string(name) == "script" || string(name) == "style"
+			builder.WriteByte(' ')
+		case html.EndTagToken, html.SelfClosingTagToken:
+			skip = false
+			builder.WriteByte(' ')
+		case html.TextToken:
+			if !skip {
+				builder.Write(tokenizer.Text())
+			}
+		}
+	}
+}
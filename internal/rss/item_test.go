@@ -0,0 +1,93 @@
+package rss
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/dto"
+)
+
+func TestItemHash(t *testing.T) {
+	withGuid := itemHash(&dto.RssFeedItem{Guid: "guid", Link: "http://example.com/1"})
+	assert.Equal(t, withGuid, itemHash(&dto.RssFeedItem{Guid: "guid", Link: "http://example.com/2", Title: "changed"}))
+
+	withLink := itemHash(&dto.RssFeedItem{Link: "http://example.com/1"})
+	assert.Equal(t, withLink, itemHash(&dto.RssFeedItem{Link: "http://example.com/1", Title: "changed"}))
+	assert.NotEqual(t, withGuid, withLink)
+
+	withContent := itemHash(&dto.RssFeedItem{Title: "title", Description: "description"})
+	assert.NotEqual(t, withContent, itemHash(&dto.RssFeedItem{Title: "title", Description: "changed"}))
+
+	// guid and link with equal values are different keys
+	assert.NotEqual(t, itemHash(&dto.RssFeedItem{Guid: "same"}), itemHash(&dto.RssFeedItem{Link: "same"}))
+}
+
+func TestParsePubDate(t *testing.T) {
+	expected := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	for _, pubDate := range []string{
+		"Mon, 02 Jan 2006 15:04:05 UTC",
+		"Mon, 02 Jan 2006 15:04:05 +0000",
+		"Mon, 2 Jan 2006 15:04:05 +0000",
+		"2006-01-02T15:04:05Z",
+	} {
+		actual := parsePubDate(pubDate)
+		if assert.NotNil(t, actual, pubDate) {
+			assert.True(t, expected.Equal(*actual), pubDate)
+		}
+	}
+
+	assert.Nil(t, parsePubDate(""))
+	assert.Nil(t, parsePubDate("yesterday"))
+}
+
+func TestStoredItem(t *testing.T) {
+	item := &dto.RssFeedItem{
+		Title:     "title",
+		Link:      "http://example.com/1",
+		Guid:      "guid",
+		PubDate:   "Mon, 02 Jan 2006 15:04:05 UTC",
+		Enclosure: &dto.RssFeedEnclosure{Url: "http://example.com/1.mp3", Length: 1, Type: "audio/mpeg"},
+		Source:    &dto.RssFeedSource{Url: "http://example.com/feed", Title: "Example"},
+	}
+
+	stored, err := toStoredItem("http://example.com/feed", "en-us", item)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com/feed", stored.Source)
+	assert.Equal(t, itemHash(item), stored.Hash)
+	assert.Equal(t, "guid", stored.Guid)
+	assert.Equal(t, "en-us", stored.Language)
+	assert.Equal(t, "title", stored.Title)
+	assert.Equal(t, int64(1136214245), stored.PublishedTime.Unix())
+
+	restored, err := fromStoredItem(stored)
+	assert.NoError(t, err)
+	assert.Equal(t, item, restored)
+}
+
+func TestSourceFallbacks(t *testing.T) {
+	channel := &dto.RssFeedChannel{Title: "Changelog"}
+	scraped := (&ScrapedSource{Url: "https://vendor.example.com/changelog", Item: "li", Title: "h2"}).String()
+
+	for source, expected := range map[string]string{
+		"https://one.com/":                 "https://one.com/",
+		scraped:                            "https://vendor.example.com/changelog",
+		NestedSource("a@b.com", "Go news"): "https://rss.example.com/a@b.com/Go%20news",
+	} {
+		item := withSourceFallbacks(publicSourceUrl("https://rss.example.com/", source), channel, &dto.RssFeedItem{Title: "title"})
+		assert.Equal(t, &dto.RssFeedSource{Url: expected, Title: "Changelog"}, item.Source, source)
+	}
+
+	// pseudo urls are not written to feeds, so source is left out
+	item := withSourceFallbacks(publicSourceUrl("https://rss.example.com/", "scrape:item=li"), channel, &dto.RssFeedItem{Title: "title"})
+	assert.Nil(t, item.Source)
+}
+
+func TestPlainText(t *testing.T) {
+	assert.Equal(t, "Hello world !", plainText("<p>Hello <b>world</b></p><script>alert(1)</script>!"))
+	assert.Equal(t, "a < b & c", plainText("a &lt; b &amp; c"))
+	assert.Equal(t, "plain", plainText("  plain\n"))
+	assert.Equal(t, "", plainText(""))
+}
@@ -0,0 +1,65 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: aggregator.go
+
+// Package rss is a generated GoMock package.
+package rss
+
+import (
+	reflect "reflect"
+	database "service-rss/internal/database"
+	dto "service-rss/internal/dto"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockAggregator is a mock of Aggregator interface.
+type MockAggregator struct {
+	ctrl     *gomock.Controller
+	recorder *MockAggregatorMockRecorder
+}
+
+// MockAggregatorMockRecorder is the mock recorder for MockAggregator.
+type MockAggregatorMockRecorder struct {
+	mock *MockAggregator
+}
+
+// NewMockAggregator creates a new mock instance.
+func NewMockAggregator(ctrl *gomock.Controller) *MockAggregator {
+	mock := &MockAggregator{ctrl: ctrl}
+	mock.recorder = &MockAggregatorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAggregator) EXPECT() *MockAggregatorMockRecorder {
+	return m.recorder
+}
+
+// Aggregate mocks base method.
+func (m *MockAggregator) Aggregate(rss *database.Rss, force bool) *dto.RssFeed {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Aggregate", rss, force)
+	ret0, _ := ret[0].(*dto.RssFeed)
+	return ret0
+}
+
+// Aggregate indicates an expected call of Aggregate.
+func (mr *MockAggregatorMockRecorder) Aggregate(rss, force interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Aggregate", reflect.TypeOf((*MockAggregator)(nil).Aggregate), rss, force)
+}
+
+// Preview mocks base method.
+func (m *MockAggregator) Preview(rss *database.Rss) (*dto.RssFeed, []*SourceDiagnostic) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Preview", rss)
+	ret0, _ := ret[0].(*dto.RssFeed)
+	ret1, _ := ret[1].([]*SourceDiagnostic)
+	return ret0, ret1
+}
+
+// Preview indicates an expected call of Preview.
+func (mr *MockAggregatorMockRecorder) Preview(rss interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Preview", reflect.TypeOf((*MockAggregator)(nil).Preview), rss)
+}
@@ -0,0 +1,49 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: cacher.go
+
+// Package rss is a generated GoMock package.
+package rss
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockRefresher is a mock of Refresher interface.
+type MockRefresher struct {
+	ctrl     *gomock.Controller
+	recorder *MockRefresherMockRecorder
+}
+
+// MockRefresherMockRecorder is the mock recorder for MockRefresher.
+type MockRefresherMockRecorder struct {
+	mock *MockRefresher
+}
+
+// NewMockRefresher creates a new mock instance.
+func NewMockRefresher(ctrl *gomock.Controller) *MockRefresher {
+	mock := &MockRefresher{ctrl: ctrl}
+	mock.recorder = &MockRefresherMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRefresher) EXPECT() *MockRefresherMockRecorder {
+	return m.recorder
+}
+
+// Refresh mocks base method.
+func (m *MockRefresher) Refresh(email, name string) (<-chan struct{}, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Refresh", email, name)
+	ret0, _ := ret[0].(<-chan struct{})
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Refresh indicates an expected call of Refresh.
+func (mr *MockRefresherMockRecorder) Refresh(email, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Refresh", reflect.TypeOf((*MockRefresher)(nil).Refresh), email, name)
+}
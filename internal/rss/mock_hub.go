@@ -0,0 +1,84 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: hub.go
+
+// Package rss is a generated GoMock package.
+package rss
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockHub is a mock of Hub interface.
+type MockHub struct {
+	ctrl     *gomock.Controller
+	recorder *MockHubMockRecorder
+}
+
+// MockHubMockRecorder is the mock recorder for MockHub.
+type MockHubMockRecorder struct {
+	mock *MockHub
+}
+
+// NewMockHub creates a new mock instance.
+func NewMockHub(ctrl *gomock.Controller) *MockHub {
+	mock := &MockHub{ctrl: ctrl}
+	mock.recorder = &MockHubMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockHub) EXPECT() *MockHubMockRecorder {
+	return m.recorder
+}
+
+// Publish mocks base method.
+func (m *MockHub) Publish(rssID int64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Publish", rssID)
+}
+
+// Publish indicates an expected call of Publish.
+func (mr *MockHubMockRecorder) Publish(rssID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Publish", reflect.TypeOf((*MockHub)(nil).Publish), rssID)
+}
+
+// Request mocks base method.
+func (m *MockHub) Request(req *HubRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Request", req)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Request indicates an expected call of Request.
+func (mr *MockHubMockRecorder) Request(req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Request", reflect.TypeOf((*MockHub)(nil).Request), req)
+}
+
+// Shutdown mocks base method.
+func (m *MockHub) Shutdown() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Shutdown")
+}
+
+// Shutdown indicates an expected call of Shutdown.
+func (mr *MockHubMockRecorder) Shutdown() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Shutdown", reflect.TypeOf((*MockHub)(nil).Shutdown))
+}
+
+// Start mocks base method.
+func (m *MockHub) Start() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Start")
+}
+
+// Start indicates an expected call of Start.
+func (mr *MockHubMockRecorder) Start() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Start", reflect.TypeOf((*MockHub)(nil).Start))
+}
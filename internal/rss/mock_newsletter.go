@@ -0,0 +1,64 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: newsletter.go
+
+// Package rss is a generated GoMock package.
+package rss
+
+import (
+	reflect "reflect"
+	database "service-rss/internal/database"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockNewsletters is a mock of Newsletters interface.
+type MockNewsletters struct {
+	ctrl     *gomock.Controller
+	recorder *MockNewslettersMockRecorder
+}
+
+// MockNewslettersMockRecorder is the mock recorder for MockNewsletters.
+type MockNewslettersMockRecorder struct {
+	mock *MockNewsletters
+}
+
+// NewMockNewsletters creates a new mock instance.
+func NewMockNewsletters(ctrl *gomock.Controller) *MockNewsletters {
+	mock := &MockNewsletters{ctrl: ctrl}
+	mock.recorder = &MockNewslettersMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockNewsletters) EXPECT() *MockNewslettersMockRecorder {
+	return m.recorder
+}
+
+// Ingest mocks base method.
+func (m *MockNewsletters) Ingest(newsletter *database.Newsletter, message []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ingest", newsletter, message)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ingest indicates an expected call of Ingest.
+func (mr *MockNewslettersMockRecorder) Ingest(newsletter, message interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ingest", reflect.TypeOf((*MockNewsletters)(nil).Ingest), newsletter, message)
+}
+
+// Recipient mocks base method.
+func (m *MockNewsletters) Recipient(address string) (*database.Newsletter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Recipient", address)
+	ret0, _ := ret[0].(*database.Newsletter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Recipient indicates an expected call of Recipient.
+func (mr *MockNewslettersMockRecorder) Recipient(address interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Recipient", reflect.TypeOf((*MockNewsletters)(nil).Recipient), address)
+}
@@ -0,0 +1,72 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: webhook.go
+
+// Package rss is a generated GoMock package.
+package rss
+
+import (
+	reflect "reflect"
+	database "service-rss/internal/database"
+	dto "service-rss/internal/dto"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockWebhookNotifier is a mock of WebhookNotifier interface.
+type MockWebhookNotifier struct {
+	ctrl     *gomock.Controller
+	recorder *MockWebhookNotifierMockRecorder
+}
+
+// MockWebhookNotifierMockRecorder is the mock recorder for MockWebhookNotifier.
+type MockWebhookNotifierMockRecorder struct {
+	mock *MockWebhookNotifier
+}
+
+// NewMockWebhookNotifier creates a new mock instance.
+func NewMockWebhookNotifier(ctrl *gomock.Controller) *MockWebhookNotifier {
+	mock := &MockWebhookNotifier{ctrl: ctrl}
+	mock.recorder = &MockWebhookNotifierMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockWebhookNotifier) EXPECT() *MockWebhookNotifierMockRecorder {
+	return m.recorder
+}
+
+// Notify mocks base method.
+func (m *MockWebhookNotifier) Notify(rss *database.Rss, feed *dto.RssFeed) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Notify", rss, feed)
+}
+
+// Notify indicates an expected call of Notify.
+func (mr *MockWebhookNotifierMockRecorder) Notify(rss, feed interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Notify", reflect.TypeOf((*MockWebhookNotifier)(nil).Notify), rss, feed)
+}
+
+// Shutdown mocks base method.
+func (m *MockWebhookNotifier) Shutdown() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Shutdown")
+}
+
+// Shutdown indicates an expected call of Shutdown.
+func (mr *MockWebhookNotifierMockRecorder) Shutdown() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Shutdown", reflect.TypeOf((*MockWebhookNotifier)(nil).Shutdown))
+}
+
+// Start mocks base method.
+func (m *MockWebhookNotifier) Start() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Start")
+}
+
+// Start indicates an expected call of Start.
+func (mr *MockWebhookNotifierMockRecorder) Start() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Start", reflect.TypeOf((*MockWebhookNotifier)(nil).Start))
+}
@@ -0,0 +1,181 @@
+package rss
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+
+	"service-rss/internal/compress"
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+)
+
+const (
+	// NestedSourcePrefix marks sources which are other rss, they are read from storage instead of fetched
+	NestedSourcePrefix = "aggregate:"
+
+	// every level delays changes of the deepest rss by one rebuild
+	maxNestedDepth = 5
+)
+
+var (
+	// ErrUnknownNested means nested source is malformed or there is no such rss
+	ErrUnknownNested = errors.New("unknown nested rss")
+	// ErrNestedCycle means rss includes itself through nested sources
+	ErrNestedCycle = errors.New("nested rss make a cycle")
+	// ErrNestedTooDeep means rss are nested deeper than maxNestedDepth
+	ErrNestedTooDeep = errors.New("nested rss are too deep")
+	// ErrForeignNested means nested rss belongs to another owner
+	ErrForeignNested = errors.New("nested rss of other owners can't be included")
+)
+
+// NestedSource is source which includes rss of owner with given name
+func NestedSource(email string, name string) string {
+	return NestedSourcePrefix + email + "/" + name
+}
+
+// IsNestedSource tells that source is another rss
+func IsNestedSource(source string) bool {
+	return strings.HasPrefix(source, NestedSourcePrefix)
+}
+
+// ParseNestedSource returns email and name of nested rss, names have no slashes unlike emails
+func ParseNestedSource(source string) (string, string, error) {
+	reference := strings.TrimPrefix(source, NestedSourcePrefix)
+	slash := strings.LastIndex(reference, "/")
+	if !IsNestedSource(source) || slash <= 0 || slash == len(reference)-1 {
+		return "", "", fmt.Errorf("%w: %s", ErrUnknownNested, source)
+	}
+
+	return reference[:slash], reference[slash+1:], nil
+}
+
+// CheckNested makes sure that nested sources of rss exist and don't include it again.
+// Only rss of the same owner may be nested, knowing url of rss doesn't allow to republish it.
+// Depth is counted from the farthest rss which includes rss, so nested rss can't be deepened from below
+func CheckNested(db database.Database, rss *database.Rss) error {
+	hasNested := false
+	for _, source := range rss.Sources {
+		hasNested = hasNested || IsNestedSource(source)
+	}
+	if !hasNested {
+		return nil
+	}
+
+	source := NestedSource(rss.Email, rss.Name)
+	depth, err := nestingDepth(db, source, 0)
+	if err != nil {
+		return err
+	}
+
+	visited := map[string]bool{source: true}
+	return checkNested(db, rss.Email, rss.Sources, visited, depth+1)
+}
+
+// nestingDepth is count of levels of rss which include source, it is not counted beyond maxNestedDepth
+func nestingDepth(db database.Database, source string, depth int) (int, error) {
+	if depth > maxNestedDepth {
+		return depth, nil
+	}
+
+	parents, err := db.GetSourceRss(source)
+	if err != nil {
+		return 0, err
+	}
+
+	deepest := depth
+	for _, parent := range parents {
+		parentDepth, err := nestingDepth(db, NestedSource(parent.Email, parent.Name), depth+1)
+		if err != nil {
+			return 0, err
+		}
+		if parentDepth > deepest {
+			deepest = parentDepth
+		}
+	}
+
+	return deepest, nil
+}
+
+func checkNested(db database.Database, owner string, sources []string, visited map[string]bool, depth int) error {
+	for _, source := range sources {
+		if !IsNestedSource(source) {
+			continue
+		}
+
+		if visited[source] {
+			return fmt.Errorf("%w: %s", ErrNestedCycle, source)
+		}
+		if depth > maxNestedDepth {
+			return fmt.Errorf("%w: max depth is %d", ErrNestedTooDeep, maxNestedDepth)
+		}
+
+		email, name, err := ParseNestedSource(source)
+		if err != nil {
+			return err
+		}
+		if email != owner {
+			return fmt.Errorf("%w: %s", ErrForeignNested, source)
+		}
+
+		nested, err := db.GetRss(email, name)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: %s", ErrUnknownNested, source)
+		}
+		if err != nil {
+			return err
+		}
+
+		visited[source] = true
+		err = checkNested(db, owner, nested.Sources, visited, depth+1)
+		if err != nil {
+			return err
+		}
+		delete(visited, source)
+	}
+
+	return nil
+}
+
+// nestedFeed reads cached feed of nested rss of owner, so only published items are included and hidden sources are not exposed
+func (a *aggregator) nestedFeed(owner string, source string) (*dto.RssFeed, error) {
+	email, name, err := ParseNestedSource(source)
+	if err != nil {
+		return nil, err
+	}
+	if email != owner {
+		return nil, fmt.Errorf("%w: %s", ErrForeignNested, source)
+	}
+
+	cached, err := a.db.GetCachedFeed(email, name)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownNested, source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// parent is rebuilt once nested rss is cached
+	if cached.Feed == nil {
+		return nil, errors.New("nested rss is not cached yet")
+	}
+
+	body, err := compress.Decode(cached.Feed)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &dto.RssFeed{}
+	err = xml.Unmarshal(body, feed)
+	if err != nil {
+		return nil, err
+	}
+
+	if feed.Channel == nil {
+		return nil, errors.New("malformed rss feed")
+	}
+
+	return feed, nil
+}
@@ -0,0 +1,186 @@
+package rss
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/compress"
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+)
+
+func TestParseNestedSource(t *testing.T) {
+	source := NestedSource("example@gmail.com", "Go news")
+	assert.Equal(t, "aggregate:example@gmail.com/Go news", source)
+	assert.True(t, IsNestedSource(source))
+	assert.False(t, IsNestedSource("https://one.com/"))
+
+	email, name, err := ParseNestedSource(source)
+	assert.NoError(t, err)
+	assert.Equal(t, "example@gmail.com", email)
+	assert.Equal(t, "Go news", name)
+
+	for _, malformed := range []string{"https://one.com/", "aggregate:", "aggregate:name", "aggregate:/name", "aggregate:example@gmail.com/"} {
+		_, _, err = ParseNestedSource(malformed)
+		assert.True(t, errors.Is(err, ErrUnknownNested), malformed)
+	}
+}
+
+func TestCheckNested(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// backend includes go and postgres, both of them include shared, loop includes backend
+	db := database.NewMockDatabase(ctrl)
+	stored := map[string]*database.Rss{
+		"go":       {Name: "go", Sources: []string{"https://go.dev/feed", "aggregate:example@gmail.com/shared"}},
+		"postgres": {Name: "postgres", Sources: []string{"aggregate:example@gmail.com/shared"}},
+		"shared":   {Name: "shared", Sources: []string{"https://one.com/"}},
+		"loop":     {Name: "loop", Sources: []string{"aggregate:example@gmail.com/backend"}},
+		"foreign":  {Name: "foreign", Sources: []string{"aggregate:other@gmail.com/shared"}},
+	}
+	for i := 1; i <= maxNestedDepth+1; i++ {
+		name := string(rune('a' + i))
+		stored[name] = &database.Rss{Name: name, Sources: []string{"aggregate:example@gmail.com/" + string(rune('a'+i+1))}}
+	}
+	db.EXPECT().GetRss("example@gmail.com", gomock.Any()).AnyTimes().DoAndReturn(func(email string, name string) (*database.Rss, error) {
+		if name == "broken" {
+			return nil, errors.New("error")
+		}
+		if rss, ok := stored[name]; ok {
+			return rss, nil
+		}
+		return nil, sql.ErrNoRows
+	})
+	db.EXPECT().GetSourceRss(gomock.Any()).AnyTimes().DoAndReturn(func(source string) ([]*database.Rss, error) {
+		parents := make([]*database.Rss, 0)
+		for _, rss := range stored {
+			for _, nested := range rss.Sources {
+				if nested == source {
+					parents = append(parents, &database.Rss{Email: "example@gmail.com", Name: rss.Name, Sources: rss.Sources})
+				}
+			}
+		}
+		return parents, nil
+	})
+
+	backend := func(sources ...string) *database.Rss {
+		return &database.Rss{Email: "example@gmail.com", Name: "backend", Sources: sources}
+	}
+
+	assert.NoError(t, CheckNested(db, backend("https://one.com/")))
+	assert.NoError(t, CheckNested(db, backend("aggregate:example@gmail.com/go", "aggregate:example@gmail.com/postgres")))
+
+	err := CheckNested(db, backend("aggregate:example@gmail.com/backend"))
+	assert.True(t, errors.Is(err, ErrNestedCycle))
+
+	err = CheckNested(db, backend("aggregate:example@gmail.com/go", "aggregate:example@gmail.com/loop"))
+	assert.True(t, errors.Is(err, ErrNestedCycle))
+
+	err = CheckNested(db, backend("aggregate:example@gmail.com/unknown"))
+	assert.True(t, errors.Is(err, ErrUnknownNested))
+
+	err = CheckNested(db, backend("aggregate:example@gmail.com/b"))
+	assert.True(t, errors.Is(err, ErrNestedTooDeep))
+
+	err = CheckNested(db, backend("aggregate:example@gmail.com/broken"))
+	assert.EqualError(t, err, "error")
+
+	// rss which are included by others are nested not deeper than their parents allow
+	assert.NoError(t, CheckNested(db, &database.Rss{Email: "example@gmail.com", Name: "d", Sources: []string{"aggregate:example@gmail.com/go"}}))
+
+	err = CheckNested(db, &database.Rss{Email: "example@gmail.com", Name: "f", Sources: []string{"aggregate:example@gmail.com/go"}})
+	assert.True(t, errors.Is(err, ErrNestedTooDeep))
+
+	// rss of other owners are not included, even through own rss
+	err = CheckNested(db, backend("aggregate:other@gmail.com/go"))
+	assert.True(t, errors.Is(err, ErrForeignNested))
+
+	err = CheckNested(db, backend("aggregate:example@gmail.com/foreign"))
+	assert.True(t, errors.Is(err, ErrForeignNested))
+}
+
+func TestAggregator_Nested(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	nestedXml, err := xml.Marshal(&dto.RssFeed{Channel: &dto.RssFeedChannel{
+		Title: "go",
+		Items: []*dto.RssFeedItem{
+			{
+				Title:   "nested",
+				Guid:    "1",
+				PubDate: "Mon, 02 Jan 2006 15:04:08 MST",
+				Source:  &dto.RssFeedSource{Url: "https://go.dev/feed", Title: "Go"},
+			},
+		},
+	}})
+	assert.NoError(t, err)
+	encoded, err := compress.Encode(nestedXml)
+	assert.NoError(t, err)
+
+	f := NewMockFetcher(ctrl)
+	f.EXPECT().Fetch("https://one.com/").AnyTimes().Return(data["https://one.com/"], nil)
+
+	db := database.NewMockDatabase(ctrl)
+	expectItemStore(db)
+	expectSourceStates(db)
+	db.EXPECT().GetCachedFeed("example@gmail.com", "go").AnyTimes().Return(&database.CachedFeed{ID: 2, Feed: encoded}, nil)
+	db.EXPECT().GetCachedFeed("example@gmail.com", "new").AnyTimes().Return(&database.CachedFeed{ID: 3}, nil)
+	db.EXPECT().GetCachedFeed("example@gmail.com", "deleted").AnyTimes().Return(nil, sql.ErrNoRows)
+
+	a := NewTestAggregator(f, db)
+
+	t.Run("items of nested rss keep their origin", func(t *testing.T) {
+		feed := a.Aggregate(&database.Rss{
+			Email:   "example@gmail.com",
+			Name:    "backend",
+			Sources: []string{"https://one.com/", "aggregate:example@gmail.com/go"},
+		}, false)
+
+		assert.Len(t, feed.Channel.Items, len(data["https://one.com/"].Channel.Items)+1)
+		assert.Equal(t, "nested", feed.Channel.Items[0].Title)
+		assert.Equal(t, &dto.RssFeedSource{Url: "https://go.dev/feed", Title: "Go"}, feed.Channel.Items[0].Source)
+	})
+
+	t.Run("items of nested rss are not stored again", func(t *testing.T) {
+		feed := a.Aggregate(&database.Rss{
+			Email:   "example@gmail.com",
+			Name:    "golang",
+			Sources: []string{"aggregate:example@gmail.com/go"},
+		}, false)
+		assert.Len(t, feed.Channel.Items, 1)
+
+		// nested items follow retention of nested rss, so they are not duplicated in item store
+		stored, err := db.GetItems([]string{"aggregate:example@gmail.com/go"}, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, stored)
+	})
+
+	t.Run("nested rss is not fetched yet", func(t *testing.T) {
+		_, diagnostics := a.Preview(&database.Rss{
+			Email:   "example@gmail.com",
+			Name:    "backend",
+			Sources: []string{"aggregate:example@gmail.com/new", "aggregate:example@gmail.com/deleted", "aggregate:other@gmail.com/go"},
+		})
+
+		assert.Len(t, diagnostics, 3)
+		assert.Equal(t, "nested rss is not cached yet", diagnostics[0].Error)
+		assert.Equal(t, "unknown nested rss: aggregate:example@gmail.com/deleted", diagnostics[1].Error)
+		assert.Equal(t, "nested rss of other owners can't be included: aggregate:other@gmail.com/go", diagnostics[2].Error)
+	})
+
+	t.Run("nested rss have no schedule", func(t *testing.T) {
+		now := time.Now()
+		states := map[string]*database.SourceState{"https://one.com/": {NextFetchTime: now.Add(30 * time.Minute)}}
+
+		ttl := scheduledTtl([]string{"https://one.com/", "aggregate:example@gmail.com/go"}, states, now)
+		assert.Equal(t, int64(30), ttl)
+	})
+}
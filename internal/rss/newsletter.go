@@ -0,0 +1,300 @@
+//go:generate mockgen -package ${GOPACKAGE} -destination mock_newsletter.go -source newsletter.go
+package rss
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"service-rss/internal/config"
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+)
+
+const (
+	// NewsletterSourcePrefix marks sources of rss which are emailed instead of fetched
+	NewsletterSourcePrefix = "newsletter:"
+
+	newsletterTokenLength = 24
+	// nested multiparts deeper than that are ignored
+	maxMimeDepth = 5
+)
+
+var (
+	// ErrUnknownNewsletter means recipient is not address of any newsletter
+	ErrUnknownNewsletter = errors.New("unknown newsletter")
+	// ErrMalformedNewsletter means email can't be parsed or has no text
+	ErrMalformedNewsletter = errors.New("malformed newsletter")
+
+	wordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+)
+
+// Newsletters turns emails sent to addresses of rss into items
+type Newsletters interface {
+	// Recipient returns newsletter of address, it returns ErrUnknownNewsletter for unknown address
+	Recipient(address string) (*database.Newsletter, error)
+	// Ingest stores email as item of newsletter source, rss with source are rebuilt
+	Ingest(newsletter *database.Newsletter, message []byte) error
+}
+
+type newsletters struct {
+	db      database.Database
+	domain  string
+	counter *prometheus.CounterVec
+}
+
+func NewNewsletters(cfg *config.Config, db database.Database) (Newsletters, error) {
+	n := newNewsletters(cfg, db)
+
+	err := prometheus.Register(n.counter)
+	if err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// newNewsletters makes newsletters without registering their metrics
+func newNewsletters(cfg *config.Config, db database.Database) *newsletters {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "newsletter_events_counter",
+		Help: "Counter of received newsletters by event",
+	}, []string{"event"})
+
+	return &newsletters{
+		db:      db,
+		domain:  cfg.NewsletterDomain,
+		counter: counter,
+	}
+}
+
+// NewNewsletter makes newsletter with random token, token is secret since anyone can email to its address
+func NewNewsletter() (*database.Newsletter, error) {
+	secret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	token := secret[:newsletterTokenLength]
+	return &database.Newsletter{
+		Token:  token,
+		Source: NewsletterSourcePrefix + token,
+	}, nil
+}
+
+// NewsletterAddress is email address of newsletter
+func NewsletterAddress(token string, domain string) string {
+	return token + "@" + domain
+}
+
+// IsNewsletterSource tells that source is not fetched, its items are emailed
+func IsNewsletterSource(source string) bool {
+	return strings.HasPrefix(source, NewsletterSourcePrefix)
+}
+
+// PublicSource returns source of stored item which can be shown to anyone. Newsletter sources hold tokens of
+// addresses, so mailto url of sender is returned instead, it is empty when sender is unknown
+func PublicSource(stored *database.Item) string {
+	if !IsNewsletterSource(stored.Source) {
+		return stored.Source
+	}
+
+	item, err := fromStoredItem(stored)
+	if err != nil || item.Source == nil {
+		return ""
+	}
+
+	return item.Source.Url
+}
+
+func (n *newsletters) Recipient(address string) (*database.Newsletter, error) {
+	at := strings.LastIndex(address, "@")
+	if at < 0 || !strings.EqualFold(address[at+1:], n.domain) {
+		return nil, ErrUnknownNewsletter
+	}
+
+	newsletter, err := n.db.GetNewsletter(strings.ToLower(address[:at]))
+	if err == sql.ErrNoRows {
+		n.counter.WithLabelValues("unknown").Inc()
+		return nil, ErrUnknownNewsletter
+	}
+
+	return newsletter, err
+}
+
+func (n *newsletters) Ingest(newsletter *database.Newsletter, message []byte) error {
+	item, err := parseNewsletter(message, time.Now())
+	if err != nil {
+		n.counter.WithLabelValues("malformed").Inc()
+		return err
+	}
+
+	// source is kept from item, newsletter source is secret
+	stored, err := toStoredItem(newsletter.Source, "", item)
+	if err != nil {
+		return err
+	}
+
+	err = n.db.SaveItems([]*database.Item{stored})
+	if err != nil {
+		return err
+	}
+
+	n.counter.WithLabelValues("received").Inc()
+	return n.db.InvalidateSourceRss(newsletter.Source)
+}
+
+// parseNewsletter makes item of email, html body is preferred to plain text one
+func parseNewsletter(message []byte, now time.Time) (*dto.RssFeedItem, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(message))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedNewsletter, err)
+	}
+
+	subject, err := wordDecoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+
+	date, err := msg.Header.Date()
+	if err != nil {
+		date = now
+	}
+
+	htmlBody, textBody, err := messageBodies(textproto.MIMEHeader(msg.Header), msg.Body, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedNewsletter, err)
+	}
+
+	description := sanitizeHtml(htmlBody)
+	if len(description) == 0 && len(strings.TrimSpace(textBody)) > 0 {
+		description = "<p>" + strings.ReplaceAll(html.EscapeString(strings.TrimSpace(textBody)), "\n", "<br>") + "</p>"
+	}
+	if len(description) == 0 && len(subject) == 0 {
+		return nil, fmt.Errorf("%w: email has neither subject nor text", ErrMalformedNewsletter)
+	}
+
+	item := &dto.RssFeedItem{
+		Title:       strings.TrimSpace(subject),
+		Description: description,
+		Guid:        strings.Trim(strings.TrimSpace(msg.Header.Get("Message-Id")), "<>"),
+		PubDate:     date.Format(time.RFC1123Z),
+	}
+
+	parser := &mail.AddressParser{WordDecoder: wordDecoder}
+	if from, err := parser.Parse(msg.Header.Get("From")); err == nil {
+		item.Author = from.Address
+		title := from.Address
+		if len(from.Name) > 0 {
+			item.Author = fmt.Sprintf("%s (%s)", from.Address, from.Name)
+			title = from.Name
+		}
+		item.Source = &dto.RssFeedSource{Url: "mailto:" + from.Address, Title: title}
+	}
+
+	return item, nil
+}
+
+// messageBodies returns the first html and plain text bodies of email, attachments are skipped
+func messageBodies(header textproto.MIMEHeader, body io.Reader, depth int) (string, string, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		// content type is text/plain by default
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= maxMimeDepth {
+			return "", "", nil
+		}
+
+		htmlBody, textBody := "", ""
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", "", err
+			}
+
+			if disposition, _, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition")); disposition == "attachment" {
+				continue
+			}
+
+			partHtml, partText, err := messageBodies(part.Header, part, depth+1)
+			if err != nil {
+				return "", "", err
+			}
+			if len(htmlBody) == 0 {
+				htmlBody = partHtml
+			}
+			if len(textBody) == 0 {
+				textBody = partText
+			}
+		}
+
+		return htmlBody, textBody, nil
+	}
+
+	if mediaType != "text/html" && mediaType != "text/plain" {
+		return "", "", nil
+	}
+
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+
+	body, err = charsetReader(params["charset"], body)
+	if err != nil {
+		return "", "", err
+	}
+
+	content, err := ioutil.ReadAll(body)
+	if err != nil {
+		return "", "", err
+	}
+
+	if mediaType == "text/html" {
+		return string(content), "", nil
+	}
+
+	return "", string(content), nil
+}
+
+// charsetReader converts latin-1 to utf-8, other charsets are read as utf-8
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "latin-1":
+		content, err := ioutil.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+
+		runes := make([]rune, 0, len(content))
+		for _, b := range content {
+			runes = append(runes, rune(b))
+		}
+		return strings.NewReader(string(runes)), nil
+	default:
+		return input, nil
+	}
+}
@@ -0,0 +1,158 @@
+package rss
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/config"
+	"service-rss/internal/database"
+)
+
+const testNewsletterEmail = "From: =?utf-8?q?Weekly_News?= <news@example.com>\r\n" +
+	"To: 0123456789abcdef01234567@in.example.com\r\n" +
+	"Subject: =?utf-8?q?Issue_=E2=84=961?=\r\n" +
+	"Date: Wed, 10 Mar 2021 08:00:00 +0000\r\n" +
+	"Message-Id: <issue-1@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"plain text\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"<p style=3D\"color: red\">Hello <b>reader</b></p><script>alert(1)</script>=\r\n" +
+	"<img src=3D\"https://track.example.com/open.gif\" width=3D\"1\" height=3D\"1\">\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/html\r\n" +
+	"Content-Disposition: attachment; filename=\"attached.html\"\r\n" +
+	"\r\n" +
+	"<p>attachment</p>\r\n" +
+	"--outer--\r\n"
+
+func newTestNewsletters(db database.Database) *newsletters {
+	return newNewsletters(&config.Config{NewsletterDomain: "in.example.com"}, db)
+}
+
+func TestParseNewsletter(t *testing.T) {
+	now := time.Date(2021, time.March, 11, 8, 0, 0, 0, time.UTC)
+
+	t.Run("html body", func(t *testing.T) {
+		item, err := parseNewsletter([]byte(testNewsletterEmail), now)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.Equal(t, "Issue №1", item.Title)
+		assert.Equal(t, "<p>Hello <b>reader</b></p>", item.Description)
+		assert.Equal(t, "issue-1@example.com", item.Guid)
+		assert.Equal(t, "Wed, 10 Mar 2021 08:00:00 +0000", item.PubDate)
+		assert.Equal(t, "news@example.com (Weekly News)", item.Author)
+		assert.Equal(t, "mailto:news@example.com", item.Source.Url)
+		assert.Equal(t, "Weekly News", item.Source.Title)
+	})
+
+	t.Run("plain text body", func(t *testing.T) {
+		email := "From: news@example.com\r\n" +
+			"Subject: Issue 2\r\n" +
+			"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+			"Content-Transfer-Encoding: base64\r\n" +
+			"\r\n" +
+			"Y2Fm6SA8IGJhcgpzZWNvbmQgbGluZQ==\r\n"
+
+		item, err := parseNewsletter([]byte(email), now)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.Equal(t, "Issue 2", item.Title)
+		assert.Equal(t, "<p>café &lt; bar<br>second line</p>", item.Description)
+		assert.Equal(t, now.Format(time.RFC1123Z), item.PubDate)
+		assert.Equal(t, "news@example.com", item.Author)
+		assert.Equal(t, "news@example.com", item.Source.Title)
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		_, err := parseNewsletter([]byte("no headers"), now)
+		assert.True(t, errors.Is(err, ErrMalformedNewsletter))
+
+		_, err = parseNewsletter([]byte("From: news@example.com\r\n\r\n"), now)
+		assert.True(t, errors.Is(err, ErrMalformedNewsletter))
+	})
+}
+
+func TestNewsletters_Recipient(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	found := &database.Newsletter{ID: 1, Token: "0123456789abcdef01234567", Source: "newsletter:0123456789abcdef01234567"}
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().GetNewsletter("0123456789abcdef01234567").Return(found, nil)
+	db.EXPECT().GetNewsletter("unknown").Return(nil, sql.ErrNoRows)
+	db.EXPECT().GetNewsletter("broken").Return(nil, errors.New("error"))
+
+	n := newTestNewsletters(db)
+
+	newsletter, err := n.Recipient("0123456789ABCDEF01234567@IN.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, found, newsletter)
+
+	_, err = n.Recipient("0123456789abcdef01234567@example.com")
+	assert.Equal(t, ErrUnknownNewsletter, err)
+
+	_, err = n.Recipient("unknown@in.example.com")
+	assert.Equal(t, ErrUnknownNewsletter, err)
+
+	_, err = n.Recipient("broken@in.example.com")
+	assert.EqualError(t, err, "error")
+}
+
+func TestNewsletters_Ingest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	newsletter := &database.Newsletter{ID: 1, Token: "0123456789abcdef01234567", Source: "newsletter:0123456789abcdef01234567"}
+
+	db := database.NewMockDatabase(ctrl)
+	gomock.InOrder(
+		db.EXPECT().SaveItems(gomock.Any()).Do(func(items []*database.Item) {
+			assert.Len(t, items, 1)
+			assert.Equal(t, newsletter.Source, items[0].Source)
+			assert.Contains(t, items[0].Data, "mailto:news@example.com")
+			assert.NotContains(t, items[0].Data, newsletter.Token)
+		}).Return(nil),
+		db.EXPECT().InvalidateSourceRss(newsletter.Source).Return(nil),
+	)
+
+	n := newTestNewsletters(db)
+
+	assert.NoError(t, n.Ingest(newsletter, []byte(testNewsletterEmail)))
+	assert.True(t, errors.Is(n.Ingest(newsletter, []byte("no headers")), ErrMalformedNewsletter))
+}
+
+func TestNewNewsletter(t *testing.T) {
+	newsletter, err := NewNewsletter()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Len(t, newsletter.Token, newsletterTokenLength)
+	assert.Equal(t, strings.ToLower(newsletter.Token), newsletter.Token)
+	assert.True(t, IsNewsletterSource(newsletter.Source))
+	assert.False(t, IsNewsletterSource("https://one.com/"))
+	assert.Equal(t, newsletter.Token+"@in.example.com", NewsletterAddress(newsletter.Token, "in.example.com"))
+}
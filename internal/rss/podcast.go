@@ -0,0 +1,118 @@
+package rss
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+)
+
+var (
+	// namespace for podcast:guid, see https://podcastindex.org/namespace/1.0#guid
+	podcastGuidNamespace = [16]byte{
+		0xea, 0xd4, 0xc2, 0x36, 0xbf, 0x58, 0x58, 0xc6,
+		0xa2, 0xc6, 0xa6, 0xb2, 0x8d, 0x12, 0x8c, 0xb6,
+	}
+)
+
+// FeedUrl returns public url of aggregated feed
+func FeedUrl(publicUrl string, email string, name string) string {
+	return fmt.Sprintf("%s/%s/%s", strings.TrimRight(publicUrl, "/"), url.PathEscape(email), url.PathEscape(name))
+}
+
+func (a *aggregator) addPodcastSettings(feed *dto.RssFeed, rss *database.Rss) {
+	settings := rss.Podcast
+	if settings == nil {
+		settings = &database.PodcastSettings{}
+	}
+
+	feed.NamespaceItunes = dto.NamespaceItunes
+	feed.NamespacePodcast = dto.NamespacePodcast
+
+	channel := feed.Channel
+	channel.Language = valueOrDefault(channel.Language, defaultLanguage)
+	channel.ItunesAuthor = settings.Author
+	channel.ItunesExplicit = fmt.Sprintf("%t", settings.Explicit)
+	channel.ItunesType = settings.Type
+	channel.PodcastGuid = podcastGuid(FeedUrl(a.publicUrl, rss.Email, rss.Name))
+
+	if len(settings.OwnerEmail) > 0 {
+		channel.ItunesOwner = &dto.ItunesOwner{
+			Name:  settings.OwnerName,
+			Email: settings.OwnerEmail,
+		}
+	}
+
+	if len(settings.Image) > 0 {
+		channel.ItunesImage = &dto.ItunesImage{
+			Href: settings.Image,
+		}
+	}
+
+	if len(settings.Category) > 0 {
+		category := &dto.ItunesCategory{
+			Text: settings.Category,
+		}
+		if len(settings.Subcategory) > 0 {
+			category.Subcategories = []*dto.ItunesCategory{{Text: settings.Subcategory}}
+		}
+		channel.ItunesCategory = []*dto.ItunesCategory{category}
+	}
+
+	locked := "no"
+	if settings.Locked {
+		locked = "yes"
+	}
+	channel.PodcastLocked = &dto.PodcastLocked{
+		Owner:  settings.OwnerEmail,
+		Locked: locked,
+	}
+}
+
+// toEpisode returns nil for items without media, since podcast apps can't play them
+func toEpisode(item *dto.RssFeedItem) *dto.RssFeedItem {
+	if item.Enclosure == nil || len(item.Enclosure.Url) == 0 {
+		return nil
+	}
+
+	episode := *item
+	if len(episode.Guid) == 0 {
+		episode.Guid = episode.Enclosure.Url
+	}
+
+	return &episode
+}
+
+// withoutPodcastFields drops itunes elements, since plain feed doesn't declare its namespace
+func withoutPodcastFields(item *dto.RssFeedItem) *dto.RssFeedItem {
+	result := *item
+	result.ItunesDuration = ""
+	result.ItunesEpisode = ""
+	result.ItunesSeason = ""
+	result.ItunesEpisodeType = ""
+	result.ItunesExplicit = ""
+	result.ItunesImage = nil
+	return &result
+}
+
+// podcastGuid is uuid v5 of feed url without scheme and trailing slashes
+func podcastGuid(feedUrl string) string {
+	name := feedUrl
+	if i := strings.Index(name, "://"); i >= 0 {
+		name = name[i+3:]
+	}
+	name = strings.TrimRight(name, "/")
+
+	hash := sha1.New()
+	hash.Write(podcastGuidNamespace[:])
+	hash.Write([]byte(name))
+	sum := hash.Sum(nil)
+
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
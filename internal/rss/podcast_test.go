@@ -0,0 +1,242 @@
+package rss
+
+import (
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+)
+
+const (
+	podcastOne = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">
+<channel>
+	<title>One</title>
+	<ttl>60</ttl>
+	<itunes:image href="https://one.com/cover.jpg"/>
+	<item>
+		<title>Episode 2</title>
+		<guid>one-2</guid>
+		<pubDate>Mon, 02 Jan 2006 15:04:07 MST</pubDate>
+		<enclosure url="https://one.com/2.mp3" length="2048" type="audio/mpeg"/>
+		<itunes:duration>00:42:00</itunes:duration>
+		<itunes:episode>2</itunes:episode>
+		<itunes:season>1</itunes:season>
+		<itunes:explicit>false</itunes:explicit>
+	</item>
+	<item>
+		<title>Announcement</title>
+		<pubDate>Mon, 02 Jan 2006 15:04:06 MST</pubDate>
+	</item>
+</channel>
+</rss>`
+
+	podcastTwo = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">
+<channel>
+	<title>Two</title>
+	<item>
+		<title>Pilot</title>
+		<pubDate>Mon, 02 Jan 2006 15:04:05 MST</pubDate>
+		<enclosure url="https://two.com/pilot.m4a" length="1024" type="audio/x-m4a"/>
+		<itunes:duration>1800</itunes:duration>
+		<itunes:image href="https://two.com/pilot.jpg"/>
+		<itunes:episodeType>trailer</itunes:episodeType>
+	</item>
+</channel>
+</rss>`
+)
+
+var (
+	podcastSources = map[string]string{
+		"https://one.com/": podcastOne,
+		"https://two.com/": podcastTwo,
+	}
+
+	uuidRegexp = regexp.MustCompile("^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$")
+)
+
+type validatedPodcast struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Channel struct {
+		AtomLink []struct {
+			Href string `xml:"href,attr"`
+		} `xml:"http://www.w3.org/2005/Atom link"`
+		Author   string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd author"`
+		Explicit string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd explicit"`
+		Image    struct {
+			Href string `xml:"href,attr"`
+		} `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+		Category []struct {
+			Text string `xml:"text,attr"`
+		} `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd category"`
+		Owner struct {
+			Email string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd email"`
+		} `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd owner"`
+		Locked struct {
+			Owner string `xml:"owner,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"https://podcastindex.org/namespace/1.0 locked"`
+		Guid        string `xml:"https://podcastindex.org/namespace/1.0 guid"`
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		Description string `xml:"description"`
+		Language    string `xml:"language"`
+		Items       []struct {
+			Title     string `xml:"title"`
+			Guid      string `xml:"guid"`
+			Enclosure *struct {
+				Url    string `xml:"url,attr"`
+				Length int64  `xml:"length,attr"`
+				Type   string `xml:"type,attr"`
+			} `xml:"enclosure"`
+			Explicit string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd explicit"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+// validatePodcastFeed checks requirements of Apple Podcasts and Podcasting 2.0 for feed
+func validatePodcastFeed(raw []byte) []string {
+	feed := &validatedPodcast{}
+	if err := xml.Unmarshal(raw, feed); err != nil {
+		return []string{fmt.Sprintf("malformed xml: %s", err)}
+	}
+
+	problems := make([]string, 0)
+	check := func(ok bool, problem string) {
+		if !ok {
+			problems = append(problems, problem)
+		}
+	}
+
+	namespaces := make(map[string]string)
+	for _, attr := range feed.Attrs {
+		if attr.Name.Space == "xmlns" {
+			namespaces[attr.Name.Local] = attr.Value
+		}
+	}
+
+	channel := feed.Channel
+	check(feed.Version == "2.0", "rss version should be 2.0")
+	check(namespaces["itunes"] == dto.NamespaceItunes, "itunes namespace is not declared")
+	check(namespaces["podcast"] == dto.NamespacePodcast, "podcast namespace is not declared")
+	check(len(channel.Title) > 0, "channel title is required")
+	check(len(channel.Link) > 0, "channel link is required")
+	check(len(channel.Description) > 0, "channel description is required")
+	check(len(channel.Language) > 0, "channel language is required")
+	check(len(channel.Author) > 0, "itunes:author is required")
+	check(channel.Explicit == "true" || channel.Explicit == "false", "itunes:explicit should be true or false")
+	check(len(channel.Image.Href) > 0, "itunes:image is required")
+	check(len(channel.Category) > 0 && len(channel.Category[0].Text) > 0, "itunes:category is required")
+	check(len(channel.Owner.Email) > 0, "itunes:owner email is required")
+	check(channel.Locked.Value == "yes" || channel.Locked.Value == "no", "podcast:locked should be yes or no")
+	check(uuidRegexp.MatchString(channel.Guid), "podcast:guid should be uuid v5")
+
+	guids := make(map[string]bool)
+	for i, item := range channel.Items {
+		check(len(item.Title) > 0, fmt.Sprintf("item %d: title is required", i))
+		check(len(item.Guid) > 0 && !guids[item.Guid], fmt.Sprintf("item %d: guid should be unique", i))
+		guids[item.Guid] = true
+
+		if item.Enclosure == nil {
+			problems = append(problems, fmt.Sprintf("item %d: enclosure is required", i))
+			continue
+		}
+		check(len(item.Enclosure.Url) > 0, fmt.Sprintf("item %d: enclosure url is required", i))
+		check(len(item.Enclosure.Type) > 0, fmt.Sprintf("item %d: enclosure type is required", i))
+		check(item.Enclosure.Length > 0, fmt.Sprintf("item %d: enclosure length is required", i))
+	}
+
+	return problems
+}
+
+func TestAggregator_Podcast(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	f := NewMockFetcher(ctrl)
+	for url, raw := range podcastSources {
+		feed := &dto.RssFeed{}
+		assert.NoError(t, xml.Unmarshal([]byte(raw), feed))
+		f.EXPECT().Fetch(url).Return(feed, nil)
+	}
+
+	a := NewTestAggregator(f, newItemStore(ctrl))
+
+	rss := &database.Rss{
+		Email:   "example@gmail.com",
+		Name:    "podcasts",
+		Sources: []string{"https://one.com/", "https://two.com/"},
+		Mode:    database.ModePodcast,
+		Podcast: &database.PodcastSettings{
+			Author:      "Example",
+			OwnerEmail:  "example@gmail.com",
+			Image:       "https://example.com/cover.jpg",
+			Category:    "Technology",
+			Subcategory: "Tech News",
+		},
+	}
+
+	feed := a.Aggregate(rss, false)
+
+	raw, err := xml.Marshal(feed)
+	assert.NoError(t, err)
+	assert.Empty(t, validatePodcastFeed(raw))
+
+	items := feed.Channel.Items
+	assert.Len(t, items, 2)
+
+	assert.Equal(t, "Episode 2", items[0].Title)
+	assert.Equal(t, &dto.RssFeedEnclosure{Url: "https://one.com/2.mp3", Length: 2048, Type: "audio/mpeg"}, items[0].Enclosure)
+	assert.Equal(t, "00:42:00", items[0].ItunesDuration)
+	assert.Equal(t, "2", items[0].ItunesEpisode)
+	assert.Equal(t, "1", items[0].ItunesSeason)
+	assert.Equal(t, "false", items[0].ItunesExplicit)
+	assert.Equal(t, "https://one.com/cover.jpg", items[0].ItunesImage.Href)
+
+	assert.Equal(t, "https://two.com/pilot.m4a", items[1].Guid)
+	assert.Equal(t, "trailer", items[1].ItunesEpisodeType)
+	assert.Equal(t, "https://two.com/pilot.jpg", items[1].ItunesImage.Href)
+
+	// the second source has no ttl and is read again by minimal interval
+	assert.Equal(t, int64(defaultTtl), feed.Channel.Ttl)
+	assert.Equal(t, "en", feed.Channel.Language)
+	assert.True(t, strings.Contains(string(raw), `<itunes:category text="Technology"><itunes:category text="Tech News"></itunes:category></itunes:category>`))
+}
+
+func TestAggregator_PodcastFieldsDroppedForRss(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	feed := &dto.RssFeed{}
+	assert.NoError(t, xml.Unmarshal([]byte(podcastOne), feed))
+
+	f := NewMockFetcher(ctrl)
+	f.EXPECT().Fetch(gomock.Any()).Return(feed, nil)
+
+	a := NewTestAggregator(f, newItemStore(ctrl))
+
+	rss := &database.Rss{
+		Name:    "plain",
+		Sources: []string{"https://one.com/"},
+	}
+
+	raw, err := xml.Marshal(a.Aggregate(rss, false))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(raw), "itunes:")
+	assert.Contains(t, string(raw), `<enclosure url="https://one.com/2.mp3" length="2048" type="audio/mpeg"></enclosure>`)
+}
+
+func TestPodcastGuid(t *testing.T) {
+	// example from https://podcastindex.org/namespace/1.0#guid
+	assert.Equal(t, "917393e3-1b1e-5cef-ace4-edaa54e1f810", podcastGuid("https://mp3s.nashownotes.com/pc20rss.xml"))
+}
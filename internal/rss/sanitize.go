@@ -0,0 +1,154 @@
+package rss
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	// allowedTags are kept with allowed attributes only, other tags are dropped and their text is kept
+	allowedTags = map[string][]string{
+		"a": {"href", "title"}, "abbr": {"title"}, "b": nil, "blockquote": nil, "br": nil, "caption": nil, "code": nil,
+		"del": nil, "div": nil, "em": nil, "figcaption": nil, "figure": nil, "h1": nil, "h2": nil, "h3": nil, "h4": nil,
+		"h5": nil, "h6": nil, "hr": nil, "i": nil, "img": {"src", "alt", "title", "width", "height"}, "li": nil, "ol": nil,
+		"p": nil, "pre": nil, "s": nil, "small": nil, "span": nil, "strong": nil, "sub": nil, "sup": nil, "table": nil,
+		"tbody": nil, "td": {"colspan", "rowspan"}, "tfoot": nil, "th": {"colspan", "rowspan"}, "thead": nil, "tr": nil,
+		"u": nil, "ul": nil,
+	}
+	// droppedTags are dropped together with their content
+	droppedTags = map[string]bool{
+		"script": true, "style": true, "head": true, "title": true, "iframe": true, "object": true, "embed": true,
+		"noscript": true, "template": true, "svg": true, "math": true, "select": true, "textarea": true, "button": true,
+	}
+	voidTags = map[string]bool{"br": true, "hr": true, "img": true}
+)
+
+// sanitizeHtml keeps safe subset of markup, so description of item can be embedded by readers as is.
+// Tracking pixels are dropped as well
+func sanitizeHtml(body string) string {
+	var builder strings.Builder
+
+	tokenizer := html.NewTokenizer(strings.NewReader(body))
+	open := make([]string, 0)
+	dropped := 0
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+
+		token := tokenizer.Token()
+		switch tokenType {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if droppedTags[token.Data] {
+				if tokenType == html.StartTagToken {
+					dropped++
+				}
+				continue
+			}
+
+			attrs, ok := allowedTags[token.Data]
+			if !ok || dropped > 0 || isTrackingPixel(token) {
+				continue
+			}
+
+			builder.WriteString("<" + token.Data)
+			for _, attr := range token.Attr {
+				if !allowedAttr(attrs, attr) {
+					continue
+				}
+				builder.WriteString(" " + attr.Key + `="` + html.EscapeString(attr.Val) + `"`)
+			}
+			builder.WriteString(">")
+
+			if !voidTags[token.Data] && tokenType == html.StartTagToken {
+				open = append(open, token.Data)
+			}
+		case html.EndTagToken:
+			if droppedTags[token.Data] {
+				if dropped > 0 {
+					dropped--
+				}
+				continue
+			}
+
+			// closing tag without opening one is skipped, tags opened inside it are closed first
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] != token.Data {
+					continue
+				}
+				for j := len(open) - 1; j >= i; j-- {
+					builder.WriteString("</" + open[j] + ">")
+				}
+				open = open[:i]
+				break
+			}
+		case html.TextToken:
+			if dropped == 0 {
+				builder.WriteString(html.EscapeString(token.Data))
+			}
+		}
+	}
+
+	for i := len(open) - 1; i >= 0; i-- {
+		builder.WriteString("</" + open[i] + ">")
+	}
+
+	return strings.TrimSpace(builder.String())
+}
+
+func allowedAttr(allowed []string, attr html.Attribute) bool {
+	if len(attr.Namespace) > 0 {
+		return false
+	}
+
+	for _, key := range allowed {
+		if key != attr.Key {
+			continue
+		}
+
+		if key == "href" || key == "src" {
+			return safeUrl(attr.Val, key == "href")
+		}
+		return true
+	}
+
+	return false
+}
+
+// safeUrl allows absolute http urls, links may be mailto as well
+func safeUrl(value string, link bool) bool {
+	u, err := url.Parse(strings.TrimSpace(value))
+	if err != nil {
+		return false
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return len(u.Host) > 0
+	case "mailto":
+		return link
+	default:
+		return false
+	}
+}
+
+func isTrackingPixel(token html.Token) bool {
+	if token.Data != "img" {
+		return false
+	}
+
+	width, height := "", ""
+	for _, attr := range token.Attr {
+		switch attr.Key {
+		case "width":
+			width = strings.TrimSuffix(attr.Val, "px")
+		case "height":
+			height = strings.TrimSuffix(attr.Val, "px")
+		}
+	}
+
+	return (width == "0" || width == "1") && (height == "0" || height == "1")
+}
@@ -0,0 +1,67 @@
+package rss
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeHtml(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			name:     "safe markup is kept",
+			body:     `<p>Hello <b>world</b><br/><a href="https://example.com/" title="link">link</a></p>`,
+			expected: `<p>Hello <b>world</b><br><a href="https://example.com/" title="link">link</a></p>`,
+		},
+		{
+			name:     "scripts and styles are dropped with content",
+			body:     `<style>p {color: red}</style><p>text</p><script>alert(1)</script>`,
+			expected: `<p>text</p>`,
+		},
+		{
+			name:     "unknown tags are dropped, their text is kept",
+			body:     `<html><body><center><font color="red">text</font></center></body></html>`,
+			expected: `text`,
+		},
+		{
+			name:     "event handlers and unsafe urls are dropped",
+			body:     `<a href="javascript:alert(1)" onclick="alert(1)">one</a><img src="data:image/png;base64,AAAA" alt="two">`,
+			expected: `<a>one</a><img alt="two">`,
+		},
+		{
+			name:     "mailto links are kept",
+			body:     `<a href="mailto:unsubscribe@example.com">unsubscribe</a>`,
+			expected: `<a href="mailto:unsubscribe@example.com">unsubscribe</a>`,
+		},
+		{
+			name:     "tracking pixels are dropped",
+			body:     `<p>text</p><img src="https://track.example.com/open.gif" width="1" height="1">`,
+			expected: `<p>text</p>`,
+		},
+		{
+			name:     "unclosed tags are closed",
+			body:     `<div><p><i>text</div>more`,
+			expected: `<div><p><i>text</i></p></div>more`,
+		},
+		{
+			name:     "stray closing tags are skipped",
+			body:     `</p>text</b>`,
+			expected: `text`,
+		},
+		{
+			name:     "text is escaped",
+			body:     `<p>1 &lt; 2 &amp; "3"</p>`,
+			expected: `<p>1 &lt; 2 &amp; &#34;3&#34;</p>`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, sanitizeHtml(test.body))
+		})
+	}
+}
@@ -0,0 +1,229 @@
+//go:generate mockgen -package ${GOPACKAGE} -destination mock_scheduler.go -source scheduler.go
+package rss
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"service-rss/internal/config"
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+)
+
+const (
+	// count of the newest items used to estimate update frequency of source
+	frequencyItemsCount = 10
+)
+
+type Scheduler interface {
+	// Schedule updates state of source after fetch at now, feed is nil on failure
+	Schedule(state *database.SourceState, feed *dto.RssFeed, err error, now time.Time)
+}
+
+type scheduler struct {
+	minInterval    time.Duration
+	maxInterval    time.Duration
+	pushedInterval time.Duration
+	backoff        time.Duration
+	maxBackoff     time.Duration
+	jitter         float64
+	random         func() float64
+}
+
+func NewScheduler(cfg *config.Config) Scheduler {
+	return &scheduler{
+		minInterval:    cfg.SchedulerMinInterval,
+		maxInterval:    cfg.SchedulerMaxInterval,
+		pushedInterval: cfg.WebSubPollInterval,
+		backoff:        cfg.SchedulerBackoff,
+		maxBackoff:     cfg.SchedulerMaxBackoff,
+		jitter:         cfg.SchedulerJitter,
+		random:         rand.Float64,
+	}
+}
+
+func (s *scheduler) Schedule(state *database.SourceState, feed *dto.RssFeed, err error, now time.Time) {
+	state.LastFetchTime = &now
+
+	if err != nil {
+		s.scheduleRetry(state, err, now)
+		return
+	}
+
+	state.LastSuccessTime = &now
+	state.Failures = 0
+	state.LastError = ""
+	state.SkipHours, state.SkipDays = skipSettings(feed.Channel)
+
+	newest := newestItemTime(feed.Channel.Items)
+	changed := newest != nil && (state.LastItemTime == nil || newest.After(*state.LastItemTime))
+	if changed {
+		state.LastItemTime = newest
+	}
+
+	interval := state.Interval
+	if gap, ok := averageItemGap(feed.Channel.Items); ok {
+		// source which went quiet is read by time since its last item instead of former frequency
+		if since := now.Sub(*newest); since > gap {
+			gap = since
+		}
+
+		// source is read twice per its usual gap, so new item waits half of it in average
+		interval = gap / 2
+	} else if interval == 0 {
+		interval = s.minInterval
+	} else if changed {
+		interval /= 2
+	} else {
+		interval = interval * 3 / 2
+	}
+	interval = clamp(interval, s.minInterval, s.maxInterval)
+	state.Interval = interval
+
+	// ttl is a request of publisher not to read feed more often, it doesn't postpone fetch beyond max interval
+	if ttl := time.Duration(feed.Channel.Ttl) * time.Minute; ttl > interval {
+		interval = clamp(ttl, s.minInterval, s.maxInterval)
+	}
+
+	// updates of pushed source come from hub, it is polled only to catch ones missed by hub
+	if state.Pushed && interval < s.pushedInterval {
+		interval = s.pushedInterval
+	}
+
+	state.NextFetchTime = skipUnavailable(now.Add(s.withJitter(interval)), state.SkipHours, state.SkipDays)
+}
+
+func (s *scheduler) scheduleRetry(state *database.SourceState, err error, now time.Time) {
+	state.Failures++
+	state.LastError = err.Error()
+
+	delay := s.backoff
+	for i := 1; i < state.Failures && delay < s.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > s.maxBackoff {
+		delay = s.maxBackoff
+	}
+	delay = s.withJitter(delay)
+
+	var httpErr *HttpError
+	if errors.As(err, &httpErr) && httpErr.RetryAfter > delay {
+		delay = httpErr.RetryAfter
+	}
+
+	state.NextFetchTime = skipUnavailable(now.Add(delay), state.SkipHours, state.SkipDays)
+}
+
+// withJitter spreads fetches of sources added together, so they don't come in bursts
+func (s *scheduler) withJitter(d time.Duration) time.Duration {
+	factor := 1 + s.jitter*(2*s.random()-1)
+	return time.Duration(float64(d) * factor)
+}
+
+func skipSettings(channel *dto.RssFeedChannel) ([]int64, []string) {
+	hours := make([]int64, 0)
+	if channel.SkipHours != nil {
+		for _, hour := range channel.SkipHours.Hours {
+			if hour >= 0 && hour < 24 {
+				hours = append(hours, hour)
+			}
+		}
+	}
+
+	days := make([]string, 0)
+	if channel.SkipDays != nil {
+		for _, day := range channel.SkipDays.Days {
+			days = append(days, strings.TrimSpace(day))
+		}
+	}
+
+	return hours, days
+}
+
+// skipUnavailable moves time out of skip hours and days, they are in GMT according to specification
+func skipUnavailable(t time.Time, hours []int64, days []string) time.Time {
+	// a week of hours is enough to leave any skip settings, unless all of them are skipped
+	for i := 0; i < 24*8; i++ {
+		utc := t.UTC()
+
+		skipped := false
+		for _, day := range days {
+			if strings.EqualFold(day, utc.Weekday().String()) {
+				t = time.Date(utc.Year(), utc.Month(), utc.Day()+1, 0, 0, 0, 0, time.UTC)
+				skipped = true
+				break
+			}
+		}
+		if skipped {
+			continue
+		}
+
+		for _, hour := range hours {
+			if int64(utc.Hour()) == hour {
+				t = utc.Truncate(time.Hour).Add(time.Hour)
+				skipped = true
+				break
+			}
+		}
+		if !skipped {
+			return t
+		}
+	}
+
+	return t
+}
+
+func newestItemTime(items []*dto.RssFeedItem) *time.Time {
+	var newest *time.Time
+	for _, item := range items {
+		t := parsePubDate(item.PubDate)
+		if t != nil && (newest == nil || t.After(*newest)) {
+			newest = t
+		}
+	}
+
+	return newest
+}
+
+// averageItemGap is estimated by the newest dated items, it is unknown if there are less than three of them
+func averageItemGap(items []*dto.RssFeedItem) (time.Duration, bool) {
+	dates := make([]time.Time, 0, len(items))
+	for _, item := range items {
+		if t := parsePubDate(item.PubDate); t != nil {
+			dates = append(dates, *t)
+		}
+	}
+
+	if len(dates) < 3 {
+		return 0, false
+	}
+
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i].After(dates[j])
+	})
+	if len(dates) > frequencyItemsCount {
+		dates = dates[:frequencyItemsCount]
+	}
+
+	gap := dates[0].Sub(dates[len(dates)-1]) / time.Duration(len(dates)-1)
+	if gap <= 0 {
+		return 0, false
+	}
+
+	return gap, true
+}
+
+func clamp(d time.Duration, min time.Duration, max time.Duration) time.Duration {
+	if d < min {
+		return min
+	}
+
+	if d > max {
+		return max
+	}
+
+	return d
+}
@@ -0,0 +1,158 @@
+package rss
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+)
+
+func newTestScheduler() *scheduler {
+	return &scheduler{
+		minInterval:    5 * time.Minute,
+		maxInterval:    6 * time.Hour,
+		pushedInterval: 12 * time.Hour,
+		backoff:        time.Minute,
+		maxBackoff:     time.Hour,
+		jitter:         0.1,
+		random: func() float64 {
+			return 0.5
+		},
+	}
+}
+
+func datedFeed(newest time.Time, gap time.Duration, count int) *dto.RssFeed {
+	items := make([]*dto.RssFeedItem, 0, count)
+	for i := 0; i < count; i++ {
+		items = append(items, &dto.RssFeedItem{
+			Title:   "item",
+			PubDate: newest.Add(-time.Duration(i) * gap).Format(time.RFC1123Z),
+		})
+	}
+	return &dto.RssFeed{Channel: &dto.RssFeedChannel{Items: items}}
+}
+
+func TestScheduler_Schedule(t *testing.T) {
+	now := time.Date(2021, 3, 3, 12, 0, 0, 0, time.UTC)
+
+	t.Run("interval is half of item gap", func(t *testing.T) {
+		state := &database.SourceState{Url: "https://one.com/"}
+		newTestScheduler().Schedule(state, datedFeed(now.Add(-10*time.Minute), time.Hour, 5), nil, now)
+
+		assert.Equal(t, 30*time.Minute, state.Interval)
+		assert.Equal(t, now.Add(30*time.Minute), state.NextFetchTime)
+		assert.WithinDuration(t, now.Add(-10*time.Minute), *state.LastItemTime, 0)
+		assert.Equal(t, now, *state.LastSuccessTime)
+	})
+
+	t.Run("quiet source is read less often", func(t *testing.T) {
+		state := &database.SourceState{Url: "https://one.com/"}
+		newTestScheduler().Schedule(state, datedFeed(now.Add(-4*time.Hour), time.Hour, 5), nil, now)
+
+		assert.Equal(t, 2*time.Hour, state.Interval)
+	})
+
+	t.Run("interval is clamped", func(t *testing.T) {
+		state := &database.SourceState{Url: "https://one.com/"}
+		newTestScheduler().Schedule(state, datedFeed(now, time.Minute, 5), nil, now)
+		assert.Equal(t, 5*time.Minute, state.Interval)
+
+		newTestScheduler().Schedule(state, datedFeed(now.Add(-30*24*time.Hour), 24*time.Hour, 5), nil, now)
+		assert.Equal(t, 6*time.Hour, state.Interval)
+	})
+
+	t.Run("undated items", func(t *testing.T) {
+		feed := &dto.RssFeed{Channel: &dto.RssFeedChannel{Items: []*dto.RssFeedItem{{Title: "item"}}}}
+		state := &database.SourceState{Url: "https://one.com/"}
+
+		newTestScheduler().Schedule(state, feed, nil, now)
+		assert.Equal(t, 5*time.Minute, state.Interval)
+
+		newTestScheduler().Schedule(state, feed, nil, now)
+		assert.Equal(t, 7*time.Minute+30*time.Second, state.Interval)
+	})
+
+	t.Run("ttl of source", func(t *testing.T) {
+		feed := datedFeed(now, time.Hour, 5)
+		feed.Channel.Ttl = 120
+		state := &database.SourceState{Url: "https://one.com/"}
+
+		newTestScheduler().Schedule(state, feed, nil, now)
+		assert.Equal(t, 30*time.Minute, state.Interval)
+		assert.Equal(t, now.Add(2*time.Hour), state.NextFetchTime)
+
+		feed.Channel.Ttl = 24 * 60
+		newTestScheduler().Schedule(state, feed, nil, now)
+		assert.Equal(t, now.Add(6*time.Hour), state.NextFetchTime)
+	})
+
+	t.Run("pushed source", func(t *testing.T) {
+		state := &database.SourceState{Url: "https://one.com/", Pushed: true}
+
+		newTestScheduler().Schedule(state, datedFeed(now, time.Hour, 5), nil, now)
+		assert.Equal(t, 30*time.Minute, state.Interval)
+		assert.Equal(t, now.Add(12*time.Hour), state.NextFetchTime)
+	})
+
+	t.Run("skip hours and days", func(t *testing.T) {
+		feed := datedFeed(now, time.Hour, 5)
+		feed.Channel.SkipHours = &dto.SkipHours{Hours: []int64{12, 13}}
+		feed.Channel.SkipDays = &dto.SkipDays{Days: []string{" Thursday "}}
+		state := &database.SourceState{Url: "https://one.com/"}
+
+		newTestScheduler().Schedule(state, feed, nil, now)
+		assert.Equal(t, []int64{12, 13}, state.SkipHours)
+		assert.Equal(t, []string{"Thursday"}, state.SkipDays)
+		assert.Equal(t, time.Date(2021, 3, 3, 14, 0, 0, 0, time.UTC), state.NextFetchTime)
+
+		late := time.Date(2021, 3, 3, 23, 50, 0, 0, time.UTC)
+		newTestScheduler().Schedule(state, feed, nil, late)
+		assert.Equal(t, time.Date(2021, 3, 5, 0, 0, 0, 0, time.UTC), state.NextFetchTime)
+	})
+
+	t.Run("backoff", func(t *testing.T) {
+		state := &database.SourceState{Url: "https://one.com/", Interval: time.Hour}
+		s := newTestScheduler()
+
+		s.Schedule(state, nil, errors.New("error"), now)
+		assert.Equal(t, 1, state.Failures)
+		assert.Equal(t, "error", state.LastError)
+		assert.Equal(t, now.Add(time.Minute), state.NextFetchTime)
+
+		s.Schedule(state, nil, errors.New("error"), now)
+		assert.Equal(t, now.Add(2*time.Minute), state.NextFetchTime)
+
+		for i := 0; i < 10; i++ {
+			s.Schedule(state, nil, errors.New("error"), now)
+		}
+		assert.Equal(t, now.Add(time.Hour), state.NextFetchTime)
+		assert.Equal(t, time.Hour, state.Interval)
+
+		s.Schedule(state, datedFeed(now, time.Hour, 5), nil, now)
+		assert.Equal(t, 0, state.Failures)
+		assert.Empty(t, state.LastError)
+	})
+
+	t.Run("retry after", func(t *testing.T) {
+		state := &database.SourceState{Url: "https://one.com/"}
+		err := &HttpError{StatusCode: http.StatusTooManyRequests, RetryAfter: 3 * time.Hour}
+
+		newTestScheduler().Schedule(state, nil, err, now)
+		assert.Equal(t, now.Add(3*time.Hour), state.NextFetchTime)
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2021, 3, 3, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 120*time.Second, parseRetryAfter("120", now))
+	assert.Equal(t, time.Hour, parseRetryAfter("Wed, 03 Mar 2021 13:00:00 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("Wed, 03 Mar 2021 11:00:00 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+}
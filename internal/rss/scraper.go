@@ -0,0 +1,321 @@
+package rss
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"service-rss/internal/dto"
+)
+
+const (
+	// ScrapedSourcePrefix marks sources which are html pages scraped by css selectors
+	ScrapedSourcePrefix = "scrape:"
+
+	// pages are read up to that size, the rest of page is ignored
+	maxScrapedPageBytes = 5 << 20
+)
+
+var (
+	// ErrMalformedScrapedSource means source has no url, required selectors or selectors can't be parsed
+	ErrMalformedScrapedSource = errors.New("malformed scraped source")
+
+	// scrapedDateLayouts are tried in order, pages show dates for humans
+	scrapedDateLayouts = []string{
+		time.RFC3339, time.RFC1123Z, time.RFC1123, time.RFC822Z, time.RFC822, "2006-01-02T15:04:05", "2006-01-02 15:04:05",
+		"2006-01-02 15:04", "2006-01-02", "January 2, 2006", "Jan 2, 2006", "2 January 2006", "2 Jan 2006", "02.01.2006",
+		"01/02/2006",
+	}
+
+	pageTitleSelector = cascadia.MustCompile("title")
+	linkSelector      = cascadia.MustCompile("a[href]")
+)
+
+// ScrapedSource is page of items without feed, selectors of fields are relative to item container
+type ScrapedSource struct {
+	Url     string
+	Item    string
+	Title   string
+	Link    string // optional, link of title is used by default
+	Date    string // optional
+	Summary string // optional
+}
+
+// scrapedSelectors are compiled selectors of source, optional ones are nil
+type scrapedSelectors struct {
+	item    cascadia.Matcher
+	title   cascadia.Matcher
+	link    cascadia.Matcher
+	date    cascadia.Matcher
+	summary cascadia.Matcher
+}
+
+// IsScrapedSource tells that source is html page instead of feed
+func IsScrapedSource(source string) bool {
+	return strings.HasPrefix(source, ScrapedSourcePrefix)
+}
+
+// String is the source kept in rss, it is stable for the same url and selectors
+func (s *ScrapedSource) String() string {
+	values := url.Values{}
+	for key, value := range map[string]string{
+		"url": s.Url, "item": s.Item, "title": s.Title, "link": s.Link, "date": s.Date, "summary": s.Summary,
+	} {
+		if len(value) > 0 {
+			values.Set(key, value)
+		}
+	}
+
+	return ScrapedSourcePrefix + values.Encode()
+}
+
+// ParseScrapedSource returns ErrMalformedScrapedSource if source can't be scraped
+func ParseScrapedSource(source string) (*ScrapedSource, error) {
+	if !IsScrapedSource(source) {
+		return nil, fmt.Errorf("%w: no %s prefix", ErrMalformedScrapedSource, ScrapedSourcePrefix)
+	}
+
+	values, err := url.ParseQuery(strings.TrimPrefix(source, ScrapedSourcePrefix))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedScrapedSource, err)
+	}
+
+	scraped := &ScrapedSource{
+		Url:     values.Get("url"),
+		Item:    values.Get("item"),
+		Title:   values.Get("title"),
+		Link:    values.Get("link"),
+		Date:    values.Get("date"),
+		Summary: values.Get("summary"),
+	}
+
+	_, err = scraped.selectors()
+	if err != nil {
+		return nil, err
+	}
+
+	return scraped, nil
+}
+
+// selectors validates source and compiles its selectors
+func (s *ScrapedSource) selectors() (*scrapedSelectors, error) {
+	u, err := url.Parse(s.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return nil, fmt.Errorf("%w: url should be absolute http url", ErrMalformedScrapedSource)
+	}
+
+	if len(s.Item) == 0 || len(s.Title) == 0 {
+		return nil, fmt.Errorf("%w: item and title selectors are required", ErrMalformedScrapedSource)
+	}
+
+	compiled := &scrapedSelectors{}
+	for _, selector := range []struct {
+		name     string
+		value    string
+		compiled *cascadia.Matcher
+	}{
+		{"item", s.Item, &compiled.item},
+		{"title", s.Title, &compiled.title},
+		{"link", s.Link, &compiled.link},
+		{"date", s.Date, &compiled.date},
+		{"summary", s.Summary, &compiled.summary},
+	} {
+		if len(selector.value) == 0 {
+			continue
+		}
+
+		group, err := cascadia.ParseGroup(selector.value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s selector: %v", ErrMalformedScrapedSource, selector.name, err)
+		}
+		*selector.compiled = group
+	}
+
+	return compiled, nil
+}
+
+// scrape turns page into feed, items without title are skipped
+func scrape(source *ScrapedSource, page io.Reader) (*dto.RssFeed, error) {
+	selectors, err := source.selectors()
+	if err != nil {
+		return nil, err
+	}
+
+	pageUrl, err := url.Parse(source.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := html.Parse(io.LimitReader(page, maxScrapedPageBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	channel := &dto.RssFeedChannel{
+		Link:  source.Url,
+		Items: make([]*dto.RssFeedItem, 0),
+	}
+	if title := cascadia.Query(doc, pageTitleSelector); title != nil {
+		channel.Title = nodeText(title)
+	}
+	if len(channel.Title) == 0 {
+		channel.Title = pageUrl.Host
+	}
+
+	for _, node := range cascadia.QueryAll(doc, selectors.item) {
+		item := scrapeItem(selectors, pageUrl, node)
+		if item == nil {
+			continue
+		}
+
+		item.Source = &dto.RssFeedSource{Url: source.Url, Title: channel.Title}
+		channel.Items = append(channel.Items, item)
+	}
+
+	if len(channel.Items) == 0 {
+		return nil, errors.New("no items matched selectors")
+	}
+
+	return &dto.RssFeed{Channel: channel}, nil
+}
+
+func scrapeItem(selectors *scrapedSelectors, pageUrl *url.URL, node *html.Node) *dto.RssFeedItem {
+	titleNode := queryFirst(node, selectors.title)
+	if titleNode == nil {
+		return nil
+	}
+
+	item := &dto.RssFeedItem{Title: nodeText(titleNode)}
+	if len(item.Title) == 0 {
+		return nil
+	}
+
+	// link of title is used if there is no link selector, item container is the last resort
+	linkNode := titleNode
+	if selectors.link != nil {
+		linkNode = queryFirst(node, selectors.link)
+	}
+	href := nodeHref(linkNode)
+	if len(href) == 0 && selectors.link == nil {
+		href = nodeHref(node)
+	}
+	if link, err := pageUrl.Parse(href); len(href) > 0 && err == nil && (link.Scheme == "http" || link.Scheme == "https") {
+		item.Link = link.String()
+	}
+
+	if selectors.date != nil {
+		if date := parseScrapedDate(queryFirst(node, selectors.date)); date != nil {
+			item.PubDate = date.Format(time.RFC1123Z)
+		}
+	}
+
+	if selectors.summary != nil {
+		if summaryNode := queryFirst(node, selectors.summary); summaryNode != nil {
+			item.Description = sanitizeHtml(innerHtml(summaryNode))
+		}
+	}
+
+	return item
+}
+
+// queryFirst matches node itself as well, so field may be item container
+func queryFirst(node *html.Node, matcher cascadia.Matcher) *html.Node {
+	if node == nil {
+		return nil
+	}
+	if matcher.Match(node) {
+		return node
+	}
+
+	return cascadia.Query(node, matcher)
+}
+
+// nodeText is text of node with collapsed whitespace
+func nodeText(node *html.Node) string {
+	var builder strings.Builder
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			builder.WriteString(n.Data)
+		}
+
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			// node itself may be dropped one like page title
+			if child.Type == html.ElementNode && droppedTags[child.Data] {
+				continue
+			}
+			walk(child)
+		}
+	}
+	walk(node)
+
+	return strings.Join(strings.Fields(builder.String()), " ")
+}
+
+// nodeHref is href of link node or of the first link inside node
+func nodeHref(node *html.Node) string {
+	if node == nil {
+		return ""
+	}
+
+	link := node
+	if link.DataAtom != atom.A {
+		link = cascadia.Query(node, linkSelector)
+	}
+	if link == nil {
+		return ""
+	}
+
+	for _, attr := range link.Attr {
+		if attr.Key == "href" {
+			return strings.TrimSpace(attr.Val)
+		}
+	}
+
+	return ""
+}
+
+func innerHtml(node *html.Node) string {
+	var buffer bytes.Buffer
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if err := html.Render(&buffer, child); err != nil {
+			return ""
+		}
+	}
+
+	return buffer.String()
+}
+
+// parseScrapedDate prefers machine readable datetime attribute of time element
+func parseScrapedDate(node *html.Node) *time.Time {
+	if node == nil {
+		return nil
+	}
+
+	values := make([]string, 0, 2)
+	for _, attr := range node.Attr {
+		if attr.Key == "datetime" {
+			values = append(values, strings.TrimSpace(attr.Val))
+		}
+	}
+	values = append(values, nodeText(node))
+
+	for _, value := range values {
+		for _, layout := range scrapedDateLayouts {
+			if date, err := time.Parse(layout, value); err == nil {
+				return &date
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package rss
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/dto"
+)
+
+const testScrapedPage = `<html><head><title> Vendor
+	changelog </title></head><body>
+<ul class="changes">
+	<li class="entry">
+		<h2><a href="/changes/2">Version <b>2.0</b></a></h2>
+		<time datetime="2021-03-10T08:00:00Z">yesterday</time>
+		<div class="summary"><p onclick="alert(1)">Breaking <em>changes</em></p><script>alert(1)</script></div>
+	</li>
+	<li class="entry">
+		<h2>Version 1.1</h2>
+		<span class="date">Mar 2, 2021</span>
+		<a class="more" href="https://other.example.com/1.1">details</a>
+	</li>
+	<li class="entry"><h2></h2></li>
+</ul>
+</body></html>`
+
+func TestScrapedSource(t *testing.T) {
+	source := &ScrapedSource{Url: "https://vendor.example.com/changelog", Item: "li.entry", Title: "h2"}
+
+	assert.Equal(t, "scrape:item=li.entry&title=h2&url=https%3A%2F%2Fvendor.example.com%2Fchangelog", source.String())
+	assert.True(t, IsScrapedSource(source.String()))
+	assert.False(t, IsScrapedSource("https://vendor.example.com/changelog"))
+
+	parsed, err := ParseScrapedSource(source.String())
+	assert.NoError(t, err)
+	assert.Equal(t, source, parsed)
+
+	for _, malformed := range []string{
+		"https://vendor.example.com/changelog",
+		"scrape:item=li&title=h2",
+		"scrape:item=li&title=h2&url=javascript%3Aalert(1)",
+		"scrape:title=h2&url=https%3A%2F%2Fvendor.example.com%2F",
+		"scrape:item=li%5B&title=h2&url=https%3A%2F%2Fvendor.example.com%2F",
+		"scrape:item=li&title=h2&date=%3Anope&url=https%3A%2F%2Fvendor.example.com%2F",
+	} {
+		_, err = ParseScrapedSource(malformed)
+		assert.True(t, errors.Is(err, ErrMalformedScrapedSource), malformed)
+	}
+}
+
+func TestScrape(t *testing.T) {
+	t.Run("all selectors", func(t *testing.T) {
+		source := &ScrapedSource{
+			Url:     "https://vendor.example.com/changelog",
+			Item:    "li.entry",
+			Title:   "h2",
+			Link:    "h2 a, a.more",
+			Date:    "time, .date",
+			Summary: ".summary",
+		}
+
+		feed, err := scrape(source, strings.NewReader(testScrapedPage))
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		origin := &dto.RssFeedSource{Url: "https://vendor.example.com/changelog", Title: "Vendor changelog"}
+		assert.Equal(t, "Vendor changelog", feed.Channel.Title)
+		assert.Equal(t, "https://vendor.example.com/changelog", feed.Channel.Link)
+		assert.Equal(t, []*dto.RssFeedItem{
+			{
+				Title:       "Version 2.0",
+				Link:        "https://vendor.example.com/changes/2",
+				PubDate:     "Wed, 10 Mar 2021 08:00:00 +0000",
+				Description: "<p>Breaking <em>changes</em></p>",
+				Source:      origin,
+			},
+			{
+				Title:   "Version 1.1",
+				Link:    "https://other.example.com/1.1",
+				PubDate: "Tue, 02 Mar 2021 00:00:00 +0000",
+				Source:  origin,
+			},
+		}, feed.Channel.Items)
+	})
+
+	t.Run("link of title or item by default", func(t *testing.T) {
+		source := &ScrapedSource{Url: "https://vendor.example.com/changelog", Item: "li.entry", Title: "h2"}
+
+		feed, err := scrape(source, strings.NewReader(testScrapedPage))
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.Len(t, feed.Channel.Items, 2)
+		assert.Equal(t, "https://vendor.example.com/changes/2", feed.Channel.Items[0].Link)
+		assert.Equal(t, "https://other.example.com/1.1", feed.Channel.Items[1].Link)
+		assert.Empty(t, feed.Channel.Items[1].PubDate)
+	})
+
+	t.Run("no items", func(t *testing.T) {
+		source := &ScrapedSource{Url: "https://vendor.example.com/changelog", Item: "article", Title: "h2"}
+
+		_, err := scrape(source, strings.NewReader(testScrapedPage))
+		assert.EqualError(t, err, "no items matched selectors")
+	})
+}
+
+func TestFetcher_Scrape(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/changelog" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(testScrapedPage))
+	}))
+	defer server.Close()
+
+	f := &fetcher{client: server.Client(), histogram: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "fetch_duration_seconds",
+		Help: "Histogram of fetch time in seconds",
+	}, []string{"status"})}
+
+	source := &ScrapedSource{Url: server.URL + "/changelog", Item: "li.entry", Title: "h2"}
+	feed, err := f.Fetch(source.String())
+	if assert.NoError(t, err) {
+		assert.Len(t, feed.Channel.Items, 2)
+		assert.Equal(t, server.URL+"/changes/2", feed.Channel.Items[0].Link)
+	}
+
+	missing := &ScrapedSource{Url: server.URL + "/missing", Item: "li.entry", Title: "h2"}
+	_, err = f.Fetch(missing.String())
+	httpErr := &HttpError{}
+	assert.True(t, errors.As(err, &httpErr))
+	assert.Equal(t, http.StatusNotFound, httpErr.StatusCode)
+}
@@ -0,0 +1,429 @@
+//go:generate mockgen -package ${GOPACKAGE} -destination mock_subscriber.go -source subscriber.go
+package rss
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+
+	"service-rss/internal/config"
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+	"service-rss/internal/netguard"
+	"service-rss/internal/safe"
+)
+
+const (
+	WebSubModeSubscribe   = "subscribe"
+	WebSubModeUnsubscribe = "unsubscribe"
+	WebSubModeDenied      = "denied"
+
+	subscribeBatchSize = 20
+	subscribeTimeout   = 10 * time.Second
+
+	// leases granted by hubs are clamped, so subscriptions are neither renewed all the time nor forgotten
+	minLeaseSeconds = 5 * 60
+	maxLeaseSeconds = 30 * 24 * 60 * 60
+)
+
+var (
+	// ErrUnknownSubscription means callback is called for subscription which is not wanted
+	ErrUnknownSubscription = errors.New("unknown subscription")
+	// ErrInvalidSignature means pushed content is not signed by secret of subscription, it should be ignored
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrMalformedContent means pushed content is not rss feed
+	ErrMalformedContent = errors.New("malformed content")
+
+	signatureHashes = map[string]func() hash.Hash{
+		"sha1":   sha1.New,
+		"sha256": sha256.New,
+		"sha384": sha512.New384,
+		"sha512": sha512.New,
+	}
+)
+
+// Subscriber subscribes to websub hubs of sources, so their updates are pushed instead of polled
+type Subscriber interface {
+	// Discover subscribes source to hub advertised by its fetched feed, it is cheap for known subscriptions
+	Discover(source string, feed *dto.RssFeed)
+	// Verify confirms intent of subscription by hub, lease seconds are zero if hub didn't grant lease,
+	// token is random part of callback url
+	Verify(id int64, token string, mode string, topic string, leaseSeconds int64, reason string) error
+	// Receive ingests content pushed by hub, signature is value of X-Hub-Signature header
+	Receive(id int64, token string, body []byte, signature string) error
+	Start()
+	Shutdown()
+}
+
+type subscriber struct {
+	db          database.Database
+	client      *http.Client
+	publicUrl   string
+	lease       time.Duration
+	checkPeriod time.Duration
+	retry       time.Duration
+	maxRetry    time.Duration
+	counter     *prometheus.CounterVec
+
+	// known are hub and topic of sources saved by this replica, so subscriptions are not saved on every fetch
+	known      map[string]string
+	knownMutex sync.Mutex
+
+	// graceful shutdown helper-channels
+	shutdownChan     chan interface{}
+	shutdownWaitChan chan interface{}
+}
+
+// NewSubscriber makes subscriber with callbacks at public url
+func NewSubscriber(cfg *config.Config, db database.Database) (Subscriber, error) {
+	s := newSubscriber(cfg, db)
+
+	err := prometheus.Register(s.counter)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// newSubscriber makes subscriber without registering its metrics
+func newSubscriber(cfg *config.Config, db database.Database) *subscriber {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "websub_events_counter",
+		Help: "Counter of websub subscriptions and pushes by event",
+	}, []string{"event"})
+
+	return &subscriber{
+		db:          db,
+		client:      netguard.New(cfg).Client(subscribeTimeout),
+		publicUrl:   cfg.ServerPublicUrl,
+		lease:       cfg.WebSubLease,
+		checkPeriod: cfg.WebSubCheckPeriod,
+		retry:       cfg.WebSubRetry,
+		maxRetry:    cfg.WebSubMaxRetry,
+		counter:     counter,
+		known:       make(map[string]string),
+
+		shutdownChan:     make(chan interface{}),
+		shutdownWaitChan: make(chan interface{}),
+	}
+}
+
+// CallbackUrl is url of websub callback of subscription, token keeps callbacks from being called by others
+func CallbackUrl(publicUrl string, id int64, token string) string {
+	return fmt.Sprintf("%s/websub/%d/%s", strings.TrimRight(publicUrl, "/"), id, token)
+}
+
+func (s *subscriber) Discover(source string, feed *dto.RssFeed) {
+	hub, topic := hubLinks(feed.Channel)
+	if len(hub) == 0 {
+		return
+	}
+	if len(topic) == 0 {
+		topic = source
+	}
+
+	key := hub + " " + topic
+	s.knownMutex.Lock()
+	known := s.known[source] == key
+	s.knownMutex.Unlock()
+	if known {
+		return
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		log.WithError(err).Error("failed to generate websub secret")
+		return
+	}
+	token, err := newSecret()
+	if err != nil {
+		log.WithError(err).Error("failed to generate websub callback token")
+		return
+	}
+
+	// subscription is saved as pending, it is subscribed by the next check of any replica
+	err = s.db.SaveSubscription(&database.Subscription{
+		Source: source,
+		Hub:    hub,
+		Topic:  topic,
+		Secret: secret,
+		Token:  token,
+	})
+	if err != nil {
+		log.WithError(err).WithField("source", source).Error("failed to save websub subscription")
+		return
+	}
+
+	s.knownMutex.Lock()
+	s.known[source] = key
+	s.knownMutex.Unlock()
+}
+
+func (s *subscriber) Verify(id int64, token string, mode string, topic string, leaseSeconds int64, reason string) error {
+	sub, err := s.subscription(id, token)
+	if err != nil {
+		return err
+	}
+
+	// topic is compared by hubs as it was sent
+	if topic != sub.Topic {
+		return ErrUnknownSubscription
+	}
+
+	switch mode {
+	case WebSubModeSubscribe:
+		// only requested subscriptions are verified, so hub can't activate them with its own leases at any time
+		if !sub.Requested {
+			return ErrUnknownSubscription
+		}
+
+		lease := s.lease
+		if leaseSeconds > 0 {
+			lease = time.Duration(clampLeaseSeconds(leaseSeconds)) * time.Second
+		}
+
+		s.counter.WithLabelValues("verified").Inc()
+		return s.db.ActivateSubscription(id, lease, renewAfter(lease))
+	case WebSubModeDenied:
+		s.counter.WithLabelValues("denied").Inc()
+		log.WithField("source", sub.Source).WithField("reason", reason).Warn("websub subscription was denied")
+		return s.db.FailSubscription(id, database.SubscriptionDenied, "denied: "+reason, s.maxRetry)
+	default:
+		// subscriptions are left to expire instead of unsubscribing
+		return ErrUnknownSubscription
+	}
+}
+
+func (s *subscriber) Receive(id int64, token string, body []byte, signature string) error {
+	sub, err := s.subscription(id, token)
+	if err != nil {
+		return err
+	}
+
+	if !validSignature(sub.Secret, body, signature) {
+		s.counter.WithLabelValues("invalid_signature").Inc()
+		return ErrInvalidSignature
+	}
+
+	feed := &dto.RssFeed{}
+	err = xml.NewDecoder(bytes.NewReader(body)).Decode(feed)
+	if err != nil || feed.Channel == nil {
+		s.counter.WithLabelValues("malformed").Inc()
+		return ErrMalformedContent
+	}
+
+	// pushed items are stored the same way as fetched ones, rss with source are rebuilt from item store
+	items := make([]*database.Item, 0, len(feed.Channel.Items))
+	for _, item := range feed.Channel.Items {
+		stored, err := toStoredItem(sub.Source, feed.Channel.Language, withSourceFallbacks(sub.Source, feed.Channel, item))
+		if err != nil {
+			return err
+		}
+		items = append(items, stored)
+	}
+
+	if len(items) > 0 {
+		err = s.db.SaveItems(items)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.counter.WithLabelValues("pushed").Inc()
+	return s.db.InvalidateSourceRss(sub.Source)
+}
+
+func (s *subscriber) Start() {
+	defer close(s.shutdownWaitChan)
+
+	ticker := time.NewTicker(s.checkPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.shutdownChan:
+			return
+		case <-ticker.C:
+			safe.Do(s.subscribeDue)
+		}
+	}
+}
+
+func (s *subscriber) Shutdown() {
+	close(s.shutdownChan)
+	<-s.shutdownWaitChan
+}
+
+// subscribeDue subscribes new and expiring subscriptions, they are leased until hub verifies them
+func (s *subscriber) subscribeDue() {
+	for {
+		subs, err := s.db.LeaseSubscriptions(subscribeBatchSize, s.retry)
+		if err != nil {
+			log.WithError(err).Error("failed to lease websub subscriptions")
+			return
+		}
+
+		for _, sub := range subs {
+			select {
+			case <-s.shutdownChan:
+				return
+			default:
+			}
+
+			err = s.subscribe(sub)
+			if err == nil {
+				s.counter.WithLabelValues("requested").Inc()
+				continue
+			}
+
+			s.counter.WithLabelValues("request_failed").Inc()
+			log.WithError(err).WithField("source", sub.Source).WithField("hub", sub.Hub).Warn("failed to subscribe to websub hub")
+
+			err = s.db.FailSubscription(sub.ID, sub.State, err.Error(), exponentialBackoff(s.retry, s.maxRetry, sub.Attempts))
+			if err != nil {
+				log.WithError(err).WithField("source", sub.Source).Error("failed to save websub subscription failure")
+			}
+		}
+
+		if len(subs) < subscribeBatchSize {
+			return
+		}
+	}
+}
+
+// subscribe requests subscription, hub verifies it asynchronously by callback
+func (s *subscriber) subscribe(sub *database.Subscription) error {
+	form := url.Values{}
+	form.Set("hub.mode", WebSubModeSubscribe)
+	form.Set("hub.topic", sub.Topic)
+	form.Set("hub.callback", CallbackUrl(s.publicUrl, sub.ID, sub.Token))
+	form.Set("hub.secret", sub.Secret)
+	form.Set("hub.lease_seconds", strconv.FormatInt(int64(s.lease.Seconds()), 10))
+
+	resp, err := s.client.PostForm(sub.Hub, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return &HttpError{StatusCode: resp.StatusCode}
+	}
+
+	return nil
+}
+
+func (s *subscriber) subscription(id int64, token string) (*database.Subscription, error) {
+	sub, err := s.db.GetSubscription(id)
+	if err == sql.ErrNoRows {
+		return nil, ErrUnknownSubscription
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sub.Token) == 0 || subtle.ConstantTimeCompare([]byte(sub.Token), []byte(token)) != 1 {
+		return nil, ErrUnknownSubscription
+	}
+
+	return sub, nil
+}
+
+// exponentialBackoff doubles base delay for every attempt after the first one
+func exponentialBackoff(base time.Duration, max time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	return delay
+}
+
+// hubLinks returns hub and self links of channel, self link is canonical topic url
+func hubLinks(channel *dto.RssFeedChannel) (string, string) {
+	var hub, self string
+	for _, link := range channel.AtomLink {
+		switch strings.ToLower(link.Rel) {
+		case "hub":
+			if len(hub) == 0 {
+				hub = link.Href
+			}
+		case "self":
+			if len(self) == 0 {
+				self = link.Href
+			}
+		}
+	}
+
+	return hub, self
+}
+
+func clampLeaseSeconds(leaseSeconds int64) int64 {
+	if leaseSeconds < minLeaseSeconds {
+		return minLeaseSeconds
+	}
+	if leaseSeconds > maxLeaseSeconds {
+		return maxLeaseSeconds
+	}
+
+	return leaseSeconds
+}
+
+// renewAfter leaves tenth of lease to renew subscription before it expires
+func renewAfter(lease time.Duration) time.Duration {
+	return lease - lease/10
+}
+
+// validSignature checks signature header like "sha256=hex" by hmac of body with secret
+func validSignature(secret string, body []byte, signature string) bool {
+	parts := strings.SplitN(signature, "=", 2)
+	if len(parts) != 2 {
+		return false
+	}
+
+	newHash, ok := signatureHashes[strings.ToLower(parts[0])]
+	if !ok {
+		return false
+	}
+
+	expected, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+func newSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
@@ -0,0 +1,271 @@
+package rss
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/config"
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+)
+
+const testPushedFeed = `<rss version="2.0"><channel><title>One</title><link>https://one.com/</link>` +
+	`<item><title>pushed</title><guid>1</guid><pubDate>Mon, 02 Jan 2006 15:04:05 MST</pubDate></item></channel></rss>`
+
+func newTestSubscriber(db database.Database, publicUrl string) *subscriber {
+	return newSubscriber(&config.Config{
+		ServerPublicUrl: publicUrl,
+		// test servers listen at loopback
+		AllowPrivateNetworks: true,
+		WebSubLease:          240 * time.Hour,
+		WebSubCheckPeriod:    time.Minute,
+		WebSubRetry:          10 * time.Minute,
+		WebSubMaxRetry:       24 * time.Hour,
+	}, db)
+}
+
+func sign(secret string, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestSubscriber_Discover(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().SaveSubscription(gomock.Any()).Do(func(sub *database.Subscription) {
+		assert.Equal(t, "https://one.com/", sub.Source)
+		assert.Equal(t, "https://hub.com/", sub.Hub)
+		assert.Equal(t, "https://one.com/feed", sub.Topic)
+		assert.Len(t, sub.Secret, 40)
+		assert.Len(t, sub.Token, 40)
+		assert.NotEqual(t, sub.Secret, sub.Token)
+	}).Return(nil)
+
+	s := newTestSubscriber(db, "http://localhost")
+
+	feed := &dto.RssFeed{Channel: &dto.RssFeedChannel{AtomLink: []*dto.AtomLink{
+		{Href: "https://one.com/feed", Rel: "self"},
+		{Href: "https://hub.com/", Rel: "hub"},
+	}}}
+
+	// known subscription is not saved again
+	s.Discover("https://one.com/", feed)
+	s.Discover("https://one.com/", feed)
+
+	// source without hub is polled only
+	s.Discover("https://two.com/", &dto.RssFeed{Channel: &dto.RssFeedChannel{}})
+}
+
+func TestSubscriber_Hub(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := database.NewMockDatabase(ctrl)
+	s := newTestSubscriber(db, "")
+
+	// callback stands for websub handler
+	callback := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/websub/"), "/")
+		assert.Len(t, parts, 2)
+		id, _ := strconv.ParseInt(parts[0], 10, 64)
+		token := parts[1]
+		if req.Method == http.MethodGet {
+			query := req.URL.Query()
+			lease, _ := strconv.ParseInt(query.Get("hub.lease_seconds"), 10, 64)
+			if err := s.Verify(id, token, query.Get("hub.mode"), query.Get("hub.topic"), lease, ""); err != nil {
+				writer.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = writer.Write([]byte(query.Get("hub.challenge")))
+			return
+		}
+
+		body, _ := ioutil.ReadAll(req.Body)
+		if err := s.Receive(id, token, body, req.Header.Get("X-Hub-Signature")); err != nil {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		writer.WriteHeader(http.StatusAccepted)
+	}))
+	defer callback.Close()
+	s.publicUrl = callback.URL
+
+	// local hub verifies intent of subscriber and pushes content signed by its secret
+	verified := false
+	pushed := false
+	hub := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		assert.NoError(t, req.ParseForm())
+		assert.Equal(t, "subscribe", req.PostForm.Get("hub.mode"))
+		assert.Equal(t, "864000", req.PostForm.Get("hub.lease_seconds"))
+
+		target := req.PostForm.Get("hub.callback")
+		query := url.Values{}
+		query.Set("hub.mode", "subscribe")
+		query.Set("hub.topic", req.PostForm.Get("hub.topic"))
+		query.Set("hub.challenge", "challenge")
+		query.Set("hub.lease_seconds", "3600")
+
+		resp, err := http.Get(target + "?" + query.Encode())
+		assert.NoError(t, err)
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		verified = resp.StatusCode == http.StatusOK && string(body) == "challenge"
+
+		push, _ := http.NewRequest(http.MethodPost, target, strings.NewReader(testPushedFeed))
+		push.Header.Set("Content-Type", "application/rss+xml")
+		push.Header.Set("X-Hub-Signature", sign(req.PostForm.Get("hub.secret"), testPushedFeed))
+		resp, err = http.DefaultClient.Do(push)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		pushed = resp.StatusCode == http.StatusAccepted
+
+		writer.WriteHeader(http.StatusAccepted)
+	}))
+	defer hub.Close()
+
+	sub := &database.Subscription{
+		ID:        7,
+		Source:    "https://one.com/",
+		Hub:       hub.URL,
+		Topic:     "https://one.com/feed",
+		Secret:    "secret",
+		Token:     "token",
+		State:     database.SubscriptionPending,
+		Requested: true,
+	}
+
+	db.EXPECT().LeaseSubscriptions(subscribeBatchSize, 10*time.Minute).Return([]*database.Subscription{sub}, nil)
+	db.EXPECT().GetSubscription(int64(7)).Times(2).Return(sub, nil)
+	db.EXPECT().ActivateSubscription(int64(7), time.Hour, 54*time.Minute).Return(nil)
+	db.EXPECT().SaveItems(gomock.Any()).Do(func(items []*database.Item) {
+		assert.Len(t, items, 1)
+		assert.Equal(t, "https://one.com/", items[0].Source)
+		assert.Equal(t, "pushed", items[0].Title)
+	}).Return(nil)
+	db.EXPECT().InvalidateSourceRss("https://one.com/").Return(nil)
+
+	s.subscribeDue()
+
+	assert.True(t, verified)
+	assert.True(t, pushed)
+}
+
+func TestSubscriber_SubscribeFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	hub := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		writer.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer hub.Close()
+
+	sub := &database.Subscription{ID: 7, Hub: hub.URL, State: database.SubscriptionActive, Attempts: 3}
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().LeaseSubscriptions(gomock.Any(), gomock.Any()).Return([]*database.Subscription{sub}, nil)
+	// active subscription stays active until its lease expires
+	db.EXPECT().FailSubscription(int64(7), database.SubscriptionActive, "unexpected http status 500", 40*time.Minute).Return(nil)
+
+	newTestSubscriber(db, "http://localhost").subscribeDue()
+}
+
+func TestSubscriber_Verify(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sub := &database.Subscription{ID: 7, Topic: "https://one.com/feed", Token: "token", Requested: true}
+	active := &database.Subscription{ID: 9, Topic: "https://one.com/feed", Token: "token", State: database.SubscriptionActive}
+	legacy := &database.Subscription{ID: 10, Topic: "https://one.com/feed", Requested: true}
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().GetSubscription(int64(7)).AnyTimes().Return(sub, nil)
+	db.EXPECT().GetSubscription(int64(8)).Return(nil, sql.ErrNoRows)
+	db.EXPECT().GetSubscription(int64(9)).Return(active, nil)
+	db.EXPECT().GetSubscription(int64(10)).Return(legacy, nil)
+	db.EXPECT().ActivateSubscription(int64(7), 240*time.Hour, 216*time.Hour).Return(nil)
+	db.EXPECT().FailSubscription(int64(7), database.SubscriptionDenied, "denied: spam", 24*time.Hour).Return(nil)
+
+	s := newTestSubscriber(db, "http://localhost")
+
+	assert.NoError(t, s.Verify(7, "token", WebSubModeSubscribe, "https://one.com/feed", 0, ""))
+	assert.NoError(t, s.Verify(7, "token", WebSubModeDenied, "https://one.com/feed", 0, "spam"))
+	assert.Equal(t, ErrUnknownSubscription, s.Verify(7, "token", WebSubModeSubscribe, "https://two.com/feed", 0, ""))
+	assert.Equal(t, ErrUnknownSubscription, s.Verify(7, "token", WebSubModeUnsubscribe, "https://one.com/feed", 0, ""))
+	assert.Equal(t, ErrUnknownSubscription, s.Verify(8, "token", WebSubModeSubscribe, "https://one.com/feed", 0, ""))
+
+	// callbacks can't be called by id only
+	assert.Equal(t, ErrUnknownSubscription, s.Verify(7, "", WebSubModeDenied, "https://one.com/feed", 0, "spam"))
+	assert.Equal(t, ErrUnknownSubscription, s.Verify(7, "other", WebSubModeSubscribe, "https://one.com/feed", 0, ""))
+	assert.Equal(t, ErrUnknownSubscription, s.Verify(10, "", WebSubModeSubscribe, "https://one.com/feed", 0, ""))
+
+	// subscription is verified only while it is requested
+	assert.Equal(t, ErrUnknownSubscription, s.Verify(9, "token", WebSubModeSubscribe, "https://one.com/feed", 0, ""))
+}
+
+func TestSubscriber_VerifyLease(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sub := &database.Subscription{ID: 7, Topic: "https://one.com/feed", Token: "token", Requested: true}
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().GetSubscription(int64(7)).AnyTimes().Return(sub, nil)
+	db.EXPECT().ActivateSubscription(int64(7), time.Hour, 54*time.Minute).Return(nil)
+	db.EXPECT().ActivateSubscription(int64(7), 5*time.Minute, 270*time.Second).Return(nil)
+	db.EXPECT().ActivateSubscription(int64(7), 720*time.Hour, 648*time.Hour).Return(nil)
+
+	s := newTestSubscriber(db, "http://localhost")
+
+	assert.NoError(t, s.Verify(7, "token", WebSubModeSubscribe, "https://one.com/feed", 3600, ""))
+	assert.NoError(t, s.Verify(7, "token", WebSubModeSubscribe, "https://one.com/feed", 1, ""))
+	assert.NoError(t, s.Verify(7, "token", WebSubModeSubscribe, "https://one.com/feed", math.MaxInt64, ""))
+}
+
+func TestSubscriber_Receive(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sub := &database.Subscription{ID: 7, Source: "https://one.com/", Secret: "secret", Token: "token"}
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().GetSubscription(int64(7)).AnyTimes().Return(sub, nil)
+	db.EXPECT().SaveItems(gomock.Any()).Return(errors.New("error"))
+
+	s := newTestSubscriber(db, "http://localhost")
+
+	assert.Equal(t, ErrUnknownSubscription, s.Receive(7, "other", []byte(testPushedFeed), sign("secret", testPushedFeed)))
+	assert.Equal(t, ErrInvalidSignature, s.Receive(7, "token", []byte(testPushedFeed), ""))
+	assert.Equal(t, ErrInvalidSignature, s.Receive(7, "token", []byte(testPushedFeed), sign("other", testPushedFeed)))
+	assert.Equal(t, ErrMalformedContent, s.Receive(7, "token", []byte("feed"), sign("secret", "feed")))
+	assert.EqualError(t, s.Receive(7, "token", []byte(testPushedFeed), sign("secret", testPushedFeed)), "error")
+}
+
+func TestValidSignature(t *testing.T) {
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("body"))
+	sum := hex.EncodeToString(mac.Sum(nil))
+
+	assert.True(t, validSignature("secret", []byte("body"), "sha256="+sum))
+	assert.True(t, validSignature("secret", []byte("body"), "SHA256="+sum))
+	assert.False(t, validSignature("secret", []byte("body"), "sha1="+sum))
+	assert.False(t, validSignature("secret", []byte("body"), "md5="+sum))
+	assert.False(t, validSignature("secret", []byte("body"), sum))
+}
@@ -0,0 +1,150 @@
+//go:generate mockgen -package ${GOPACKAGE} -destination mock_validator.go -source validator.go
+package rss
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"service-rss/internal/netguard"
+	"service-rss/internal/safe"
+)
+
+const (
+	SourceStatusOk          = "ok"
+	SourceStatusNotFeed     = "not_feed"
+	SourceStatusUnsupported = "unsupported"
+	SourceStatusHttpError   = "http_error"
+	SourceStatusBlocked     = "blocked"
+	SourceStatusTimeout     = "timeout"
+	SourceStatusUnreachable = "unreachable"
+)
+
+type SourceCheck struct {
+	Url    string
+	Status string
+	Error  string
+	// Feeds are suggested instead of source which is not a feed
+	Feeds []*DiscoveredFeed
+}
+
+func (c *SourceCheck) Ok() bool {
+	return c.Status == SourceStatusOk
+}
+
+type Validator interface {
+	// Validate fetches sources concurrently and returns checks in the same order
+	Validate(sources []string) []*SourceCheck
+}
+
+type validator struct {
+	discoverer Discoverer
+	histogram  *prometheus.HistogramVec
+}
+
+func NewValidator(discoverer Discoverer) (Validator, error) {
+	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "validation_duration_seconds",
+		Help:    "Histogram of sources validation time in seconds",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"status"})
+
+	err := prometheus.Register(histogram)
+	if err != nil {
+		return nil, err
+	}
+
+	return &validator{
+		discoverer: discoverer,
+		histogram:  histogram,
+	}, nil
+}
+
+func (v *validator) Validate(sources []string) []*SourceCheck {
+	start := time.Now()
+
+	checks := v.validate(sources)
+
+	status := "ok"
+	for _, check := range checks {
+		if !check.Ok() {
+			status = "error"
+		}
+	}
+	v.histogram.WithLabelValues(status).Observe(time.Since(start).Seconds())
+
+	return checks
+}
+
+func (v *validator) validate(sources []string) []*SourceCheck {
+	checks := make([]*SourceCheck, len(sources))
+
+	wg := sync.WaitGroup{}
+	for i, source := range sources {
+		wg.Add(1)
+		i, source := i, source
+		go safe.Do(func() {
+			defer wg.Done()
+			checks[i] = v.check(source)
+		})
+	}
+	wg.Wait()
+
+	return checks
+}
+
+func (v *validator) check(source string) *SourceCheck {
+	check := &SourceCheck{Url: source}
+
+	// discovery has one deadline of short discovery timeout, it is the only request of the check
+	feeds, err := v.discoverer.Discover(source)
+	if err != nil {
+		check.Status = errorStatus(err)
+		check.Error = err.Error()
+		return check
+	}
+
+	if len(feeds) != 1 || feeds[0].Url != source {
+		check.Status = SourceStatusNotFeed
+		check.Error = "source is not a feed"
+		check.Feeds = feeds
+		return check
+	}
+
+	// fetcher decodes rss only
+	if feeds[0].Type != FeedTypeRss {
+		check.Status = SourceStatusUnsupported
+		check.Error = "only rss feeds are supported"
+		return check
+	}
+
+	check.Status = SourceStatusOk
+	return check
+}
+
+func errorStatus(err error) string {
+	if errors.Is(err, netguard.ErrPrivateAddress) {
+		return SourceStatusBlocked
+	}
+
+	httpErr := &HttpError{}
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests, http.StatusUnavailableForLegalReasons:
+			return SourceStatusBlocked
+		default:
+			return SourceStatusHttpError
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return SourceStatusTimeout
+	}
+
+	return SourceStatusUnreachable
+}
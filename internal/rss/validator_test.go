@@ -0,0 +1,81 @@
+package rss
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/config"
+	"service-rss/internal/netguard"
+)
+
+func TestValidator_Validate(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rss", serve("application/rss+xml", testRssFeed))
+	mux.HandleFunc("/atom", serve("application/atom+xml", testAtomFeed))
+	mux.HandleFunc("/page", serve("text/html", testPage))
+	mux.HandleFunc("/forbidden", func(writer http.ResponseWriter, req *http.Request) {
+		writer.WriteHeader(http.StatusForbidden)
+	})
+	mux.HandleFunc("/slow", func(writer http.ResponseWriter, req *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		serve("application/rss+xml", testRssFeed)(writer, req)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "validation_duration_seconds",
+		Help:    "Histogram of sources validation time in seconds",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"status"})
+
+	v := &validator{
+		discoverer: NewTestDiscoverer(100 * time.Millisecond),
+		histogram:  histogram,
+	}
+
+	checks := v.Validate([]string{
+		server.URL + "/rss",
+		server.URL + "/atom",
+		server.URL + "/page",
+		server.URL + "/missing",
+		server.URL + "/forbidden",
+		server.URL + "/slow",
+		"http://localhost:0/rss",
+	})
+
+	statuses := make([]string, 0, len(checks))
+	for _, check := range checks {
+		statuses = append(statuses, check.Status)
+	}
+	assert.Equal(t, []string{
+		SourceStatusOk,
+		SourceStatusUnsupported,
+		SourceStatusNotFeed,
+		SourceStatusHttpError,
+		SourceStatusBlocked,
+		SourceStatusTimeout,
+		SourceStatusUnreachable,
+	}, statuses)
+
+	assert.Equal(t, server.URL+"/rss", checks[0].Url)
+	assert.Empty(t, checks[0].Error)
+	assert.Equal(t, []*DiscoveredFeed{
+		{Url: server.URL + "/feed.xml", Title: "Rss", Type: FeedTypeRss},
+		{Url: "https://other.example.com/atom.xml", Title: "Atom", Type: FeedTypeAtom},
+	}, checks[2].Feeds)
+	assert.Equal(t, "unexpected http status 404", checks[3].Error)
+
+	// test server listens at loopback, so it isn't reached without allowed private networks
+	guarded := NewTestDiscoverer(time.Second).(*discoverer)
+	guarded.client = netguard.New(&config.Config{}).Client(time.Second)
+	v.discoverer = guarded
+
+	checks = v.Validate([]string{server.URL + "/rss"})
+	assert.Equal(t, SourceStatusBlocked, checks[0].Status)
+}
@@ -0,0 +1,426 @@
+//go:generate mockgen -package ${GOPACKAGE} -destination mock_webhook.go -source webhook.go
+package rss
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+
+	"service-rss/internal/config"
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+	"service-rss/internal/netguard"
+	"service-rss/internal/safe"
+)
+
+const (
+	// DefaultWebhookTemplate is payload of webhook created without template
+	DefaultWebhookTemplate = `{"feed": {{json .Feed.Url}}, "title": {{json .Item.Title}}, "link": {{json .Item.Link}}, ` +
+		`"guid": {{json .Item.Guid}}, "pub_date": {{json .Item.PubDate}}, "source": {{json .Item.Source}}}`
+
+	deliveryBatchSize = 20
+	// delivery is retried if replica fails before it is finished
+	deliveryLease = time.Minute
+	prunePeriod   = time.Hour
+)
+
+var (
+	// ErrInvalidWebhook means webhook can't be created, it is wrapped with the reason
+	ErrInvalidWebhook = errors.New("invalid webhook")
+
+	webhookFuncs = template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}
+
+	// sampleWebhookPayload checks that template renders json
+	sampleWebhookPayload = &WebhookPayload{
+		Feed: WebhookFeed{Name: "name", Title: "Title", Url: "https://example.com/example@gmail.com/name"},
+		Item: WebhookItem{Title: "Title", Link: "https://example.com/1", Guid: "1", Categories: []string{"news"}},
+	}
+)
+
+// WebhookPayload is data of webhook template, values are inserted into json by json function like {{json .Item.Title}}
+type WebhookPayload struct {
+	Feed WebhookFeed
+	Item WebhookItem
+}
+
+type WebhookFeed struct {
+	Name  string
+	Title string
+	Url   string
+}
+
+type WebhookItem struct {
+	Title       string
+	Link        string
+	Guid        string
+	Description string
+	Author      string
+	PubDate     string
+	Source      string // url of source feed
+	Categories  []string
+}
+
+// WebhookNotifier delivers new items of rss to its webhooks
+type WebhookNotifier interface {
+	// Notify queues deliveries of items which are new since the previous feed of rss,
+	// items of the first feed after webhook is created are not delivered
+	Notify(rss *database.Rss, feed *dto.RssFeed)
+	Start()
+	Shutdown()
+}
+
+type webhookNotifier struct {
+	db           database.Database
+	client       *http.Client
+	publicUrl    string
+	checkPeriod  time.Duration
+	retry        time.Duration
+	maxRetry     time.Duration
+	maxAttempts  int
+	logRetention time.Duration
+	counter      *prometheus.CounterVec
+
+	wakeChan chan struct{}
+
+	// graceful shutdown helper-channels
+	shutdownChan     chan interface{}
+	shutdownWaitChan chan interface{}
+}
+
+// NewWebhookNotifier makes notifier which delivers queued items of all replicas
+func NewWebhookNotifier(cfg *config.Config, db database.Database) (WebhookNotifier, error) {
+	n := newWebhookNotifier(cfg, db)
+
+	err := prometheus.Register(n.counter)
+	if err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// newWebhookNotifier makes notifier without registering its metrics
+func newWebhookNotifier(cfg *config.Config, db database.Database) *webhookNotifier {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "webhook_events_counter",
+		Help: "Counter of webhook deliveries by event",
+	}, []string{"event"})
+
+	return &webhookNotifier{
+		db:           db,
+		client:       netguard.New(cfg).Client(cfg.WebhookTimeout),
+		publicUrl:    cfg.ServerPublicUrl,
+		checkPeriod:  cfg.WebhookCheckPeriod,
+		retry:        cfg.WebhookRetry,
+		maxRetry:     cfg.WebhookMaxRetry,
+		maxAttempts:  cfg.WebhookMaxAttempts,
+		logRetention: cfg.WebhookLogRetention,
+		counter:      counter,
+
+		wakeChan: make(chan struct{}, 1),
+
+		shutdownChan:     make(chan interface{}),
+		shutdownWaitChan: make(chan interface{}),
+	}
+}
+
+// NewWebhook validates webhook of owner, secret is generated if it is empty and default template is used if it is empty
+func NewWebhook(webhookUrl string, secret string, payloadTemplate string) (*database.Webhook, error) {
+	u, err := url.Parse(webhookUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return nil, fmt.Errorf("%w: url should be absolute http url", ErrInvalidWebhook)
+	}
+
+	if len(payloadTemplate) == 0 {
+		payloadTemplate = DefaultWebhookTemplate
+	}
+
+	tmpl, err := parseWebhookTemplate(payloadTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidWebhook, err.Error())
+	}
+
+	_, err = renderWebhookPayload(tmpl, sampleWebhookPayload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidWebhook, err.Error())
+	}
+
+	if len(secret) == 0 {
+		secret, err = newSecret()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &database.Webhook{
+		Url:      webhookUrl,
+		Secret:   secret,
+		Template: payloadTemplate,
+	}, nil
+}
+
+func (n *webhookNotifier) Notify(rss *database.Rss, feed *dto.RssFeed) {
+	webhooks, err := n.db.GetRssWebhooks(rss.ID)
+	if err != nil {
+		log.WithError(err).WithField("id", rss.ID).Error("failed to get webhooks")
+		return
+	}
+
+	if len(webhooks) == 0 {
+		return
+	}
+
+	hashes := make([]string, 0, len(feed.Channel.Items))
+	for _, item := range feed.Channel.Items {
+		hashes = append(hashes, itemHash(item))
+	}
+
+	queued := false
+	for _, webhook := range webhooks {
+		deliveries := n.deliveries(rss, feed, webhook, hashes)
+		if webhook.SeenItems != nil && len(deliveries) == 0 && sameItems(webhook.SeenItems, hashes) {
+			continue
+		}
+
+		err = n.db.QueueWebhookDeliveries(webhook.ID, hashes, deliveries)
+		if err != nil {
+			log.WithError(err).WithField("webhook", webhook.ID).Error("failed to queue webhook deliveries")
+			continue
+		}
+
+		n.counter.WithLabelValues("queued").Add(float64(len(deliveries)))
+		queued = queued || len(deliveries) > 0
+	}
+
+	if queued {
+		select {
+		case n.wakeChan <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (n *webhookNotifier) Start() {
+	defer close(n.shutdownWaitChan)
+
+	ticker := time.NewTicker(n.checkPeriod)
+	defer ticker.Stop()
+
+	pruneTicker := time.NewTicker(prunePeriod)
+	defer pruneTicker.Stop()
+
+	for {
+		select {
+		case <-n.shutdownChan:
+			return
+		case <-pruneTicker.C:
+			safe.Do(n.prune)
+			continue
+		case <-ticker.C:
+		case <-n.wakeChan:
+		}
+
+		safe.Do(n.deliverDue)
+	}
+}
+
+func (n *webhookNotifier) Shutdown() {
+	close(n.shutdownChan)
+	<-n.shutdownWaitChan
+}
+
+// deliveries renders payloads of new items, the oldest items are delivered first
+func (n *webhookNotifier) deliveries(rss *database.Rss, feed *dto.RssFeed, webhook *database.Webhook, hashes []string) []*database.WebhookDelivery {
+	// the first feed is remembered only, otherwise every item would be new
+	if webhook.SeenItems == nil {
+		return nil
+	}
+
+	seen := make(map[string]struct{}, len(webhook.SeenItems))
+	for _, hash := range webhook.SeenItems {
+		seen[hash] = struct{}{}
+	}
+
+	tmpl, err := parseWebhookTemplate(webhook.Template)
+	if err != nil {
+		log.WithError(err).WithField("webhook", webhook.ID).Error("failed to parse webhook template")
+		return nil
+	}
+
+	deliveries := make([]*database.WebhookDelivery, 0)
+	for i := len(feed.Channel.Items) - 1; i >= 0; i-- {
+		if _, ok := seen[hashes[i]]; ok {
+			continue
+		}
+
+		payload, err := renderWebhookPayload(tmpl, &WebhookPayload{
+			Feed: WebhookFeed{
+				Name:  rss.Name,
+				Title: feed.Channel.Title,
+				Url:   FeedUrl(n.publicUrl, rss.Email, rss.Name),
+			},
+			Item: toWebhookItem(feed.Channel.Items[i]),
+		})
+		if err != nil {
+			log.WithError(err).WithField("webhook", webhook.ID).Warn("failed to render webhook payload")
+			continue
+		}
+
+		deliveries = append(deliveries, &database.WebhookDelivery{
+			WebhookID: webhook.ID,
+			Item:      hashes[i],
+			Payload:   payload,
+		})
+	}
+
+	return deliveries
+}
+
+func (n *webhookNotifier) deliverDue() {
+	for {
+		deliveries, err := n.db.LeaseWebhookDeliveries(deliveryBatchSize, deliveryLease)
+		if err != nil {
+			log.WithError(err).Error("failed to lease webhook deliveries")
+			return
+		}
+
+		for _, delivery := range deliveries {
+			select {
+			case <-n.shutdownChan:
+				return
+			default:
+			}
+
+			err = n.db.FinishWebhookDelivery(delivery, n.deliver(delivery))
+			if err != nil {
+				log.WithError(err).WithField("id", delivery.ID).Error("failed to finish webhook delivery")
+			}
+		}
+
+		if len(deliveries) < deliveryBatchSize {
+			return
+		}
+	}
+}
+
+// deliver posts signed payload and sets result of delivery, it returns delay of retry for pending delivery
+func (n *webhookNotifier) deliver(delivery *database.WebhookDelivery) time.Duration {
+	body := []byte(delivery.Payload)
+
+	mac := hmac.New(sha256.New, []byte(delivery.Secret))
+	mac.Write(body)
+
+	req, err := http.NewRequest(http.MethodPost, delivery.Url, bytes.NewReader(body))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(delivery.ID, 10))
+		req.Header.Set("X-Webhook-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+		var resp *http.Response
+		resp, err = n.client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+
+			delivery.StatusCode = resp.StatusCode
+			if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+				delivery.State = database.DeliveryDelivered
+				delivery.LastError = ""
+				n.counter.WithLabelValues("delivered").Inc()
+				return 0
+			}
+			err = &HttpError{StatusCode: resp.StatusCode}
+		}
+	}
+
+	delivery.LastError = err.Error()
+
+	if delivery.Attempts >= n.maxAttempts {
+		delivery.State = database.DeliveryDead
+		n.counter.WithLabelValues("dead").Inc()
+		log.WithError(err).WithField("id", delivery.ID).Warn("webhook delivery is dead after retries")
+		return 0
+	}
+
+	delivery.State = database.DeliveryPending
+	n.counter.WithLabelValues("failed").Inc()
+	return exponentialBackoff(n.retry, n.maxRetry, delivery.Attempts)
+}
+
+func (n *webhookNotifier) prune() {
+	count, err := n.db.PruneWebhookDeliveries(time.Now().Add(-n.logRetention))
+	if err != nil {
+		log.WithError(err).Error("failed to prune webhook deliveries")
+		return
+	}
+
+	if count > 0 {
+		log.WithField("count", count).Info("webhook deliveries were pruned")
+	}
+}
+
+func parseWebhookTemplate(text string) (*template.Template, error) {
+	return template.New("webhook").Funcs(webhookFuncs).Parse(text)
+}
+
+// renderWebhookPayload fails if template doesn't render valid json
+func renderWebhookPayload(tmpl *template.Template, payload *WebhookPayload) (string, error) {
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, payload)
+	if err != nil {
+		return "", err
+	}
+
+	if !json.Valid(buf.Bytes()) {
+		return "", errors.New("template should render json")
+	}
+
+	return buf.String(), nil
+}
+
+func toWebhookItem(item *dto.RssFeedItem) WebhookItem {
+	out := WebhookItem{
+		Title:       item.Title,
+		Link:        item.Link,
+		Guid:        item.Guid,
+		Description: item.Description,
+		Author:      item.Author,
+		PubDate:     item.PubDate,
+		Categories:  item.Category,
+	}
+	if item.Source != nil {
+		out.Source = item.Source.Url
+	}
+
+	return out
+}
+
+func sameItems(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
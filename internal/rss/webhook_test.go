@@ -0,0 +1,179 @@
+package rss
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"service-rss/internal/config"
+	"service-rss/internal/database"
+	"service-rss/internal/dto"
+)
+
+func newTestWebhookNotifier(db database.Database) *webhookNotifier {
+	return newWebhookNotifier(&config.Config{
+		ServerPublicUrl: "http://localhost",
+		// test servers listen at loopback
+		AllowPrivateNetworks: true,
+		WebhookTimeout:       time.Second,
+		WebhookCheckPeriod:   time.Minute,
+		WebhookRetry:         time.Minute,
+		WebhookMaxRetry:      time.Hour,
+		WebhookMaxAttempts:   3,
+		WebhookLogRetention:  24 * time.Hour,
+	}, db)
+}
+
+func TestNewWebhook(t *testing.T) {
+	webhook, err := NewWebhook("https://one.com/hook", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://one.com/hook", webhook.Url)
+	assert.Len(t, webhook.Secret, 40)
+	assert.Equal(t, DefaultWebhookTemplate, webhook.Template)
+
+	webhook, err = NewWebhook("https://one.com/hook", "secret", `{"text": {{json .Item.Title}}}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", webhook.Secret)
+
+	_, err = NewWebhook("one.com/hook", "", "")
+	assert.ErrorIs(t, err, ErrInvalidWebhook)
+	_, err = NewWebhook("https://one.com/hook", "", `{"text": {{json .Item.Title}`)
+	assert.ErrorIs(t, err, ErrInvalidWebhook)
+	_, err = NewWebhook("https://one.com/hook", "", `{"text": {{json .Item.Missing}}}`)
+	assert.ErrorIs(t, err, ErrInvalidWebhook)
+	// values should be escaped by json function
+	_, err = NewWebhook("https://one.com/hook", "", `{"text": "{{.Item.Title}}", {{.Item.Link}}}`)
+	assert.EqualError(t, err, "invalid webhook: template should render json")
+}
+
+func TestWebhookNotifier_Notify(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	feed := &dto.RssFeed{Channel: &dto.RssFeedChannel{Title: "Test", Items: []*dto.RssFeedItem{
+		{Title: "three", Guid: "3", Source: &dto.RssFeedSource{Url: "https://one.com/"}},
+		{Title: "two \"quoted\"", Guid: "2"},
+		{Title: "one", Guid: "1"},
+	}}}
+	hashes := []string{itemHash(feed.Channel.Items[0]), itemHash(feed.Channel.Items[1]), itemHash(feed.Channel.Items[2])}
+
+	template := `{"feed": {{json .Feed.Url}}, "title": {{json .Item.Title}}, "source": {{json .Item.Source}}}`
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().GetRssWebhooks(int64(7)).Return([]*database.Webhook{
+		// the first feed is remembered only
+		{ID: 1, Template: template},
+		// seen feed is not saved again
+		{ID: 2, Template: template, SeenItems: hashes},
+		{ID: 3, Template: template, SeenItems: hashes[2:]},
+	}, nil)
+	db.EXPECT().QueueWebhookDeliveries(int64(1), hashes, gomock.Len(0)).Return(nil)
+	db.EXPECT().QueueWebhookDeliveries(int64(3), hashes, gomock.Any()).Do(func(id int64, seen []string, deliveries []*database.WebhookDelivery) {
+		// the oldest item is delivered first
+		if assert.Len(t, deliveries, 2) {
+			assert.Equal(t, hashes[1], deliveries[0].Item)
+			assert.Equal(t, `{"feed": "http://localhost/example@gmail.com/test", "title": "two \"quoted\"", "source": ""}`, deliveries[0].Payload)
+			assert.Equal(t, hashes[0], deliveries[1].Item)
+			assert.Equal(t, `{"feed": "http://localhost/example@gmail.com/test", "title": "three", "source": "https://one.com/"}`, deliveries[1].Payload)
+		}
+	}).Return(nil)
+
+	n := newTestWebhookNotifier(db)
+	n.Notify(&database.Rss{ID: 7, Email: "example@gmail.com", Name: "test"}, feed)
+
+	assert.Len(t, n.wakeChan, 1)
+
+	t.Run("without webhooks", func(t *testing.T) {
+		db.EXPECT().GetRssWebhooks(int64(8)).Return([]*database.Webhook{}, nil)
+
+		n := newTestWebhookNotifier(db)
+		n.Notify(&database.Rss{ID: 8}, feed)
+
+		assert.Len(t, n.wakeChan, 0)
+	})
+}
+
+func TestWebhookNotifier_DeliverDue(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// receiver stands for internal tool
+	received := make([]string, 0)
+	receiver := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/ok" {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(req.Body)
+		assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+		assert.Equal(t, "1", req.Header.Get("X-Webhook-Delivery"))
+		assert.True(t, validSignature("secret", body, req.Header.Get("X-Webhook-Signature")))
+		assert.True(t, json.Valid(body))
+		received = append(received, string(body))
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	delivery := func(id int64, path string, attempts int) *database.WebhookDelivery {
+		return &database.WebhookDelivery{
+			ID:       id,
+			Url:      receiver.URL + path,
+			Secret:   "secret",
+			Payload:  `{"title": "one"}`,
+			State:    database.DeliveryPending,
+			Attempts: attempts,
+		}
+	}
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().LeaseWebhookDeliveries(deliveryBatchSize, deliveryLease).Return([]*database.WebhookDelivery{
+		delivery(1, "/ok", 1),
+		delivery(2, "/failed", 2),
+		delivery(3, "/failed", 3),
+	}, nil)
+	db.EXPECT().FinishWebhookDelivery(gomock.Any(), time.Duration(0)).Do(func(d *database.WebhookDelivery, retryAfter time.Duration) {
+		assert.Equal(t, int64(1), d.ID)
+		assert.Equal(t, database.DeliveryDelivered, d.State)
+		assert.Equal(t, http.StatusNoContent, d.StatusCode)
+	}).Return(nil)
+	db.EXPECT().FinishWebhookDelivery(gomock.Any(), 2*time.Minute).Do(func(d *database.WebhookDelivery, retryAfter time.Duration) {
+		assert.Equal(t, int64(2), d.ID)
+		assert.Equal(t, database.DeliveryPending, d.State)
+		assert.Equal(t, http.StatusServiceUnavailable, d.StatusCode)
+		assert.Equal(t, "unexpected http status 503", d.LastError)
+	}).Return(nil)
+	// delivery is dead letter after max attempts
+	db.EXPECT().FinishWebhookDelivery(gomock.Any(), time.Duration(0)).Do(func(d *database.WebhookDelivery, retryAfter time.Duration) {
+		assert.Equal(t, int64(3), d.ID)
+		assert.Equal(t, database.DeliveryDead, d.State)
+	}).Return(errors.New("error"))
+
+	newTestWebhookNotifier(db).deliverDue()
+
+	assert.Equal(t, []string{`{"title": "one"}`}, received)
+}
+
+func TestWebhookNotifier_Prune(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := database.NewMockDatabase(ctrl)
+	db.EXPECT().PruneWebhookDeliveries(gomock.Any()).Do(func(keepSince time.Time) {
+		assert.WithinDuration(t, time.Now().Add(-24*time.Hour), keepSince, time.Minute)
+	}).Return(3, nil)
+
+	newTestWebhookNotifier(db).prune()
+}
+
+func TestToWebhookItem(t *testing.T) {
+	item := toWebhookItem(&dto.RssFeedItem{Title: "one", Category: []string{"news"}})
+	assert.Equal(t, WebhookItem{Title: "one", Categories: []string{"news"}}, item)
+}
@@ -12,10 +12,14 @@ import (
 	"github.com/xeipuuv/gojsonschema"
 
 	"service-rss/internal/auth"
+	"service-rss/internal/compress"
 	"service-rss/internal/config"
 	"service-rss/internal/database"
+	"service-rss/internal/feedcache"
 	"service-rss/internal/handlers"
 	"service-rss/internal/metrics"
+	"service-rss/internal/ratelimit"
+	"service-rss/internal/reads"
 	"service-rss/internal/rss"
 )
 
@@ -24,12 +28,17 @@ type Server struct {
 	db     database.Database
 }
 
-func New(cfg *config.Config, db database.Database, aggregator rss.Aggregator) (*Server, error) {
+func New(cfg *config.Config, db database.Database, aggregator rss.Aggregator, discoverer rss.Discoverer, validator rss.Validator,
+	refresher rss.Refresher, hotCache feedcache.Cache, reads reads.Recorder, subscriber rss.Subscriber, hub rss.Hub) (*Server, error) {
 	router := chi.NewRouter()
 
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
-	router.Use(middleware.AllowContentType("application/json"))
+	// feeds are served precompressed, other responses are compressed on the fly
+	router.Use(compress.Middleware(cfg.CompressionLevel))
+	// feeds are pushed by websub hubs, subscriptions to our hub are forms
+	router.Use(middleware.AllowContentType("application/json", "application/rss+xml", "application/xml", "text/xml",
+		"application/x-www-form-urlencoded"))
 
 	measurer, err := metrics.NewMeasurer()
 	if err != nil {
@@ -42,24 +51,166 @@ func New(cfg *config.Config, db database.Database, aggregator rss.Aggregator) (*
 		return nil, err
 	}
 
+	updateSchema, err := loadJsonSchema("jsonschema/api/rss/update/request.json")
+	if err != nil {
+		return nil, err
+	}
+
+	discoverSchema, err := loadJsonSchema("jsonschema/api/sources/discover/request.json")
+	if err != nil {
+		return nil, err
+	}
+
+	scrapeSchema, err := loadJsonSchema("jsonschema/api/sources/scrape/request.json")
+	if err != nil {
+		return nil, err
+	}
+
+	pinSchema, err := loadJsonSchema("jsonschema/api/items/pin/request.json")
+	if err != nil {
+		return nil, err
+	}
+
+	webhookCreateSchema, err := loadJsonSchema("jsonschema/api/webhooks/create/request.json")
+	if err != nil {
+		return nil, err
+	}
+
+	webhookDeleteSchema, err := loadJsonSchema("jsonschema/api/webhooks/delete/request.json")
+	if err != nil {
+		return nil, err
+	}
+
+	webhookRedeliverSchema, err := loadJsonSchema("jsonschema/api/webhooks/redeliver/request.json")
+	if err != nil {
+		return nil, err
+	}
+
+	digestCreateSchema, err := loadJsonSchema("jsonschema/api/digests/create/request.json")
+	if err != nil {
+		return nil, err
+	}
+
+	digestDeleteSchema, err := loadJsonSchema("jsonschema/api/digests/delete/request.json")
+	if err != nil {
+		return nil, err
+	}
+
+	newsletterCreateSchema, err := loadJsonSchema("jsonschema/api/newsletters/create/request.json")
+	if err != nil {
+		return nil, err
+	}
+
+	newsletterDeleteSchema, err := loadJsonSchema("jsonschema/api/newsletters/delete/request.json")
+	if err != nil {
+		return nil, err
+	}
+
 	authHandler := auth.NewGoogleAuthHandler(cfg)
 	router.Get("/login", authHandler.Login)
 
-	rssCreateHandler := handlers.NewRssCreateHandler(db, schema, authHandler)
+	rssCreateHandler := handlers.NewRssCreateHandler(db, validator, schema, authHandler)
 	router.Post("/api/rss/create", rssCreateHandler.ServeHTTP)
 
+	rssUpdateHandler := handlers.NewRssUpdateHandler(db, validator, updateSchema, authHandler)
+	router.Post("/api/rss/update", rssUpdateHandler.ServeHTTP)
+
+	// preview takes the same input as create
+	previewLimiter := ratelimit.New(cfg.PreviewRateLimitPerUser, cfg.PreviewRateLimitTotal)
+	rssPreviewHandler := handlers.NewRssPreviewHandler(aggregator, previewLimiter, schema, authHandler)
+	router.Post("/api/rss/preview", rssPreviewHandler.ServeHTTP)
+
+	refreshLimiter := ratelimit.New(cfg.RefreshRateLimitPerUser, cfg.RefreshRateLimitTotal)
+	rssRefreshHandler := handlers.NewRssRefreshHandler(refresher, refreshLimiter, cfg.RefreshWaitTimeout, authHandler)
+	router.Post("/api/rss/{name}/refresh", rssRefreshHandler.ServeHTTP)
+
+	itemsPinHandler := handlers.NewItemsPinHandler(db, pinSchema, authHandler)
+	router.Post("/api/items/pin", itemsPinHandler.ServeHTTP)
+
+	webhooksGetHandler := handlers.NewWebhooksGetHandler(db, authHandler)
+	router.Get("/api/webhooks", webhooksGetHandler.ServeHTTP)
+
+	webhookCreateHandler := handlers.NewWebhookCreateHandler(db, webhookCreateSchema, authHandler)
+	router.Post("/api/webhooks/create", webhookCreateHandler.ServeHTTP)
+
+	// pending deliveries are deleted with webhook
+	webhookDeleteHandler := handlers.NewOwnedDeleteHandler("webhook", db.DeleteWebhook, webhookDeleteSchema, authHandler)
+	router.Post("/api/webhooks/delete", webhookDeleteHandler.ServeHTTP)
+
+	webhookRedeliverHandler := handlers.NewWebhookRedeliverHandler(db, webhookRedeliverSchema, authHandler)
+	router.Post("/api/webhooks/redeliver", webhookRedeliverHandler.ServeHTTP)
+
+	webhookDeliveriesHandler := handlers.NewWebhookDeliveriesHandler(db, authHandler)
+	router.Get("/api/webhooks/{id}/deliveries", webhookDeliveriesHandler.ServeHTTP)
+
+	// digests are not sent without smtp relay, so they can't be created
+	if cfg.DigestsEnabled {
+		digestsGetHandler := handlers.NewDigestsGetHandler(db, authHandler)
+		router.Get("/api/digests", digestsGetHandler.ServeHTTP)
+
+		digestCreateHandler := handlers.NewDigestCreateHandler(db, digestCreateSchema, authHandler, cfg.DigestHour)
+		router.Post("/api/digests/create", digestCreateHandler.ServeHTTP)
+
+		digestDeleteHandler := handlers.NewOwnedDeleteHandler("digest", db.DeleteDigest, digestDeleteSchema, authHandler)
+		router.Post("/api/digests/delete", digestDeleteHandler.ServeHTTP)
+
+		// recipients unsubscribe by links from digests without signing in
+		digestUnsubscribeHandler, err := handlers.NewDigestUnsubscribeHandler(db)
+		if err != nil {
+			return nil, err
+		}
+		router.Get("/digests/{id}/unsubscribe/{token}", digestUnsubscribeHandler.ServeHTTP)
+		router.Post("/digests/{id}/unsubscribe/{token}", digestUnsubscribeHandler.ServeHTTP)
+	}
+
+	// newsletters are not received without inbound smtp, so addresses can't be created
+	if cfg.NewslettersEnabled {
+		newslettersGetHandler := handlers.NewNewslettersGetHandler(db, authHandler, cfg.NewsletterDomain)
+		router.Get("/api/newsletters", newslettersGetHandler.ServeHTTP)
+
+		newsletterCreateHandler := handlers.NewNewsletterCreateHandler(db, newsletterCreateSchema, authHandler, cfg.NewsletterDomain)
+		router.Post("/api/newsletters/create", newsletterCreateHandler.ServeHTTP)
+
+		// source is removed from rss of newsletter, other rss keep it
+		newsletterDeleteHandler := handlers.NewOwnedDeleteHandler("newsletter", db.DeleteNewsletter, newsletterDeleteSchema, authHandler)
+		router.Post("/api/newsletters/delete", newsletterDeleteHandler.ServeHTTP)
+	}
+
+	sourcesDiscoverHandler := handlers.NewSourcesDiscoverHandler(discoverer, discoverSchema, authHandler)
+	router.Post("/api/sources/discover", sourcesDiscoverHandler.ServeHTTP)
+
+	sourcesScrapeHandler := handlers.NewSourcesScrapeHandler(aggregator, previewLimiter, scrapeSchema, authHandler)
+	router.Post("/api/sources/scrape", sourcesScrapeHandler.ServeHTTP)
+
+	searchHandler := handlers.NewSearchHandler(db)
+	router.Get("/api/search", searchHandler.ServeHTTP)
+
 	indexHandler, err := handlers.NewIndexHandler(db, authHandler)
 	if err != nil {
 		return nil, err
 	}
 	router.Get("/", indexHandler.ServeHTTP)
 
-	rssGetHandler, err := handlers.NewRssGetHandler(db, aggregator)
+	rssGetHandler, err := handlers.NewRssGetHandler(db, refresher, hotCache, reads, cfg.CacheMissWaitTimeout)
 	if err != nil {
 		return nil, err
 	}
 	router.Get("/{email}/{name}", rssGetHandler.ServeHTTP)
 
+	if subscriber != nil {
+		webSubCallbackHandler := handlers.NewWebSubCallbackHandler(subscriber)
+		router.Get("/websub/{id}", webSubCallbackHandler.ServeHTTP)
+		router.Post("/websub/{id}", webSubCallbackHandler.ServeHTTP)
+		router.Get("/websub/{id}/{token}", webSubCallbackHandler.ServeHTTP)
+		router.Post("/websub/{id}/{token}", webSubCallbackHandler.ServeHTTP)
+	}
+
+	if hub != nil {
+		webSubHubLimiter := ratelimit.New(cfg.WebSubHubRateLimitPerHost, cfg.WebSubHubRateLimitTotal)
+		webSubHubHandler := handlers.NewWebSubHubHandler(hub, webSubHubLimiter)
+		router.Post("/websub/hub", webSubHubHandler.ServeHTTP)
+	}
+
 	router.Get("/metrics", promhttp.Handler().ServeHTTP)
 
 	server := &http.Server{
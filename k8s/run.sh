@@ -54,11 +54,27 @@ fi
 
 kubectl apply -f rss-secret-db.yaml
 
+# init smtp secret, credentials are optional for relay
+smtp_username=$(printf "%s" "${RSS_SMTP_USERNAME}" | base64)
+smtp_password=$(printf "%s" "${RSS_SMTP_PASSWORD}" | base64)
+
+rm -f ./rss-secret-smtp.yaml
+cp ./rss-secret-smtp-template.yaml ./rss-secret-smtp.yaml
+
+if [[ $OSTYPE == 'darwin'* ]]; then
+  sed -i '' "s/username_template/$smtp_username/" rss-secret-smtp.yaml
+  sed -i '' "s/password_template/$smtp_password/" rss-secret-smtp.yaml
+else
+  sed -i "s/username_template/$smtp_username/" rss-secret-smtp.yaml
+  sed -i "s/password_template/$smtp_password/" rss-secret-smtp.yaml
+fi
+
+kubectl apply -f rss-secret-smtp.yaml
+
 # apply configmap
 kubectl apply -f rss-configmap.yaml
 
 # set up database
-kubectl create configmap init-script.sql --from-file=../db/sql/db.sql -n rss
 kubectl apply -f postgres-pv.yaml
 kubectl apply -f postgres-pvc.yaml
 kubectl apply -f postgres-service.yaml